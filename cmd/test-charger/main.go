@@ -79,7 +79,7 @@ func main() {
 	if err != nil {
 		log.Printf("Failed to start transaction: %v", err)
 	} else {
-		log.Printf("Transaction started: ID=%d", transaction.ID)
+		log.Printf("Transaction started: ID=%d CSMS ID=%d", transaction.ID, transaction.CSMSID)
 
 		// Simulate charging for 30 seconds
 		log.Println("Simulating charging for 30 seconds...")
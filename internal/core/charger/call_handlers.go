@@ -0,0 +1,449 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// callHandler handles a Call initiated by the CSMS. It returns the CallResult
+// payload and an optional follow-up that runs once the CallResult has been sent,
+// so that messages triggered by the Call reach the CSMS after the reply.
+type callHandler func(ctx context.Context, payload json.RawMessage) (response interface{}, after func(), err error)
+
+// registerCallHandlers sets up the handlers for CSMS-initiated Calls
+func (vc *VirtualCharger) registerCallHandlers() {
+	vc.callHandlers = map[string]callHandler{
+		ocpp.MessageTypeRemoteStartTransaction: vc.handleRemoteStartTransaction,
+		ocpp.MessageTypeRemoteStopTransaction:  vc.handleRemoteStopTransaction,
+		ocpp.MessageTypeReset:                  vc.handleReset,
+		ocpp.MessageTypeChangeAvailability:     vc.handleChangeAvailability,
+		ocpp.MessageTypeUnlockConnector:        vc.handleUnlockConnector,
+		ocpp.MessageTypeClearCache:             vc.handleClearCache,
+		ocpp.MessageTypeDataTransfer:           vc.handleDataTransfer,
+		ocpp.MessageTypeGetConfiguration:       vc.handleGetConfiguration,
+		ocpp.MessageTypeChangeConfiguration:    vc.handleChangeConfiguration,
+
+		// Smart Charging profile
+		ocpp.MessageTypeSetChargingProfile:   vc.handleSetChargingProfile,
+		ocpp.MessageTypeClearChargingProfile: vc.handleClearChargingProfile,
+		ocpp.MessageTypeGetCompositeSchedule: vc.handleGetCompositeSchedule,
+
+		// Firmware Management profile
+		ocpp.MessageTypeGetDiagnostics: vc.handleGetDiagnostics,
+		ocpp.MessageTypeUpdateFirmware: vc.handleUpdateFirmware,
+
+		// Remote Trigger profile
+		ocpp.MessageTypeTriggerMessage: vc.handleTriggerMessage,
+
+		// Local Auth List Management profile
+		ocpp.MessageTypeGetLocalListVersion: vc.handleGetLocalListVersion,
+		ocpp.MessageTypeSendLocalList:       vc.handleSendLocalList,
+
+		// Reservation profile
+		ocpp.MessageTypeReserveNow:        vc.handleReserveNow,
+		ocpp.MessageTypeCancelReservation: vc.handleCancelReservation,
+
+		// Security extension
+		ocpp.MessageTypeCertificateSigned:          vc.handleCertificateSigned,
+		ocpp.MessageTypeInstallCertificate:         vc.handleInstallCertificate,
+		ocpp.MessageTypeGetInstalledCertificateIds: vc.handleGetInstalledCertificateIds,
+		ocpp.MessageTypeDeleteCertificate:          vc.handleDeleteCertificate,
+		ocpp.MessageTypeSignedUpdateFirmware:       vc.handleSignedUpdateFirmware,
+		ocpp.MessageTypeExtendedTriggerMessage:     vc.handleExtendedTriggerMessage,
+	}
+}
+
+// callFeatureProfiles maps the Calls outside the Core profile to their
+// feature profile. The Security extension is not a feature profile, its
+// Calls are served by every charger.
+var callFeatureProfiles = map[string]string{
+	ocpp.MessageTypeSetChargingProfile:   FeatureProfileSmartCharging,
+	ocpp.MessageTypeClearChargingProfile: FeatureProfileSmartCharging,
+	ocpp.MessageTypeGetCompositeSchedule: FeatureProfileSmartCharging,
+	ocpp.MessageTypeGetDiagnostics:       FeatureProfileFirmwareManagement,
+	ocpp.MessageTypeUpdateFirmware:       FeatureProfileFirmwareManagement,
+	ocpp.MessageTypeTriggerMessage:       FeatureProfileRemoteTrigger,
+	ocpp.MessageTypeGetLocalListVersion:  FeatureProfileLocalAuthListManagement,
+	ocpp.MessageTypeSendLocalList:        FeatureProfileLocalAuthListManagement,
+	ocpp.MessageTypeReserveNow:           FeatureProfileReservation,
+	ocpp.MessageTypeCancelReservation:    FeatureProfileReservation,
+}
+
+// handleCall handles incoming OCPP Call messages from CSMS
+func (vc *VirtualCharger) handleCall(ctx context.Context, msg *ocpp.OCPP16Message) error {
+	if accepted, err := vc.acceptUnknownCall(ctx, msg); accepted {
+		return err
+	}
+	return dispatchCall(ctx, vc.ocppClient, vc.callHandlers, vc.checkCallFeature, vc.logger, msg)
+}
+
+// checkFeature rejects Calls of feature profiles the charger does not support
+func (vc *VirtualCharger) checkFeature(profile string) error {
+	if !vc.configuration.SupportsFeature(profile) {
+		return ocpp.NewCallError(ocpp.ErrorCodeNotSupported, fmt.Sprintf("feature profile %s is not supported", profile))
+	}
+	return nil
+}
+
+// checkCallFeature rejects a Call whose feature profile is not listed in
+// SupportedFeatureProfiles
+func (vc *VirtualCharger) checkCallFeature(action string) error {
+	if profile, ok := callFeatureProfiles[action]; ok {
+		return vc.checkFeature(profile)
+	}
+	return nil
+}
+
+// dispatchCall runs the handler registered for a CSMS-initiated Call and
+// replies with its CallResult, or a CallError if the handler fails. A
+// non-nil check may refuse the Call before its handler runs.
+func dispatchCall(ctx context.Context, client ocpp.Client, handlers map[string]callHandler, check func(action string) error, logger *logrus.Entry, msg *ocpp.OCPP16Message) error {
+	logger.WithField("action", msg.Action).Debug("Handling Call from CSMS")
+
+	handler, exists := handlers[msg.Action]
+	if !exists {
+		return client.SendCallError(ctx, msg.MessageID, ocpp.NewCallError(
+			ocpp.ErrorCodeNotImplemented,
+			fmt.Sprintf("action %s is not implemented", msg.Action),
+		))
+	}
+
+	var response interface{}
+	var after func()
+	var err error
+	if check != nil {
+		err = check(msg.Action)
+	}
+	if err == nil {
+		payload, _ := msg.Payload.(json.RawMessage)
+		response, after, err = handler(ctx, payload)
+	}
+	if err != nil {
+		callErr, ok := err.(*ocpp.CallError)
+		if !ok {
+			callErr = ocpp.NewCallError(ocpp.ErrorCodeInternalError, err.Error())
+		}
+		logger.WithError(err).WithField("action", msg.Action).Warn("Rejecting Call from CSMS")
+		return client.SendCallError(ctx, msg.MessageID, callErr)
+	}
+
+	if err := client.SendCallResult(ctx, msg.MessageID, response); err != nil {
+		return fmt.Errorf("failed to send %s response: %w", msg.Action, err)
+	}
+
+	if after != nil {
+		go after()
+	}
+
+	return nil
+}
+
+// decodeCallPayload unmarshals a Call payload, reporting failures as FormationViolation
+func decodeCallPayload(payload json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ocpp.NewCallError(ocpp.ErrorCodeFormationViolation, err.Error())
+	}
+	return nil
+}
+
+// handleRemoteStartTransaction starts a transaction on request of the CSMS
+func (vc *VirtualCharger) handleRemoteStartTransaction(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.RemoteStartTransactionRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	// Remote transactions are not allowed until the CSMS accepted the charger
+	if vc.GetRegistrationStatus() != RegistrationAccepted {
+		return &ocpp.RemoteStartTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	// Without a connector ID a connector reserved for the idTag is preferred
+	connectorID := 0
+	vc.mu.RLock()
+	if req.ConnectorId != nil {
+		if *req.ConnectorId >= 1 && *req.ConnectorId <= len(vc.connectors) && vc.remoteStartableLocked(vc.connectors[*req.ConnectorId-1], req.IdTag) {
+			connectorID = *req.ConnectorId
+		}
+	} else {
+		for _, connector := range vc.connectors {
+			if r := vc.connectorReservationLocked(connector.ID); r != nil && r.IDTag == req.IdTag && vc.startableLocked(connector) {
+				connectorID = connector.ID
+				break
+			}
+		}
+		for _, connector := range vc.connectors {
+			if connectorID == 0 && vc.remoteStartableLocked(connector, req.IdTag) {
+				connectorID = connector.ID
+			}
+		}
+	}
+	vc.mu.RUnlock()
+
+	if connectorID == 0 {
+		return &ocpp.RemoteStartTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	// A charging profile must be a valid TxProfile for the new transaction
+	if profile := req.ChargingProfile; profile != nil {
+		if profile.ChargingProfilePurpose != ocpp.ChargingProfilePurposeTx {
+			return &ocpp.RemoteStartTransactionResponse{Status: "Rejected"}, nil, nil
+		}
+		if err := validateChargingProfile(*profile, vc.configuration); err != nil {
+			vc.logger.WithError(err).Warn("Rejecting remote start with invalid charging profile")
+			return &ocpp.RemoteStartTransactionResponse{Status: "Rejected"}, nil, nil
+		}
+	}
+
+	// AuthorizeRemoteTxRequests decides whether the idTag is authorized first
+	authorize := vc.configuration.GetBool(KeyAuthorizeRemoteTxRequests, false)
+	start := func() {
+		transaction, err := vc.startTransaction(connectorID, req.IdTag, authorize)
+		if err != nil {
+			vc.logger.WithError(err).WithField("connector_id", connectorID).Error("Failed to start remote transaction")
+			return
+		}
+		if profile := req.ChargingProfile; profile != nil {
+			profile.TransactionId = &transaction.CSMSID
+			vc.installChargingProfile(vc.context(), connectorID, *profile)
+		}
+	}
+
+	return &ocpp.RemoteStartTransactionResponse{Status: "Accepted"}, start, nil
+}
+
+// remoteStartableLocked reports whether a remote start for an idTag may use
+// a connector. Reservations with a parentIdTag are settled when starting.
+// The caller must hold vc.mu.
+func (vc *VirtualCharger) remoteStartableLocked(connector *Connector, idTag string) bool {
+	if !vc.startableLocked(connector) {
+		return false
+	}
+	r := vc.blockingReservationLocked(connector, idTag, "")
+	return r == nil || r.ParentIDTag != "" || vc.config.Reservations.IgnoreReservations
+}
+
+// handleRemoteStopTransaction stops a transaction on request of the CSMS
+func (vc *VirtualCharger) handleRemoteStopTransaction(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.RemoteStopTransactionRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if vc.GetRegistrationStatus() != RegistrationAccepted {
+		return &ocpp.RemoteStopTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	// The CSMS refers to transactions by the ID it assigned
+	vc.mu.RLock()
+	transaction := vc.transactionByCSMSID(req.TransactionId)
+	active := transaction != nil && transaction.IsActive()
+	vc.mu.RUnlock()
+
+	if !active {
+		return &ocpp.RemoteStopTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	transactionID := transaction.ID
+	stop := func() {
+		if err := vc.StopTransaction(transactionID, "Remote"); err != nil {
+			vc.logger.WithError(err).WithField("transaction_id", transactionID).Error("Failed to stop remote transaction")
+		}
+	}
+
+	return &ocpp.RemoteStopTransactionResponse{Status: "Accepted"}, stop, nil
+}
+
+// handleReset reboots the charger. A Soft reset stops running transactions
+// first, a Hard reset cuts the power and queues their StopTransactions.
+func (vc *VirtualCharger) handleReset(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.ResetRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if req.Type != "Hard" && req.Type != "Soft" {
+		return nil, nil, ocpp.NewCallError(ocpp.ErrorCodePropertyConstraintViolation, fmt.Sprintf("invalid reset type: %s", req.Type))
+	}
+
+	reset := func() {
+		if err := vc.reboot(ResetType(req.Type), req.Type+"Reset", BootReasonRemoteReset); err != nil {
+			vc.logger.WithError(err).Error("Failed to reboot after reset")
+		}
+	}
+	return &ocpp.ResetResponse{Status: "Accepted"}, reset, nil
+}
+
+// handleChangeAvailability switches connectors between Operative and Inoperative
+func (vc *VirtualCharger) handleChangeAvailability(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.ChangeAvailabilityRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	var target ConnectorStatus
+	switch req.Type {
+	case "Inoperative":
+		target = ConnectorStatusUnavailable
+	case "Operative":
+		target = ConnectorStatusAvailable
+	default:
+		return nil, nil, ocpp.NewCallError(ocpp.ErrorCodePropertyConstraintViolation, fmt.Sprintf("invalid availability type: %s", req.Type))
+	}
+
+	vc.mu.Lock()
+	if req.ConnectorId < 0 || req.ConnectorId > len(vc.connectors) {
+		vc.mu.Unlock()
+		return &ocpp.ChangeAvailabilityResponse{Status: "Rejected"}, nil, nil
+	}
+
+	// Connector 0 addresses the whole charge point
+	affected := vc.connectors
+	if req.ConnectorId > 0 {
+		affected = vc.connectors[req.ConnectorId-1 : req.ConnectorId]
+	} else if vc.chargePoint.Status != ConnectorStatusFaulted || target == ConnectorStatusUnavailable {
+		if err := vc.setConnectorStatusLocked(vc.chargePoint, target, ""); err != nil {
+			vc.logger.WithError(err).Error("Failed to change charge point availability")
+		}
+	}
+
+	status := "Accepted"
+	for _, connector := range affected {
+		if vc.hasActiveTransaction(connector.ID) || connector.starting || connector.Status == ConnectorStatusPreparing {
+			// Applied once the running transaction has finished and the EV has left
+			vc.scheduledAvailability[connector.ID] = target
+			status = "Scheduled"
+			continue
+		}
+		delete(vc.scheduledAvailability, connector.ID)
+
+		var next ConnectorStatus
+		switch {
+		case target == ConnectorStatusUnavailable:
+			next = target
+		case connector.Status == ConnectorStatusUnavailable:
+			next = vc.idleStatusLocked(connector)
+		}
+		if next == "" || next == connector.Status {
+			continue
+		}
+		if err := vc.setConnectorStatusLocked(connector, next, ""); err != nil {
+			vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to change connector availability")
+			status = "Rejected"
+		}
+	}
+	vc.mu.Unlock()
+
+	return &ocpp.ChangeAvailabilityResponse{Status: status}, vc.flushStatusNotifications, nil
+}
+
+// handleUnlockConnector unlocks a connector, ending any transaction running on it
+func (vc *VirtualCharger) handleUnlockConnector(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.UnlockConnectorRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	vc.mu.RLock()
+	valid := req.ConnectorId >= 1 && req.ConnectorId <= len(vc.connectors)
+	vc.mu.RUnlock()
+
+	if !valid {
+		return &ocpp.UnlockConnectorResponse{Status: "NotSupported"}, nil, nil
+	}
+
+	var after func()
+	for _, tx := range vc.activeTransactions() {
+		if tx.ConnectorID != req.ConnectorId {
+			continue
+		}
+		transactionID := tx.ID
+		after = func() {
+			if err := vc.StopTransaction(transactionID, "UnlockCommand"); err != nil {
+				vc.logger.WithError(err).WithField("transaction_id", transactionID).Error("Failed to stop transaction for unlock")
+			}
+		}
+	}
+
+	return &ocpp.UnlockConnectorResponse{Status: "Unlocked"}, after, nil
+}
+
+// handleDataTransfer answers vendor-specific data transfers
+func (vc *VirtualCharger) handleDataTransfer(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.DataTransferRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	vc.logger.WithFields(logrus.Fields{
+		"vendor_id":  req.VendorId,
+		"message_id": req.MessageId,
+	}).Debug("Received DataTransfer from CSMS")
+
+	if req.VendorId != vc.config.Vendor {
+		return &ocpp.DataTransferResponse{Status: "UnknownVendorId"}, nil, nil
+	}
+
+	return &ocpp.DataTransferResponse{Status: "Accepted"}, nil, nil
+}
+
+// handleGetConfiguration reports configuration keys to the CSMS
+func (vc *VirtualCharger) handleGetConfiguration(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.GetConfigurationRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	maxKeys := vc.configuration.GetInt(KeyGetConfigurationMaxKeys, 0)
+	if maxKeys > 0 && len(req.Key) > maxKeys {
+		return nil, nil, ocpp.NewCallError(ocpp.ErrorCodeOccurenceConstraintViolation, fmt.Sprintf("at most %d keys can be requested", maxKeys))
+	}
+
+	known, unknown := vc.configuration.Keys(req.Key...)
+	resp := &ocpp.GetConfigurationResponse{UnknownKey: unknown}
+	for _, k := range known {
+		value := k.Value
+		resp.ConfigurationKey = append(resp.ConfigurationKey, ocpp.KeyValue{
+			Key:      k.Key,
+			Readonly: k.ReadOnly,
+			Value:    &value,
+		})
+	}
+
+	return resp, nil, nil
+}
+
+// handleChangeConfiguration updates a configuration key on request of the CSMS
+func (vc *VirtualCharger) handleChangeConfiguration(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.ChangeConfigurationRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	status := vc.configuration.Change(req.Key, req.Value)
+
+	vc.logger.WithFields(logrus.Fields{
+		"key":    req.Key,
+		"value":  req.Value,
+		"status": status,
+	}).Info("Configuration change requested by CSMS")
+
+	if status == ConfigurationAccepted || status == ConfigurationRebootRequired {
+		vc.eventBus.Publish(ctx, eventbus.NewChargerEvent(
+			"charger.configuration.changed",
+			vc.id,
+			map[string]interface{}{
+				"key":    req.Key,
+				"value":  req.Value,
+				"status": status,
+			},
+		))
+	}
+
+	return &ocpp.ChangeConfigurationResponse{Status: status}, nil, nil
+}
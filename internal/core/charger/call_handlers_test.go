@@ -0,0 +1,183 @@
+package charger
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// deliverCall hands a CSMS-initiated Call to the charger and returns its reply
+func deliverCall(t *testing.T, charger ocpp.MessageHandler, client *mockClient, action string, payload interface{}) sentFrame {
+    raw, err := json.Marshal(payload)
+    require.NoError(t, err)
+
+    messageID := fmt.Sprintf("csms-%d", len(client.sent()))
+    err = charger.HandleMessage(context.Background(), &ocpp.OCPP16Message{
+        MessageType: "Call",
+        MessageID:   messageID,
+        Action:      action,
+        Payload:     json.RawMessage(raw),
+    })
+    require.NoError(t, err)
+
+    for _, frame := range client.sent() {
+        if frame.MessageID == messageID && frame.Kind != "Call" {
+            return frame
+        }
+    }
+    t.Fatalf("no reply sent for %s", action)
+    return sentFrame{}
+}
+
+func TestHandleCall_UnknownAction(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, "GetLog", map[string]interface{}{})
+    assert.Equal(t, "CallError", reply.Kind)
+    assert.Equal(t, ocpp.ErrorCodeNotImplemented, reply.Payload.(*ocpp.CallError).ErrorCode)
+}
+
+func TestHandleCall_FeatureProfiles(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    // Chargers support every implemented profile unless told otherwise
+    assert.Equal(t, implementedFeatureProfiles, vc.Configuration().GetList(KeySupportedFeatureProfiles))
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeGetLocalListVersion, map[string]interface{}{})
+    assert.Equal(t, "CallResult", reply.Kind)
+
+    // Calls of profiles missing from SupportedFeatureProfiles are not supported
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core")
+    for action := range callFeatureProfiles {
+        reply = deliverCall(t, vc, client, action, map[string]interface{}{})
+        require.Equal(t, "CallError", reply.Kind, action)
+        assert.Equal(t, ocpp.ErrorCodeNotSupported, reply.Payload.(*ocpp.CallError).ErrorCode, action)
+    }
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeGetConfiguration, map[string]interface{}{})
+    assert.Equal(t, "CallResult", reply.Kind)
+}
+
+func TestHandleCall_MalformedPayload(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeRemoteStopTransaction, map[string]interface{}{
+        "transactionId": "not-a-number",
+    })
+    assert.Equal(t, "CallError", reply.Kind)
+    assert.Equal(t, ocpp.ErrorCodeFormationViolation, reply.Payload.(*ocpp.CallError).ErrorCode)
+}
+
+func TestHandleRemoteStartTransaction(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeRemoteStartTransaction, map[string]interface{}{
+        "idTag": "TAG001",
+    })
+    assert.Equal(t, "CallResult", reply.Kind)
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.RemoteStartTransactionResponse).Status)
+
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeStartTransaction)) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    // The only connector is now busy
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeRemoteStartTransaction, map[string]interface{}{
+        "connectorId": 1,
+        "idTag":       "TAG002",
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.RemoteStartTransactionResponse).Status)
+}
+
+func TestHandleRemoteStopTransaction_Unknown(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeRemoteStopTransaction, map[string]interface{}{
+        "transactionId": 99,
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.RemoteStopTransactionResponse).Status)
+}
+
+func TestHandleChangeAvailability(t *testing.T) {
+    vc, client := newTestCharger(2)
+
+    _, err := vc.StartTransaction(2, "TAG001")
+    require.NoError(t, err)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeChangeAvailability, map[string]interface{}{
+        "connectorId": 0,
+        "type":        "Inoperative",
+    })
+    assert.Equal(t, "Scheduled", reply.Payload.(*ocpp.ChangeAvailabilityResponse).Status)
+
+    connectors := vc.GetConnectors()
+    assert.Equal(t, ConnectorStatusUnavailable, connectors[0].Status)
+    assert.Equal(t, ConnectorStatusCharging, connectors[1].Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeChangeAvailability, map[string]interface{}{
+        "connectorId": 1,
+        "type":        "Operative",
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ChangeAvailabilityResponse).Status)
+}
+
+func TestHandleDataTransfer(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeDataTransfer, map[string]interface{}{
+        "vendorId": "SomeoneElse",
+    })
+    assert.Equal(t, "UnknownVendorId", reply.Payload.(*ocpp.DataTransferResponse).Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeDataTransfer, map[string]interface{}{
+        "vendorId": "TestVendor",
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.DataTransferResponse).Status)
+}
+
+func TestHandleGetConfiguration(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeGetConfiguration, map[string]interface{}{
+        "key": []string{KeyHeartbeatInterval, "Unknown"},
+    })
+    resp := reply.Payload.(*ocpp.GetConfigurationResponse)
+    require.Len(t, resp.ConfigurationKey, 1)
+    assert.Equal(t, KeyHeartbeatInterval, resp.ConfigurationKey[0].Key)
+    assert.Equal(t, "30", *resp.ConfigurationKey[0].Value)
+    assert.Equal(t, []string{"Unknown"}, resp.UnknownKey)
+}
+
+func TestHandleChangeConfiguration(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeChangeConfiguration, map[string]interface{}{
+        "key":   KeyHeartbeatInterval,
+        "value": "300",
+    })
+    assert.Equal(t, ConfigurationAccepted, reply.Payload.(*ocpp.ChangeConfigurationResponse).Status)
+    assert.Equal(t, 300, vc.Configuration().GetInt(KeyHeartbeatInterval, 0))
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeChangeConfiguration, map[string]interface{}{
+        "key":   KeyNumberOfConnectors,
+        "value": "8",
+    })
+    assert.Equal(t, ConfigurationRejected, reply.Payload.(*ocpp.ChangeConfigurationResponse).Status)
+}
+
+func TestHeartbeatLoopFollowsConfiguration(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.Configuration().Set(KeyHeartbeatInterval, "3600")
+    go vc.heartbeatLoop()
+    defer vc.cancel()
+
+    // Shortening the interval must not wait for the old hour-long tick
+    vc.Configuration().Change(KeyHeartbeatInterval, "1")
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeHeartbeat)) > 0
+    }, 3*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,338 @@
+package charger
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+)
+
+// CertificateStore holds the key material of a charger: the key pair and
+// chain of its charge point certificate and the root certificates installed
+// by the CSMS
+type CertificateStore struct {
+	key         *ecdsa.PrivateKey              // Key of the installed charge point certificate
+	chain       []*x509.Certificate            // Charge point certificate chain, leaf first
+	pendingKey  *ecdsa.PrivateKey              // Key of the last CSR until the CSMS signs it
+	pendingName string                         // Common name requested by the last CSR
+	roots       map[string][]*x509.Certificate // Installed root certificates by certificate type
+	mu          sync.RWMutex
+}
+
+// NewCertificateStore creates an empty certificate store
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{roots: make(map[string][]*x509.Certificate)}
+}
+
+// GenerateCSR creates a new key pair and returns a PEM encoded certificate
+// signing request for it. The key replaces the installed one once the CSMS
+// returns a matching certificate.
+func (s *CertificateStore) GenerateCSR(commonName, organization string) (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	subject := pkix.Name{CommonName: commonName}
+	if organization != "" {
+		subject.Organization = []string{organization}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: subject}, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create certificate signing request: %w", err)
+	}
+
+	s.mu.Lock()
+	s.pendingKey = key
+	s.pendingName = commonName
+	s.mu.Unlock()
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// InstallChargePointCertificate checks a PEM encoded chain returned by the
+// CSMS against the pending CSR and installs it. The leaf must match the key
+// and common name of the CSR and be valid at the given time. If root
+// certificates of the CSMS are installed, the chain must lead to one of them.
+func (s *CertificateStore) InstallChargePointCertificate(chainPEM string, now time.Time) error {
+	chain, err := parseCertificates(chainPEM)
+	if err != nil {
+		return err
+	}
+	leaf := chain[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pendingKey == nil {
+		return fmt.Errorf("no certificate signing request is pending")
+	}
+	leafKey, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !leafKey.Equal(s.pendingKey.Public()) {
+		return fmt.Errorf("certificate does not match the key of the signing request")
+	}
+	if leaf.Subject.CommonName != s.pendingName {
+		return fmt.Errorf("certificate common name %q does not match %q", leaf.Subject.CommonName, s.pendingName)
+	}
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate is not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if roots := s.roots[ocpp.CertificateTypeCentralSystemRoot]; len(roots) > 0 {
+		options := x509.VerifyOptions{
+			Roots:         x509.NewCertPool(),
+			Intermediates: x509.NewCertPool(),
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		for _, root := range roots {
+			options.Roots.AddCert(root)
+		}
+		for _, intermediate := range chain[1:] {
+			options.Intermediates.AddCert(intermediate)
+		}
+		if _, err := leaf.Verify(options); err != nil {
+			return fmt.Errorf("certificate chain is not trusted: %w", err)
+		}
+	}
+
+	s.key = s.pendingKey
+	s.chain = chain
+	s.pendingKey = nil
+	s.pendingName = ""
+	return nil
+}
+
+// SetChargePointCertificate installs a certificate without any checks, so
+// chaos scenarios can present expired or mismatched certificates to the CSMS
+func (s *CertificateStore) SetChargePointCertificate(cert tls.Certificate) error {
+	key, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", cert.PrivateKey)
+	}
+	chain := make([]*x509.Certificate, 0, len(cert.Certificate))
+	for _, der := range cert.Certificate {
+		parsed, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("invalid certificate: %w", err)
+		}
+		chain = append(chain, parsed)
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("certificate is empty")
+	}
+
+	s.mu.Lock()
+	s.key = key
+	s.chain = chain
+	s.mu.Unlock()
+	return nil
+}
+
+// ChargePointCertificate returns the installed charge point certificate, nil
+// if the CSMS has not signed one yet
+func (s *CertificateStore) ChargePointCertificate() *x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.chain) == 0 {
+		return nil
+	}
+	return s.chain[0]
+}
+
+// ClientCertificate returns the charge point certificate for TLS connections,
+// nil if none is installed
+func (s *CertificateStore) ClientCertificate() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.chain) == 0 {
+		return nil
+	}
+	cert := &tls.Certificate{PrivateKey: s.key, Leaf: s.chain[0]}
+	for _, c := range s.chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert
+}
+
+// InstallRoot adds a PEM encoded root certificate of the given type
+func (s *CertificateStore) InstallRoot(certificateType, certificatePEM string) error {
+	certs, err := parseCertificates(certificatePEM)
+	if err != nil {
+		return err
+	}
+	if !certs[0].IsCA {
+		return fmt.Errorf("certificate is not a CA certificate")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, installed := range s.roots[certificateType] {
+		if installed.Equal(certs[0]) {
+			return nil
+		}
+	}
+	s.roots[certificateType] = append(s.roots[certificateType], certs[0])
+	return nil
+}
+
+// RootCount returns the number of installed root certificates
+func (s *CertificateStore) RootCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, roots := range s.roots {
+		count += len(roots)
+	}
+	return count
+}
+
+// Roots returns the installed root certificates of a type
+func (s *CertificateStore) Roots(certificateType string) []*x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]*x509.Certificate(nil), s.roots[certificateType]...)
+}
+
+// CertificateIDs returns the hash data of the installed roots of a type
+func (s *CertificateStore) CertificateIDs(certificateType string) []ocpp.CertificateHashData {
+	var ids []ocpp.CertificateHashData
+	for _, root := range s.Roots(certificateType) {
+		ids = append(ids, certificateHashData(root, root))
+	}
+	return ids
+}
+
+// DeleteRoot removes the root certificate matching the hash data. Deleting
+// the charge point certificate is refused.
+func (s *CertificateStore) DeleteRoot(id ocpp.CertificateHashData) (found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.chain) > 0 {
+		issuer := s.chain[0]
+		if len(s.chain) > 1 {
+			issuer = s.chain[1]
+		}
+		if sameCertificate(certificateHashData(s.chain[0], issuer), id) {
+			return true, fmt.Errorf("the charge point certificate cannot be deleted")
+		}
+	}
+
+	for certificateType, roots := range s.roots {
+		for i, root := range roots {
+			if sameCertificate(certificateHashData(root, root), id) {
+				s.roots[certificateType] = append(roots[:i:i], roots[i+1:]...)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// VerifyFirmwareSigningCertificate checks that a PEM encoded firmware signing
+// certificate was issued by an installed manufacturer root
+func (s *CertificateStore) VerifyFirmwareSigningCertificate(certificatePEM string, now time.Time) error {
+	certs, err := parseCertificates(certificatePEM)
+	if err != nil {
+		return err
+	}
+
+	roots := s.Roots(ocpp.CertificateTypeManufacturerRoot)
+	if len(roots) == 0 {
+		return fmt.Errorf("no manufacturer root certificate is installed")
+	}
+	options := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range roots {
+		options.Roots.AddCert(root)
+	}
+	for _, intermediate := range certs[1:] {
+		options.Intermediates.AddCert(intermediate)
+	}
+	if _, err := certs[0].Verify(options); err != nil {
+		return fmt.Errorf("firmware signing certificate is not trusted: %w", err)
+	}
+	return nil
+}
+
+// parseCertificates decodes the certificates of a PEM bundle
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(strings.TrimSpace(data))
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+// certificateHashData identifies a certificate the way OCSP does: by the
+// SHA256 hashes of its issuer name and issuer public key and its serial number
+func certificateHashData(cert, issuer *x509.Certificate) ocpp.CertificateHashData {
+	nameHash := sha256.Sum256(cert.RawIssuer)
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	keyBytes := issuer.RawSubjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err == nil {
+		keyBytes = publicKeyInfo.PublicKey.RightAlign()
+	}
+	keyHash := sha256.Sum256(keyBytes)
+
+	return ocpp.CertificateHashData{
+		HashAlgorithm:  "SHA256",
+		IssuerNameHash: hex.EncodeToString(nameHash[:]),
+		IssuerKeyHash:  hex.EncodeToString(keyHash[:]),
+		SerialNumber:   cert.SerialNumber.Text(16),
+	}
+}
+
+// sameCertificate compares hash data case-insensitively, ignoring leading
+// zeros of the serial number
+func sameCertificate(a, b ocpp.CertificateHashData) bool {
+	return a.HashAlgorithm == b.HashAlgorithm &&
+		strings.EqualFold(a.IssuerNameHash, b.IssuerNameHash) &&
+		strings.EqualFold(a.IssuerKeyHash, b.IssuerKeyHash) &&
+		strings.EqualFold(strings.TrimLeft(a.SerialNumber, "0"), strings.TrimLeft(b.SerialNumber, "0"))
+}
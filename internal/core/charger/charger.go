@@ -0,0 +1,95 @@
+package charger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// Charger is a simulated charger independent of the OCPP version it speaks.
+// The simulation layer drives chargers through this interface.
+type Charger interface {
+	GetID() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	GetStatus() ChargerStatus
+	GetConnectors() []*Connector
+	IsConnected() bool
+	GetRegistrationStatus() RegistrationStatus
+
+	// Transactions are addressed by their local ID. Connector IDs address
+	// connectors in OCPP 1.6 and EVSEs in OCPP 2.0.1.
+	StartTransaction(connectorID int, idTag string) (*Transaction, error)
+	StopTransaction(transactionID int, reason string) error
+	SendMeterValues(transactionID int, meterValue int) error
+	SimulateCharging(ctx context.Context, transactionID int, duration time.Duration, powerKW float64) error
+	// PlugInEV sets the EV the next transaction on a connector charges
+	PlugInEV(connectorID int, ev EVModel) error
+
+	// Configuration holds the OCPP 1.6 configuration keys or the OCPP 2.0.1
+	// device model variables
+	Configuration() *ConfigurationStore
+}
+
+// ConnectorEvents are the physical events of a connector a scenario can
+// inject. Only OCPP 1.6 chargers implement them.
+type ConnectorEvents interface {
+	PlugIn(connectorID int) error
+	PlugOut(connectorID int) error
+	SuspendEV(connectorID int) error
+	ResumeEV(connectorID int) error
+	Fault(connectorID int, errorCode string) error
+	ClearFault(connectorID int) error
+	// SetConnectorStatus forces a status, bypassing the state machine when
+	// invalid transitions are allowed
+	SetConnectorStatus(connectorID int, status ConnectorStatus, errorCode string) error
+}
+
+// ReservationDrivers are the drivers of a charger, who honor reservations
+// unless told to ignore them. Only OCPP 1.6 chargers implement them.
+type ReservationDrivers interface {
+	SetIgnoreReservations(ignore bool)
+}
+
+// FirmwareFaults are the faults a scenario can inject into firmware updates
+// and diagnostics uploads. Only OCPP 1.6 chargers implement them.
+type FirmwareFaults interface {
+	SetFirmwareBehavior(behavior FirmwareBehavior)
+}
+
+// PowerCycling reboots a charger the way a local reset or a power cut would.
+// Only OCPP 1.6 chargers implement it.
+type PowerCycling interface {
+	Reboot(resetType ResetType) error
+}
+
+var (
+	_ Charger            = (*VirtualCharger)(nil)
+	_ ConnectorEvents    = (*VirtualCharger)(nil)
+	_ ReservationDrivers = (*VirtualCharger)(nil)
+	_ FirmwareFaults     = (*VirtualCharger)(nil)
+	_ PowerCycling       = (*VirtualCharger)(nil)
+	_ Charger            = (*ChargingStation)(nil)
+)
+
+// New creates a charger speaking the OCPP version of the config. The version
+// must be registered with the ocpp package and have a charger registered with
+// RegisterCharger.
+func New(config ChargerConfig, eventBus eventbus.EventBus) (Charger, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	protocol, err := ocpp.LookupProtocol(config.OCPPVersion)
+	if err != nil {
+		return nil, fmt.Errorf("charger %s: %w", config.Identifier, err)
+	}
+	constructor, err := lookupCharger(config.OCPPVersion)
+	if err != nil {
+		return nil, fmt.Errorf("charger %s: %w", config.Identifier, err)
+	}
+	return constructor(config, protocol, eventBus), nil
+}
@@ -0,0 +1,489 @@
+package charger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+)
+
+// Electrical assumptions used to convert between ampere and watt limits
+const (
+	nominalVoltage = 230.0 // Volts per phase
+	defaultPhases  = 3     // Phases used when a period does not specify numberPhases
+)
+
+// recurrencyPeriods maps recurrency kinds to the length of one recurrence
+var recurrencyPeriods = map[string]time.Duration{
+	ocpp.RecurrencyKindDaily:  24 * time.Hour,
+	ocpp.RecurrencyKindWeekly: 7 * 24 * time.Hour,
+}
+
+// installedProfile is a charging profile set on a connector, 0 for the
+// whole charge point
+type installedProfile struct {
+	connectorID int
+	profile     ocpp.ChargingProfile
+}
+
+// chargingContext describes the transaction running on a connector, which
+// TxProfiles and Relative schedules refer to
+type chargingContext struct {
+	transactionID int       // ID assigned by the CSMS
+	start         time.Time // Start of the transaction
+}
+
+// ChargingProfileStore holds the charging profiles installed through
+// SetChargingProfile and computes the limits they impose
+type ChargingProfileStore struct {
+	profiles []installedProfile
+	mu       sync.RWMutex
+}
+
+// NewChargingProfileStore creates an empty charging profile store
+func NewChargingProfileStore() *ChargingProfileStore {
+	return &ChargingProfileStore{}
+}
+
+// Install adds a profile to a connector. A profile with the same ID, or with
+// the same purpose and stack level on the connector, is replaced.
+func (s *ChargingProfileStore) Install(connectorID int, profile ocpp.ChargingProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.profiles = s.without(func(p installedProfile) bool {
+		return replaces(p, connectorID, profile)
+	})
+	s.profiles = append(s.profiles, installedProfile{connectorID: connectorID, profile: profile})
+}
+
+// CountAfterInstall returns how many profiles would be installed after
+// installing the profile on the connector
+func (s *ChargingProfileStore) CountAfterInstall(connectorID int, profile ocpp.ChargingProfile) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 1
+	for _, p := range s.profiles {
+		if !replaces(p, connectorID, profile) {
+			count++
+		}
+	}
+	return count
+}
+
+// replaces reports whether installing profile on connectorID replaces p
+func replaces(p installedProfile, connectorID int, profile ocpp.ChargingProfile) bool {
+	if p.profile.ChargingProfileId == profile.ChargingProfileId {
+		return true
+	}
+	return p.connectorID == connectorID &&
+		p.profile.ChargingProfilePurpose == profile.ChargingProfilePurpose &&
+		p.profile.StackLevel == profile.StackLevel
+}
+
+// Clear removes the profiles matching the ClearChargingProfile criteria and
+// returns how many were removed. A profile ID takes precedence over the other
+// criteria.
+func (s *ChargingProfileStore) Clear(req ocpp.ClearChargingProfileRequest) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.profiles)
+	s.profiles = s.without(func(p installedProfile) bool {
+		if req.Id != nil {
+			return p.profile.ChargingProfileId == *req.Id
+		}
+		if req.ConnectorId != nil && p.connectorID != *req.ConnectorId {
+			return false
+		}
+		if req.ChargingProfilePurpose != nil && p.profile.ChargingProfilePurpose != *req.ChargingProfilePurpose {
+			return false
+		}
+		if req.StackLevel != nil && p.profile.StackLevel != *req.StackLevel {
+			return false
+		}
+		return true
+	})
+	return before - len(s.profiles)
+}
+
+// ClearTransaction removes the TxProfiles of a connector once its
+// transaction has ended
+func (s *ChargingProfileStore) ClearTransaction(connectorID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.profiles)
+	s.profiles = s.without(func(p installedProfile) bool {
+		return p.connectorID == connectorID && p.profile.ChargingProfilePurpose == ocpp.ChargingProfilePurposeTx
+	})
+	return before - len(s.profiles)
+}
+
+// without returns the profiles for which remove is false.
+// The caller must hold s.mu for writing.
+func (s *ChargingProfileStore) without(remove func(p installedProfile) bool) []installedProfile {
+	kept := s.profiles[:0]
+	for _, p := range s.profiles {
+		if !remove(p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// Profiles returns the profiles installed on a connector
+func (s *ChargingProfileStore) Profiles(connectorID int) []ocpp.ChargingProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var profiles []ocpp.ChargingProfile
+	for _, p := range s.profiles {
+		if p.connectorID == connectorID {
+			profiles = append(profiles, p.profile)
+		}
+	}
+	return profiles
+}
+
+// Count returns the number of installed profiles
+func (s *ChargingProfileStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.profiles)
+}
+
+// limitAt returns the limit in W the profiles impose on a connector at t,
+// capped at ratedW, and the number of phases of the governing TxProfile or
+// TxDefaultProfile period (0 when unspecified). Connector 0 is only limited by
+// ChargePointMaxProfiles. tx is nil when no transaction runs on the connector.
+// A ChargePointMaxProfile limits the charger as a whole, so its limit is split
+// equally across the given number of connectors charging at the same time.
+func (s *ChargingProfileStore) limitAt(connectorID int, tx *chargingContext, t time.Time, ratedW float64, shares int) (float64, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	limit := ratedW
+	phases := 0
+	if period, ok := s.governingPeriod(s.candidates(0, nil, ocpp.ChargingProfilePurposeChargePointMax), tx, t); ok {
+		watts := period.watts
+		if connectorID != 0 && shares > 1 {
+			watts /= float64(shares)
+		}
+		limit = math.Min(limit, watts)
+	}
+	if connectorID == 0 {
+		return limit, phases
+	}
+
+	// TxProfiles overrule TxDefaultProfiles while they are in effect
+	period, ok := s.governingPeriod(s.candidates(connectorID, tx, ocpp.ChargingProfilePurposeTx), tx, t)
+	if !ok {
+		period, ok = s.governingPeriod(s.candidates(connectorID, tx, ocpp.ChargingProfilePurposeTxDefault), tx, t)
+	}
+	if ok {
+		limit = math.Min(limit, period.watts)
+		phases = period.phases
+	}
+	return limit, phases
+}
+
+// candidates returns the profiles of a purpose that may apply to a connector,
+// ordered by descending stack level with connector specific profiles first.
+// The caller must hold s.mu.
+func (s *ChargingProfileStore) candidates(connectorID int, tx *chargingContext, purpose string) []installedProfile {
+	var result []installedProfile
+	for _, p := range s.profiles {
+		if p.profile.ChargingProfilePurpose != purpose {
+			continue
+		}
+		switch purpose {
+		case ocpp.ChargingProfilePurposeChargePointMax:
+			// Only valid on connector 0
+		case ocpp.ChargingProfilePurposeTx:
+			if tx == nil || p.connectorID != connectorID {
+				continue
+			}
+			if p.profile.TransactionId != nil && *p.profile.TransactionId != tx.transactionID {
+				continue
+			}
+		case ocpp.ChargingProfilePurposeTxDefault:
+			// Defaults on connector 0 apply to every connector
+			if p.connectorID != connectorID && p.connectorID != 0 {
+				continue
+			}
+		}
+		result = append(result, p)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].profile.StackLevel != result[j].profile.StackLevel {
+			return result[i].profile.StackLevel > result[j].profile.StackLevel
+		}
+		return result[i].connectorID > result[j].connectorID
+	})
+	return result
+}
+
+// effectivePeriod is a schedule period converted to watts
+type effectivePeriod struct {
+	watts  float64
+	phases int
+}
+
+// governingPeriod returns the period of the first candidate whose schedule is
+// in effect at t
+func (s *ChargingProfileStore) governingPeriod(candidates []installedProfile, tx *chargingContext, t time.Time) (effectivePeriod, bool) {
+	for _, p := range candidates {
+		if period, ok := periodAt(p.profile, tx, t); ok {
+			phases := 0
+			if period.NumberPhases != nil {
+				phases = *period.NumberPhases
+			}
+			return effectivePeriod{
+				watts:  toWatts(period.Limit, p.profile.ChargingSchedule.ChargingRateUnit, phases),
+				phases: phases,
+			}, true
+		}
+	}
+	return effectivePeriod{}, false
+}
+
+// periodAt returns the schedule period of a profile in effect at t
+func periodAt(profile ocpp.ChargingProfile, tx *chargingContext, t time.Time) (ocpp.ChargingSchedulePeriod, bool) {
+	if profile.ValidFrom != nil && t.Before(*profile.ValidFrom) {
+		return ocpp.ChargingSchedulePeriod{}, false
+	}
+	if profile.ValidTo != nil && !t.Before(*profile.ValidTo) {
+		return ocpp.ChargingSchedulePeriod{}, false
+	}
+
+	start, ok := scheduleStart(profile, tx, t)
+	if !ok {
+		return ocpp.ChargingSchedulePeriod{}, false
+	}
+	offset := t.Sub(start)
+	schedule := profile.ChargingSchedule
+	if offset < 0 || (schedule.Duration != nil && offset >= time.Duration(*schedule.Duration)*time.Second) {
+		return ocpp.ChargingSchedulePeriod{}, false
+	}
+
+	// Periods are sorted by start, validated on installation
+	var current *ocpp.ChargingSchedulePeriod
+	for i := range schedule.ChargingSchedulePeriod {
+		period := &schedule.ChargingSchedulePeriod[i]
+		if time.Duration(period.StartPeriod)*time.Second > offset {
+			break
+		}
+		current = period
+	}
+	if current == nil {
+		return ocpp.ChargingSchedulePeriod{}, false
+	}
+	return *current, true
+}
+
+// scheduleStart returns when the schedule of a profile started for the
+// recurrence containing t
+func scheduleStart(profile ocpp.ChargingProfile, tx *chargingContext, t time.Time) (time.Time, bool) {
+	switch profile.ChargingProfileKind {
+	case ocpp.ChargingProfileKindRelative:
+		if tx == nil {
+			return time.Time{}, false
+		}
+		return tx.start, true
+	case ocpp.ChargingProfileKindRecurring:
+		if profile.ChargingSchedule.StartSchedule == nil || profile.RecurrencyKind == nil {
+			return time.Time{}, false
+		}
+		start := *profile.ChargingSchedule.StartSchedule
+		period := recurrencyPeriods[*profile.RecurrencyKind]
+		if period == 0 || t.Before(start) {
+			return start, true
+		}
+		return start.Add(t.Sub(start) / period * period), true
+	default:
+		if profile.ChargingSchedule.StartSchedule == nil {
+			return time.Time{}, false
+		}
+		return *profile.ChargingSchedule.StartSchedule, true
+	}
+}
+
+// compositeSchedule combines the profiles of a connector into the schedule
+// that applies from start for the given duration, in the given unit. shares
+// is passed on to limitAt.
+func (s *ChargingProfileStore) compositeSchedule(connectorID int, tx *chargingContext, start time.Time, duration time.Duration, unit string, ratedW float64, shares int) ocpp.ChargingSchedule {
+	end := start.Add(duration)
+
+	// The limit can only change where a profile starts, ends or changes period
+	points := []time.Time{start}
+	s.mu.RLock()
+	for _, p := range s.profiles {
+		points = append(points, breakpoints(p.profile, tx, start, end)...)
+	}
+	s.mu.RUnlock()
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	seconds := int(duration / time.Second)
+	schedule := ocpp.ChargingSchedule{
+		Duration:         &seconds,
+		StartSchedule:    &start,
+		ChargingRateUnit: unit,
+	}
+	for _, point := range points {
+		watts, phases := s.limitAt(connectorID, tx, point, ratedW, shares)
+		period := ocpp.ChargingSchedulePeriod{
+			StartPeriod: int(point.Sub(start) / time.Second),
+			Limit:       fromWatts(watts, unit, phases),
+		}
+		if phases > 0 {
+			period.NumberPhases = &phases
+		}
+
+		periods := schedule.ChargingSchedulePeriod
+		if n := len(periods); n > 0 {
+			last := periods[n-1]
+			if last.StartPeriod == period.StartPeriod {
+				periods = periods[:n-1]
+			} else if last.Limit == period.Limit && samePhases(last.NumberPhases, period.NumberPhases) {
+				continue
+			}
+		}
+		schedule.ChargingSchedulePeriod = append(periods, period)
+	}
+	return schedule
+}
+
+// breakpoints returns the instants in (from, to) at which a profile starts,
+// ends or changes period
+func breakpoints(profile ocpp.ChargingProfile, tx *chargingContext, from, to time.Time) []time.Time {
+	var points []time.Time
+	add := func(t time.Time) {
+		if t.After(from) && t.Before(to) {
+			points = append(points, t)
+		}
+	}
+	if profile.ValidFrom != nil {
+		add(*profile.ValidFrom)
+	}
+	if profile.ValidTo != nil {
+		add(*profile.ValidTo)
+	}
+
+	var starts []time.Time
+	if start, ok := scheduleStart(profile, tx, from); ok {
+		starts = append(starts, start)
+		if profile.ChargingProfileKind == ocpp.ChargingProfileKindRecurring {
+			period := recurrencyPeriods[*profile.RecurrencyKind]
+			for next := start.Add(period); period > 0 && next.Before(to); next = next.Add(period) {
+				starts = append(starts, next)
+			}
+		}
+	}
+
+	schedule := profile.ChargingSchedule
+	for _, start := range starts {
+		for _, period := range schedule.ChargingSchedulePeriod {
+			add(start.Add(time.Duration(period.StartPeriod) * time.Second))
+		}
+		if schedule.Duration != nil {
+			add(start.Add(time.Duration(*schedule.Duration) * time.Second))
+		}
+	}
+	return points
+}
+
+func samePhases(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// toWatts converts a limit in the given unit into watts
+func toWatts(limit float64, unit string, phases int) float64 {
+	if unit != ocpp.ChargingRateUnitAmperes {
+		return limit
+	}
+	if phases <= 0 {
+		phases = defaultPhases
+	}
+	return limit * nominalVoltage * float64(phases)
+}
+
+// fromWatts converts watts into a limit in the given unit, rounded to the
+// 0.1 resolution of OCPP limits
+func fromWatts(watts float64, unit string, phases int) float64 {
+	limit := watts
+	if unit == ocpp.ChargingRateUnitAmperes {
+		if phases <= 0 {
+			phases = defaultPhases
+		}
+		limit = watts / (nominalVoltage * float64(phases))
+	}
+	return math.Round(limit*10) / 10
+}
+
+// validateChargingProfile checks a profile against the OCPP rules and the
+// smart charging limits of the configuration
+func validateChargingProfile(profile ocpp.ChargingProfile, config *ConfigurationStore) error {
+	if maxLevel := config.GetInt(KeyChargeProfileMaxStackLevel, 0); profile.StackLevel < 0 || profile.StackLevel > maxLevel {
+		return fmt.Errorf("stack level %d outside 0-%d", profile.StackLevel, maxLevel)
+	}
+
+	schedule := profile.ChargingSchedule
+	if !chargingRateUnitAllowed(schedule.ChargingRateUnit, config) {
+		return fmt.Errorf("charging rate unit %s not allowed", schedule.ChargingRateUnit)
+	}
+	periods := schedule.ChargingSchedulePeriod
+	if maxPeriods := config.GetInt(KeyChargingScheduleMaxPeriods, 0); len(periods) == 0 || len(periods) > maxPeriods {
+		return fmt.Errorf("%d schedule periods, 1-%d allowed", len(periods), maxPeriods)
+	}
+	if periods[0].StartPeriod != 0 {
+		return fmt.Errorf("first schedule period must start at 0")
+	}
+	for i := 1; i < len(periods); i++ {
+		if periods[i].StartPeriod <= periods[i-1].StartPeriod {
+			return fmt.Errorf("schedule periods must be in ascending order")
+		}
+	}
+	for _, period := range periods {
+		if period.Limit < 0 {
+			return fmt.Errorf("negative limit %v", period.Limit)
+		}
+	}
+
+	switch profile.ChargingProfileKind {
+	case ocpp.ChargingProfileKindAbsolute:
+		if schedule.StartSchedule == nil {
+			return fmt.Errorf("absolute schedule without startSchedule")
+		}
+	case ocpp.ChargingProfileKindRecurring:
+		if schedule.StartSchedule == nil || profile.RecurrencyKind == nil {
+			return fmt.Errorf("recurring schedule without startSchedule or recurrencyKind")
+		}
+	}
+	if profile.ValidFrom != nil && profile.ValidTo != nil && !profile.ValidTo.After(*profile.ValidFrom) {
+		return fmt.Errorf("validTo must be after validFrom")
+	}
+	return nil
+}
+
+// chargingRateUnitAllowed checks a unit against ChargingScheduleAllowedChargingRateUnit
+func chargingRateUnitAllowed(unit string, config *ConfigurationStore) bool {
+	allowed := map[string]string{
+		ocpp.ChargingRateUnitAmperes: "Current",
+		ocpp.ChargingRateUnitWatts:   "Power",
+	}[unit]
+	for _, value := range config.GetList(KeyChargingScheduleAllowedChargingRateUnit) {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,492 @@
+package charger
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// defaultMaxPowerKW is the rated power of chargers that do not configure one
+const defaultMaxPowerKW = 22.0
+
+// chargingStep is the integration step of charging sessions and how often a
+// simulated session re-evaluates its limit
+var chargingStep = time.Second
+
+// ratedPowerW returns the rated power of the charger in watts
+func (c ChargerConfig) ratedPowerW() float64 {
+	if c.MaxPowerKW > 0 {
+		return c.MaxPowerKW * 1000
+	}
+	return defaultMaxPowerKW * 1000
+}
+
+// currentType returns whether the charger delivers AC or DC
+func (c ChargerConfig) currentType() string {
+	if c.CurrentType == CurrentTypeDC {
+		return CurrentTypeDC
+	}
+	return CurrentTypeAC
+}
+
+// chargingState tells who, if anyone, holds back energy delivery. The values
+// are OCPP 1.6 connector statuses and OCPP 2.0.1 charging states alike.
+type chargingState string
+
+const (
+	chargingStateCharging      chargingState = "Charging"
+	chargingStateSuspendedEV   chargingState = "SuspendedEV"
+	chargingStateSuspendedEVSE chargingState = "SuspendedEVSE"
+)
+
+// chargingLimit returns the power in W a connector may deliver at t and the
+// number of phases the limit refers to, 0 when unspecified
+type chargingLimit func(connectorID int, tx chargingContext, t time.Time) (float64, int)
+
+// chargingSession integrates the energy a transaction delivers to its EV
+type chargingSession struct {
+	localID     int // Local ID of the transaction
+	connectorID int
+	tx          chargingContext
+	ev          EVModel
+	dc          bool
+	capW        float64 // Power requested by SimulateCharging, 0 for no cap
+	suspended   bool    // Energy delivery stopped by the charger
+	faulted     bool    // Energy delivery stopped by a connector fault
+	evSuspended bool    // The EV stopped drawing energy
+	offeredW    float64 // Power offered in the last step, -1 before the first step
+	powerW      float64 // Power drawn in the last step
+	phases      int     // AC phases used in the last step
+	state       chargingState
+	energyWh    float64 // Energy register
+	last        time.Time
+	mu          sync.Mutex
+}
+
+// newChargingSession starts a session for a transaction with the EV plugged
+// into its connector
+func newChargingSession(transaction *Transaction, ev EVModel, currentType string) *chargingSession {
+	return &chargingSession{
+		localID:     transaction.ID,
+		connectorID: transaction.ConnectorID,
+		tx:          chargingContext{transactionID: transaction.CSMSID, start: transaction.StartTime},
+		ev:          ev,
+		dc:          currentType == CurrentTypeDC,
+		offeredW:    -1,
+		phases:      ev.Phases(),
+		state:       chargingStateCharging,
+		energyWh:    float64(transaction.MeterStart),
+		last:        transaction.StartTime,
+	}
+}
+
+// chargingUpdate reports how a step changed a session
+type chargingUpdate struct {
+	previousState    chargingState
+	state            chargingState
+	previousOfferedW float64
+	offeredW         float64
+	powerW           float64
+}
+
+// advance integrates the session up to now in steps of chargingStep. In every
+// step the EV draws what it accepts of the power the limit, the requested
+// power and the charger allow.
+func (s *chargingSession) advance(now time.Time, limit chargingLimit) chargingUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := chargingUpdate{
+		previousState:    s.state,
+		previousOfferedW: s.offeredW,
+	}
+	for s.last.Before(now) {
+		next := s.last.Add(chargingStep)
+		if next.After(now) {
+			next = now
+		}
+		s.stepLocked(next, limit)
+	}
+
+	update.state = s.state
+	update.offeredW = s.offeredW
+	update.powerW = s.powerW
+	return update
+}
+
+// reevaluate determines power and state for the current instant without
+// delivering energy, after the charger or the EV changed their mind
+func (s *chargingSession) reevaluate(limit chargingLimit) chargingUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := chargingUpdate{
+		previousState:    s.state,
+		previousOfferedW: s.offeredW,
+	}
+	s.stepLocked(s.last, limit)
+
+	update.state = s.state
+	update.offeredW = s.offeredW
+	update.powerW = s.powerW
+	return update
+}
+
+// stepLocked delivers energy from the last step up to next. The caller must
+// hold s.mu.
+func (s *chargingSession) stepLocked(next time.Time, limit chargingLimit) {
+	offered, phases := limit(s.connectorID, s.tx, s.last)
+	if s.capW > 0 {
+		offered = math.Min(offered, s.capW)
+	}
+	if s.suspended || s.faulted {
+		offered = 0
+	}
+	power := s.ev.AcceptedPower(offered)
+	if s.evSuspended {
+		power = 0
+	}
+	s.energyWh += s.ev.Charge(power * next.Sub(s.last).Hours())
+
+	s.offeredW = offered
+	s.powerW = power
+	s.phases = s.ev.Phases()
+	if phases > 0 && phases < s.phases {
+		s.phases = phases
+	}
+	switch {
+	case offered <= 0:
+		s.state = chargingStateSuspendedEVSE
+	case power <= 0:
+		s.state = chargingStateSuspendedEV
+	default:
+		s.state = chargingStateCharging
+	}
+	s.last = next
+}
+
+// setCap limits the power the session draws, 0 removes the limit
+func (s *chargingSession) setCap(w float64) {
+	s.mu.Lock()
+	s.capW = w
+	s.mu.Unlock()
+}
+
+// suspend stops delivering energy
+func (s *chargingSession) suspend() {
+	s.mu.Lock()
+	s.suspended = true
+	s.mu.Unlock()
+}
+
+// setFaulted stops or resumes energy delivery for a connector fault
+func (s *chargingSession) setFaulted(faulted bool) {
+	s.mu.Lock()
+	s.faulted = faulted
+	s.mu.Unlock()
+}
+
+// setEVSuspended makes the EV stop or resume drawing energy
+func (s *chargingSession) setEVSuspended(suspended bool) {
+	s.mu.Lock()
+	s.evSuspended = suspended
+	s.mu.Unlock()
+}
+
+// setTransactionID records the transaction ID the CSMS assigned, which
+// TxProfiles refer to
+func (s *chargingSession) setTransactionID(id int) {
+	s.mu.Lock()
+	s.tx.transactionID = id
+	s.mu.Unlock()
+}
+
+// meterWh returns the energy register of the session
+func (s *chargingSession) meterWh() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(math.Round(s.energyWh))
+}
+
+// reading returns the electrical values of the last step
+func (s *chargingSession) reading() meterReading {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := meterReading{
+		EnergyWh: s.energyWh,
+		PowerW:   s.powerW,
+		OfferedW: math.Max(s.offeredW, 0),
+		EV:       true,
+		SoC:      s.ev.SoC(),
+	}
+	if s.dc {
+		r.VoltageV = s.ev.BatteryVoltage()
+		r.CurrentA = s.powerW / r.VoltageV
+		return r
+	}
+	r.Phases = max(s.phases, 1)
+	r.VoltageV = nominalVoltage
+	r.CurrentA = s.powerW / (nominalVoltage * float64(r.Phases))
+	return r
+}
+
+// meterReading holds the values a meter reports for a connector
+type meterReading struct {
+	EnergyWh float64
+	PowerW   float64
+	OfferedW float64
+	CurrentA float64 // Per phase for AC
+	VoltageV float64 // Phase to neutral for AC
+	Phases   int     // AC phases in use, 0 for DC
+	EV       bool    // An EV is charging, SoC is valid
+	SoC      float64 // Percent
+}
+
+// meterWh returns the energy register in whole Wh
+func (r meterReading) meterWh() int {
+	return int(math.Round(r.EnergyWh))
+}
+
+// meterSample is one sampled value of a meter reading
+type meterSample struct {
+	measurand string
+	phase     string
+	location  string
+	unit      string
+	value     float64
+}
+
+// supportedMeasurands are the measurands a reading provides
+var supportedMeasurands = map[string]bool{
+	"Energy.Active.Import.Register": true,
+	"Power.Active.Import":           true,
+	"Power.Offered":                 true,
+	"Current.Import":                true,
+	"Voltage":                       true,
+	"SoC":                           true,
+}
+
+// samples lists the measurands of a reading, with current and voltage per
+// phase for AC and the SoC only while an EV charges
+func (r meterReading) samples() []meterSample {
+	samples := []meterSample{
+		{measurand: "Energy.Active.Import.Register", location: "Outlet", unit: "Wh", value: math.Round(r.EnergyWh)},
+		{measurand: "Power.Active.Import", location: "Outlet", unit: "W", value: round(r.PowerW, 1)},
+		{measurand: "Power.Offered", location: "Outlet", unit: "W", value: round(r.OfferedW, 1)},
+	}
+	if r.Phases == 0 {
+		samples = append(samples,
+			meterSample{measurand: "Current.Import", location: "Outlet", unit: "A", value: round(r.CurrentA, 2)},
+			meterSample{measurand: "Voltage", location: "Outlet", unit: "V", value: round(r.VoltageV, 1)},
+		)
+	}
+	for phase := 1; phase <= r.Phases; phase++ {
+		samples = append(samples,
+			meterSample{measurand: "Current.Import", phase: fmt.Sprintf("L%d", phase), location: "Outlet", unit: "A", value: round(r.CurrentA, 2)},
+			meterSample{measurand: "Voltage", phase: fmt.Sprintf("L%d-N", phase), location: "Outlet", unit: "V", value: round(r.VoltageV, 1)},
+		)
+	}
+	if r.EV {
+		samples = append(samples, meterSample{measurand: "SoC", location: "EV", unit: "Percent", value: round(r.SoC, 1)})
+	}
+	return samples
+}
+
+// selectSamples keeps the samples of the given measurands in reading order
+func selectSamples(samples []meterSample, measurands []string) []meterSample {
+	selected := make(map[string]bool, len(measurands))
+	for _, measurand := range measurands {
+		selected[measurand] = true
+	}
+
+	var kept []meterSample
+	for _, sample := range samples {
+		if selected[sample.measurand] {
+			kept = append(kept, sample)
+		}
+	}
+	return kept
+}
+
+func round(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// chargingSessions holds the EVs and charging sessions of a charger. It is
+// guarded by the mutex of the charger.
+type chargingSessions struct {
+	fleet       []EVType
+	currentType string
+	sessions    map[int]*chargingSession // By local transaction ID
+	evs         map[int]EVModel          // EVs plugged in for the next transaction, by connector
+	registers   map[int]float64          // Energy register in Wh after the last transaction, by connector
+	rng         *rand.Rand               // Draws EVs from the fleet
+
+	// Connectors with a charging session. Limits are computed with and
+	// without the mutex of the charger held, so it has its own.
+	charging   map[int]int // Sessions by connector
+	chargingMu sync.Mutex
+}
+
+func newChargingSessions(config ChargerConfig) *chargingSessions {
+	return &chargingSessions{
+		fleet:       config.EVFleet,
+		currentType: config.currentType(),
+		sessions:    make(map[int]*chargingSession),
+		evs:         make(map[int]EVModel),
+		registers:   make(map[int]float64),
+		rng:         newChargerRand(config.Identifier),
+		charging:    make(map[int]int),
+	}
+}
+
+// start begins the charging session of a new transaction with the EV plugged
+// into its connector, or an EV drawn from the fleet
+func (c *chargingSessions) start(transaction *Transaction) *chargingSession {
+	ev, plugged := c.evs[transaction.ConnectorID]
+	if plugged {
+		delete(c.evs, transaction.ConnectorID)
+	} else {
+		ev = NewBatteryEV(sampleEVProfile(c.fleet, c.rng), c.currentType)
+	}
+
+	session := newChargingSession(transaction, ev, c.currentType)
+	c.sessions[transaction.ID] = session
+
+	c.chargingMu.Lock()
+	c.charging[transaction.ConnectorID]++
+	c.chargingMu.Unlock()
+	return session
+}
+
+// finish brings the charging session of a transaction up to now and returns
+// its final reading. The session keeps running until end is called, once the
+// CSMS has been told that the transaction stopped.
+func (c *chargingSessions) finish(transaction *Transaction, limit chargingLimit) meterReading {
+	session, exists := c.sessions[transaction.ID]
+	if !exists {
+		return meterReading{EnergyWh: float64(transaction.MeterStart)}
+	}
+
+	session.advance(time.Now(), limit)
+	return session.reading()
+}
+
+// end ends the charging session of a transaction at its final reading. The
+// energy register of the connector keeps counting from there.
+func (c *chargingSessions) end(transaction *Transaction, final meterReading) {
+	if _, exists := c.sessions[transaction.ID]; !exists {
+		return
+	}
+	delete(c.sessions, transaction.ID)
+	c.registers[transaction.ConnectorID] = final.EnergyWh
+
+	c.chargingMu.Lock()
+	c.charging[transaction.ConnectorID]--
+	if c.charging[transaction.ConnectorID] <= 0 {
+		delete(c.charging, transaction.ConnectorID)
+	}
+	c.chargingMu.Unlock()
+}
+
+// chargePointMaxShares returns the number of connectors sharing the limit of
+// a ChargePointMaxProfile while connectorID charges: the connectors with a
+// charging session, connectorID included. Connector 0 stands for the whole
+// charger and does not share.
+func (c *chargingSessions) chargePointMaxShares(connectorID int) int {
+	if connectorID == 0 {
+		return 1
+	}
+
+	c.chargingMu.Lock()
+	defer c.chargingMu.Unlock()
+
+	shares := len(c.charging)
+	if c.charging[connectorID] == 0 {
+		shares++
+	}
+	return shares
+}
+
+// register returns the energy register of a connector, where its next
+// transaction starts
+func (c *chargingSessions) register(connectorID int) int {
+	return int(math.Round(c.registers[connectorID]))
+}
+
+// idleReading returns the reading of a connector without a charging session
+func (c *chargingSessions) idleReading(connectorID int) meterReading {
+	r := meterReading{EnergyWh: c.registers[connectorID]}
+	if c.currentType == CurrentTypeAC {
+		r.Phases = defaultPhases
+		r.VoltageV = nominalVoltage
+	}
+	return r
+}
+
+// PlugInEV connects an EV to a connector; the next transaction on the
+// connector charges it. Without one every transaction draws an EV from the
+// configured fleet.
+func (vc *VirtualCharger) PlugInEV(connectorID int, ev EVModel) error {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if connectorID < 1 || connectorID > len(vc.connectors) {
+		return fmt.Errorf("invalid connector ID: %d", connectorID)
+	}
+	vc.charging.evs[connectorID] = ev
+	return nil
+}
+
+// sessionLimit is the chargingLimit of VirtualCharger sessions: the charging
+// profiles capped at the rated power, with the ChargePointMaxProfile shared by
+// all charging connectors
+func (vc *VirtualCharger) sessionLimit(connectorID int, tx chargingContext, t time.Time) (float64, int) {
+	return vc.chargingProfiles.limitAt(connectorID, &tx, t, vc.config.ratedPowerW(), vc.charging.chargePointMaxShares(connectorID))
+}
+
+// advanceCharging steps a session up to now and reports what changed
+func (vc *VirtualCharger) advanceCharging(s *chargingSession, now time.Time) {
+	vc.reportCharging(s, s.advance(now, vc.sessionLimit))
+}
+
+// reportCharging publishes a new offered power, and changes the connector
+// status when the charger or the EV suspends or resumes charging
+func (vc *VirtualCharger) reportCharging(s *chargingSession, update chargingUpdate) {
+	if update.previousOfferedW >= 0 && update.offeredW != update.previousOfferedW {
+		vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.charging_power.changed", vc.id, map[string]interface{}{
+			"connector_id": s.connectorID,
+			"offered_w":    update.offeredW,
+			"power_w":      update.powerW,
+		}))
+	}
+	if update.state == update.previousState {
+		return
+	}
+
+	if update.state == chargingStateSuspendedEV && s.ev.Full() {
+		vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.ev.full", vc.id, map[string]interface{}{
+			"connector_id": s.connectorID,
+			"soc":          s.ev.SoC(),
+			"meter_wh":     s.meterWh(),
+		}))
+	}
+
+	// Only a connector that is still in its transaction follows the session
+	defer vc.flushStatusNotifications()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	connector := vc.connectors[s.connectorID-1]
+	switch connector.Status {
+	case ConnectorStatusCharging, ConnectorStatusSuspendedEV, ConnectorStatusSuspendedEVSE:
+		if err := vc.setConnectorStatusLocked(connector, ConnectorStatus(update.state), ""); err != nil {
+			vc.logger.WithError(err).WithField("connector_id", s.connectorID).Error("Failed to follow charging state")
+		}
+	}
+}
@@ -0,0 +1,1105 @@
+package charger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/ocpp201"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// idTokenType is the IdToken type of locally presented id tags
+const idTokenType = "ISO14443"
+
+// ChargingStation represents a single OCPP 2.0.1 charging station. Every
+// configured connector is modelled as an EVSE with one connector, so the
+// connector IDs of the Charger interface are EVSE IDs.
+type ChargingStation struct {
+	id                string
+	config            ChargerConfig
+	ocppClient        ocpp.Client
+	messageIDs        ocpp.MessageIDGenerator // Shared with the OCPP client
+	eventBus          eventbus.EventBus
+	status            ChargerStatus
+	evses             []*Connector         // Connector.ID is the EVSE ID
+	transactions      map[int]*Transaction // Keyed by local transaction ID
+	seqNo             map[int]int          // Next TransactionEvent seqNo by local transaction ID
+	nextTransactionID int
+	callHandlers      map[string]callHandler
+	deviceModel       *ConfigurationStore
+	charging          *chargingSessions // EVs and their charging sessions, guarded by mu
+	registration      atomic.Value      // RegistrationStatus
+	bootRetry         *time.Timer
+	resetScheduled    bool           // Reset OnIdle waiting for transactions to end
+	offlineStarts     map[string]int // Local IDs of queued Started events by message ID
+	mu                sync.RWMutex
+	logger            *logrus.Entry
+	ctx               context.Context
+	cancel            context.CancelFunc
+}
+
+// NewChargingStation creates a new OCPP 2.0.1 charging station
+func NewChargingStation(config ChargerConfig, eventBus eventbus.EventBus) *ChargingStation {
+	return newChargingStation(config, ocpp201.Protocol, eventBus)
+}
+
+// newChargingStation creates a charging station whose client speaks protocol
+func newChargingStation(config ChargerConfig, protocol ocpp.Protocol, eventBus eventbus.EventBus) *ChargingStation {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger := logrus.WithFields(logrus.Fields{
+		"component":  "charging_station",
+		"charger_id": config.Identifier,
+	})
+
+	deviceModel := NewDeviceModel(config)
+	clientConfig := config.clientConfig()
+	clientConfig.Keepalive.PingInterval = deviceModel.GetInterval(VariableWebSocketPingInterval)
+
+	cs := &ChargingStation{
+		id:            config.Identifier,
+		config:        config,
+		ocppClient:    protocol.CreateClientWithConfig(clientConfig),
+		messageIDs:    clientConfig.MessageIDs,
+		eventBus:      eventBus,
+		status:        StatusOffline,
+		evses:         make([]*Connector, config.ConnectorCount),
+		transactions:  make(map[int]*Transaction),
+		seqNo:         make(map[int]int),
+		deviceModel:   deviceModel,
+		charging:      newChargingSessions(config),
+		offlineStarts: make(map[string]int),
+		logger:        logger,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	cs.registerCallHandlers()
+
+	for i := 0; i < config.ConnectorCount; i++ {
+		cs.evses[i] = NewConnector(i+1, ConnectorStatusAvailable)
+	}
+
+	return cs
+}
+
+// GetID returns the charging station identifier
+func (cs *ChargingStation) GetID() string {
+	return cs.id
+}
+
+// Start connects to the CSMS and boots the charging station
+func (cs *ChargingStation) Start(ctx context.Context) error {
+	cs.logger.Info("Starting charging station")
+
+	cs.setStatus(StatusConnecting)
+
+	if err := cs.ocppClient.Connect(cs.ctx); err != nil {
+		cs.setStatus(StatusError)
+		return fmt.Errorf("failed to connect to CSMS: %w", err)
+	}
+
+	cs.ocppClient.SetMessageHandler(cs)
+	cs.ocppClient.SetConnectionHandler(cs)
+
+	if err := cs.sendBootNotification("PowerUp"); err != nil {
+		cs.ocppClient.Disconnect(cs.ctx)
+		cs.setStatus(StatusError)
+		return err
+	}
+
+	cs.setStatus(StatusConnected)
+	cs.logger.Info("Charging station started successfully")
+
+	go cs.heartbeatLoop()
+	go cs.statusLoop()
+	go watchPingInterval(cs.ctx, cs.deviceModel, VariableWebSocketPingInterval, cs.ocppClient)
+
+	return nil
+}
+
+// Stop ends all transactions and disconnects from the CSMS
+func (cs *ChargingStation) Stop(ctx context.Context) error {
+	cs.logger.Info("Stopping charging station")
+
+	// A full offline queue is waited for no longer than ctx allows
+	activeTransactions := cs.activeTransactions()
+	for _, tx := range activeTransactions {
+		if err := cs.stopTransaction(ctx, tx.ID, "Local"); err != nil {
+			cs.logger.WithError(err).WithField("transaction_id", tx.ID).Error("Failed to stop transaction")
+		}
+	}
+
+	if cs.IsConnected() {
+		if err := cs.ocppClient.Disconnect(ctx); err != nil {
+			cs.logger.WithError(err).Error("Failed to disconnect from CSMS")
+		}
+	}
+
+	cs.cancel()
+	cs.stopBootRetry()
+	cs.setStatus(StatusOffline)
+
+	cs.eventBus.Publish(ctx, eventbus.NewChargerEvent(
+		"charger.stopped",
+		cs.id,
+		map[string]interface{}{
+			"active_transactions": len(activeTransactions),
+		},
+	))
+
+	cs.logger.Info("Charging station stopped")
+	return nil
+}
+
+// GetStatus returns the current status of the charging station
+func (cs *ChargingStation) GetStatus() ChargerStatus {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.status
+}
+
+// GetConnectors returns the EVSEs of the charging station
+func (cs *ChargingStation) GetConnectors() []*Connector {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.evses
+}
+
+// IsConnected returns true if the charging station is connected to the CSMS
+func (cs *ChargingStation) IsConnected() bool {
+	return cs.ocppClient.IsConnected()
+}
+
+// Configuration returns the device model of the charging station
+func (cs *ChargingStation) Configuration() *ConfigurationStore {
+	return cs.deviceModel
+}
+
+// SetIgnorePings stops or resumes answering WebSocket pings from the CSMS
+func (cs *ChargingStation) SetIgnorePings(ignore bool) {
+	if controller, ok := cs.ocppClient.(ocpp.KeepaliveController); ok {
+		controller.SetIgnorePings(ignore)
+	}
+}
+
+// KeepaliveStats returns the WebSocket ping statistics of the charging station
+func (cs *ChargingStation) KeepaliveStats() ocpp.KeepaliveStats {
+	if controller, ok := cs.ocppClient.(ocpp.KeepaliveController); ok {
+		return controller.KeepaliveStats()
+	}
+	return ocpp.KeepaliveStats{}
+}
+
+// PipelineStats returns the message queue statistics of the charging station
+func (cs *ChargingStation) PipelineStats() ocpp.PipelineStats {
+	if monitor, ok := cs.ocppClient.(ocpp.PipelineMonitor); ok {
+		return monitor.PipelineStats()
+	}
+	return ocpp.PipelineStats{}
+}
+
+// setStatus updates the charging station status
+func (cs *ChargingStation) setStatus(status ChargerStatus) {
+	cs.mu.Lock()
+	oldStatus := cs.status
+	cs.status = status
+	cs.mu.Unlock()
+
+	cs.logger.WithFields(logrus.Fields{
+		"old_status": oldStatus,
+		"new_status": status,
+	}).Info("Charger status changed")
+}
+
+// activeTransactions returns a snapshot of all active transactions
+func (cs *ChargingStation) activeTransactions() []*Transaction {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	active := make([]*Transaction, 0)
+	for _, tx := range cs.transactions {
+		if tx.IsActive() {
+			active = append(active, tx)
+		}
+	}
+	return active
+}
+
+// GetRegistrationStatus returns the registration status assigned by the CSMS
+func (cs *ChargingStation) GetRegistrationStatus() RegistrationStatus {
+	status, _ := cs.registration.Load().(RegistrationStatus)
+	return status
+}
+
+// setRegistrationStatus updates the registration status and returns the old one
+func (cs *ChargingStation) setRegistrationStatus(status RegistrationStatus) RegistrationStatus {
+	old, _ := cs.registration.Swap(status).(RegistrationStatus)
+	return old
+}
+
+// checkRegistration returns an error if the action may not be sent with the
+// current registration status
+func (cs *ChargingStation) checkRegistration(action string) error {
+	if action == ocpp201.ActionBootNotification || cs.config.Boot.SendWhilePending {
+		return nil
+	}
+
+	status := cs.GetRegistrationStatus()
+	if status == RegistrationAccepted {
+		return nil
+	}
+	if status == RegistrationUnknown {
+		return fmt.Errorf("%s not permitted before BootNotification is accepted", action)
+	}
+	return fmt.Errorf("%s not permitted while registration is %s", action, status)
+}
+
+// sendMessage sends a station-initiated message without waiting for the response
+func (cs *ChargingStation) sendMessage(messageID, action string, payload interface{}) error {
+	return cs.sendMessageContext(cs.ctx, messageID, action, payload)
+}
+
+// sendMessageContext is sendMessage bounded by ctx instead of the station
+func (cs *ChargingStation) sendMessageContext(ctx context.Context, messageID, action string, payload interface{}) error {
+	if err := cs.checkRegistration(action); err != nil {
+		return err
+	}
+	return cs.ocppClient.SendMessage(ctx, &ocpp201.Message{
+		MessageType: "Call",
+		MessageID:   messageID,
+		Action:      action,
+		Payload:     payload,
+	})
+}
+
+// call sends a station-initiated request and waits for the CSMS response
+func (cs *ChargingStation) call(action string, payload interface{}) (interface{}, error) {
+	if err := cs.checkRegistration(action); err != nil {
+		return nil, err
+	}
+	return cs.ocppClient.Call(cs.ctx, action, payload)
+}
+
+// sendBootNotification registers the charging station with the CSMS
+func (cs *ChargingStation) sendBootNotification(reason string) error {
+	station := ocpp201.ChargingStation{
+		Model:      cs.config.Model,
+		VendorName: cs.config.Vendor,
+	}
+	if cs.config.SerialNumber != "" {
+		station.SerialNumber = &cs.config.SerialNumber
+	}
+
+	cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent(
+		"charger.boot_notification.sent",
+		cs.id,
+		map[string]interface{}{
+			"model":  cs.config.Model,
+			"vendor": cs.config.Vendor,
+			"reason": reason,
+		},
+	))
+
+	resp, err := cs.call(ocpp201.ActionBootNotification, &ocpp201.BootNotificationRequest{
+		ChargingStation: station,
+		Reason:          reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send boot notification: %w", err)
+	}
+
+	bootResp, ok := resp.(*ocpp201.BootNotificationResponse)
+	if !ok {
+		return fmt.Errorf("invalid boot notification response")
+	}
+
+	cs.handleBootNotificationResponse(bootResp, reason)
+	return nil
+}
+
+// handleBootNotificationResponse processes the CSMS answer to a BootNotification
+func (cs *ChargingStation) handleBootNotificationResponse(resp *ocpp201.BootNotificationResponse, reason string) {
+	status := RegistrationStatus(resp.Status)
+	oldStatus := cs.setRegistrationStatus(status)
+
+	switch status {
+	case RegistrationAccepted:
+		cs.logger.WithField("interval", resp.Interval).Info("Boot notification accepted by CSMS")
+		cs.stopBootRetry()
+		if resp.Interval > 0 && !cs.config.Boot.IgnoreInterval {
+			cs.deviceModel.Set(VariableHeartbeatInterval, strconv.Itoa(resp.Interval))
+		}
+	default:
+		cs.logger.WithFields(logrus.Fields{
+			"status":   resp.Status,
+			"interval": resp.Interval,
+		}).Warn("Boot notification not accepted")
+		cs.scheduleBootRetry(time.Duration(resp.Interval)*time.Second, reason)
+	}
+
+	// Messages queued while offline follow once the station may send them
+	if cs.checkRegistration(ocpp201.ActionTransactionEvent) == nil {
+		cs.ocppClient.ResumeQueue()
+	}
+
+	if oldStatus != status {
+		cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent(
+			"charger.registration.changed",
+			cs.id,
+			map[string]interface{}{
+				"old_status": string(oldStatus),
+				"new_status": string(status),
+				"interval":   resp.Interval,
+			},
+		))
+	}
+}
+
+// scheduleBootRetry re-sends the BootNotification after the given interval
+func (cs *ChargingStation) scheduleBootRetry(interval time.Duration, reason string) {
+	if cs.config.Boot.NoRetry {
+		return
+	}
+	if cs.config.Boot.RetryInterval > 0 {
+		interval = time.Duration(cs.config.Boot.RetryInterval) * time.Second
+	}
+	if interval <= 0 {
+		interval = defaultBootRetryInterval
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.bootRetry != nil {
+		cs.bootRetry.Stop()
+	}
+	cs.bootRetry = time.AfterFunc(interval, func() {
+		if cs.ctx.Err() != nil || !cs.IsConnected() {
+			return
+		}
+		cs.logger.Info("Retrying boot notification")
+		if err := cs.sendBootNotification(reason); err != nil {
+			cs.logger.WithError(err).Error("Failed to retry boot notification")
+			cs.scheduleBootRetry(interval, reason)
+		}
+	})
+}
+
+// stopBootRetry cancels a scheduled BootNotification retry
+func (cs *ChargingStation) stopBootRetry() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.bootRetry != nil {
+		cs.bootRetry.Stop()
+		cs.bootRetry = nil
+	}
+}
+
+// OnDisconnected is called by the OCPP client when the connection to the
+// CSMS is lost unexpectedly
+func (cs *ChargingStation) OnDisconnected(err error) {
+	cs.setStatus(StatusConnecting)
+
+	data := map[string]interface{}{}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent("charger.disconnected", cs.id, data))
+}
+
+// OnReconnected is called by the OCPP client once the connection to the CSMS
+// has been re-established. Unlike OCPP 1.6 the station keeps its
+// registration and only reports the status of every EVSE.
+func (cs *ChargingStation) OnReconnected(attempts int) {
+	go func() {
+		if cs.ctx.Err() != nil {
+			return
+		}
+
+		cs.sendAllStatusNotifications()
+		cs.setStatus(StatusConnected)
+
+		cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent(
+			"charger.reconnected",
+			cs.id,
+			map[string]interface{}{
+				"attempts":            attempts,
+				"registration_status": string(cs.GetRegistrationStatus()),
+			},
+		))
+	}()
+}
+
+// heartbeatLoop sends heartbeats every OCPPCommCtrlr.HeartbeatInterval seconds
+func (cs *ChargingStation) heartbeatLoop() {
+	cs.deviceModel.runLoop(cs.ctx, VariableHeartbeatInterval, func() {
+		if !cs.IsConnected() || cs.checkRegistration(ocpp201.ActionHeartbeat) != nil {
+			return
+		}
+		if err := cs.sendMessage(cs.messageIDs.NewMessageID(ocpp201.ActionHeartbeat), ocpp201.ActionHeartbeat, &ocpp201.HeartbeatRequest{}); err != nil {
+			cs.logger.WithError(err).Error("Failed to send heartbeat")
+		}
+	})
+}
+
+// statusLoop re-sends the status of every EVSE every
+// SimulatorCtrlr.StatusNotificationInterval seconds
+func (cs *ChargingStation) statusLoop() {
+	cs.deviceModel.runLoop(cs.ctx, VariableStatusNotificationInterval, func() {
+		if cs.checkRegistration(ocpp201.ActionStatusNotification) == nil {
+			cs.sendAllStatusNotifications()
+		}
+	})
+}
+
+// sendAllStatusNotifications reports the status of every EVSE
+func (cs *ChargingStation) sendAllStatusNotifications() {
+	for _, evse := range cs.GetConnectors() {
+		cs.mu.RLock()
+		status := evse.Status
+		cs.mu.RUnlock()
+
+		if err := cs.sendStatusNotification(evse.ID, status); err != nil {
+			cs.logger.WithError(err).WithField("evse_id", evse.ID).Error("Failed to send status notification")
+		}
+	}
+}
+
+// sendStatusNotification reports the status of the connector of an EVSE
+func (cs *ChargingStation) sendStatusNotification(evseID int, status ConnectorStatus) error {
+	req := &ocpp201.StatusNotificationRequest{
+		Timestamp:       time.Now(),
+		ConnectorStatus: connectorStatus(status),
+		EvseId:          evseID,
+		ConnectorId:     1,
+	}
+	if err := cs.sendMessage(cs.messageIDs.NewMessageID(ocpp201.ActionStatusNotification), ocpp201.ActionStatusNotification, req); err != nil {
+		return fmt.Errorf("failed to send status notification: %w", err)
+	}
+	return nil
+}
+
+// connectorStatus maps a connector status onto the OCPP 2.0.1 connector
+// status, which folds all transaction states into Occupied
+func connectorStatus(status ConnectorStatus) string {
+	switch status {
+	case ConnectorStatusAvailable, ConnectorStatusReserved, ConnectorStatusUnavailable, ConnectorStatusFaulted:
+		return string(status)
+	default:
+		return "Occupied"
+	}
+}
+
+// HandleMessage implements MessageHandler interface
+func (cs *ChargingStation) HandleMessage(ctx context.Context, message ocpp.Message) error {
+	msg, ok := message.(*ocpp201.Message)
+	if !ok {
+		return fmt.Errorf("unsupported message type")
+	}
+
+	switch msg.MessageType {
+	case "Call":
+		return dispatchCall(ctx, cs.ocppClient, cs.callHandlers, nil, cs.logger, msg)
+	case "CallResult":
+		return cs.handleCallResult(msg)
+	case "CallError":
+		cs.logger.WithFields(logrus.Fields{
+			"action": msg.Action,
+			"error":  msg.Payload,
+		}).Error("Received CallError from CSMS")
+		return nil
+	default:
+		return fmt.Errorf("unknown message type: %s", msg.MessageType)
+	}
+}
+
+// handleCallResult handles responses to messages sent without waiting
+func (cs *ChargingStation) handleCallResult(msg *ocpp201.Message) error {
+	switch msg.Action {
+	case ocpp201.ActionBootNotification:
+		resp, ok := msg.Payload.(*ocpp201.BootNotificationResponse)
+		if !ok {
+			return fmt.Errorf("invalid boot notification response")
+		}
+		cs.handleBootNotificationResponse(resp, "PowerUp")
+
+	case ocpp201.ActionTransactionEvent:
+		resp, ok := msg.Payload.(*ocpp201.TransactionEventResponse)
+		if !ok {
+			return fmt.Errorf("invalid transaction event response")
+		}
+		cs.confirmOfflineTransaction(msg.MessageID, resp)
+	}
+
+	return nil
+}
+
+// StartTransaction starts a locally initiated transaction on an EVSE. The
+// idTag is authorized with the CSMS first.
+func (cs *ChargingStation) StartTransaction(evseID int, idTag string) (*Transaction, error) {
+	return cs.startTransaction(evseID, ocpp201.IdToken{IdToken: idTag, Type: idTokenType}, true, nil)
+}
+
+// startTransaction authorizes the idToken if requested and reports the start
+// of the transaction with a TransactionEvent. remoteStartID is set for
+// transactions requested by the CSMS.
+func (cs *ChargingStation) startTransaction(evseID int, idToken ocpp201.IdToken, authorize bool, remoteStartID *int) (*Transaction, error) {
+	cs.logger.WithFields(logrus.Fields{
+		"evse_id":  evseID,
+		"id_token": idToken.IdToken,
+	}).Info("Starting transaction")
+
+	cs.mu.Lock()
+	if evseID < 1 || evseID > len(cs.evses) {
+		cs.mu.Unlock()
+		return nil, fmt.Errorf("invalid EVSE ID: %d", evseID)
+	}
+
+	evse := cs.evses[evseID-1]
+	if !evse.IsAvailable() {
+		cs.mu.Unlock()
+		return nil, fmt.Errorf("EVSE %d not available: %s", evseID, evse.Status)
+	}
+	evse.SetStatus(ConnectorStatusPreparing)
+
+	cs.nextTransactionID++
+	transaction := NewTransaction(cs.nextTransactionID, evseID, idToken.IdToken, cs.charging.register(evseID))
+	transaction.TransactionID = ocpp.NewUUID()
+	cs.mu.Unlock()
+
+	abort := func(reason string) {
+		cs.mu.Lock()
+		transaction.Fail(reason)
+		evse.SetStatus(ConnectorStatusAvailable)
+		cs.mu.Unlock()
+	}
+
+	offline := !cs.IsConnected()
+	if offline {
+		if authorize && !cs.deviceModel.GetBool(VariableOfflineTxForUnknownIdEnabled, false) {
+			abort("DeAuthorized")
+			return nil, fmt.Errorf("id token %s cannot be authorized while offline", idToken.IdToken)
+		}
+	} else if authorize {
+		status, err := cs.authorize(idToken)
+		if err != nil {
+			abort("AuthorizeFailed")
+			return nil, err
+		}
+		if status != "Accepted" {
+			abort("DeAuthorized")
+			return nil, fmt.Errorf("id token %s not authorized: %s", idToken.IdToken, status)
+		}
+	}
+
+	trigger := "Authorized"
+	if remoteStartID != nil {
+		trigger = "RemoteStart"
+	}
+
+	cs.mu.Lock()
+	req := cs.newTransactionEventLocked(transaction, ocpp201.TransactionEventStarted, trigger, transaction.MeterStart, "Transaction.Begin")
+	cs.mu.Unlock()
+	connectorID := 1
+	req.Evse = &ocpp201.EVSE{Id: evseID, ConnectorId: &connectorID}
+	req.IdToken = &idToken
+	req.TransactionInfo.RemoteStartId = remoteStartID
+
+	// Without a connection the Started event is queued by the OCPP client and
+	// the CSMS verdict on the idToken arrives after reconnecting
+	if offline {
+		messageID := cs.messageIDs.NewMessageID(ocpp201.ActionTransactionEvent)
+		if err := cs.sendMessage(messageID, ocpp201.ActionTransactionEvent, req); err != nil {
+			abort("StartFailed")
+			return nil, fmt.Errorf("failed to queue transaction event: %w", err)
+		}
+
+		cs.mu.Lock()
+		transaction.Offline = true
+		cs.transactions[transaction.ID] = transaction
+		cs.charging.start(transaction)
+		cs.offlineStarts[messageID] = transaction.ID
+		evse.SetStatus(ConnectorStatusCharging)
+		cs.mu.Unlock()
+
+		cs.publishTransactionStarted(transaction, "")
+		return transaction, nil
+	}
+
+	resp, err := cs.call(ocpp201.ActionTransactionEvent, req)
+	if err != nil {
+		abort("StartFailed")
+		return nil, fmt.Errorf("failed to send transaction event: %w", err)
+	}
+
+	eventResp, ok := resp.(*ocpp201.TransactionEventResponse)
+	if !ok {
+		abort("StartFailed")
+		return nil, fmt.Errorf("invalid transaction event response")
+	}
+
+	// The CSMS only includes idTokenInfo when it has a verdict on the token
+	status := "Accepted"
+	if eventResp.IdTokenInfo != nil {
+		status = eventResp.IdTokenInfo.Status
+	}
+
+	cs.mu.Lock()
+	transaction.IDTagStatus = status
+	cs.transactions[transaction.ID] = transaction
+	session := cs.charging.start(transaction)
+	evse.SetStatus(ConnectorStatusCharging)
+	cs.mu.Unlock()
+
+	cs.publishTransactionStarted(transaction, status)
+
+	if status != "Accepted" {
+		if cs.deviceModel.GetBool(VariableStopTxOnInvalidId, true) {
+			if err := cs.StopTransaction(transaction.ID, "DeAuthorized"); err != nil {
+				cs.logger.WithError(err).WithField("transaction_id", transaction.ID).Error("Failed to stop deauthorized transaction")
+			}
+			return transaction, fmt.Errorf("id token %s not accepted by CSMS: %s", idToken.IdToken, status)
+		}
+
+		session.suspend()
+		cs.mu.Lock()
+		evse.SetStatus(ConnectorStatusSuspendedEVSE)
+		cs.mu.Unlock()
+	}
+
+	return transaction, nil
+}
+
+// publishTransactionStarted logs and publishes the start of a transaction
+func (cs *ChargingStation) publishTransactionStarted(transaction *Transaction, idTokenStatus string) {
+	cs.logger.WithFields(logrus.Fields{
+		"transaction_id":      transaction.ID,
+		"ocpp_transaction_id": transaction.TransactionID,
+		"offline":             transaction.Offline,
+	}).Info("Transaction started")
+
+	data := map[string]interface{}{
+		"transaction_id":      transaction.ID,
+		"ocpp_transaction_id": transaction.TransactionID,
+		"connector_id":        transaction.ConnectorID,
+		"id_tag":              transaction.IDTag,
+	}
+	if transaction.Offline {
+		data["offline"] = true
+	} else {
+		data["id_tag_status"] = idTokenStatus
+	}
+
+	cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent("charger.transaction.started", cs.id, data))
+}
+
+// authorize sends an Authorize request and returns the IdTokenInfo status
+func (cs *ChargingStation) authorize(idToken ocpp201.IdToken) (string, error) {
+	resp, err := cs.call(ocpp201.ActionAuthorize, &ocpp201.AuthorizeRequest{IdToken: idToken})
+	if err != nil {
+		return "", fmt.Errorf("failed to authorize id token: %w", err)
+	}
+
+	authResp, ok := resp.(*ocpp201.AuthorizeResponse)
+	if !ok {
+		return "", fmt.Errorf("invalid authorize response")
+	}
+
+	return authResp.IdTokenInfo.Status, nil
+}
+
+// confirmOfflineTransaction applies the CSMS verdict on the idToken of a
+// transaction started offline once its Started event has been replayed
+func (cs *ChargingStation) confirmOfflineTransaction(messageID string, resp *ocpp201.TransactionEventResponse) {
+	cs.mu.Lock()
+	transactionID, exists := cs.offlineStarts[messageID]
+	if !exists {
+		cs.mu.Unlock()
+		return
+	}
+	delete(cs.offlineStarts, messageID)
+
+	status := "Accepted"
+	if resp.IdTokenInfo != nil {
+		status = resp.IdTokenInfo.Status
+	}
+	transaction := cs.transactions[transactionID]
+	transaction.IDTagStatus = status
+	active := transaction.IsActive()
+	cs.mu.Unlock()
+
+	cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent(
+		"charger.transaction.confirmed",
+		cs.id,
+		map[string]interface{}{
+			"transaction_id":      transactionID,
+			"ocpp_transaction_id": transaction.TransactionID,
+			"connector_id":        transaction.ConnectorID,
+			"id_tag_status":       status,
+		},
+	))
+
+	if active && status != "Accepted" && cs.deviceModel.GetBool(VariableStopTxOnInvalidId, true) {
+		if err := cs.StopTransaction(transactionID, "DeAuthorized"); err != nil {
+			cs.logger.WithError(err).WithField("transaction_id", transactionID).Error("Failed to stop deauthorized transaction")
+		}
+	}
+}
+
+// newTransactionEventLocked builds the next TransactionEvent of a transaction,
+// reporting the energy register in Wh. The caller must hold cs.mu.
+func (cs *ChargingStation) newTransactionEventLocked(transaction *Transaction, eventType, trigger string, meterValue int, readingContext string) *ocpp201.TransactionEventRequest {
+	seqNo := cs.seqNo[transaction.ID]
+	cs.seqNo[transaction.ID] = seqNo + 1
+
+	measurand := "Energy.Active.Import.Register"
+	return &ocpp201.TransactionEventRequest{
+		EventType:       eventType,
+		Timestamp:       time.Now(),
+		TriggerReason:   trigger,
+		SeqNo:           seqNo,
+		Offline:         !cs.IsConnected(),
+		TransactionInfo: ocpp201.Transaction{TransactionId: transaction.TransactionID},
+		MeterValue: []ocpp201.MeterValue{
+			{
+				Timestamp: time.Now(),
+				SampledValue: []ocpp201.SampledValue{
+					{
+						Value:         float64(meterValue),
+						Context:       &readingContext,
+						Measurand:     &measurand,
+						UnitOfMeasure: &ocpp201.UnitOfMeasure{Unit: "Wh"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// transactionByID finds a transaction by its OCPP 2.0.1 transactionId.
+// The caller must hold cs.mu.
+func (cs *ChargingStation) transactionByID(transactionID string) *Transaction {
+	for _, tx := range cs.transactions {
+		if tx.TransactionID == transactionID {
+			return tx
+		}
+	}
+	return nil
+}
+
+// StopTransaction ends a transaction with a TransactionEvent. OCPP 1.6 stop
+// reasons are translated to their OCPP 2.0.1 equivalent.
+func (cs *ChargingStation) StopTransaction(transactionID int, reason string) error {
+	return cs.stopTransaction(cs.ctx, transactionID, reason)
+}
+
+// stopTransaction stops a transaction, giving up when ctx ends while the
+// TransactionEvent waits for room in a full offline queue. The station is not
+// locked while the message is sent.
+func (cs *ChargingStation) stopTransaction(ctx context.Context, transactionID int, reason string) error {
+	cs.logger.WithFields(logrus.Fields{
+		"transaction_id": transactionID,
+		"reason":         reason,
+	}).Info("Stopping transaction")
+
+	cs.mu.Lock()
+
+	transaction, exists := cs.transactions[transactionID]
+	if !exists {
+		cs.mu.Unlock()
+		return fmt.Errorf("transaction %d not found", transactionID)
+	}
+	if !transaction.IsActive() || transaction.stopping {
+		cs.mu.Unlock()
+		return fmt.Errorf("transaction %d already stopped", transactionID)
+	}
+	evse := cs.evses[transaction.ConnectorID-1]
+
+	// Final meter value of the charging session, which ends once the
+	// TransactionEvent has been sent or queued
+	reading := cs.charging.finish(transaction, cs.sessionLimit)
+	meterStop := reading.meterWh()
+	stoppedReason := stoppedReason(reason)
+
+	req := cs.newTransactionEventLocked(transaction, ocpp201.TransactionEventEnded, stopTrigger(stoppedReason), meterStop, "Transaction.End")
+	req.TransactionInfo.StoppedReason = &stoppedReason
+
+	transaction.stopping = true
+	cs.mu.Unlock()
+
+	err := cs.sendMessageContext(ctx, cs.messageIDs.NewMessageID(ocpp201.ActionTransactionEvent), ocpp201.ActionTransactionEvent, req)
+
+	cs.mu.Lock()
+	transaction.stopping = false
+	if err != nil {
+		cs.mu.Unlock()
+		return fmt.Errorf("failed to send transaction event: %w", err)
+	}
+
+	cs.charging.end(transaction, reading)
+	transaction.Complete(meterStop, stoppedReason)
+	delete(cs.seqNo, transactionID)
+	evse.SetStatus(ConnectorStatusFinishing)
+
+	// A Reset OnIdle runs once the last transaction has ended
+	reset := false
+	if cs.resetScheduled {
+		reset = true
+		for _, tx := range cs.transactions {
+			if tx.IsActive() {
+				reset = false
+			}
+		}
+		cs.resetScheduled = !reset
+	}
+	cs.mu.Unlock()
+
+	go func() {
+		time.Sleep(2 * time.Second)
+		cs.mu.Lock()
+		evse.SetStatus(ConnectorStatusAvailable)
+		cs.mu.Unlock()
+	}()
+
+	cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent(
+		"charger.transaction.stopped",
+		cs.id,
+		map[string]interface{}{
+			"transaction_id":      transactionID,
+			"ocpp_transaction_id": transaction.TransactionID,
+			"connector_id":        transaction.ConnectorID,
+			"meter_stop":          meterStop,
+			"reason":              stoppedReason,
+		},
+	))
+
+	if reset {
+		go cs.reboot()
+	}
+
+	return nil
+}
+
+// stoppedReasons lists the OCPP 2.0.1 transaction stopped reasons
+var stoppedReasons = map[string]bool{
+	"DeAuthorized": true, "EmergencyStop": true, "EnergyLimitReached": true, "EVDisconnected": true,
+	"GroundFault": true, "ImmediateReset": true, "Local": true, "LocalOutOfCredit": true,
+	"MasterPass": true, "Other": true, "OvercurrentFault": true, "PowerLoss": true,
+	"PowerQuality": true, "Reboot": true, "Remote": true, "SOCLimitReached": true,
+	"StoppedByEV": true, "TimeLimitReached": true, "Timeout": true,
+}
+
+// stoppedReason translates a stop reason into an OCPP 2.0.1 stopped reason
+func stoppedReason(reason string) string {
+	switch {
+	case stoppedReasons[reason]:
+		return reason
+	case reason == "HardReset" || reason == "SoftReset":
+		return "ImmediateReset"
+	default:
+		return "Other"
+	}
+}
+
+// stopTrigger returns the TransactionEvent trigger reason for a stopped reason
+func stopTrigger(stoppedReason string) string {
+	switch stoppedReason {
+	case "Remote":
+		return "RemoteStop"
+	case "DeAuthorized":
+		return "Deauthorized"
+	case "ImmediateReset":
+		return "ResetCommand"
+	case "EVDisconnected":
+		return "EVCommunicationLost"
+	default:
+		return "StopAuthorized"
+	}
+}
+
+// SendMeterValues reports the energy register of an active transaction with
+// an Updated TransactionEvent, along with power, current, voltage and SoC of
+// its charging session
+func (cs *ChargingStation) SendMeterValues(transactionID int, meterValue int) error {
+	cs.mu.Lock()
+	transaction, exists := cs.transactions[transactionID]
+	if !exists {
+		cs.mu.Unlock()
+		return fmt.Errorf("transaction %d not found", transactionID)
+	}
+	if !transaction.IsActive() {
+		cs.mu.Unlock()
+		return fmt.Errorf("transaction %d is not active", transactionID)
+	}
+	req := cs.newTransactionEventLocked(transaction, ocpp201.TransactionEventUpdated, "MeterValuePeriodic", meterValue, "Sample.Periodic")
+	if session, exists := cs.charging.sessions[transactionID]; exists {
+		reading := session.reading()
+		reading.EnergyWh = float64(meterValue)
+		req.MeterValue[0].SampledValue = transactionEventSampledValues(reading, "Sample.Periodic")
+	}
+	cs.mu.Unlock()
+
+	if err := cs.sendMessage(cs.messageIDs.NewMessageID(ocpp201.ActionTransactionEvent), ocpp201.ActionTransactionEvent, req); err != nil {
+		return fmt.Errorf("failed to send meter values: %w", err)
+	}
+
+	cs.logger.WithFields(logrus.Fields{
+		"transaction_id": transactionID,
+		"meter_value":    meterValue,
+	}).Debug("Sent meter values")
+
+	return nil
+}
+
+// transactionEventSampledValues converts a meter reading into OCPP 2.0.1
+// sampled values
+func transactionEventSampledValues(reading meterReading, readingContext string) []ocpp201.SampledValue {
+	samples := reading.samples()
+	values := make([]ocpp201.SampledValue, 0, len(samples))
+	for _, sample := range samples {
+		sample := sample
+		value := ocpp201.SampledValue{
+			Value:         sample.value,
+			Context:       &readingContext,
+			Measurand:     &sample.measurand,
+			Location:      &sample.location,
+			UnitOfMeasure: &ocpp201.UnitOfMeasure{Unit: sample.unit},
+		}
+		if sample.phase != "" {
+			value.Phase = &sample.phase
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// PlugInEV connects an EV to an EVSE; the next transaction on the EVSE
+// charges it. Without one every transaction draws an EV from the configured
+// fleet.
+func (cs *ChargingStation) PlugInEV(evseID int, ev EVModel) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if evseID < 1 || evseID > len(cs.evses) {
+		return fmt.Errorf("invalid EVSE ID: %d", evseID)
+	}
+	cs.charging.evs[evseID] = ev
+	return nil
+}
+
+// sessionLimit is the chargingLimit of ChargingStation sessions, which only
+// the rated power of the station limits
+func (cs *ChargingStation) sessionLimit(connectorID int, tx chargingContext, t time.Time) (float64, int) {
+	return cs.config.ratedPowerW(), 0
+}
+
+// advanceCharging steps a session up to now and reports changes of its
+// charging state with an Updated TransactionEvent
+func (cs *ChargingStation) advanceCharging(s *chargingSession, now time.Time) {
+	update := s.advance(now, cs.sessionLimit)
+	if update.state == update.previousState {
+		return
+	}
+
+	if update.state == chargingStateSuspendedEV && s.ev.Full() {
+		cs.eventBus.Publish(cs.ctx, eventbus.NewChargerEvent("charger.ev.full", cs.id, map[string]interface{}{
+			"connector_id": s.connectorID,
+			"soc":          s.ev.SoC(),
+			"meter_wh":     s.meterWh(),
+		}))
+	}
+
+	cs.mu.Lock()
+	transaction, exists := cs.transactions[s.localID]
+	if !exists || !transaction.IsActive() {
+		cs.mu.Unlock()
+		return
+	}
+	req := cs.newTransactionEventLocked(transaction, ocpp201.TransactionEventUpdated, "ChargingStateChanged", s.meterWh(), "Sample.Periodic")
+	state := string(update.state)
+	req.TransactionInfo.ChargingState = &state
+	cs.mu.Unlock()
+
+	if err := cs.sendMessage(cs.messageIDs.NewMessageID(ocpp201.ActionTransactionEvent), ocpp201.ActionTransactionEvent, req); err != nil {
+		cs.logger.WithError(err).WithField("transaction_id", s.localID).Error("Failed to report charging state")
+	}
+}
+
+// SimulateCharging simulates a charging session with periodic meter updates
+// sent every SampledDataCtrlr.TxUpdatedInterval seconds. The EV draws up to
+// powerKW, 0 for as much as it accepts. It returns early once the EV is full.
+func (cs *ChargingStation) SimulateCharging(ctx context.Context, transactionID int, duration time.Duration, powerKW float64) error {
+	cs.mu.RLock()
+	_, exists := cs.transactions[transactionID]
+	session := cs.charging.sessions[transactionID]
+	cs.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("transaction %d not found", transactionID)
+	}
+	if session == nil {
+		return fmt.Errorf("transaction %d is not active", transactionID)
+	}
+	session.setCap(powerKW * 1000)
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	// Report charging state changes between meter samples and stop once the EV is full
+	full := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(chargingStep)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				cs.advanceCharging(session, now)
+				if session.ev.Full() {
+					close(full)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	sendMeterValues := func() {
+		cs.advanceCharging(session, time.Now())
+		if err := cs.SendMeterValues(transactionID, session.meterWh()); err != nil {
+			cs.logger.WithError(err).Error("Failed to send meter values")
+		}
+	}
+	cs.deviceModel.runLoop(ctx, VariableTxUpdatedInterval, sendMeterValues)
+
+	select {
+	case <-full:
+		sendMeterValues()
+		return nil
+	default:
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// reboot re-registers with the CSMS after a Reset and reports every EVSE
+func (cs *ChargingStation) reboot() {
+	cs.logger.Info("Rebooting charging station")
+
+	if err := cs.sendBootNotification("RemoteReset"); err != nil {
+		cs.logger.WithError(err).Error("Failed to send boot notification after reset")
+		return
+	}
+	cs.sendAllStatusNotifications()
+}
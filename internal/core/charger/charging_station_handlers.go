@@ -0,0 +1,220 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/ocpp201"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// registerCallHandlers sets up the handlers for CSMS-initiated Calls
+func (cs *ChargingStation) registerCallHandlers() {
+	cs.callHandlers = map[string]callHandler{
+		ocpp201.ActionGetBaseReport:           cs.handleGetBaseReport,
+		ocpp201.ActionGetVariables:            cs.handleGetVariables,
+		ocpp201.ActionSetVariables:            cs.handleSetVariables,
+		ocpp201.ActionRequestStartTransaction: cs.handleRequestStartTransaction,
+		ocpp201.ActionRequestStopTransaction:  cs.handleRequestStopTransaction,
+		ocpp201.ActionReset:                   cs.handleReset,
+	}
+}
+
+// decodeRequest unmarshals an OCPP 2.0.1 Call payload, reporting failures as FormatViolation
+func decodeRequest(payload json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ocpp.NewCallError(ocpp201.ErrorCodeFormatViolation, err.Error())
+	}
+	return nil
+}
+
+// handleGetVariables reports device model variables to the CSMS
+func (cs *ChargingStation) handleGetVariables(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp201.GetVariablesRequest
+	if err := decodeRequest(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	resp := &ocpp201.GetVariablesResponse{}
+	for _, data := range req.GetVariableData {
+		resp.GetVariableResult = append(resp.GetVariableResult, cs.deviceModel.getVariable(data))
+	}
+
+	return resp, nil, nil
+}
+
+// handleSetVariables updates device model variables on request of the CSMS
+func (cs *ChargingStation) handleSetVariables(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp201.SetVariablesRequest
+	if err := decodeRequest(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	resp := &ocpp201.SetVariablesResponse{}
+	for _, data := range req.SetVariableData {
+		result := cs.deviceModel.setVariable(data)
+		resp.SetVariableResult = append(resp.SetVariableResult, result)
+
+		key := deviceModelKey(data.Component, data.Variable)
+		cs.logger.WithFields(logrus.Fields{
+			"variable": key,
+			"value":    data.AttributeValue,
+			"status":   result.AttributeStatus,
+		}).Info("Variable change requested by CSMS")
+
+		if result.AttributeStatus == AttributeAccepted || result.AttributeStatus == AttributeRebootRequired {
+			cs.eventBus.Publish(ctx, eventbus.NewChargerEvent(
+				"charger.configuration.changed",
+				cs.id,
+				map[string]interface{}{
+					"key":    key,
+					"value":  data.AttributeValue,
+					"status": result.AttributeStatus,
+				},
+			))
+		}
+	}
+
+	return resp, nil, nil
+}
+
+// handleGetBaseReport accepts a report request and sends the device model in
+// a NotifyReport after the response
+func (cs *ChargingStation) handleGetBaseReport(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp201.GetBaseReportRequest
+	if err := decodeRequest(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	switch req.ReportBase {
+	case "ConfigurationInventory", "FullInventory", "SummaryInventory":
+	default:
+		return &ocpp201.GetBaseReportResponse{Status: "NotSupported"}, nil, nil
+	}
+
+	report := func() {
+		_, err := cs.call(ocpp201.ActionNotifyReport, &ocpp201.NotifyReportRequest{
+			RequestId:   req.RequestId,
+			GeneratedAt: time.Now(),
+			ReportData:  cs.deviceModel.report(),
+		})
+		if err != nil {
+			cs.logger.WithError(err).WithField("request_id", req.RequestId).Error("Failed to send report")
+		}
+	}
+
+	return &ocpp201.GetBaseReportResponse{Status: "Accepted"}, report, nil
+}
+
+// handleRequestStartTransaction starts a transaction on request of the CSMS
+func (cs *ChargingStation) handleRequestStartTransaction(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp201.RequestStartTransactionRequest
+	if err := decodeRequest(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if cs.GetRegistrationStatus() != RegistrationAccepted {
+		return &ocpp201.RequestStartTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	evseID := 0
+	cs.mu.RLock()
+	if req.EvseId != nil {
+		if *req.EvseId >= 1 && *req.EvseId <= len(cs.evses) && cs.evses[*req.EvseId-1].IsAvailable() {
+			evseID = *req.EvseId
+		}
+	} else {
+		for _, evse := range cs.evses {
+			if evse.IsAvailable() {
+				evseID = evse.ID
+				break
+			}
+		}
+	}
+	cs.mu.RUnlock()
+
+	if evseID == 0 {
+		return &ocpp201.RequestStartTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	// AuthorizeRemoteStart decides whether the idToken is authorized first
+	authorize := cs.deviceModel.GetBool(VariableAuthorizeRemoteStart, false)
+	remoteStartID := req.RemoteStartId
+	start := func() {
+		if _, err := cs.startTransaction(evseID, req.IdToken, authorize, &remoteStartID); err != nil {
+			cs.logger.WithError(err).WithField("evse_id", evseID).Error("Failed to start remote transaction")
+		}
+	}
+
+	return &ocpp201.RequestStartTransactionResponse{Status: "Accepted"}, start, nil
+}
+
+// handleRequestStopTransaction stops a transaction on request of the CSMS
+func (cs *ChargingStation) handleRequestStopTransaction(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp201.RequestStopTransactionRequest
+	if err := decodeRequest(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	cs.mu.RLock()
+	transaction := cs.transactionByID(req.TransactionId)
+	active := transaction != nil && transaction.IsActive()
+	cs.mu.RUnlock()
+
+	if !active {
+		return &ocpp201.RequestStopTransactionResponse{Status: "Rejected"}, nil, nil
+	}
+
+	transactionID := transaction.ID
+	stop := func() {
+		if err := cs.StopTransaction(transactionID, "Remote"); err != nil {
+			cs.logger.WithError(err).WithField("transaction_id", transactionID).Error("Failed to stop remote transaction")
+		}
+	}
+
+	return &ocpp201.RequestStopTransactionResponse{Status: "Accepted"}, stop, nil
+}
+
+// handleReset reboots the charging station. An Immediate reset ends running
+// transactions, an OnIdle reset waits until the last transaction has ended.
+func (cs *ChargingStation) handleReset(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp201.ResetRequest
+	if err := decodeRequest(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if req.Type != "Immediate" && req.Type != "OnIdle" {
+		return nil, nil, ocpp.NewCallError(ocpp.ErrorCodePropertyConstraintViolation, fmt.Sprintf("invalid reset type: %s", req.Type))
+	}
+
+	// Resetting a single EVSE is not supported
+	if req.EvseId != nil {
+		return &ocpp201.ResetResponse{Status: "Rejected"}, nil, nil
+	}
+
+	active := cs.activeTransactions()
+	scheduled := req.Type == "OnIdle" && len(active) > 0
+
+	cs.mu.Lock()
+	cs.resetScheduled = scheduled
+	cs.mu.Unlock()
+
+	if scheduled {
+		return &ocpp201.ResetResponse{Status: "Scheduled"}, nil, nil
+	}
+
+	reset := func() {
+		for _, tx := range active {
+			if err := cs.StopTransaction(tx.ID, "ImmediateReset"); err != nil {
+				cs.logger.WithError(err).WithField("transaction_id", tx.ID).Error("Failed to stop transaction for reset")
+			}
+		}
+		cs.reboot()
+	}
+
+	return &ocpp201.ResetResponse{Status: "Accepted"}, reset, nil
+}
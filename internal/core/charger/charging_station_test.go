@@ -0,0 +1,289 @@
+package charger
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/ocpp201"
+    "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// newTestChargingStation creates an OCPP 2.0.1 station wired to a mock client
+// answering like a CSMS accepting everything
+func newTestChargingStation(evses int) (*ChargingStation, *mockClient) {
+    client := newMockClient()
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        if action == ocpp201.ActionAuthorize {
+            return &ocpp201.AuthorizeResponse{IdTokenInfo: ocpp201.IdTokenInfo{Status: "Accepted"}}, nil
+        }
+        return ocpp201.DecodeCallResult(action, []byte("{}"))
+    }
+
+    cs := NewChargingStation(ChargerConfig{
+        Identifier:     "CS001",
+        Model:          "TestModel",
+        Vendor:         "TestVendor",
+        ConnectorCount: evses,
+        OCPPVersion:    ocpp201.Version,
+        CSMSEndpoint:   "ws://localhost:8080/ocpp",
+    }, eventbus.NewInMemoryBus())
+    cs.ocppClient = client
+    cs.setRegistrationStatus(RegistrationAccepted)
+    client.SetMessageHandler(cs)
+    return cs, client
+}
+
+func TestNew_SelectsOCPPVersion(t *testing.T) {
+    bus := eventbus.NewInMemoryBus()
+
+    station, err := New(ChargerConfig{OCPPVersion: "2.0.1"}, bus)
+    require.NoError(t, err)
+    assert.IsType(t, &ChargingStation{}, station)
+
+    vc, err := New(ChargerConfig{OCPPVersion: "1.6"}, bus)
+    require.NoError(t, err)
+    assert.IsType(t, &VirtualCharger{}, vc)
+
+    _, err = New(ChargerConfig{Identifier: "CP001", OCPPVersion: "2.0"}, bus)
+    assert.ErrorContains(t, err, `unsupported OCPP version "2.0"`)
+
+    // Every version has a single charger
+    assert.Panics(t, func() { RegisterCharger(ocpp201.Version, nil) })
+    _, err = lookupCharger("2.0")
+    assert.ErrorContains(t, err, `no charger registered for OCPP version "2.0"`)
+}
+
+func TestChargingStation_TransactionEvents(t *testing.T) {
+    cs, client := newTestChargingStation(2)
+
+    tx, err := cs.StartTransaction(2, "TAG001")
+    require.NoError(t, err)
+    assert.NotEmpty(t, tx.TransactionID)
+    assert.Equal(t, ConnectorStatusCharging, cs.GetConnectors()[1].Status)
+
+    require.Len(t, client.sentCalls(ocpp201.ActionAuthorize), 1)
+
+    require.NoError(t, cs.SendMeterValues(tx.ID, 1200))
+    require.NoError(t, cs.StopTransaction(tx.ID, "Remote"))
+
+    events := client.sentCalls(ocpp201.ActionTransactionEvent)
+    require.Len(t, events, 3)
+
+    started := events[0].Payload.(*ocpp201.TransactionEventRequest)
+    assert.Equal(t, ocpp201.TransactionEventStarted, started.EventType)
+    assert.Equal(t, 0, started.SeqNo)
+    assert.Equal(t, tx.TransactionID, started.TransactionInfo.TransactionId)
+    require.NotNil(t, started.Evse)
+    assert.Equal(t, 2, started.Evse.Id)
+    assert.Equal(t, "TAG001", started.IdToken.IdToken)
+
+    updated := events[1].Payload.(*ocpp201.TransactionEventRequest)
+    assert.Equal(t, ocpp201.TransactionEventUpdated, updated.EventType)
+    assert.Equal(t, 1, updated.SeqNo)
+    assert.Equal(t, 1200.0, updated.MeterValue[0].SampledValue[0].Value)
+
+    ended := events[2].Payload.(*ocpp201.TransactionEventRequest)
+    assert.Equal(t, ocpp201.TransactionEventEnded, ended.EventType)
+    assert.Equal(t, 2, ended.SeqNo)
+    assert.Equal(t, "RemoteStop", ended.TriggerReason)
+    assert.Equal(t, "Remote", *ended.TransactionInfo.StoppedReason)
+}
+
+func TestChargingStation_StopsTransactionRejectedByCSMS(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        switch action {
+        case ocpp201.ActionAuthorize:
+            return &ocpp201.AuthorizeResponse{IdTokenInfo: ocpp201.IdTokenInfo{Status: "Accepted"}}, nil
+        case ocpp201.ActionTransactionEvent:
+            return &ocpp201.TransactionEventResponse{IdTokenInfo: &ocpp201.IdTokenInfo{Status: "Blocked"}}, nil
+        }
+        return ocpp201.DecodeCallResult(action, []byte("{}"))
+    }
+
+    tx, err := cs.StartTransaction(1, "TAG001")
+    assert.Error(t, err)
+    require.NotNil(t, tx)
+    assert.False(t, tx.IsActive())
+    assert.Equal(t, "DeAuthorized", tx.Reason)
+}
+
+// blockingClient waits for its context on every message, like a client
+// whose offline queue is full
+type blockingClient struct {
+    *mockClient
+    sending chan struct{}
+}
+
+func (c *blockingClient) SendMessage(ctx context.Context, message ocpp.Message) error {
+    c.sending <- struct{}{}
+    <-ctx.Done()
+    return ctx.Err()
+}
+
+func TestChargingStation_StopWhileSendBlocks(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+    tx, err := cs.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    blocking := &blockingClient{mockClient: client, sending: make(chan struct{}, 1)}
+    cs.ocppClient = blocking
+
+    // The station is not locked while the TransactionEvent waits
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    done := make(chan struct{})
+    go func() {
+        cs.Stop(ctx)
+        close(done)
+    }()
+    <-blocking.sending
+    assert.Len(t, cs.GetConnectors(), 1)
+    assert.Error(t, cs.StopTransaction(tx.ID, "Local"))
+
+    // Stop gives up waiting once its context ends
+    select {
+    case <-done:
+    case <-time.After(2 * time.Second):
+        t.Fatal("Stop blocked on sending the TransactionEvent")
+    }
+    assert.True(t, tx.IsActive())
+    assert.Equal(t, StatusOffline, cs.GetStatus())
+
+    // The failed stop leaves the charging session running
+    cs.mu.RLock()
+    _, charging := cs.charging.sessions[tx.ID]
+    cs.mu.RUnlock()
+    assert.True(t, charging)
+}
+
+func TestChargingStation_Variables(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+
+    reply := deliverCall(t, cs, client, ocpp201.ActionSetVariables, map[string]interface{}{
+        "setVariableData": []map[string]interface{}{
+            {"component": map[string]string{"name": "OCPPCommCtrlr"}, "variable": map[string]string{"name": "HeartbeatInterval"}, "attributeValue": "120"},
+            {"component": map[string]string{"name": "OCPPCommCtrlr"}, "variable": map[string]string{"name": "HeartbeatInterval"}, "attributeValue": "soon"},
+            {"component": map[string]string{"name": "OCPPCommCtrlr"}, "variable": map[string]string{"name": "Unknown"}, "attributeValue": "1"},
+            {"component": map[string]string{"name": "NoSuchCtrlr"}, "variable": map[string]string{"name": "Enabled"}, "attributeValue": "1"},
+        },
+    })
+    require.Equal(t, "CallResult", reply.Kind)
+    var statuses []string
+    for _, result := range reply.Payload.(*ocpp201.SetVariablesResponse).SetVariableResult {
+        statuses = append(statuses, result.AttributeStatus)
+    }
+    assert.Equal(t, []string{AttributeAccepted, AttributeRejected, AttributeUnknownVariable, AttributeUnknownComponent}, statuses)
+
+    reply = deliverCall(t, cs, client, ocpp201.ActionGetVariables, map[string]interface{}{
+        "getVariableData": []map[string]interface{}{
+            {"component": map[string]string{"name": "OCPPCommCtrlr"}, "variable": map[string]string{"name": "HeartbeatInterval"}},
+            {"component": map[string]string{"name": "OCPPCommCtrlr"}, "variable": map[string]string{"name": "HeartbeatInterval"}, "attributeType": "Target"},
+        },
+    })
+    require.Equal(t, "CallResult", reply.Kind)
+    results := reply.Payload.(*ocpp201.GetVariablesResponse).GetVariableResult
+    require.Len(t, results, 2)
+    assert.Equal(t, AttributeAccepted, results[0].AttributeStatus)
+    assert.Equal(t, "120", *results[0].AttributeValue)
+    assert.Equal(t, AttributeNotSupportedAttributeType, results[1].AttributeStatus)
+}
+
+func TestChargingStation_GetBaseReport(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+
+    reply := deliverCall(t, cs, client, ocpp201.ActionGetBaseReport, map[string]interface{}{
+        "requestId":  7,
+        "reportBase": "FullInventory",
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp201.GetBaseReportResponse).Status)
+
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp201.ActionNotifyReport)) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    report := client.sentCalls(ocpp201.ActionNotifyReport)[0].Payload.(*ocpp201.NotifyReportRequest)
+    assert.Equal(t, 7, report.RequestId)
+    assert.Len(t, report.ReportData, len(defaultDeviceModel))
+
+    reply = deliverCall(t, cs, client, ocpp201.ActionGetBaseReport, map[string]interface{}{
+        "requestId":  8,
+        "reportBase": "Everything",
+    })
+    assert.Equal(t, "NotSupported", reply.Payload.(*ocpp201.GetBaseReportResponse).Status)
+}
+
+func TestChargingStation_RemoteStartAndStop(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+
+    reply := deliverCall(t, cs, client, ocpp201.ActionRequestStartTransaction, map[string]interface{}{
+        "remoteStartId": 42,
+        "idToken":       map[string]string{"idToken": "TAG001", "type": "Central"},
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp201.RequestStartTransactionResponse).Status)
+
+    assert.Eventually(t, func() bool {
+        return len(cs.activeTransactions()) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    started := client.sentCalls(ocpp201.ActionTransactionEvent)[0].Payload.(*ocpp201.TransactionEventRequest)
+    assert.Equal(t, "RemoteStart", started.TriggerReason)
+    assert.Equal(t, 42, *started.TransactionInfo.RemoteStartId)
+    assert.Empty(t, client.sentCalls(ocpp201.ActionAuthorize), "AuthorizeRemoteStart is false by default")
+
+    reply = deliverCall(t, cs, client, ocpp201.ActionRequestStopTransaction, map[string]interface{}{
+        "transactionId": started.TransactionInfo.TransactionId,
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp201.RequestStopTransactionResponse).Status)
+
+    assert.Eventually(t, func() bool {
+        return len(cs.activeTransactions()) == 0
+    }, time.Second, 10*time.Millisecond)
+}
+
+func TestChargingStation_ResetOnIdleWaitsForTransactions(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+
+    tx, err := cs.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    reply := deliverCall(t, cs, client, ocpp201.ActionReset, map[string]interface{}{"type": "OnIdle"})
+    assert.Equal(t, "Scheduled", reply.Payload.(*ocpp201.ResetResponse).Status)
+    assert.Empty(t, client.sentCalls(ocpp201.ActionBootNotification))
+
+    require.NoError(t, cs.StopTransaction(tx.ID, "Local"))
+
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp201.ActionBootNotification)) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    boot := client.sentCalls(ocpp201.ActionBootNotification)[0].Payload.(*ocpp201.BootNotificationRequest)
+    assert.Equal(t, "RemoteReset", boot.Reason)
+}
+
+func TestChargingStation_ChargingStateChanged(t *testing.T) {
+    cs, client := newTestChargingStation(1)
+    require.NoError(t, cs.PlugInEV(1, NewBatteryEV(EVProfile{BatteryCapacityKWh: 10, InitialSoC: 59, TargetSoC: 60, MaxDCPowerKW: 50}, CurrentTypeDC)))
+
+    tx, err := cs.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    cs.mu.RLock()
+    session := cs.charging.sessions[tx.ID]
+    cs.mu.RUnlock()
+    cs.advanceCharging(session, tx.StartTime.Add(time.Hour))
+    assert.Equal(t, 100, session.meterWh())
+
+    events := client.sentCalls(ocpp201.ActionTransactionEvent)
+    require.Len(t, events, 2)
+    updated := events[1].Payload.(*ocpp201.TransactionEventRequest)
+    assert.Equal(t, "ChargingStateChanged", updated.TriggerReason)
+    assert.Equal(t, "SuspendedEV", *updated.TransactionInfo.ChargingState)
+
+    require.NoError(t, cs.StopTransaction(tx.ID, "Local"))
+    ended := client.sentCalls(ocpp201.ActionTransactionEvent)[2].Payload.(*ocpp201.TransactionEventRequest)
+    assert.Equal(t, 100.0, ended.MeterValue[0].SampledValue[0].Value)
+}
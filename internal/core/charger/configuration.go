@@ -0,0 +1,440 @@
+package charger
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OCPP 1.6 feature profiles listed in SupportedFeatureProfiles
+const (
+	FeatureProfileCore                    = "Core"
+	FeatureProfileFirmwareManagement      = "FirmwareManagement"
+	FeatureProfileLocalAuthListManagement = "LocalAuthListManagement"
+	FeatureProfileRemoteTrigger           = "RemoteTrigger"
+	FeatureProfileReservation             = "Reservation"
+	FeatureProfileSmartCharging           = "SmartCharging"
+)
+
+// implementedFeatureProfiles are supported unless the charger config lists
+// its features
+var implementedFeatureProfiles = []string{
+	FeatureProfileCore,
+	FeatureProfileFirmwareManagement,
+	FeatureProfileLocalAuthListManagement,
+	FeatureProfileRemoteTrigger,
+	FeatureProfileReservation,
+	FeatureProfileSmartCharging,
+}
+
+// OCPP 1.6 configuration keys used by the virtual charger
+const (
+	KeyAllowOfflineTxForUnknownId        = "AllowOfflineTxForUnknownId"
+	KeyAuthorizationCacheEnabled         = "AuthorizationCacheEnabled"
+	KeyAuthorizeRemoteTxRequests         = "AuthorizeRemoteTxRequests"
+	KeyClockAlignedDataInterval          = "ClockAlignedDataInterval"
+	KeyConnectionTimeOut                 = "ConnectionTimeOut"
+	KeyConnectorPhaseRotation            = "ConnectorPhaseRotation"
+	KeyGetConfigurationMaxKeys           = "GetConfigurationMaxKeys"
+	KeyHeartbeatInterval                 = "HeartbeatInterval"
+	KeyLocalAuthorizeOffline             = "LocalAuthorizeOffline"
+	KeyLocalPreAuthorize                 = "LocalPreAuthorize"
+	KeyMeterValuesAlignedData            = "MeterValuesAlignedData"
+	KeyMeterValuesSampledData            = "MeterValuesSampledData"
+	KeyMeterValueSampleInterval          = "MeterValueSampleInterval"
+	KeyNumberOfConnectors                = "NumberOfConnectors"
+	KeyResetRetries                      = "ResetRetries"
+	KeyStopTransactionOnEVSideDisconnect = "StopTransactionOnEVSideDisconnect"
+	KeyStopTransactionOnInvalidId        = "StopTransactionOnInvalidId"
+	KeyStopTxnAlignedData                = "StopTxnAlignedData"
+	KeyStopTxnSampledData                = "StopTxnSampledData"
+	KeySupportedFeatureProfiles          = "SupportedFeatureProfiles"
+	KeyTransactionMessageAttempts        = "TransactionMessageAttempts"
+	KeyTransactionMessageRetryInterval   = "TransactionMessageRetryInterval"
+	KeyUnlockConnectorOnEVSideDisconnect = "UnlockConnectorOnEVSideDisconnect"
+	KeyWebSocketPingInterval             = "WebSocketPingInterval"
+
+	// Smart Charging profile
+	KeyChargeProfileMaxStackLevel              = "ChargeProfileMaxStackLevel"
+	KeyChargingScheduleAllowedChargingRateUnit = "ChargingScheduleAllowedChargingRateUnit"
+	KeyChargingScheduleMaxPeriods              = "ChargingScheduleMaxPeriods"
+	KeyMaxChargingProfilesInstalled            = "MaxChargingProfilesInstalled"
+
+	// Local Auth List Management profile
+	KeyLocalAuthListEnabled   = "LocalAuthListEnabled"
+	KeyLocalAuthListMaxLength = "LocalAuthListMaxLength"
+	KeySendLocalListMaxLength = "SendLocalListMaxLength"
+
+	// Reservation profile
+	KeyReserveConnectorZeroSupported = "ReserveConnectorZeroSupported"
+
+	// Security extension
+	KeyCertificateSignedMaxChainSize = "CertificateSignedMaxChainSize"
+	KeyCertificateStoreMaxLength     = "CertificateStoreMaxLength"
+	KeyCpoName                       = "CpoName"
+	KeySecurityProfile               = "SecurityProfile"
+
+	// KeyStatusNotificationInterval is a simulator-specific key controlling how
+	// often connector status is re-sent, 0 to only report changes. It is not
+	// part of OCPP 1.6.
+	KeyStatusNotificationInterval = "StatusNotificationInterval"
+)
+
+// ChangeConfiguration statuses
+const (
+	ConfigurationAccepted       = "Accepted"
+	ConfigurationRejected       = "Rejected"
+	ConfigurationRebootRequired = "RebootRequired"
+	ConfigurationNotSupported   = "NotSupported"
+)
+
+// configurationValueType describes how a configuration value is validated
+type configurationValueType int
+
+const (
+	configurationString configurationValueType = iota
+	configurationInteger
+	configurationBoolean
+	configurationList          // comma separated list
+	configurationMeasurandList // comma separated list of supported measurands
+)
+
+// ConfigurationKey represents a single OCPP configuration key
+type ConfigurationKey struct {
+	Key            string `json:"key"`
+	Value          string `json:"value"`
+	ReadOnly       bool   `json:"readonly"`
+	RebootRequired bool   `json:"reboot_required"`
+
+	valueType configurationValueType
+}
+
+// configurationDefinition describes a known key and its default value
+type configurationDefinition struct {
+	key            string
+	value          string
+	valueType      configurationValueType
+	readOnly       bool
+	rebootRequired bool
+}
+
+// defaultConfiguration lists the keys every virtual charger exposes
+var defaultConfiguration = []configurationDefinition{
+	{KeyAllowOfflineTxForUnknownId, "false", configurationBoolean, false, false},
+	{KeyAuthorizationCacheEnabled, "true", configurationBoolean, false, false},
+	{KeyAuthorizeRemoteTxRequests, "false", configurationBoolean, false, false},
+	{KeyClockAlignedDataInterval, "0", configurationInteger, false, false},
+	{KeyConnectionTimeOut, "60", configurationInteger, false, false},
+	{KeyConnectorPhaseRotation, "NotApplicable", configurationList, false, false},
+	{KeyGetConfigurationMaxKeys, "50", configurationInteger, true, false},
+	{KeyHeartbeatInterval, "30", configurationInteger, false, false},
+	{KeyLocalAuthorizeOffline, "true", configurationBoolean, false, false},
+	{KeyLocalPreAuthorize, "false", configurationBoolean, false, false},
+	{KeyMeterValuesAlignedData, "Energy.Active.Import.Register", configurationMeasurandList, false, false},
+	{KeyMeterValuesSampledData, "Energy.Active.Import.Register", configurationMeasurandList, false, false},
+	{KeyMeterValueSampleInterval, "30", configurationInteger, false, false},
+	{KeyNumberOfConnectors, "0", configurationInteger, true, false},
+	{KeyResetRetries, "3", configurationInteger, false, false},
+	{KeyStatusNotificationInterval, "0", configurationInteger, false, false},
+	{KeyStopTransactionOnEVSideDisconnect, "true", configurationBoolean, false, false},
+	{KeyStopTransactionOnInvalidId, "true", configurationBoolean, false, false},
+	{KeyStopTxnAlignedData, "", configurationMeasurandList, false, false},
+	{KeyStopTxnSampledData, "", configurationMeasurandList, false, false},
+	{KeySupportedFeatureProfiles, strings.Join(implementedFeatureProfiles, ","), configurationList, true, false},
+	{KeyTransactionMessageAttempts, "3", configurationInteger, false, false},
+	{KeyTransactionMessageRetryInterval, "60", configurationInteger, false, false},
+	{KeyUnlockConnectorOnEVSideDisconnect, "true", configurationBoolean, false, false},
+	{KeyWebSocketPingInterval, "0", configurationInteger, false, false},
+	{KeyChargeProfileMaxStackLevel, "10", configurationInteger, true, false},
+	{KeyChargingScheduleAllowedChargingRateUnit, "Current,Power", configurationList, true, false},
+	{KeyChargingScheduleMaxPeriods, "24", configurationInteger, true, false},
+	{KeyMaxChargingProfilesInstalled, "20", configurationInteger, true, false},
+	{KeyLocalAuthListEnabled, "true", configurationBoolean, false, false},
+	{KeyLocalAuthListMaxLength, "1000", configurationInteger, true, false},
+	{KeySendLocalListMaxLength, "100", configurationInteger, true, false},
+	{KeyReserveConnectorZeroSupported, "true", configurationBoolean, true, false},
+	{KeyCertificateSignedMaxChainSize, "10000", configurationInteger, true, false},
+	{KeyCertificateStoreMaxLength, "20", configurationInteger, true, false},
+	{KeyCpoName, "", configurationString, false, false},
+	{KeySecurityProfile, "0", configurationInteger, true, false},
+}
+
+// ConfigurationStore holds the OCPP configuration keys of a charger
+type ConfigurationStore struct {
+	keys    map[string]*ConfigurationKey
+	changed map[string]chan struct{}
+	mu      sync.RWMutex
+}
+
+// NewConfigurationStore creates a configuration store with the default keys,
+// overridden by the values in the charger config
+func NewConfigurationStore(config ChargerConfig) *ConfigurationStore {
+	store := newConfigurationStore(defaultConfiguration)
+
+	store.keys[KeyNumberOfConnectors].Value = strconv.Itoa(config.ConnectorCount)
+	store.keys[KeySecurityProfile].Value = strconv.Itoa(config.SecurityProfile)
+	if len(config.Features) > 0 {
+		store.keys[KeySupportedFeatureProfiles].Value = strings.Join(config.Features, ",")
+	}
+
+	// Seed values from the charger config; unknown keys become vendor keys
+	for key, value := range config.Configuration {
+		store.Set(key, value)
+	}
+
+	return store
+}
+
+// newConfigurationStore creates a store holding the given keys
+func newConfigurationStore(definitions []configurationDefinition) *ConfigurationStore {
+	store := &ConfigurationStore{
+		keys:    make(map[string]*ConfigurationKey),
+		changed: make(map[string]chan struct{}),
+	}
+
+	for _, def := range definitions {
+		store.keys[def.key] = &ConfigurationKey{
+			Key:            def.key,
+			Value:          def.value,
+			ReadOnly:       def.readOnly,
+			RebootRequired: def.rebootRequired,
+			valueType:      def.valueType,
+		}
+	}
+
+	return store
+}
+
+// Get returns the value of a key
+func (s *ConfigurationStore) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, exists := s.keys[key]
+	if !exists {
+		return "", false
+	}
+	return k.Value, true
+}
+
+// GetInt returns the integer value of a key, or fallback if unset or invalid
+func (s *ConfigurationStore) GetInt(key string, fallback int) int {
+	value, exists := s.Get(key)
+	if !exists {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// GetBool returns the boolean value of a key, or fallback if unset or invalid
+func (s *ConfigurationStore) GetBool(key string, fallback bool) bool {
+	value, exists := s.Get(key)
+	if !exists {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+// GetList returns the comma separated values of a key
+func (s *ConfigurationStore) GetList(key string) []string {
+	value, _ := s.Get(key)
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SupportsFeature reports whether SupportedFeatureProfiles lists a profile
+func (s *ConfigurationStore) SupportsFeature(profile string) bool {
+	for _, supported := range s.GetList(KeySupportedFeatureProfiles) {
+		if supported == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInterval returns a key holding seconds as a duration. Zero or negative
+// values mean the interval is disabled.
+func (s *ConfigurationStore) GetInterval(key string) time.Duration {
+	return time.Duration(s.GetInt(key, 0)) * time.Second
+}
+
+// Set stores a value without any validation, creating the key if needed.
+// It is used for values the charger itself decides on.
+func (s *ConfigurationStore) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, exists := s.keys[key]
+	if !exists {
+		k = &ConfigurationKey{Key: key}
+		s.keys[key] = k
+	}
+	k.Value = value
+	s.notifyLocked(key)
+}
+
+// Change applies a ChangeConfiguration request and returns its OCPP status
+func (s *ConfigurationStore) Change(key, value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, exists := s.keys[key]
+	if !exists {
+		return ConfigurationNotSupported
+	}
+	if k.ReadOnly || !k.valueType.valid(value) {
+		return ConfigurationRejected
+	}
+
+	k.Value = value
+	s.notifyLocked(key)
+
+	if k.RebootRequired {
+		return ConfigurationRebootRequired
+	}
+	return ConfigurationAccepted
+}
+
+// Keys returns the requested keys, or all keys when none are given, together
+// with the requested keys that are unknown
+func (s *ConfigurationStore) Keys(requested ...string) ([]ConfigurationKey, []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var known []ConfigurationKey
+	var unknown []string
+
+	if len(requested) == 0 {
+		for _, k := range s.keys {
+			known = append(known, *k)
+		}
+		sort.Slice(known, func(i, j int) bool { return known[i].Key < known[j].Key })
+		return known, nil
+	}
+
+	for _, key := range requested {
+		if k, exists := s.keys[key]; exists {
+			known = append(known, *k)
+		} else {
+			unknown = append(unknown, key)
+		}
+	}
+	return known, unknown
+}
+
+// Changed returns a channel that is closed the next time the key changes
+func (s *ConfigurationStore) Changed(key string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, exists := s.changed[key]
+	if !exists {
+		ch = make(chan struct{})
+		s.changed[key] = ch
+	}
+	return ch
+}
+
+// runLoop runs fn every interval given by a key in seconds until ctx is done.
+// Changes to the key take effect immediately, an interval of 0 pauses the loop.
+func (s *ConfigurationStore) runLoop(ctx context.Context, key string, fn func()) {
+	next := func(now time.Time, interval time.Duration) time.Time {
+		return now.Add(interval)
+	}
+	s.runScheduledLoop(ctx, key, next, func(time.Time) { fn() })
+}
+
+// runAlignedLoop is runLoop at the clock aligned times of the interval,
+// counted from midnight UTC. fn receives the aligned time.
+func (s *ConfigurationStore) runAlignedLoop(ctx context.Context, key string, fn func(time.Time)) {
+	s.runScheduledLoop(ctx, key, nextAlignedTime, fn)
+}
+
+// nextAlignedTime returns the first multiple of interval since midnight UTC
+// after now. Intervals that do not divide a day restart at midnight.
+func nextAlignedTime(now time.Time, interval time.Duration) time.Time {
+	midnight := now.Truncate(24 * time.Hour)
+	next := midnight.Add((now.Sub(midnight)/interval + 1) * interval)
+	if tomorrow := midnight.Add(24 * time.Hour); next.After(tomorrow) {
+		return tomorrow
+	}
+	return next
+}
+
+// runScheduledLoop runs fn at the times next derives from the interval given
+// by a key until ctx is done
+func (s *ConfigurationStore) runScheduledLoop(ctx context.Context, key string, next func(now time.Time, interval time.Duration) time.Time, fn func(time.Time)) {
+	for {
+		changed := s.Changed(key)
+		interval := s.GetInterval(key)
+
+		var tick <-chan time.Time
+		var timer *time.Timer
+		var at time.Time
+		if interval > 0 {
+			at = next(time.Now(), interval)
+			timer = time.NewTimer(time.Until(at))
+			tick = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-tick:
+			fn(at)
+		}
+	}
+}
+
+// notifyLocked wakes up everyone waiting for a change of key.
+// The caller must hold s.mu.
+func (s *ConfigurationStore) notifyLocked(key string) {
+	if ch, exists := s.changed[key]; exists {
+		close(ch)
+		delete(s.changed, key)
+	}
+}
+
+// valid reports whether value is acceptable for the value type
+func (t configurationValueType) valid(value string) bool {
+	switch t {
+	case configurationInteger:
+		n, err := strconv.Atoi(value)
+		return err == nil && n >= 0
+	case configurationBoolean:
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	case configurationMeasurandList:
+		for _, measurand := range strings.Split(value, ",") {
+			if measurand = strings.TrimSpace(measurand); measurand != "" && !supportedMeasurands[measurand] {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
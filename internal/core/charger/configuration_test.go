@@ -0,0 +1,72 @@
+package charger
+
+import (
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestConfigurationStore_Defaults(t *testing.T) {
+    store := NewConfigurationStore(ChargerConfig{
+        ConnectorCount: 2,
+        Features:       []string{"Core", "RemoteTrigger"},
+        Configuration: map[string]string{
+            KeyHeartbeatInterval: "120",
+            "VendorSpecificKey":  "on",
+        },
+    })
+
+    assert.Equal(t, 120, store.GetInt(KeyHeartbeatInterval, 0))
+    assert.Equal(t, 2, store.GetInt(KeyNumberOfConnectors, 0))
+    assert.Equal(t, []string{"Core", "RemoteTrigger"}, store.GetList(KeySupportedFeatureProfiles))
+    assert.Equal(t, 30*time.Second, store.GetInterval(KeyMeterValueSampleInterval))
+
+    value, exists := store.Get("VendorSpecificKey")
+    assert.True(t, exists)
+    assert.Equal(t, "on", value)
+}
+
+func TestConfigurationStore_Change(t *testing.T) {
+    store := NewConfigurationStore(ChargerConfig{ConnectorCount: 1})
+
+    assert.Equal(t, ConfigurationAccepted, store.Change(KeyHeartbeatInterval, "60"))
+    assert.Equal(t, ConfigurationRejected, store.Change(KeyHeartbeatInterval, "often"))
+    assert.Equal(t, ConfigurationRejected, store.Change(KeyAuthorizeRemoteTxRequests, "maybe"))
+    assert.Equal(t, ConfigurationRejected, store.Change(KeyNumberOfConnectors, "4"))
+    assert.Equal(t, ConfigurationNotSupported, store.Change("NoSuchKey", "1"))
+
+    assert.Equal(t, 60, store.GetInt(KeyHeartbeatInterval, 0))
+    assert.Equal(t, 1, store.GetInt(KeyNumberOfConnectors, 0))
+}
+
+func TestConfigurationStore_Changed(t *testing.T) {
+    store := NewConfigurationStore(ChargerConfig{})
+
+    changed := store.Changed(KeyHeartbeatInterval)
+    select {
+    case <-changed:
+        t.Fatal("channel closed before change")
+    default:
+    }
+
+    store.Change(KeyHeartbeatInterval, "5")
+    select {
+    case <-changed:
+    case <-time.After(time.Second):
+        t.Fatal("change not signalled")
+    }
+}
+
+func TestConfigurationStore_Keys(t *testing.T) {
+    store := NewConfigurationStore(ChargerConfig{})
+
+    known, unknown := store.Keys(KeyHeartbeatInterval, "Unknown")
+    assert.Len(t, known, 1)
+    assert.Equal(t, KeyHeartbeatInterval, known[0].Key)
+    assert.Equal(t, []string{"Unknown"}, unknown)
+
+    all, unknown := store.Keys()
+    assert.Len(t, all, len(defaultConfiguration))
+    assert.Empty(t, unknown)
+}
@@ -0,0 +1,275 @@
+package charger
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// ReconnectPolicy configures how a charger reconnects after losing its
+// connection to the CSMS. Durations are given in seconds; zero values fall
+// back to the client defaults.
+type ReconnectPolicy struct {
+	Disabled       bool    `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	InitialBackoff float64 `json:"initial_backoff,omitempty" yaml:"initial_backoff,omitempty"`
+	MaxBackoff     float64 `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	Multiplier     float64 `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	Jitter         float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	MaxAttempts    int     `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+}
+
+// Merge returns the policy with unset fields taken from defaults
+func (p ReconnectPolicy) Merge(defaults ReconnectPolicy) ReconnectPolicy {
+	if !p.Disabled {
+		p.Disabled = defaults.Disabled
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaults.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaults.MaxBackoff
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = defaults.Multiplier
+	}
+	if p.Jitter <= 0 {
+		p.Jitter = defaults.Jitter
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	return p
+}
+
+// clientConfig converts the policy into the OCPP client reconnect settings
+func (p ReconnectPolicy) clientConfig() ocpp.ReconnectConfig {
+	return ocpp.ReconnectConfig{
+		Disabled:       p.Disabled,
+		InitialBackoff: time.Duration(p.InitialBackoff * float64(time.Second)),
+		MaxBackoff:     time.Duration(p.MaxBackoff * float64(time.Second)),
+		Multiplier:     p.Multiplier,
+		Jitter:         p.Jitter,
+		MaxAttempts:    p.MaxAttempts,
+	}
+}
+
+// TLSPolicy configures wss:// connections to the CSMS. Certificate paths may
+// contain "{charger_id}" to give every charger its own certificate.
+type TLSPolicy struct {
+	CACert             string `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty"`               // PEM bundle trusted for the CSMS certificate
+	ClientCert         string `json:"client_cert,omitempty" yaml:"client_cert,omitempty"`       // Client certificate for security profile 3
+	ClientKey          string `json:"client_key,omitempty" yaml:"client_key,omitempty"`         // Key of the client certificate
+	ClientCACert       string `json:"client_ca_cert,omitempty" yaml:"client_ca_cert,omitempty"` // Issue client certificates from this CA
+	ClientCAKey        string `json:"client_ca_key,omitempty" yaml:"client_ca_key,omitempty"`
+	ServerName         string `json:"server_name,omitempty" yaml:"server_name,omitempty"` // SNI, defaults to the endpoint host
+	MinVersion         string `json:"min_version,omitempty" yaml:"min_version,omitempty"` // "1.0" to "1.3", defaults to "1.2"
+	MaxVersion         string `json:"max_version,omitempty" yaml:"max_version,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// tlsVersions maps the configurable TLS versions to crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion converts "1.2" into tls.VersionTLS12, "" into 0
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// Validate checks the TLS versions and that certificates come with their keys
+func (p TLSPolicy) Validate() error {
+	minVersion, err := parseTLSVersion(p.MinVersion)
+	if err != nil {
+		return fmt.Errorf("min_version: %w", err)
+	}
+	maxVersion, err := parseTLSVersion(p.MaxVersion)
+	if err != nil {
+		return fmt.Errorf("max_version: %w", err)
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return fmt.Errorf("min_version %s is above max_version %s", p.MinVersion, p.MaxVersion)
+	}
+	if (p.ClientCert == "") != (p.ClientKey == "") {
+		return fmt.Errorf("client_cert and client_key must be set together")
+	}
+	if (p.ClientCACert == "") != (p.ClientCAKey == "") {
+		return fmt.Errorf("client_ca_cert and client_ca_key must be set together")
+	}
+	return nil
+}
+
+// clientConfig converts the policy into the OCPP client TLS settings.
+// Invalid versions are rejected by Validate and fall back to the defaults.
+func (p TLSPolicy) clientConfig() ocpp.TLSConfig {
+	minVersion, _ := parseTLSVersion(p.MinVersion)
+	maxVersion, _ := parseTLSVersion(p.MaxVersion)
+	return ocpp.TLSConfig{
+		CACertFile:         p.CACert,
+		CertFile:           p.ClientCert,
+		KeyFile:            p.ClientKey,
+		ClientCACertFile:   p.ClientCACert,
+		ClientCAKeyFile:    p.ClientCAKey,
+		ServerName:         p.ServerName,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+	}
+}
+
+// KeepalivePolicy configures WebSocket pings on the connection to the CSMS.
+// The ping interval is the WebSocketPingInterval configuration key; durations
+// are given in seconds.
+type KeepalivePolicy struct {
+	PongTimeout float64 `json:"pong_timeout,omitempty" yaml:"pong_timeout,omitempty"` // Extra wait for a pong, defaults to the ping interval
+	ReadTimeout float64 `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty"` // Drop the connection after this long without any frame
+	IgnorePings bool    `json:"ignore_pings,omitempty" yaml:"ignore_pings,omitempty"` // Leave pings from the CSMS unanswered
+}
+
+// clientConfig converts the policy into the OCPP client keepalive settings
+func (p KeepalivePolicy) clientConfig() ocpp.KeepaliveConfig {
+	return ocpp.KeepaliveConfig{
+		PongTimeout: time.Duration(p.PongTimeout * float64(time.Second)),
+		ReadTimeout: time.Duration(p.ReadTimeout * float64(time.Second)),
+		IgnorePings: p.IgnorePings,
+	}
+}
+
+// PipelinePolicy sizes the message queues of the connection to the CSMS.
+// The write timeout is given in seconds; zero values fall back to the
+// client defaults.
+type PipelinePolicy struct {
+	OutboundQueueSize int     `json:"outbound_queue_size,omitempty" yaml:"outbound_queue_size,omitempty"` // Frames waiting to be written before senders block
+	InboundQueueSize  int     `json:"inbound_queue_size,omitempty" yaml:"inbound_queue_size,omitempty"`   // Frames waiting for the handler before reading blocks
+	WriteTimeout      float64 `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`             // Deadline for writing one frame
+}
+
+// clientConfig converts the policy into the OCPP client pipeline settings
+func (p PipelinePolicy) clientConfig() ocpp.PipelineConfig {
+	return ocpp.PipelineConfig{
+		OutboundQueueSize: p.OutboundQueueSize,
+		InboundQueueSize:  p.InboundQueueSize,
+		WriteTimeout:      time.Duration(p.WriteTimeout * float64(time.Second)),
+	}
+}
+
+// MessageIDPolicy selects how a charger generates the IDs of its messages.
+// The chaos rates repeat IDs to test how the CSMS deduplicates messages.
+type MessageIDPolicy struct {
+	Format        string  `json:"format,omitempty" yaml:"format,omitempty"`                 // "uuid" (default), "counter" or "prefixed"
+	ReuseRate     float64 `json:"reuse_rate,omitempty" yaml:"reuse_rate,omitempty"`         // Share of messages repeating a recent message ID
+	DuplicateRate float64 `json:"duplicate_rate,omitempty" yaml:"duplicate_rate,omitempty"` // Share of messages repeating the previous message ID
+}
+
+// Validate checks the format and the chaos rates
+func (p MessageIDPolicy) Validate() error {
+	return p.clientConfig("").Validate()
+}
+
+// clientConfig converts the policy into the OCPP message ID settings
+func (p MessageIDPolicy) clientConfig(chargerID string) ocpp.MessageIDConfig {
+	return ocpp.MessageIDConfig{
+		Format:        p.Format,
+		ChargerID:     chargerID,
+		ReuseRate:     p.ReuseRate,
+		DuplicateRate: p.DuplicateRate,
+	}
+}
+
+// watchPingInterval applies changes of the ping interval key to the client
+// until ctx is done
+func watchPingInterval(ctx context.Context, store *ConfigurationStore, key string, client ocpp.Client) {
+	controller, ok := client.(ocpp.KeepaliveController)
+	if !ok {
+		return
+	}
+	for {
+		changed := store.Changed(key)
+		controller.SetPingInterval(store.GetInterval(key))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// SetIgnorePings stops or resumes answering WebSocket pings from the CSMS, so
+// the CSMS sees a dead connection while the charger keeps sending messages
+func (vc *VirtualCharger) SetIgnorePings(ignore bool) {
+	if controller, ok := vc.ocppClient.(ocpp.KeepaliveController); ok {
+		controller.SetIgnorePings(ignore)
+	}
+}
+
+// KeepaliveStats returns the WebSocket ping statistics of the charger
+func (vc *VirtualCharger) KeepaliveStats() ocpp.KeepaliveStats {
+	if controller, ok := vc.ocppClient.(ocpp.KeepaliveController); ok {
+		return controller.KeepaliveStats()
+	}
+	return ocpp.KeepaliveStats{}
+}
+
+// PipelineStats returns the message queue statistics of the charger
+func (vc *VirtualCharger) PipelineStats() ocpp.PipelineStats {
+	if monitor, ok := vc.ocppClient.(ocpp.PipelineMonitor); ok {
+		return monitor.PipelineStats()
+	}
+	return ocpp.PipelineStats{}
+}
+
+// OnDisconnected is called by the OCPP client when the connection to the
+// CSMS is lost unexpectedly
+func (vc *VirtualCharger) OnDisconnected(err error) {
+	vc.setStatus(StatusConnecting)
+
+	data := map[string]interface{}{}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.disconnected", vc.id, data))
+}
+
+// OnReconnected is called by the OCPP client once the connection to the CSMS
+// has been re-established. The charger boots again and reports the status of
+// every connector.
+func (vc *VirtualCharger) OnReconnected(attempts int) {
+	go vc.resumeAfterReconnect(attempts)
+}
+
+// resumeAfterReconnect re-runs the boot sequence on a new connection
+func (vc *VirtualCharger) resumeAfterReconnect(attempts int) {
+	if vc.context().Err() != nil {
+		return
+	}
+
+	if err := vc.sendBootNotification(); err != nil {
+		vc.logger.WithError(err).Error("Failed to send boot notification after reconnect")
+	}
+
+	vc.setStatus(StatusConnected)
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
+		"charger.reconnected",
+		vc.id,
+		map[string]interface{}{
+			"attempts":            attempts,
+			"registration_status": string(vc.GetRegistrationStatus()),
+		},
+	))
+}
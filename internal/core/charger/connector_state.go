@@ -0,0 +1,480 @@
+package charger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// OCPP 1.6 ChargePointErrorCode values reported with a Faulted connector
+const (
+	ErrorCodeNoError              = "NoError"
+	ErrorCodeConnectorLockFailure = "ConnectorLockFailure"
+	ErrorCodeEVCommunicationError = "EVCommunicationError"
+	ErrorCodeGroundFailure        = "GroundFailure"
+	ErrorCodeHighTemperature      = "HighTemperature"
+	ErrorCodeInternalError        = "InternalError"
+	ErrorCodeLocalListConflict    = "LocalListConflict"
+	ErrorCodeOtherError           = "OtherError"
+	ErrorCodeOverCurrentFailure   = "OverCurrentFailure"
+	ErrorCodeOverVoltage          = "OverVoltage"
+	ErrorCodePowerMeterFailure    = "PowerMeterFailure"
+	ErrorCodePowerSwitchFailure   = "PowerSwitchFailure"
+	ErrorCodeReaderFailure        = "ReaderFailure"
+	ErrorCodeResetFailure         = "ResetFailure"
+	ErrorCodeUnderVoltage         = "UnderVoltage"
+	ErrorCodeWeakSignal           = "WeakSignal"
+)
+
+// faultErrorCodes are the error codes a connector can fault with
+var faultErrorCodes = map[string]bool{
+	ErrorCodeConnectorLockFailure: true,
+	ErrorCodeEVCommunicationError: true,
+	ErrorCodeGroundFailure:        true,
+	ErrorCodeHighTemperature:      true,
+	ErrorCodeInternalError:        true,
+	ErrorCodeLocalListConflict:    true,
+	ErrorCodeOtherError:           true,
+	ErrorCodeOverCurrentFailure:   true,
+	ErrorCodeOverVoltage:          true,
+	ErrorCodePowerMeterFailure:    true,
+	ErrorCodePowerSwitchFailure:   true,
+	ErrorCodeReaderFailure:        true,
+	ErrorCodeResetFailure:         true,
+	ErrorCodeUnderVoltage:         true,
+	ErrorCodeWeakSignal:           true,
+}
+
+// connectorTransitions lists the status changes the OCPP 1.6 connector state
+// machine allows, by current status
+var connectorTransitions = map[ConnectorStatus][]ConnectorStatus{
+	ConnectorStatusAvailable:     {ConnectorStatusPreparing, ConnectorStatusCharging, ConnectorStatusSuspendedEV, ConnectorStatusSuspendedEVSE, ConnectorStatusReserved, ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusPreparing:     {ConnectorStatusAvailable, ConnectorStatusCharging, ConnectorStatusSuspendedEV, ConnectorStatusSuspendedEVSE, ConnectorStatusFinishing, ConnectorStatusFaulted},
+	ConnectorStatusCharging:      {ConnectorStatusAvailable, ConnectorStatusSuspendedEV, ConnectorStatusSuspendedEVSE, ConnectorStatusFinishing, ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusSuspendedEV:   {ConnectorStatusAvailable, ConnectorStatusCharging, ConnectorStatusSuspendedEVSE, ConnectorStatusFinishing, ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusSuspendedEVSE: {ConnectorStatusAvailable, ConnectorStatusCharging, ConnectorStatusSuspendedEV, ConnectorStatusFinishing, ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusFinishing:     {ConnectorStatusAvailable, ConnectorStatusPreparing, ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusReserved:      {ConnectorStatusAvailable, ConnectorStatusPreparing, ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusUnavailable:   {ConnectorStatusAvailable, ConnectorStatusPreparing, ConnectorStatusCharging, ConnectorStatusSuspendedEV, ConnectorStatusSuspendedEVSE, ConnectorStatusFaulted},
+	ConnectorStatusFaulted:       {ConnectorStatusAvailable, ConnectorStatusPreparing, ConnectorStatusCharging, ConnectorStatusSuspendedEV, ConnectorStatusSuspendedEVSE, ConnectorStatusFinishing, ConnectorStatusReserved, ConnectorStatusUnavailable},
+}
+
+// chargePointTransitions lists the status changes of connector 0, which
+// stands for the charge point as a whole
+var chargePointTransitions = map[ConnectorStatus][]ConnectorStatus{
+	ConnectorStatusAvailable:   {ConnectorStatusUnavailable, ConnectorStatusFaulted},
+	ConnectorStatusUnavailable: {ConnectorStatusAvailable, ConnectorStatusFaulted},
+	ConnectorStatusFaulted:     {ConnectorStatusAvailable, ConnectorStatusUnavailable},
+}
+
+// validConnectorTransition reports whether a connector may change from one
+// status to another
+func validConnectorTransition(connectorID int, from, to ConnectorStatus) bool {
+	transitions := connectorTransitions
+	if connectorID == 0 {
+		transitions = chargePointTransitions
+	}
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectorBehavior configures deviations from the connector state machine,
+// used by chaos scenarios
+type ConnectorBehavior struct {
+	// AllowInvalidTransitions applies and reports status changes the OCPP 1.6
+	// state machine forbids instead of rejecting them
+	AllowInvalidTransitions bool `json:"allow_invalid_transitions,omitempty" yaml:"allow_invalid_transitions,omitempty"`
+}
+
+// statusNotification is a status change waiting to be reported to the CSMS
+type statusNotification struct {
+	connectorID int
+	previous    ConnectorStatus
+	status      ConnectorStatus
+	errorCode   string
+	timestamp   time.Time
+	forced      bool // The transition is not allowed by the state machine
+}
+
+// errorCode returns the error code reported with the connector status
+func (c *Connector) errorCode() string {
+	if c.ErrorCode == "" {
+		return ErrorCodeNoError
+	}
+	return c.ErrorCode
+}
+
+// sendConnectorStatus reports the current status of a connector
+func (vc *VirtualCharger) sendConnectorStatus(connector Connector) error {
+	return vc.sendStatusNotificationAt(connector.ID, string(connector.Status), connector.errorCode(), time.Now())
+}
+
+// connectorLocked returns a connector by ID, 0 for the charge point.
+// The caller must hold vc.mu.
+func (vc *VirtualCharger) connectorLocked(connectorID int) (*Connector, error) {
+	if connectorID == 0 {
+		return vc.chargePoint, nil
+	}
+	if connectorID < 0 || connectorID > len(vc.connectors) {
+		return nil, fmt.Errorf("invalid connector ID: %d", connectorID)
+	}
+	return vc.connectors[connectorID-1], nil
+}
+
+// setConnectorStatusLocked moves a connector to a new status and queues its
+// StatusNotification. Transitions the state machine forbids are rejected
+// unless the connector behavior allows them. The caller must hold vc.mu and
+// call flushStatusNotifications after releasing it.
+func (vc *VirtualCharger) setConnectorStatusLocked(connector *Connector, status ConnectorStatus, errorCode string) error {
+	if errorCode == "" {
+		errorCode = ErrorCodeNoError
+	}
+	if connector.Status == status && connector.errorCode() == errorCode {
+		return nil
+	}
+
+	valid := connector.Status == status || validConnectorTransition(connector.ID, connector.Status, status)
+	if !valid && !vc.config.ConnectorStates.AllowInvalidTransitions {
+		return fmt.Errorf("connector %d cannot change from %s to %s", connector.ID, connector.Status, status)
+	}
+
+	vc.statusQueue = append(vc.statusQueue, statusNotification{
+		connectorID: connector.ID,
+		previous:    connector.Status,
+		status:      status,
+		errorCode:   errorCode,
+		timestamp:   time.Now(),
+		forced:      !valid,
+	})
+	connector.SetStatus(status)
+	connector.ErrorCode = ""
+	if errorCode != ErrorCodeNoError {
+		connector.ErrorCode = errorCode
+	}
+	return nil
+}
+
+// flushStatusNotifications sends the queued status changes in order
+func (vc *VirtualCharger) flushStatusNotifications() {
+	vc.statusSendMu.Lock()
+	defer vc.statusSendMu.Unlock()
+
+	vc.mu.Lock()
+	pending := vc.statusQueue
+	vc.statusQueue = nil
+	vc.mu.Unlock()
+
+	for _, n := range pending {
+		if n.forced {
+			vc.logger.WithFields(logrus.Fields{
+				"connector_id": n.connectorID,
+				"from":         n.previous,
+				"to":           n.status,
+			}).Warn("Reporting invalid connector status transition")
+		}
+
+		vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.connector.status_changed", vc.id, map[string]interface{}{
+			"connector_id": n.connectorID,
+			"from":         string(n.previous),
+			"to":           string(n.status),
+			"error_code":   n.errorCode,
+			"forced":       n.forced,
+		}))
+
+		if err := vc.sendStatusNotificationAt(n.connectorID, string(n.status), n.errorCode, n.timestamp); err != nil {
+			vc.logger.WithError(err).WithFields(logrus.Fields{
+				"connector_id": n.connectorID,
+				"status":       n.status,
+			}).Error("Failed to send status notification")
+		}
+	}
+}
+
+// idleStatusLocked returns the status a connector without transaction
+// settles in: the availability the CSMS scheduled, Reserved while a
+// reservation holds it, Preparing while an EV is plugged in, Available
+// otherwise. The caller must hold vc.mu.
+func (vc *VirtualCharger) idleStatusLocked(connector *Connector) ConnectorStatus {
+	if scheduled, ok := vc.scheduledAvailability[connector.ID]; ok {
+		delete(vc.scheduledAvailability, connector.ID)
+		if scheduled == ConnectorStatusUnavailable {
+			return scheduled
+		}
+	}
+	if vc.connectorReservationLocked(connector.ID) != nil {
+		return ConnectorStatusReserved
+	}
+	if connector.PluggedIn {
+		return ConnectorStatusPreparing
+	}
+	return ConnectorStatusAvailable
+}
+
+// releaseConnectorLocked lets a connector whose transaction failed or ended
+// settle in its idle status, unplugging an EV StartTransaction plugged in.
+// The caller must hold vc.mu.
+func (vc *VirtualCharger) releaseConnectorLocked(connector *Connector) {
+	connector.starting = false
+	if connector.autoUnplug {
+		connector.PluggedIn = false
+		connector.autoUnplug = false
+	}
+	if err := vc.setConnectorStatusLocked(connector, vc.idleStatusLocked(connector), ""); err != nil {
+		vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to release connector")
+	}
+}
+
+// startableLocked reports whether a transaction may start on a connector:
+// it is idle, an EV may already be plugged in or a reservation hold it. The
+// caller must hold vc.mu.
+func (vc *VirtualCharger) startableLocked(connector *Connector) bool {
+	switch connector.Status {
+	case ConnectorStatusAvailable, ConnectorStatusPreparing, ConnectorStatusReserved:
+		return !connector.starting && vc.activeTransactionLocked(connector.ID) == nil
+	}
+	return false
+}
+
+// activeTransactionLocked is activeTransaction for callers holding vc.mu
+func (vc *VirtualCharger) activeTransactionLocked(connectorID int) *Transaction {
+	for _, tx := range vc.transactions {
+		if tx.ConnectorID == connectorID && tx.IsActive() {
+			return tx
+		}
+	}
+	return nil
+}
+
+// reportConnectorStatus sends the current status of the charge point and of
+// every connector, as after a boot
+func (vc *VirtualCharger) reportConnectorStatus() {
+	vc.mu.RLock()
+	connectors := make([]Connector, 0, len(vc.connectors)+1)
+	connectors = append(connectors, *vc.chargePoint)
+	for _, connector := range vc.connectors {
+		connectors = append(connectors, *connector)
+	}
+	vc.mu.RUnlock()
+
+	for _, connector := range connectors {
+		if err := vc.sendConnectorStatus(connector); err != nil {
+			vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to send status notification")
+		}
+	}
+}
+
+// PlugIn connects an EV to a connector. An idle connector becomes Preparing
+// and the next transaction on it starts without plugging in again.
+func (vc *VirtualCharger) PlugIn(connectorID int) error {
+	defer vc.flushStatusNotifications()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if connectorID < 1 || connectorID > len(vc.connectors) {
+		return fmt.Errorf("invalid connector ID: %d", connectorID)
+	}
+	connector := vc.connectors[connectorID-1]
+	if connector.PluggedIn {
+		return fmt.Errorf("an EV is already plugged into connector %d", connectorID)
+	}
+
+	// A reserved connector waits for the idTag of its reservation
+	if connector.Status == ConnectorStatusAvailable {
+		if err := vc.setConnectorStatusLocked(connector, ConnectorStatusPreparing, ""); err != nil {
+			return err
+		}
+	}
+	connector.PluggedIn = true
+	connector.autoUnplug = false
+	return nil
+}
+
+// PlugOut disconnects the EV from a connector. A running transaction is
+// stopped when StopTransactionOnEVSideDisconnect is set and suspended by the
+// EV otherwise.
+func (vc *VirtualCharger) PlugOut(connectorID int) error {
+	vc.mu.Lock()
+	if connectorID < 1 || connectorID > len(vc.connectors) {
+		vc.mu.Unlock()
+		return fmt.Errorf("invalid connector ID: %d", connectorID)
+	}
+	connector := vc.connectors[connectorID-1]
+	if !connector.PluggedIn {
+		vc.mu.Unlock()
+		return fmt.Errorf("no EV plugged into connector %d", connectorID)
+	}
+	connector.PluggedIn = false
+	connector.autoUnplug = false
+	tx := vc.activeTransactionLocked(connectorID)
+	var session *chargingSession
+	if tx != nil {
+		session = vc.charging.sessions[tx.ID]
+	}
+	vc.mu.Unlock()
+
+	if tx != nil {
+		if !vc.configuration.GetBool(KeyStopTransactionOnEVSideDisconnect, true) {
+			// The transaction goes on without an EV to charge
+			if session != nil {
+				vc.setEVSuspended(session, true)
+			}
+			return nil
+		}
+		if err := vc.StopTransaction(tx.ID, "EVDisconnected"); err != nil {
+			return err
+		}
+	}
+
+	defer vc.flushStatusNotifications()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	switch connector.Status {
+	case ConnectorStatusPreparing, ConnectorStatusFinishing:
+		return vc.setConnectorStatusLocked(connector, vc.idleStatusLocked(connector), "")
+	}
+	return nil
+}
+
+// SuspendEV makes the EV on a connector stop drawing energy while its
+// transaction goes on, the connector becomes SuspendedEV
+func (vc *VirtualCharger) SuspendEV(connectorID int) error {
+	session, err := vc.connectorSession(connectorID)
+	if err != nil {
+		return err
+	}
+	vc.setEVSuspended(session, true)
+	return nil
+}
+
+// ResumeEV lets the EV on a connector draw energy again after SuspendEV
+func (vc *VirtualCharger) ResumeEV(connectorID int) error {
+	session, err := vc.connectorSession(connectorID)
+	if err != nil {
+		return err
+	}
+	vc.setEVSuspended(session, false)
+	return nil
+}
+
+// connectorSession returns the charging session running on a connector
+func (vc *VirtualCharger) connectorSession(connectorID int) (*chargingSession, error) {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if connectorID < 1 || connectorID > len(vc.connectors) {
+		return nil, fmt.Errorf("invalid connector ID: %d", connectorID)
+	}
+	tx := vc.activeTransactionLocked(connectorID)
+	if tx == nil || vc.charging.sessions[tx.ID] == nil {
+		return nil, fmt.Errorf("no transaction active on connector %d", connectorID)
+	}
+	return vc.charging.sessions[tx.ID], nil
+}
+
+// setEVSuspended pauses or resumes the EV of a session and reports the
+// resulting charging state right away
+func (vc *VirtualCharger) setEVSuspended(session *chargingSession, suspended bool) {
+	vc.advanceCharging(session, time.Now())
+	session.setEVSuspended(suspended)
+	vc.reportCharging(session, session.reevaluate(vc.sessionLimit))
+}
+
+// Fault puts a connector, or the charge point for connector 0, into Faulted
+// with an OCPP 1.6 error code. A running transaction stops delivering energy
+// until the fault is cleared.
+func (vc *VirtualCharger) Fault(connectorID int, errorCode string) error {
+	if !faultErrorCodes[errorCode] {
+		return fmt.Errorf("invalid error code: %s", errorCode)
+	}
+
+	defer vc.flushStatusNotifications()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	connector, err := vc.connectorLocked(connectorID)
+	if err != nil {
+		return err
+	}
+	if err := vc.setConnectorStatusLocked(connector, ConnectorStatusFaulted, errorCode); err != nil {
+		return err
+	}
+	if tx := vc.activeTransactionLocked(connectorID); tx != nil {
+		if session, exists := vc.charging.sessions[tx.ID]; exists {
+			session.advance(time.Now(), vc.sessionLimit)
+			session.setFaulted(true)
+			// The connector stays Faulted whatever state the session is in
+			session.reevaluate(vc.sessionLimit)
+		}
+	}
+	return nil
+}
+
+// ClearFault ends the fault of a connector, which returns to the state of its
+// transaction or becomes idle
+func (vc *VirtualCharger) ClearFault(connectorID int) error {
+	vc.mu.Lock()
+	connector, err := vc.connectorLocked(connectorID)
+	if err != nil {
+		vc.mu.Unlock()
+		return err
+	}
+	if connector.Status != ConnectorStatusFaulted {
+		vc.mu.Unlock()
+		return fmt.Errorf("connector %d is not faulted", connectorID)
+	}
+
+	var session *chargingSession
+	if tx := vc.activeTransactionLocked(connectorID); tx != nil {
+		session = vc.charging.sessions[tx.ID]
+	}
+	if session == nil {
+		status := ConnectorStatusAvailable
+		if connectorID != 0 {
+			status = vc.idleStatusLocked(connector)
+		}
+		err = vc.setConnectorStatusLocked(connector, status, "")
+		vc.mu.Unlock()
+		vc.flushStatusNotifications()
+		return err
+	}
+	vc.mu.Unlock()
+
+	// The connector follows its session again, starting from the current state
+	vc.advanceCharging(session, time.Now())
+	session.setFaulted(false)
+	update := session.reevaluate(vc.sessionLimit)
+	vc.mu.Lock()
+	err = vc.setConnectorStatusLocked(connector, ConnectorStatus(update.state), "")
+	vc.mu.Unlock()
+	vc.flushStatusNotifications()
+	return err
+}
+
+// SetConnectorStatus forces a connector, or the charge point for connector 0,
+// into a status. It follows the state machine unless the connector behavior
+// allows invalid transitions, which lets chaos scenarios report impossible
+// status sequences.
+func (vc *VirtualCharger) SetConnectorStatus(connectorID int, status ConnectorStatus, errorCode string) error {
+	if _, known := connectorTransitions[status]; !known {
+		return fmt.Errorf("invalid connector status: %s", status)
+	}
+	if errorCode != "" && errorCode != ErrorCodeNoError && !faultErrorCodes[errorCode] {
+		return fmt.Errorf("invalid error code: %s", errorCode)
+	}
+
+	defer vc.flushStatusNotifications()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	connector, err := vc.connectorLocked(connectorID)
+	if err != nil {
+		return err
+	}
+	return vc.setConnectorStatusLocked(connector, status, errorCode)
+}
@@ -0,0 +1,131 @@
+package charger
+
+import (
+    "context"
+    "fmt"
+    "testing"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// sentStatuses returns the StatusNotifications sent so far as
+// "connector:status" or "connector:status:errorCode" for faults
+func sentStatuses(client *mockClient) []string {
+    var statuses []string
+    for _, frame := range client.sentCalls(ocpp.MessageTypeStatusNotification) {
+        req := frame.Payload.(*ocpp.StatusNotificationRequest)
+        status := fmt.Sprintf("%d:%s", req.ConnectorId, req.Status)
+        if req.ErrorCode != ErrorCodeNoError {
+            status += ":" + req.ErrorCode
+        }
+        statuses = append(statuses, status)
+    }
+    return statuses
+}
+
+func TestValidConnectorTransition(t *testing.T) {
+    assert.True(t, validConnectorTransition(1, ConnectorStatusAvailable, ConnectorStatusPreparing))
+    assert.True(t, validConnectorTransition(1, ConnectorStatusCharging, ConnectorStatusSuspendedEV))
+    assert.True(t, validConnectorTransition(1, ConnectorStatusFinishing, ConnectorStatusPreparing))
+    assert.False(t, validConnectorTransition(1, ConnectorStatusAvailable, ConnectorStatusFinishing))
+    assert.False(t, validConnectorTransition(1, ConnectorStatusReserved, ConnectorStatusCharging))
+
+    // Connector 0 is only ever Available, Unavailable or Faulted
+    assert.True(t, validConnectorTransition(0, ConnectorStatusAvailable, ConnectorStatusUnavailable))
+    assert.False(t, validConnectorTransition(0, ConnectorStatusAvailable, ConnectorStatusCharging))
+}
+
+func TestVirtualCharger_ConnectorLifecycle(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    events := make(chan eventbus.Event, 10)
+    vc.eventBus.Subscribe("charger.connector.status_changed", func(ctx context.Context, event eventbus.Event) error {
+        events <- event
+        return nil
+    })
+
+    require.NoError(t, vc.PlugIn(1))
+    assert.Error(t, vc.PlugIn(1))
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    require.NoError(t, vc.SuspendEV(1))
+    assert.Equal(t, ConnectorStatusSuspendedEV, vc.GetConnectors()[0].Status)
+    require.NoError(t, vc.ResumeEV(1))
+
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    assert.Equal(t, ConnectorStatusFinishing, vc.GetConnectors()[0].Status)
+
+    require.NoError(t, vc.PlugOut(1))
+    assert.Equal(t, []string{"1:Preparing", "1:Charging", "1:SuspendedEV", "1:Charging", "1:Finishing", "1:Available"}, sentStatuses(client))
+
+    data := (<-events).Data().(eventbus.ChargerEvent).Data
+    assert.Equal(t, 1, data["connector_id"])
+    assert.Equal(t, "Available", data["from"])
+    assert.Equal(t, "Preparing", data["to"])
+    assert.Equal(t, false, data["forced"])
+}
+
+func TestVirtualCharger_PlugOutStopsTransaction(t *testing.T) {
+    vc, client := newTestCharger(1)
+    require.NoError(t, vc.PlugIn(1))
+    _, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    require.NoError(t, vc.PlugOut(1))
+    stops := client.sentCalls(ocpp.MessageTypeStopTransaction)
+    require.Len(t, stops, 1)
+    assert.Equal(t, "EVDisconnected", *stops[0].Payload.(*ocpp.StopTransactionRequest).Reason)
+    assert.Equal(t, ConnectorStatusAvailable, vc.GetConnectors()[0].Status)
+
+    // Without StopTransactionOnEVSideDisconnect the transaction goes on suspended
+    vc.Configuration().Set(KeyStopTransactionOnEVSideDisconnect, "false")
+    require.NoError(t, vc.PlugIn(1))
+    _, err = vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    require.NoError(t, vc.PlugOut(1))
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeStopTransaction), 1)
+    assert.Equal(t, ConnectorStatusSuspendedEV, vc.GetConnectors()[0].Status)
+}
+
+func TestVirtualCharger_ConnectorFault(t *testing.T) {
+    vc, client := newTestCharger(1)
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    assert.Error(t, vc.Fault(1, "Broken"))
+    require.NoError(t, vc.Fault(1, ErrorCodeGroundFailure))
+    connector := vc.GetConnectors()[0]
+    assert.Equal(t, ConnectorStatusFaulted, connector.Status)
+    assert.Equal(t, ErrorCodeGroundFailure, connector.ErrorCode)
+    assert.Equal(t, 0.0, vc.charging.sessions[tx.ID].reading().PowerW)
+
+    require.NoError(t, vc.ClearFault(1))
+    assert.Equal(t, ConnectorStatusCharging, vc.GetConnectors()[0].Status)
+    assert.Error(t, vc.ClearFault(1))
+
+    // The charge point itself can fault
+    require.NoError(t, vc.Fault(0, ErrorCodeHighTemperature))
+    require.NoError(t, vc.ClearFault(0))
+    assert.Equal(t, []string{"1:Preparing", "1:Charging", "1:Faulted:GroundFailure", "1:Charging", "0:Faulted:HighTemperature", "0:Available"}, sentStatuses(client))
+}
+
+func TestVirtualCharger_InvalidTransitions(t *testing.T) {
+    vc, client := newTestCharger(1)
+
+    assert.Error(t, vc.SetConnectorStatus(1, ConnectorStatusFinishing, ""))
+    assert.Error(t, vc.SetConnectorStatus(0, ConnectorStatusCharging, ""))
+    assert.Error(t, vc.SetConnectorStatus(1, "Broken", ""))
+    assert.Equal(t, ConnectorStatusAvailable, vc.GetConnectors()[0].Status)
+    assert.Empty(t, sentStatuses(client))
+
+    // Chaos scenarios may report what the state machine forbids
+    vc.config.ConnectorStates.AllowInvalidTransitions = true
+    require.NoError(t, vc.SetConnectorStatus(1, ConnectorStatusFinishing, ""))
+    require.NoError(t, vc.SetConnectorStatus(0, ConnectorStatusCharging, ""))
+    assert.Equal(t, []string{"1:Finishing", "0:Charging"}, sentStatuses(client))
+}
@@ -0,0 +1,189 @@
+package charger
+
+import (
+	"strings"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/ocpp201"
+)
+
+// OCPP 2.0.1 device model variables used by the charging station. Variables
+// are stored in a ConfigurationStore keyed "<Component>.<Variable>".
+const (
+	VariableAlignedDataInterval          = "AlignedDataCtrlr.Interval"
+	VariableAuthorizeRemoteStart         = "AuthCtrlr.AuthorizeRemoteStart"
+	VariableLocalAuthorizeOffline        = "AuthCtrlr.LocalAuthorizeOffline"
+	VariableOfflineTxForUnknownIdEnabled = "AuthCtrlr.OfflineTxForUnknownIdEnabled"
+	VariableHeartbeatInterval            = "OCPPCommCtrlr.HeartbeatInterval"
+	VariableWebSocketPingInterval        = "OCPPCommCtrlr.WebSocketPingInterval"
+	VariableTxUpdatedInterval            = "SampledDataCtrlr.TxUpdatedInterval"
+	VariableTxUpdatedMeasurands          = "SampledDataCtrlr.TxUpdatedMeasurands"
+	VariableEVConnectionTimeOut          = "TxCtrlr.EVConnectionTimeOut"
+	VariableStopTxOnInvalidId            = "TxCtrlr.StopTxOnInvalidId"
+
+	// VariableStatusNotificationInterval is simulator-specific, like
+	// KeyStatusNotificationInterval in OCPP 1.6
+	VariableStatusNotificationInterval = "SimulatorCtrlr.StatusNotificationInterval"
+)
+
+// GetVariables and SetVariables attribute statuses
+const (
+	AttributeAccepted                  = "Accepted"
+	AttributeRejected                  = "Rejected"
+	AttributeUnknownComponent          = "UnknownComponent"
+	AttributeUnknownVariable           = "UnknownVariable"
+	AttributeNotSupportedAttributeType = "NotSupportedAttributeType"
+	AttributeRebootRequired            = "RebootRequired"
+)
+
+// defaultDeviceModel lists the variables every charging station exposes
+var defaultDeviceModel = []configurationDefinition{
+	{VariableAlignedDataInterval, "0", configurationInteger, false, false},
+	{VariableAuthorizeRemoteStart, "false", configurationBoolean, false, false},
+	{VariableLocalAuthorizeOffline, "true", configurationBoolean, false, false},
+	{VariableOfflineTxForUnknownIdEnabled, "false", configurationBoolean, false, false},
+	{VariableHeartbeatInterval, "30", configurationInteger, false, false},
+	{VariableWebSocketPingInterval, "0", configurationInteger, false, false},
+	{VariableTxUpdatedInterval, "30", configurationInteger, false, false},
+	{VariableTxUpdatedMeasurands, "Energy.Active.Import.Register", configurationList, false, false},
+	{VariableEVConnectionTimeOut, "60", configurationInteger, false, false},
+	{VariableStopTxOnInvalidId, "true", configurationBoolean, false, false},
+	{VariableStatusNotificationInterval, "10", configurationInteger, false, false},
+}
+
+// NewDeviceModel creates the device model of a charging station with the
+// default variables, overridden by the values in the charger config
+func NewDeviceModel(config ChargerConfig) *ConfigurationStore {
+	store := newConfigurationStore(defaultDeviceModel)
+
+	// Unknown "<Component>.<Variable>" keys become vendor variables
+	for key, value := range config.Configuration {
+		store.Set(key, value)
+	}
+
+	return store
+}
+
+// deviceModelKey returns the store key of a component variable. Instances
+// and EVSEs are not modelled, every variable exists once per station.
+func deviceModelKey(component ocpp201.Component, variable ocpp201.Variable) string {
+	return component.Name + "." + variable.Name
+}
+
+// hasComponent reports whether the device model has variables of a component
+func (s *ConfigurationStore) hasComponent(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key := range s.keys {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownVariableStatus tells an unknown component apart from an unknown variable
+func (s *ConfigurationStore) unknownVariableStatus(component ocpp201.Component) string {
+	if s.hasComponent(component.Name) {
+		return AttributeUnknownVariable
+	}
+	return AttributeUnknownComponent
+}
+
+// actualAttribute reports whether an attribute type addresses the actual value,
+// the only attribute the simulator models
+func actualAttribute(attributeType *string) bool {
+	return attributeType == nil || *attributeType == "Actual"
+}
+
+// getVariable answers one entry of a GetVariables request
+func (s *ConfigurationStore) getVariable(data ocpp201.GetVariableData) ocpp201.GetVariableResult {
+	result := ocpp201.GetVariableResult{
+		AttributeType: data.AttributeType,
+		Component:     data.Component,
+		Variable:      data.Variable,
+	}
+
+	value, exists := s.Get(deviceModelKey(data.Component, data.Variable))
+	switch {
+	case !exists:
+		result.AttributeStatus = s.unknownVariableStatus(data.Component)
+	case !actualAttribute(data.AttributeType):
+		result.AttributeStatus = AttributeNotSupportedAttributeType
+	default:
+		result.AttributeStatus = AttributeAccepted
+		result.AttributeValue = &value
+	}
+	return result
+}
+
+// setVariable applies one entry of a SetVariables request
+func (s *ConfigurationStore) setVariable(data ocpp201.SetVariableData) ocpp201.SetVariableResult {
+	result := ocpp201.SetVariableResult{
+		AttributeType: data.AttributeType,
+		Component:     data.Component,
+		Variable:      data.Variable,
+	}
+
+	if !actualAttribute(data.AttributeType) {
+		result.AttributeStatus = AttributeNotSupportedAttributeType
+		return result
+	}
+
+	switch s.Change(deviceModelKey(data.Component, data.Variable), data.AttributeValue) {
+	case ConfigurationAccepted:
+		result.AttributeStatus = AttributeAccepted
+	case ConfigurationRebootRequired:
+		result.AttributeStatus = AttributeRebootRequired
+	case ConfigurationNotSupported:
+		result.AttributeStatus = s.unknownVariableStatus(data.Component)
+	default:
+		result.AttributeStatus = AttributeRejected
+	}
+	return result
+}
+
+// report describes every variable for a NotifyReport
+func (s *ConfigurationStore) report() []ocpp201.ReportData {
+	keys, _ := s.Keys()
+
+	data := make([]ocpp201.ReportData, 0, len(keys))
+	for _, k := range keys {
+		component, variable, found := strings.Cut(k.Key, ".")
+		if !found {
+			continue
+		}
+
+		value := k.Value
+		mutability := "ReadWrite"
+		if k.ReadOnly {
+			mutability = "ReadOnly"
+		}
+
+		data = append(data, ocpp201.ReportData{
+			Component: ocpp201.Component{Name: component},
+			Variable:  ocpp201.Variable{Name: variable},
+			VariableAttribute: []ocpp201.VariableAttribute{
+				{Value: &value, Mutability: &mutability},
+			},
+			VariableCharacteristics: &ocpp201.VariableCharacteristics{
+				DataType: k.valueType.dataType(),
+			},
+		})
+	}
+	return data
+}
+
+// dataType returns the OCPP 2.0.1 data type of the value type
+func (t configurationValueType) dataType() string {
+	switch t {
+	case configurationInteger:
+		return "integer"
+	case configurationBoolean:
+		return "boolean"
+	case configurationList:
+		return "MemberList"
+	default:
+		return "string"
+	}
+}
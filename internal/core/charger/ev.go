@@ -0,0 +1,290 @@
+package charger
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Current types of a charger
+const (
+	CurrentTypeAC = "AC"
+	CurrentTypeDC = "DC"
+)
+
+// Battery model constants
+const (
+	minTaperFactor    = 0.05  // Share of the maximum power still accepted close to 100 % SoC
+	dcVoltageEmpty    = 350.0 // DC battery voltage at 0 % SoC
+	dcVoltageFull     = 420.0 // DC battery voltage at 100 % SoC
+	fullSoCResolution = 1e-6  // Percent below the target SoC that counts as full
+)
+
+// EVModel simulates the vehicle plugged into a connector. The charging
+// session asks it how much of the offered power it accepts and stores the
+// energy delivered in its battery.
+type EVModel interface {
+	// AcceptedPower returns the power in W the EV draws when offered offeredW
+	AcceptedPower(offeredW float64) float64
+	// Charge stores energyWh in the battery and returns the energy actually stored
+	Charge(energyWh float64) float64
+	// SoC returns the state of charge in percent
+	SoC() float64
+	// Full reports whether the EV stopped charging at its target SoC
+	Full() bool
+	// Phases returns the number of phases the EV charges on with AC
+	Phases() int
+	// BatteryVoltage returns the battery voltage seen when charging with DC
+	BatteryVoltage() float64
+}
+
+// EVProfile describes one EV. Zero values fall back to a mid-size EV with a
+// 60 kWh battery charging from 20 % to 100 %.
+type EVProfile struct {
+	BatteryCapacityKWh float64 `json:"battery_capacity_kwh,omitempty" yaml:"battery_capacity_kwh,omitempty"`
+	InitialSoC         float64 `json:"initial_soc,omitempty" yaml:"initial_soc,omitempty"` // Percent
+	TargetSoC          float64 `json:"target_soc,omitempty" yaml:"target_soc,omitempty"`   // Percent, charging stops here
+	TaperSoC           float64 `json:"taper_soc,omitempty" yaml:"taper_soc,omitempty"`     // Percent, constant voltage phase starts here
+	MaxACPowerKW       float64 `json:"max_ac_power_kw,omitempty" yaml:"max_ac_power_kw,omitempty"`
+	MaxDCPowerKW       float64 `json:"max_dc_power_kw,omitempty" yaml:"max_dc_power_kw,omitempty"`
+	Phases             int     `json:"phases,omitempty" yaml:"phases,omitempty"` // AC phases, 1-3
+}
+
+// withDefaults fills unset fields with the default values
+func (p EVProfile) withDefaults() EVProfile {
+	if p.BatteryCapacityKWh <= 0 {
+		p.BatteryCapacityKWh = 60
+	}
+	if p.InitialSoC <= 0 {
+		p.InitialSoC = 20
+	}
+	if p.TargetSoC <= 0 || p.TargetSoC > 100 {
+		p.TargetSoC = 100
+	}
+	if p.TaperSoC <= 0 || p.TaperSoC >= 100 {
+		p.TaperSoC = 80
+	}
+	if p.MaxACPowerKW <= 0 {
+		p.MaxACPowerKW = 11
+	}
+	if p.MaxDCPowerKW <= 0 {
+		p.MaxDCPowerKW = 50
+	}
+	if p.Phases <= 0 || p.Phases > 3 {
+		p.Phases = defaultPhases
+	}
+	p.InitialSoC = math.Min(p.InitialSoC, 100)
+	return p
+}
+
+// BatteryEV is an EVModel with a constant current / constant voltage
+// charging curve: the EV draws its maximum power up to the taper SoC, then the
+// accepted power falls linearly towards 100 %.
+type BatteryEV struct {
+	profile  EVProfile
+	dc       bool
+	storedWh float64
+	mu       sync.Mutex
+}
+
+// NewBatteryEV creates an EV charging on a connector with the given current type
+func NewBatteryEV(profile EVProfile, currentType string) *BatteryEV {
+	profile = profile.withDefaults()
+	return &BatteryEV{
+		profile:  profile,
+		dc:       currentType == CurrentTypeDC,
+		storedWh: profile.BatteryCapacityKWh * 1000 * profile.InitialSoC / 100,
+	}
+}
+
+// Profile returns the parameters of the EV
+func (b *BatteryEV) Profile() EVProfile {
+	return b.profile
+}
+
+// AcceptedPower returns the power the EV draws when offered offeredW
+func (b *BatteryEV) AcceptedPower(offeredW float64) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fullLocked() || offeredW <= 0 {
+		return 0
+	}
+	maxW := b.profile.MaxACPowerKW * 1000
+	if b.dc {
+		maxW = b.profile.MaxDCPowerKW * 1000
+	}
+	if soc := b.socLocked(); soc > b.profile.TaperSoC {
+		maxW *= math.Max(minTaperFactor, (100-soc)/(100-b.profile.TaperSoC))
+	}
+	return math.Min(offeredW, maxW)
+}
+
+// Charge stores energy up to the target SoC
+func (b *BatteryEV) Charge(energyWh float64) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	targetWh := b.profile.BatteryCapacityKWh * 1000 * b.profile.TargetSoC / 100
+	stored := math.Max(0, math.Min(energyWh, targetWh-b.storedWh))
+	b.storedWh += stored
+	return stored
+}
+
+// SoC returns the state of charge in percent
+func (b *BatteryEV) SoC() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.socLocked()
+}
+
+// Full reports whether the target SoC has been reached
+func (b *BatteryEV) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.fullLocked()
+}
+
+// Phases returns the number of AC phases the EV charges on
+func (b *BatteryEV) Phases() int {
+	return b.profile.Phases
+}
+
+// BatteryVoltage rises linearly with the SoC
+func (b *BatteryEV) BatteryVoltage() float64 {
+	return dcVoltageEmpty + (dcVoltageFull-dcVoltageEmpty)*b.SoC()/100
+}
+
+func (b *BatteryEV) socLocked() float64 {
+	return b.storedWh / (b.profile.BatteryCapacityKWh * 1000) * 100
+}
+
+func (b *BatteryEV) fullLocked() bool {
+	return b.socLocked() >= b.profile.TargetSoC-fullSoCResolution
+}
+
+// Range is a parameter drawn uniformly between Min and Max. In YAML and JSON
+// it is either a number or {min: x, max: y}.
+type Range struct {
+	Min float64 `json:"min" yaml:"min"`
+	Max float64 `json:"max" yaml:"max"`
+}
+
+// Fixed returns a range that always yields v
+func Fixed(v float64) Range {
+	return Range{Min: v, Max: v}
+}
+
+// sample draws a value from the range
+func (r Range) sample(rng *rand.Rand) float64 {
+	if r.Max <= r.Min {
+		return r.Min
+	}
+	return r.Min + rng.Float64()*(r.Max-r.Min)
+}
+
+// UnmarshalYAML accepts a plain number or a min/max mapping
+func (r *Range) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var v float64
+		if err := node.Decode(&v); err != nil {
+			return err
+		}
+		*r = Fixed(v)
+		return nil
+	}
+	type plain Range
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	return r.validate()
+}
+
+// UnmarshalJSON accepts a plain number or a min/max object
+func (r *Range) UnmarshalJSON(data []byte) error {
+	var v float64
+	if err := json.Unmarshal(data, &v); err == nil {
+		*r = Fixed(v)
+		return nil
+	}
+	type plain Range
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	return r.validate()
+}
+
+func (r Range) validate() error {
+	if r.Max < r.Min {
+		return fmt.Errorf("range max %v below min %v", r.Max, r.Min)
+	}
+	return nil
+}
+
+// EVType describes a kind of EV in a fleet. Every session draws a new EV:
+// the type is picked by weight and each range is sampled independently.
+type EVType struct {
+	Name               string  `json:"name,omitempty" yaml:"name,omitempty"`
+	Weight             float64 `json:"weight,omitempty" yaml:"weight,omitempty"` // Relative frequency, defaults to 1
+	BatteryCapacityKWh Range   `json:"battery_capacity_kwh,omitempty" yaml:"battery_capacity_kwh,omitempty"`
+	InitialSoC         Range   `json:"initial_soc,omitempty" yaml:"initial_soc,omitempty"`
+	TargetSoC          Range   `json:"target_soc,omitempty" yaml:"target_soc,omitempty"`
+	TaperSoC           Range   `json:"taper_soc,omitempty" yaml:"taper_soc,omitempty"`
+	MaxACPowerKW       Range   `json:"max_ac_power_kw,omitempty" yaml:"max_ac_power_kw,omitempty"`
+	MaxDCPowerKW       Range   `json:"max_dc_power_kw,omitempty" yaml:"max_dc_power_kw,omitempty"`
+	Phases             int     `json:"phases,omitempty" yaml:"phases,omitempty"`
+}
+
+// sample draws the profile of one EV of this type
+func (t EVType) sample(rng *rand.Rand) EVProfile {
+	return EVProfile{
+		BatteryCapacityKWh: t.BatteryCapacityKWh.sample(rng),
+		InitialSoC:         t.InitialSoC.sample(rng),
+		TargetSoC:          t.TargetSoC.sample(rng),
+		TaperSoC:           t.TaperSoC.sample(rng),
+		MaxACPowerKW:       t.MaxACPowerKW.sample(rng),
+		MaxDCPowerKW:       t.MaxDCPowerKW.sample(rng),
+		Phases:             t.Phases,
+	}
+}
+
+// sampleEVProfile picks an EV type from the fleet by weight and draws a
+// profile from it. An empty fleet yields the default EV.
+func sampleEVProfile(fleet []EVType, rng *rand.Rand) EVProfile {
+	total := 0.0
+	for _, t := range fleet {
+		total += evTypeWeight(t)
+	}
+	if total <= 0 {
+		return EVProfile{}.withDefaults()
+	}
+
+	pick := rng.Float64() * total
+	for _, t := range fleet {
+		if pick -= evTypeWeight(t); pick < 0 {
+			return t.sample(rng).withDefaults()
+		}
+	}
+	return fleet[len(fleet)-1].sample(rng).withDefaults()
+}
+
+func evTypeWeight(t EVType) float64 {
+	if t.Weight == 0 {
+		return 1
+	}
+	return math.Max(0, t.Weight)
+}
+
+// newChargerRand creates the random source a charger draws EVs from, distinct
+// for chargers created at the same time
+func newChargerRand(chargerID string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(chargerID))
+	return rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(h.Sum64())))
+}
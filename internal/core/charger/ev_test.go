@@ -0,0 +1,99 @@
+package charger
+
+import (
+    "math/rand"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestBatteryEV_ChargingCurve(t *testing.T) {
+    ev := NewBatteryEV(EVProfile{BatteryCapacityKWh: 50, InitialSoC: 50, TargetSoC: 90, TaperSoC: 80, MaxACPowerKW: 11, MaxDCPowerKW: 100}, CurrentTypeDC)
+
+    // Constant current below the taper SoC, limited by the charger or the EV
+    assert.Equal(t, 40000.0, ev.AcceptedPower(40000))
+    assert.Equal(t, 100000.0, ev.AcceptedPower(150000))
+    assert.Equal(t, 0.0, ev.AcceptedPower(0))
+
+    // 35 % of 50 kWh takes the EV to 85 %, half way through the taper
+    assert.Equal(t, 17500.0, ev.Charge(17500))
+    assert.InDelta(t, 85, ev.SoC(), 1e-9)
+    assert.InDelta(t, 75000, ev.AcceptedPower(150000), 1e-6)
+
+    // Energy beyond the target SoC is not stored
+    assert.InDelta(t, 2500, ev.Charge(10000), 1e-6)
+    assert.True(t, ev.Full())
+    assert.Equal(t, 0.0, ev.AcceptedPower(150000))
+    assert.InDelta(t, 413, ev.BatteryVoltage(), 1e-9)
+}
+
+func TestSampleEVProfile(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+
+    assert.Equal(t, EVProfile{}.withDefaults(), sampleEVProfile(nil, rng))
+
+    fleet := []EVType{
+        {Name: "never", Weight: -1, BatteryCapacityKWh: Fixed(10)},
+        {Name: "compact", BatteryCapacityKWh: Range{Min: 40, Max: 60}, InitialSoC: Range{Min: 10, Max: 30}, Phases: 1},
+    }
+    for i := 0; i < 100; i++ {
+        profile := sampleEVProfile(fleet, rng)
+        assert.GreaterOrEqual(t, profile.BatteryCapacityKWh, 40.0)
+        assert.LessOrEqual(t, profile.BatteryCapacityKWh, 60.0)
+        assert.GreaterOrEqual(t, profile.InitialSoC, 10.0)
+        assert.LessOrEqual(t, profile.InitialSoC, 30.0)
+        assert.Equal(t, 1, profile.Phases)
+        assert.Equal(t, 100.0, profile.TargetSoC)
+    }
+}
+
+func TestChargingSession_EVFullSuspends(t *testing.T) {
+    vc, client := newTestCharger(1)
+    require.NoError(t, vc.PlugInEV(1, NewBatteryEV(EVProfile{BatteryCapacityKWh: 10, InitialSoC: 50, TargetSoC: 60, MaxACPowerKW: 7.4, Phases: 1}, CurrentTypeAC)))
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    session := vc.charging.sessions[tx.ID]
+
+    // 10 minutes at 7.4 kW deliver about 1.2 kWh, the EV only takes 1 kWh
+    vc.advanceCharging(session, tx.StartTime.Add(5*time.Minute))
+    assert.Equal(t, ConnectorStatusCharging, vc.GetConnectors()[0].Status)
+
+    reading := session.reading()
+    assert.Equal(t, 7400.0, reading.PowerW)
+    assert.Equal(t, 1, reading.Phases)
+    assert.InDelta(t, 32.17, reading.CurrentA, 0.01)
+
+    vc.advanceCharging(session, tx.StartTime.Add(10*time.Minute))
+    assert.Equal(t, ConnectorStatusSuspendedEV, vc.GetConnectors()[0].Status)
+    assert.Equal(t, 1000, session.meterWh())
+
+    vc.Configuration().Set(KeyMeterValuesSampledData, "Energy.Active.Import.Register,Power.Active.Import,Current.Import,Voltage,SoC")
+    require.NoError(t, vc.SendMeterValues(tx.ID, session.meterWh()))
+    meterValues := client.sentCalls(ocpp.MessageTypeMeterValues)
+    require.Len(t, meterValues, 1)
+    values := map[string]string{}
+    for _, value := range meterValues[0].Payload.(*ocpp.MeterValuesRequest).MeterValue[0].SampledValue {
+        key := *value.Measurand
+        if value.Phase != nil {
+            key += "/" + *value.Phase
+        }
+        values[key] = value.Value
+    }
+    assert.Equal(t, map[string]string{
+        "Energy.Active.Import.Register": "1000",
+        "Power.Active.Import":           "0",
+        "Current.Import/L1":             "0",
+        "Voltage/L1-N":                  "230",
+        "SoC":                           "60",
+    }, values)
+
+    // The final meter value comes from the session instead of a flat estimate
+    require.NoError(t, vc.StopTransaction(tx.ID, "EVDisconnected"))
+    stops := client.sentCalls(ocpp.MessageTypeStopTransaction)
+    require.Len(t, stops, 1)
+    assert.Equal(t, 1000, stops[0].Payload.(*ocpp.StopTransactionRequest).MeterStop)
+}
@@ -0,0 +1,294 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/filetransfer"
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// fileTransferTimeout bounds a single firmware download or diagnostics upload
+const fileTransferTimeout = 2 * time.Minute
+
+// defaultTransferRetryInterval is used when the CSMS does not give a retry interval
+const defaultTransferRetryInterval = 30 * time.Second
+
+// FirmwareBehavior injects faults into firmware updates and diagnostics
+// uploads, used to test how a CSMS copes with failing chargers
+type FirmwareBehavior struct {
+	// DownloadFailure fails every firmware download attempt
+	DownloadFailure bool `json:"download_failure,omitempty" yaml:"download_failure,omitempty"`
+	// CorruptImage makes downloaded images fail to install
+	CorruptImage bool `json:"corrupt_image,omitempty" yaml:"corrupt_image,omitempty"`
+	// BrickAfterInstall installs the image, but the charger never comes back
+	// from the reboot that follows
+	BrickAfterInstall bool `json:"brick_after_install,omitempty" yaml:"brick_after_install,omitempty"`
+	// UploadFailure fails every diagnostics upload attempt
+	UploadFailure bool `json:"upload_failure,omitempty" yaml:"upload_failure,omitempty"`
+}
+
+// FirmwareVersion returns the version of the installed firmware
+func (vc *VirtualCharger) FirmwareVersion() string {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return vc.firmwareVersion
+}
+
+// SetFirmwareBehavior changes the faults injected into firmware updates and
+// diagnostics uploads from now on
+func (vc *VirtualCharger) SetFirmwareBehavior(behavior FirmwareBehavior) {
+	vc.mu.Lock()
+	vc.firmwareBehavior = behavior
+	vc.mu.Unlock()
+}
+
+// handleUpdateFirmware downloads and installs a firmware image on request of
+// the CSMS, then reboots the charger
+func (vc *VirtualCharger) handleUpdateFirmware(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.UpdateFirmwareRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	vc.logger.WithFields(logrus.Fields{
+		"location":      req.Location,
+		"retrieve_date": req.RetrieveDate,
+	}).Info("Firmware update requested by CSMS")
+
+	return &ocpp.UpdateFirmwareResponse{}, func() { vc.updateFirmware(req) }, nil
+}
+
+// updateFirmware walks through the download and installation of a firmware
+// image, reporting each step with FirmwareStatusNotification
+func (vc *VirtualCharger) updateFirmware(req ocpp.UpdateFirmwareRequest) {
+	// A lost notification does not stop the update
+	report := func(status string) {
+		if err := vc.sendFirmwareStatus(status); err != nil {
+			vc.logger.WithError(err).WithField("status", status).Error("Failed to send firmware status")
+		}
+	}
+
+	if time.Now().Before(req.RetrieveDate) && !vc.waitUntil(req.RetrieveDate) {
+		return
+	}
+
+	var image []byte
+	err := vc.retryTransfer(req.Retries, req.RetryInterval, func() error {
+		report(ocpp.FirmwareStatusDownloading)
+		var err error
+		image, err = vc.downloadFirmware(req.Location)
+		return err
+	})
+	if err != nil {
+		vc.logger.WithError(err).WithField("location", req.Location).Warn("Firmware download failed")
+		report(ocpp.FirmwareStatusDownloadFailed)
+		return
+	}
+	report(ocpp.FirmwareStatusDownloaded)
+	report(ocpp.FirmwareStatusInstalling)
+
+	vc.mu.RLock()
+	behavior := vc.firmwareBehavior
+	vc.mu.RUnlock()
+	if behavior.CorruptImage || len(image) == 0 {
+		vc.logger.WithField("location", req.Location).Warn("Firmware image is corrupt")
+		report(ocpp.FirmwareStatusInstallationFailed)
+		return
+	}
+
+	version := firmwareVersionOf(req.Location)
+	vc.mu.Lock()
+	vc.firmwareVersion = version
+	vc.mu.Unlock()
+	report(ocpp.FirmwareStatusInstalled)
+
+	vc.logger.WithField("firmware_version", version).Info("Firmware installed, rebooting")
+	if behavior.BrickAfterInstall {
+		vc.brick()
+		return
+	}
+	if err := vc.reboot(ResetSoft, "Reboot", BootReasonFirmwareUpdate); err != nil {
+		vc.logger.WithError(err).Error("Failed to reboot after firmware update")
+	}
+}
+
+// downloadFirmware fetches a firmware image unless downloads are made to fail
+func (vc *VirtualCharger) downloadFirmware(location string) ([]byte, error) {
+	vc.mu.RLock()
+	fail := vc.firmwareBehavior.DownloadFailure
+	vc.mu.RUnlock()
+	if fail {
+		return nil, fmt.Errorf("download failure injected")
+	}
+
+	ctx, cancel := context.WithTimeout(vc.context(), fileTransferTimeout)
+	defer cancel()
+	return filetransfer.Download(ctx, location)
+}
+
+// firmwareVersionOf names the firmware after the file name of its image,
+// "https://example.com/fw/v2.1.0.bin" installs "v2.1.0"
+func firmwareVersionOf(location string) string {
+	name := location
+	if u, err := url.Parse(location); err == nil && u.Path != "" {
+		name = path.Base(u.Path)
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// sendFirmwareStatus records and reports the firmware update status
+func (vc *VirtualCharger) sendFirmwareStatus(status string) error {
+	vc.mu.Lock()
+	vc.firmwareStatus = status
+	vc.mu.Unlock()
+
+	if _, err := vc.call(ocpp.MessageTypeFirmwareStatusNotification, &ocpp.FirmwareStatusNotificationRequest{Status: status}); err != nil {
+		return err
+	}
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.firmware.status", vc.id, map[string]interface{}{
+		"status": status,
+	}))
+	return nil
+}
+
+// brick leaves the charger dead after a firmware install, as if the new
+// image never booted: the connection drops and the charger stays offline
+func (vc *VirtualCharger) brick() {
+	vc.logger.Warn("Charger bricked by firmware update")
+
+	vc.cancel()
+	vc.stopBootRetry()
+	if err := vc.ocppClient.Disconnect(context.Background()); err != nil {
+		vc.logger.WithError(err).Error("Failed to disconnect bricked charger")
+	}
+	vc.setStatus(StatusError)
+
+	vc.eventBus.Publish(context.Background(), eventbus.NewChargerEvent("charger.firmware.bricked", vc.id, map[string]interface{}{
+		"firmware_version": vc.FirmwareVersion(),
+	}))
+}
+
+// handleGetDiagnostics uploads a diagnostics file on request of the CSMS
+func (vc *VirtualCharger) handleGetDiagnostics(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.GetDiagnosticsRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	fileName := fmt.Sprintf("diagnostics-%s-%s.log", vc.id, now.UTC().Format("20060102T150405Z"))
+	content := vc.diagnostics(now, req.StartTime, req.StopTime)
+
+	vc.logger.WithFields(logrus.Fields{
+		"location":  req.Location,
+		"file_name": fileName,
+	}).Info("Diagnostics requested by CSMS")
+
+	return &ocpp.GetDiagnosticsResponse{FileName: &fileName}, func() { vc.uploadDiagnostics(req, fileName, content) }, nil
+}
+
+// uploadDiagnostics uploads a diagnostics file, reporting the progress with
+// DiagnosticsStatusNotification
+func (vc *VirtualCharger) uploadDiagnostics(req ocpp.GetDiagnosticsRequest, fileName string, content []byte) {
+	report := func(status string) {
+		if err := vc.sendDiagnosticsStatus(status); err != nil {
+			vc.logger.WithError(err).WithField("status", status).Error("Failed to send diagnostics status")
+		}
+	}
+
+	err := vc.retryTransfer(req.Retries, req.RetryInterval, func() error {
+		report(ocpp.DiagnosticsStatusUploading)
+
+		vc.mu.RLock()
+		fail := vc.firmwareBehavior.UploadFailure
+		vc.mu.RUnlock()
+		if fail {
+			return fmt.Errorf("upload failure injected")
+		}
+
+		ctx, cancel := context.WithTimeout(vc.context(), fileTransferTimeout)
+		defer cancel()
+		return filetransfer.Upload(ctx, req.Location, fileName, content)
+	})
+	if err != nil {
+		vc.logger.WithError(err).WithField("location", req.Location).Warn("Diagnostics upload failed")
+		report(ocpp.DiagnosticsStatusUploadFailed)
+		return
+	}
+	report(ocpp.DiagnosticsStatusUploaded)
+}
+
+// sendDiagnosticsStatus records and reports the diagnostics upload status
+func (vc *VirtualCharger) sendDiagnosticsStatus(status string) error {
+	vc.mu.Lock()
+	vc.diagnosticsStatus = status
+	vc.mu.Unlock()
+
+	if _, err := vc.call(ocpp.MessageTypeDiagnosticsStatusNotification, &ocpp.DiagnosticsStatusNotificationRequest{Status: status}); err != nil {
+		return err
+	}
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.diagnostics.status", vc.id, map[string]interface{}{
+		"status": status,
+	}))
+	return nil
+}
+
+// diagnostics renders the diagnostics file: the identity of the charger,
+// the state of its connectors and its configuration
+func (vc *VirtualCharger) diagnostics(now time.Time, start, stop *time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "charger: %s\nvendor: %s\nmodel: %s\n", vc.id, vc.config.Vendor, vc.config.Model)
+	fmt.Fprintf(&b, "firmware_version: %s\ngenerated: %s\n", vc.FirmwareVersion(), now.UTC().Format(time.RFC3339))
+	if start != nil {
+		fmt.Fprintf(&b, "start_time: %s\n", start.UTC().Format(time.RFC3339))
+	}
+	if stop != nil {
+		fmt.Fprintf(&b, "stop_time: %s\n", stop.UTC().Format(time.RFC3339))
+	}
+
+	vc.mu.RLock()
+	for _, connector := range append([]*Connector{vc.chargePoint}, vc.connectors...) {
+		fmt.Fprintf(&b, "connector %d: %s %s\n", connector.ID, connector.Status, connector.ErrorCode)
+	}
+	vc.mu.RUnlock()
+
+	keys, _ := vc.configuration.Keys()
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", key.Key, key.Value)
+	}
+	return []byte(b.String())
+}
+
+// retryTransfer runs a file transfer up to 1+retries times, waiting the retry
+// interval in seconds between attempts, and returns the last error
+func (vc *VirtualCharger) retryTransfer(retries, retryInterval *int, transfer func() error) error {
+	attempts := 1
+	if retries != nil && *retries > 0 {
+		attempts += *retries
+	}
+	interval := defaultTransferRetryInterval
+	if retryInterval != nil {
+		interval = time.Duration(*retryInterval) * time.Second
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = transfer(); err == nil {
+			return nil
+		}
+		if attempt < attempts && !vc.waitUntil(time.Now().Add(interval)) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package charger
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// newFirmwareCharger returns a charger supporting the Firmware Management profile
+func newFirmwareCharger(connectors int) (*VirtualCharger, *mockClient) {
+    vc, client := newTestCharger(connectors)
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core,FirmwareManagement")
+    return vc, client
+}
+
+// fileServer serves firmware images and receives diagnostics uploads
+type fileServer struct {
+    *httptest.Server
+    uploads map[string]string
+    mu      sync.Mutex
+}
+
+func newFileServer(t *testing.T) *fileServer {
+    s := &fileServer{uploads: make(map[string]string)}
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch {
+        case r.Method == http.MethodGet && r.URL.Path == "/fw/v2.1.0.bin":
+            w.Write([]byte("firmware image"))
+        case r.Method == http.MethodGet && r.URL.Path == "/fw/empty.bin":
+        case r.Method == http.MethodPost && r.URL.Path == "/diagnostics":
+            file, header, err := r.FormFile("file")
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            content, _ := io.ReadAll(file)
+            s.mu.Lock()
+            s.uploads[header.Filename] = string(content)
+            s.mu.Unlock()
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(s.Close)
+    return s
+}
+
+func (s *fileServer) upload(name string) string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.uploads[name]
+}
+
+func firmwareStatuses(client *mockClient) []string {
+    var statuses []string
+    for _, call := range client.sentCalls(ocpp.MessageTypeFirmwareStatusNotification) {
+        statuses = append(statuses, call.Payload.(*ocpp.FirmwareStatusNotificationRequest).Status)
+    }
+    return statuses
+}
+
+func diagnosticsStatuses(client *mockClient) []string {
+    var statuses []string
+    for _, call := range client.sentCalls(ocpp.MessageTypeDiagnosticsStatusNotification) {
+        statuses = append(statuses, call.Payload.(*ocpp.DiagnosticsStatusNotificationRequest).Status)
+    }
+    return statuses
+}
+
+func updateFirmware(t *testing.T, vc *VirtualCharger, client *mockClient, location string) {
+    retries, retryInterval := 1, 0
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeUpdateFirmware, &ocpp.UpdateFirmwareRequest{
+        Location:      location,
+        Retries:       &retries,
+        RetrieveDate:  time.Now().Add(-time.Minute),
+        RetryInterval: &retryInterval,
+    })
+    require.Equal(t, "CallResult", reply.Kind)
+}
+
+func TestHandleUpdateFirmware(t *testing.T) {
+    server := newFileServer(t)
+
+    // The profile must be listed in SupportedFeatureProfiles
+    vc, client := newTestCharger(1)
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core")
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeUpdateFirmware, &ocpp.UpdateFirmwareRequest{Location: server.URL + "/fw/v2.1.0.bin"})
+    assert.Equal(t, "CallError", reply.Kind)
+    assert.Equal(t, ocpp.ErrorCodeNotSupported, reply.Payload.(*ocpp.CallError).ErrorCode)
+
+    vc, client = newFirmwareCharger(1)
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    updateFirmware(t, vc, client, server.URL+"/fw/v2.1.0.bin")
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeBootNotification)) == 1
+    }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"Downloading", "Downloaded", "Installing", "Installed"}, firmwareStatuses(client))
+    assert.Equal(t, "v2.1.0", vc.FirmwareVersion())
+
+    // The charger reboots with the new firmware
+    boot := client.sentCalls(ocpp.MessageTypeBootNotification)[0].Payload.(*ocpp.BootNotificationRequest)
+    require.NotNil(t, boot.FirmwareVersion)
+    assert.Equal(t, "v2.1.0", *boot.FirmwareVersion)
+    assert.False(t, tx.IsActive())
+    stop := client.sentCalls(ocpp.MessageTypeStopTransaction)[0].Payload.(*ocpp.StopTransactionRequest)
+    assert.Equal(t, "Reboot", *stop.Reason)
+}
+
+func TestVirtualCharger_FirmwareFaults(t *testing.T) {
+    server := newFileServer(t)
+
+    vc, client := newFirmwareCharger(1)
+    updateFirmware(t, vc, client, server.URL+"/fw/missing.bin")
+    assert.Eventually(t, func() bool { return len(firmwareStatuses(client)) == 3 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"Downloading", "Downloading", "DownloadFailed"}, firmwareStatuses(client))
+
+    vc, client = newFirmwareCharger(1)
+    vc.SetFirmwareBehavior(FirmwareBehavior{DownloadFailure: true})
+    updateFirmware(t, vc, client, server.URL+"/fw/v2.1.0.bin")
+    assert.Eventually(t, func() bool { return len(firmwareStatuses(client)) == 3 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, "DownloadFailed", firmwareStatuses(client)[2])
+
+    // Corrupt images fail to install and the old firmware keeps running
+    for _, behavior := range []FirmwareBehavior{{CorruptImage: true}, {}} {
+        vc, client = newFirmwareCharger(1)
+        vc.SetFirmwareBehavior(behavior)
+        location := server.URL + "/fw/v2.1.0.bin"
+        if !behavior.CorruptImage {
+            location = server.URL + "/fw/empty.bin"
+        }
+        updateFirmware(t, vc, client, location)
+        assert.Eventually(t, func() bool { return len(firmwareStatuses(client)) == 4 }, time.Second, 10*time.Millisecond)
+        assert.Equal(t, []string{"Downloading", "Downloaded", "Installing", "InstallationFailed"}, firmwareStatuses(client))
+        assert.Empty(t, vc.FirmwareVersion())
+    }
+
+    // A bricked charger never comes back after installing
+    vc, client = newFirmwareCharger(1)
+    vc.SetFirmwareBehavior(FirmwareBehavior{BrickAfterInstall: true})
+    updateFirmware(t, vc, client, server.URL+"/fw/v2.1.0.bin")
+    assert.Eventually(t, func() bool { return vc.GetStatus() == StatusError }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, "Installed", firmwareStatuses(client)[3])
+    assert.False(t, vc.IsConnected())
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeBootNotification))
+}
+
+func TestHandleGetDiagnostics(t *testing.T) {
+    server := newFileServer(t)
+    vc, client := newFirmwareCharger(2)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeGetDiagnostics, &ocpp.GetDiagnosticsRequest{Location: server.URL + "/diagnostics"})
+    fileName := reply.Payload.(*ocpp.GetDiagnosticsResponse).FileName
+    require.NotNil(t, fileName)
+    assert.True(t, strings.HasPrefix(*fileName, "diagnostics-TEST001-"))
+
+    assert.Eventually(t, func() bool { return len(diagnosticsStatuses(client)) == 2 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"Uploading", "Uploaded"}, diagnosticsStatuses(client))
+    assert.Contains(t, server.upload(*fileName), "charger: TEST001")
+    assert.Contains(t, server.upload(*fileName), "connector 2: Available")
+
+    vc, client = newFirmwareCharger(1)
+    vc.SetFirmwareBehavior(FirmwareBehavior{UploadFailure: true})
+    deliverCall(t, vc, client, ocpp.MessageTypeGetDiagnostics, &ocpp.GetDiagnosticsRequest{Location: server.URL + "/diagnostics"})
+    assert.Eventually(t, func() bool { return len(diagnosticsStatuses(client)) == 2 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"Uploading", "UploadFailed"}, diagnosticsStatuses(client))
+}
@@ -0,0 +1,268 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// IdTagInfo statuses of OCPP 1.6
+var idTagStatuses = map[string]bool{
+	"Accepted":     true,
+	"Blocked":      true,
+	"Expired":      true,
+	"Invalid":      true,
+	"ConcurrentTx": true,
+}
+
+// LocalAuthList is a local authorization list a charger starts with, as if
+// the CSMS had sent it before the scenario began
+type LocalAuthList struct {
+	Version int              `json:"version,omitempty" yaml:"version,omitempty"`
+	Entries []LocalAuthEntry `json:"entries,omitempty" yaml:"entries,omitempty"`
+}
+
+// LocalAuthEntry is an idTag of a LocalAuthList
+type LocalAuthEntry struct {
+	IDTag       string     `json:"id_tag" yaml:"id_tag"`
+	Status      string     `json:"status,omitempty" yaml:"status,omitempty"` // IdTagInfo status, defaults to Accepted
+	ParentIDTag string     `json:"parent_id_tag,omitempty" yaml:"parent_id_tag,omitempty"`
+	ExpiryDate  *time.Time `json:"expiry_date,omitempty" yaml:"expiry_date,omitempty"`
+}
+
+// Validate checks the statuses of the entries
+func (l LocalAuthList) Validate() error {
+	for _, entry := range l.Entries {
+		if entry.IDTag == "" {
+			return fmt.Errorf("entry without id_tag")
+		}
+		if entry.Status != "" && !idTagStatuses[entry.Status] {
+			return fmt.Errorf("id tag %s: invalid status %q", entry.IDTag, entry.Status)
+		}
+	}
+	return nil
+}
+
+// AuthorizationStore holds the local authorization list sent by the CSMS and
+// the cache of idTag information the CSMS returned. Entries on the list take
+// precedence over the cache.
+type AuthorizationStore struct {
+	listVersion int
+	list        map[string]ocpp.IdTagInfo
+	cache       map[string]ocpp.IdTagInfo
+	mu          sync.RWMutex
+}
+
+// NewAuthorizationStore creates an authorization store holding an initial
+// local list and an empty cache
+func NewAuthorizationStore(initial LocalAuthList) *AuthorizationStore {
+	s := &AuthorizationStore{
+		listVersion: initial.Version,
+		list:        make(map[string]ocpp.IdTagInfo),
+		cache:       make(map[string]ocpp.IdTagInfo),
+	}
+	for _, entry := range initial.Entries {
+		info := ocpp.IdTagInfo{Status: entry.Status, ExpiryDate: entry.ExpiryDate}
+		if info.Status == "" {
+			info.Status = "Accepted"
+		}
+		if entry.ParentIDTag != "" {
+			parent := entry.ParentIDTag
+			info.ParentIdTag = &parent
+		}
+		s.list[entry.IDTag] = info
+	}
+	return s
+}
+
+// ListVersion returns the version of the local authorization list, 0 while
+// no list is installed
+func (s *AuthorizationStore) ListVersion() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listVersion
+}
+
+// ListLength returns the number of idTags on the local authorization list
+func (s *AuthorizationStore) ListLength() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.list)
+}
+
+// UpdateList applies a SendLocalList update and returns its status. A full
+// update replaces the list, a differential one adds, replaces and, for
+// entries without IdTagInfo, removes idTags and must raise the version. The
+// list may not grow beyond maxLength idTags.
+func (s *AuthorizationStore) UpdateList(version int, updateType string, entries []ocpp.AuthorizationData, maxLength int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list map[string]ocpp.IdTagInfo
+	switch updateType {
+	case ocpp.UpdateTypeFull:
+		list = make(map[string]ocpp.IdTagInfo, len(entries))
+	case ocpp.UpdateTypeDifferential:
+		if version <= s.listVersion {
+			return ocpp.UpdateStatusVersionMismatch
+		}
+		list = make(map[string]ocpp.IdTagInfo, len(s.list)+len(entries))
+		for idTag, info := range s.list {
+			list[idTag] = info
+		}
+	default:
+		return ocpp.UpdateStatusFailed
+	}
+
+	for _, entry := range entries {
+		if entry.IdTagInfo == nil {
+			delete(list, entry.IdTag)
+			continue
+		}
+		list[entry.IdTag] = *entry.IdTagInfo
+	}
+	if maxLength > 0 && len(list) > maxLength {
+		return ocpp.UpdateStatusFailed
+	}
+
+	s.list = list
+	s.listVersion = version
+	return ocpp.UpdateStatusAccepted
+}
+
+// Lookup returns the information held about an idTag, from the list and
+// then from the cache as enabled. An entry past its expiry date is Expired.
+func (s *AuthorizationStore) Lookup(idTag string, useList, useCache bool, now time.Time) (ocpp.IdTagInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, found := s.list[idTag]
+	if !found || !useList {
+		info, found = s.cache[idTag]
+		found = found && useCache
+	}
+	if !found {
+		return ocpp.IdTagInfo{}, false
+	}
+	if info.ExpiryDate != nil && info.ExpiryDate.Before(now) && info.Status == "Accepted" {
+		info.Status = "Expired"
+	}
+	return info, true
+}
+
+// Cache remembers the information the CSMS returned for an idTag, unless
+// the idTag is on the local list
+func (s *AuthorizationStore) Cache(idTag string, info ocpp.IdTagInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, listed := s.list[idTag]; !listed {
+		s.cache[idTag] = info
+	}
+}
+
+// ClearCache forgets every cached idTag
+func (s *AuthorizationStore) ClearCache() {
+	s.mu.Lock()
+	s.cache = make(map[string]ocpp.IdTagInfo)
+	s.mu.Unlock()
+}
+
+// Authorizations returns the local authorization list and cache of the charger
+func (vc *VirtualCharger) Authorizations() *AuthorizationStore {
+	return vc.authorizations
+}
+
+// authorizeIdTag decides whether an idTag may charge. Online the CSMS is
+// asked, unless LocalPreAuthorize lets the local list or cache accept the
+// idTag right away. Offline the local list and cache answer with
+// LocalAuthorizeOffline, unknown idTags need AllowOfflineTxForUnknownId.
+func (vc *VirtualCharger) authorizeIdTag(idTag string) (ocpp.IdTagInfo, error) {
+	local, known := vc.authorizations.Lookup(idTag,
+		vc.configuration.GetBool(KeyLocalAuthListEnabled, true),
+		vc.configuration.GetBool(KeyAuthorizationCacheEnabled, true),
+		time.Now())
+
+	if vc.IsConnected() {
+		if known && local.Status == "Accepted" && vc.configuration.GetBool(KeyLocalPreAuthorize, false) {
+			return local, nil
+		}
+		info, err := vc.authorize(idTag)
+		if err != nil {
+			return ocpp.IdTagInfo{}, err
+		}
+		vc.cacheIdTag(idTag, info)
+		return info, nil
+	}
+
+	if known && vc.configuration.GetBool(KeyLocalAuthorizeOffline, true) {
+		return local, nil
+	}
+	if vc.configuration.GetBool(KeyAllowOfflineTxForUnknownId, false) {
+		return ocpp.IdTagInfo{Status: "Accepted"}, nil
+	}
+	return ocpp.IdTagInfo{Status: "Invalid"}, nil
+}
+
+// cacheIdTag keeps the IdTagInfo the CSMS returned if the cache is enabled
+func (vc *VirtualCharger) cacheIdTag(idTag string, info ocpp.IdTagInfo) {
+	if vc.configuration.GetBool(KeyAuthorizationCacheEnabled, true) {
+		vc.authorizations.Cache(idTag, info)
+	}
+}
+
+// handleSendLocalList installs a full or differential local authorization list
+func (vc *VirtualCharger) handleSendLocalList(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.SendLocalListRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	status := ocpp.UpdateStatusNotSupported
+	switch {
+	case !vc.configuration.GetBool(KeyLocalAuthListEnabled, true):
+	case len(req.LocalAuthorizationList) > vc.configuration.GetInt(KeySendLocalListMaxLength, 100):
+		status = ocpp.UpdateStatusFailed
+	default:
+		status = vc.authorizations.UpdateList(req.ListVersion, req.UpdateType, req.LocalAuthorizationList, vc.configuration.GetInt(KeyLocalAuthListMaxLength, 1000))
+	}
+
+	vc.logger.WithFields(logrus.Fields{
+		"list_version": req.ListVersion,
+		"update_type":  req.UpdateType,
+		"entries":      len(req.LocalAuthorizationList),
+		"status":       status,
+	}).Info("Local authorization list update requested by CSMS")
+
+	if status == ocpp.UpdateStatusAccepted {
+		vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.local_list.updated", vc.id, map[string]interface{}{
+			"list_version": req.ListVersion,
+			"update_type":  req.UpdateType,
+			"length":       vc.authorizations.ListLength(),
+		}))
+	}
+	return &ocpp.SendLocalListResponse{Status: status}, nil, nil
+}
+
+// handleGetLocalListVersion reports the version of the local authorization list
+func (vc *VirtualCharger) handleGetLocalListVersion(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	if !vc.configuration.GetBool(KeyLocalAuthListEnabled, true) {
+		return &ocpp.GetLocalListVersionResponse{ListVersion: -1}, nil, nil
+	}
+	return &ocpp.GetLocalListVersionResponse{ListVersion: vc.authorizations.ListVersion()}, nil, nil
+}
+
+// handleClearCache clears the authorization cache
+func (vc *VirtualCharger) handleClearCache(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	if !vc.configuration.GetBool(KeyAuthorizationCacheEnabled, true) {
+		return &ocpp.ClearCacheResponse{Status: "Rejected"}, nil, nil
+	}
+	vc.authorizations.ClearCache()
+	return &ocpp.ClearCacheResponse{Status: "Accepted"}, nil, nil
+}
@@ -0,0 +1,146 @@
+package charger
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// sendLocalList delivers a SendLocalList and returns its status
+func sendLocalList(t *testing.T, vc *VirtualCharger, client *mockClient, version int, updateType string, entries ...ocpp.AuthorizationData) string {
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeSendLocalList, ocpp.SendLocalListRequest{
+        ListVersion:            version,
+        LocalAuthorizationList: entries,
+        UpdateType:             updateType,
+    })
+    return reply.Payload.(*ocpp.SendLocalListResponse).Status
+}
+
+// listEntry builds a local list entry, an empty status removes the idTag
+func listEntry(idTag, status string) ocpp.AuthorizationData {
+    if status == "" {
+        return ocpp.AuthorizationData{IdTag: idTag}
+    }
+    return ocpp.AuthorizationData{IdTag: idTag, IdTagInfo: &ocpp.IdTagInfo{Status: status}}
+}
+
+func listVersion(t *testing.T, vc *VirtualCharger, client *mockClient) int {
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeGetLocalListVersion, map[string]interface{}{})
+    return reply.Payload.(*ocpp.GetLocalListVersionResponse).ListVersion
+}
+
+func TestHandleSendLocalList(t *testing.T) {
+    vc, client := newTestCharger(1)
+    assert.Equal(t, 0, listVersion(t, vc, client))
+
+    assert.Equal(t, "Accepted", sendLocalList(t, vc, client, 3, ocpp.UpdateTypeFull,
+        listEntry("TAG001", "Accepted"), listEntry("TAG002", "Blocked")))
+    assert.Equal(t, 3, listVersion(t, vc, client))
+    assert.Equal(t, 2, vc.Authorizations().ListLength())
+
+    // Differential updates must raise the version
+    assert.Equal(t, "VersionMismatch", sendLocalList(t, vc, client, 3, ocpp.UpdateTypeDifferential, listEntry("TAG003", "Accepted")))
+    assert.Equal(t, "Accepted", sendLocalList(t, vc, client, 4, ocpp.UpdateTypeDifferential,
+        listEntry("TAG003", "Accepted"), listEntry("TAG001", "")))
+    assert.Equal(t, 4, listVersion(t, vc, client))
+    _, listed := vc.Authorizations().Lookup("TAG001", true, false, time.Now())
+    assert.False(t, listed)
+    info, listed := vc.Authorizations().Lookup("TAG003", true, false, time.Now())
+    assert.True(t, listed)
+    assert.Equal(t, "Accepted", info.Status)
+
+    // A full update may go back to a lower version
+    assert.Equal(t, "Accepted", sendLocalList(t, vc, client, 1, ocpp.UpdateTypeFull, listEntry("TAG004", "Accepted")))
+    assert.Equal(t, 1, vc.Authorizations().ListLength())
+
+    vc.Configuration().Set(KeySendLocalListMaxLength, "1")
+    assert.Equal(t, "Failed", sendLocalList(t, vc, client, 2, ocpp.UpdateTypeFull,
+        listEntry("TAG001", "Accepted"), listEntry("TAG002", "Accepted")))
+
+    vc.Configuration().Set(KeyLocalAuthListEnabled, "false")
+    assert.Equal(t, "NotSupported", sendLocalList(t, vc, client, 5, ocpp.UpdateTypeFull))
+    assert.Equal(t, -1, listVersion(t, vc, client))
+}
+
+func TestVirtualCharger_OfflineStaleLocalList(t *testing.T) {
+    vc, client := newTestCharger(2)
+    require.Equal(t, "Accepted", sendLocalList(t, vc, client, 1, ocpp.UpdateTypeFull,
+        listEntry("TAG001", "Accepted"), listEntry("TAG002", "Blocked")))
+    require.NoError(t, client.Disconnect(context.Background()))
+
+    // The CSMS blocked TAG001 meanwhile, the charger only knows its list
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.True(t, tx.Offline)
+    _, err = vc.StartTransaction(2, "TAG002")
+    assert.Error(t, err)
+    _, err = vc.StartTransaction(2, "TAG003")
+    assert.Error(t, err)
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeAuthorize))
+
+    // The CSMS rejects the idTag once the queued StartTransaction is answered
+    starts := client.sentCalls(ocpp.MessageTypeStartTransaction)
+    require.Len(t, starts, 1)
+    require.NoError(t, vc.HandleMessage(context.Background(), &ocpp.OCPP16Message{
+        MessageType: "CallResult",
+        MessageID:   starts[0].MessageID,
+        Action:      ocpp.MessageTypeStartTransaction,
+        Payload:     &ocpp.StartTransactionResponse{TransactionId: 9, IdTagInfo: ocpp.IdTagInfo{Status: "Blocked"}},
+    }))
+    assert.False(t, tx.IsActive())
+
+    vc.Configuration().Set(KeyLocalAuthorizeOffline, "false")
+    _, err = vc.StartTransaction(1, "TAG001")
+    assert.Error(t, err)
+}
+
+func TestVirtualCharger_AuthorizationCache(t *testing.T) {
+    vc, client := newTestCharger(2)
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    info, cached := vc.Authorizations().Lookup("TAG001", false, true, time.Now())
+    require.True(t, cached)
+    assert.Equal(t, "Accepted", info.Status)
+
+    // Cached idTags start without an Authorize when pre-authorizing locally
+    vc.Configuration().Set(KeyLocalPreAuthorize, "true")
+    tx, err = vc.StartTransaction(2, "TAG001")
+    require.NoError(t, err)
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeAuthorize), 1)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeClearCache, map[string]interface{}{})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ClearCacheResponse).Status)
+    _, cached = vc.Authorizations().Lookup("TAG001", false, true, time.Now())
+    assert.False(t, cached)
+
+    vc.Configuration().Set(KeyAuthorizationCacheEnabled, "false")
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeClearCache, map[string]interface{}{})
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.ClearCacheResponse).Status)
+}
+
+func TestAuthorizationStore_InitialList(t *testing.T) {
+    expired := time.Now().Add(-time.Hour)
+    list := LocalAuthList{Version: 2, Entries: []LocalAuthEntry{
+        {IDTag: "TAG001", ParentIDTag: "FLEET"},
+        {IDTag: "TAG002", ExpiryDate: &expired},
+    }}
+    require.NoError(t, list.Validate())
+    store := NewAuthorizationStore(list)
+    assert.Equal(t, 2, store.ListVersion())
+
+    info, found := store.Lookup("TAG001", true, true, time.Now())
+    require.True(t, found)
+    assert.Equal(t, "Accepted", info.Status)
+    assert.Equal(t, "FLEET", *info.ParentIdTag)
+    info, _ = store.Lookup("TAG002", true, true, time.Now())
+    assert.Equal(t, "Expired", info.Status)
+
+    assert.Error(t, LocalAuthList{Entries: []LocalAuthEntry{{IDTag: "TAG003", Status: "Maybe"}}}.Validate())
+}
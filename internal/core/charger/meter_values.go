@@ -0,0 +1,167 @@
+package charger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+)
+
+// OCPP 1.6 reading contexts
+const (
+	readingContextSamplePeriodic   = "Sample.Periodic"
+	readingContextSampleClock      = "Sample.Clock"
+	readingContextTransactionBegin = "Transaction.Begin"
+	readingContextTransactionEnd   = "Transaction.End"
+	readingContextTrigger          = "Trigger"
+)
+
+// meterValuesLoop samples every active transaction every
+// MeterValueSampleInterval seconds
+func (vc *VirtualCharger) meterValuesLoop() {
+	vc.runConfiguredLoop(KeyMeterValueSampleInterval, func() {
+		if vc.registeredFor(ocpp.MessageTypeMeterValues) {
+			vc.sampleTransactions()
+		}
+	})
+}
+
+// clockAlignedLoop samples every connector at the clock aligned times given
+// by ClockAlignedDataInterval
+func (vc *VirtualCharger) clockAlignedLoop() {
+	vc.configuration.runAlignedLoop(vc.context(), KeyClockAlignedDataInterval, func(at time.Time) {
+		if vc.registeredFor(ocpp.MessageTypeMeterValues) {
+			vc.sampleClockAligned(at)
+		}
+	})
+}
+
+// sampleTransactions sends the MeterValuesSampledData of every active
+// transaction and records its StopTxnSampledData
+func (vc *VirtualCharger) sampleTransactions() {
+	now := time.Now()
+	for _, tx := range vc.activeTransactions() {
+		reading := vc.connectorReading(tx.ConnectorID, now)
+
+		if meterValue, ok := vc.sampleMeterValue(KeyMeterValuesSampledData, now, reading, readingContextSamplePeriodic); ok {
+			if err := vc.sendMeterValues(tx.ConnectorID, tx, meterValue); err != nil {
+				vc.logger.WithError(err).WithField("transaction_id", tx.ID).Error("Failed to send meter values")
+			}
+		}
+		vc.recordTransactionData(tx, KeyStopTxnSampledData, now, reading, readingContextSamplePeriodic)
+	}
+}
+
+// sampleClockAligned sends the MeterValuesAlignedData of every connector,
+// with the transaction active on it if any, and records the StopTxnAlignedData
+// of active transactions
+func (vc *VirtualCharger) sampleClockAligned(at time.Time) {
+	for _, connector := range vc.GetConnectors() {
+		tx := vc.activeTransaction(connector.ID)
+		reading := vc.connectorReading(connector.ID, at)
+
+		if meterValue, ok := vc.sampleMeterValue(KeyMeterValuesAlignedData, at, reading, readingContextSampleClock); ok {
+			if err := vc.sendMeterValues(connector.ID, tx, meterValue); err != nil {
+				vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to send clock aligned meter values")
+			}
+		}
+		if tx != nil {
+			vc.recordTransactionData(tx, KeyStopTxnAlignedData, at, reading, readingContextSampleClock)
+		}
+	}
+}
+
+// activeTransaction returns the transaction active on a connector, nil if
+// there is none
+func (vc *VirtualCharger) activeTransaction(connectorID int) *Transaction {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	for _, tx := range vc.transactions {
+		if tx.ConnectorID == connectorID && tx.IsActive() {
+			return tx
+		}
+	}
+	return nil
+}
+
+// connectorReading advances the charging session on a connector to now and
+// returns its reading, or the idle reading of the connector without one
+func (vc *VirtualCharger) connectorReading(connectorID int, now time.Time) meterReading {
+	vc.mu.RLock()
+	var session *chargingSession
+	for _, s := range vc.charging.sessions {
+		if s.connectorID == connectorID {
+			session = s
+		}
+	}
+	idle := vc.charging.idleReading(connectorID)
+	vc.mu.RUnlock()
+
+	if session == nil {
+		return idle
+	}
+	vc.advanceCharging(session, now)
+	return session.reading()
+}
+
+// sampleMeterValue samples the measurands listed by a configuration key,
+// false if none are configured
+func (vc *VirtualCharger) sampleMeterValue(key string, timestamp time.Time, reading meterReading, readingContext string) (ocpp.MeterValue, bool) {
+	values := sampledValues(reading, vc.configuration.GetList(key), readingContext)
+	if len(values) == 0 {
+		return ocpp.MeterValue{}, false
+	}
+	vc.config.VendorProfile.energyValues(values)
+	return ocpp.MeterValue{Timestamp: timestamp, SampledValue: values}, true
+}
+
+// beginTransactionDataLocked records the Transaction.Begin sample of a new
+// transaction. The caller must hold vc.mu.
+func (vc *VirtualCharger) beginTransactionDataLocked(transaction *Transaction, session *chargingSession) {
+	if meterValue, ok := vc.sampleMeterValue(KeyStopTxnSampledData, transaction.StartTime, session.reading(), readingContextTransactionBegin); ok {
+		vc.transactionData[transaction.ID] = []ocpp.MeterValue{meterValue}
+	}
+}
+
+// recordTransactionData keeps the measurands of a StopTxn*Data key for the
+// TransactionData of the StopTransaction
+func (vc *VirtualCharger) recordTransactionData(transaction *Transaction, key string, timestamp time.Time, reading meterReading, readingContext string) {
+	meterValue, ok := vc.sampleMeterValue(key, timestamp, reading, readingContext)
+	if !ok {
+		return
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if transaction.IsActive() {
+		vc.transactionData[transaction.ID] = append(vc.transactionData[transaction.ID], meterValue)
+	}
+}
+
+// sendMeterValues sends one meter value of a connector, for the transaction
+// if one is given
+func (vc *VirtualCharger) sendMeterValues(connectorID int, transaction *Transaction, meterValue ocpp.MeterValue) error {
+	req := &ocpp.MeterValuesRequest{
+		ConnectorId: connectorID,
+		MeterValue:  []ocpp.MeterValue{meterValue},
+	}
+	if transaction != nil {
+		vc.mu.RLock()
+		csmsTransactionID := transaction.CSMSID
+		vc.mu.RUnlock()
+		req.TransactionId = &csmsTransactionID
+	}
+
+	msg := &ocpp.OCPP16Message{
+		MessageType: "Call",
+		MessageID:   vc.messageIDs.NewMessageID(ocpp.MessageTypeMeterValues),
+		Action:      ocpp.MessageTypeMeterValues,
+		Payload:     req,
+	}
+
+	if err := vc.sendMessage(msg); err != nil {
+		return fmt.Errorf("failed to send meter values: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package charger
+
+import (
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func meterValueContexts(values []ocpp.MeterValue) []string {
+    var contexts []string
+    for _, value := range values {
+        contexts = append(contexts, *value.SampledValue[0].Context)
+    }
+    return contexts
+}
+
+func TestNextAlignedTime(t *testing.T) {
+    now := time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC)
+
+    assert.Equal(t, time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC), nextAlignedTime(now, 15*time.Minute))
+    assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), nextAlignedTime(now.Add(7*time.Minute+30*time.Second), 15*time.Minute))
+
+    // Intervals that do not divide a day restart at midnight
+    assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), nextAlignedTime(time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC), 7*time.Hour))
+}
+
+func TestConfiguration_MeasurandLists(t *testing.T) {
+    store := NewConfigurationStore(ChargerConfig{})
+
+    assert.Equal(t, ConfigurationAccepted, store.Change(KeyMeterValuesSampledData, "Energy.Active.Import.Register, Power.Active.Import,SoC"))
+    assert.Equal(t, ConfigurationAccepted, store.Change(KeyStopTxnSampledData, ""))
+    assert.Equal(t, ConfigurationRejected, store.Change(KeyMeterValuesAlignedData, "Energy.Active.Import.Register,Temperature"))
+    assert.Equal(t, []string{"Energy.Active.Import.Register"}, store.GetList(KeyMeterValuesAlignedData))
+}
+
+func TestVirtualCharger_SampledAndClockAlignedData(t *testing.T) {
+    vc, client := newTestCharger(2)
+    vc.Configuration().Set(KeyMeterValuesSampledData, "Energy.Active.Import.Register,Power.Active.Import,Current.Import")
+    vc.Configuration().Set(KeyStopTxnSampledData, "Energy.Active.Import.Register")
+    vc.Configuration().Set(KeyStopTxnAlignedData, "Energy.Active.Import.Register")
+    require.NoError(t, vc.PlugInEV(1, NewBatteryEV(EVProfile{MaxACPowerKW: 11, Phases: 3}, CurrentTypeAC)))
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    vc.sampleTransactions()
+    meterValues := client.sentCalls(ocpp.MessageTypeMeterValues)
+    require.Len(t, meterValues, 1)
+    periodic := meterValues[0].Payload.(*ocpp.MeterValuesRequest)
+    assert.Equal(t, 1001, *periodic.TransactionId)
+    require.Len(t, periodic.MeterValue[0].SampledValue, 5)
+    for _, value := range periodic.MeterValue[0].SampledValue {
+        assert.Equal(t, "Sample.Periodic", *value.Context)
+    }
+    assert.Equal(t, "L3", *periodic.MeterValue[0].SampledValue[4].Phase)
+
+    // Clock aligned data is sent for every connector, idle ones without a transaction
+    at := time.Now().Truncate(time.Second)
+    vc.sampleClockAligned(at)
+    meterValues = client.sentCalls(ocpp.MessageTypeMeterValues)
+    require.Len(t, meterValues, 3)
+    for i, connectorID := range []int{1, 2} {
+        aligned := meterValues[i+1].Payload.(*ocpp.MeterValuesRequest)
+        assert.Equal(t, connectorID, aligned.ConnectorId)
+        assert.Equal(t, at, aligned.MeterValue[0].Timestamp)
+        assert.Equal(t, "Sample.Clock", *aligned.MeterValue[0].SampledValue[0].Context)
+        assert.Equal(t, "Energy.Active.Import.Register", *aligned.MeterValue[0].SampledValue[0].Measurand)
+    }
+    assert.NotNil(t, meterValues[1].Payload.(*ocpp.MeterValuesRequest).TransactionId)
+    assert.Nil(t, meterValues[2].Payload.(*ocpp.MeterValuesRequest).TransactionId)
+
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    stop := client.sentCalls(ocpp.MessageTypeStopTransaction)[0].Payload.(*ocpp.StopTransactionRequest)
+    assert.Equal(t, []string{"Transaction.Begin", "Sample.Periodic", "Sample.Clock", "Transaction.End"}, meterValueContexts(stop.TransactionData))
+    assert.Equal(t, "0", stop.TransactionData[0].SampledValue[0].Value)
+    assert.Empty(t, vc.transactionData)
+}
+
+func TestVirtualCharger_MeterRegisterPersists(t *testing.T) {
+    vc, client := newTestCharger(1)
+    require.NoError(t, vc.PlugInEV(1, NewBatteryEV(EVProfile{MaxACPowerKW: 7.2, Phases: 1}, CurrentTypeAC)))
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.Equal(t, 0, tx.MeterStart)
+
+    // Half an hour at 7.2 kW
+    vc.advanceCharging(vc.charging.sessions[tx.ID], tx.StartTime.Add(30*time.Minute))
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    assert.Equal(t, 3600, *tx.MeterStop)
+
+    vc.mu.Lock()
+    vc.connectors[0].SetStatus(ConnectorStatusAvailable)
+    vc.mu.Unlock()
+
+    next, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.Equal(t, 3600, next.MeterStart)
+    starts := client.sentCalls(ocpp.MessageTypeStartTransaction)
+    require.Len(t, starts, 2)
+    assert.Equal(t, 3600, starts[1].Payload.(*ocpp.StartTransactionRequest).MeterStart)
+}
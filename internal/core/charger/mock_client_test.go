@@ -0,0 +1,197 @@
+package charger
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// sentFrame records a frame written by the mock client
+type sentFrame struct {
+    Kind      string // Call, CallResult or CallError
+    MessageID string
+    Action    string
+    Payload   interface{}
+}
+
+// mockClient is an in-memory ocpp.Client used to drive VirtualCharger in tests
+type mockClient struct {
+    mu        sync.Mutex
+    connected bool
+    handler   ocpp.MessageHandler
+    connHandler ocpp.ConnectionHandler
+    frames    []sentFrame
+    // transactionID is the last transaction ID handed out by defaultResponse
+    transactionID int
+    // respond answers Calls, returning nil falls back to an empty response
+    respond func(action string, payload interface{}) (interface{}, error)
+}
+
+func newMockClient() *mockClient {
+    return &mockClient{connected: true}
+}
+
+func (m *mockClient) Connect(ctx context.Context) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.connected = true
+    return nil
+}
+
+func (m *mockClient) Disconnect(ctx context.Context) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.connected = false
+    return nil
+}
+
+func (m *mockClient) IsConnected() bool {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.connected
+}
+
+func (m *mockClient) SendMessage(ctx context.Context, message ocpp.Message) error {
+    msg := message.(*ocpp.OCPP16Message)
+    m.record(sentFrame{Kind: "Call", MessageID: msg.MessageID, Action: msg.Action, Payload: msg.Payload})
+    return nil
+}
+
+func (m *mockClient) SetMessageHandler(handler ocpp.MessageHandler) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.handler = handler
+}
+
+func (m *mockClient) SetConnectionHandler(handler ocpp.ConnectionHandler) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.connHandler = handler
+}
+
+func (m *mockClient) Call(ctx context.Context, action string, payload interface{}) (interface{}, error) {
+    m.record(sentFrame{Kind: "Call", Action: action, Payload: payload})
+    if m.respond != nil {
+        if resp, err := m.respond(action, payload); resp != nil || err != nil {
+            return resp, err
+        }
+    }
+    return m.defaultResponse(action)
+}
+
+// defaultResponse answers like a CSMS accepting everything
+func (m *mockClient) defaultResponse(action string) (interface{}, error) {
+    accepted := ocpp.IdTagInfo{Status: "Accepted"}
+    switch action {
+    case ocpp.MessageTypeAuthorize:
+        return &ocpp.AuthorizeResponse{IdTagInfo: accepted}, nil
+    case ocpp.MessageTypeStartTransaction:
+        m.mu.Lock()
+        m.transactionID++
+        id := m.transactionID
+        m.mu.Unlock()
+        return &ocpp.StartTransactionResponse{IdTagInfo: accepted, TransactionId: 1000 + id}, nil
+    case ocpp.MessageTypeSignCertificate:
+        return &ocpp.SignCertificateResponse{Status: "Accepted"}, nil
+    }
+    return ocpp.DecodeCallResult(action, []byte("{}"))
+}
+
+func (m *mockClient) SendCallResult(ctx context.Context, messageID string, payload interface{}) error {
+    m.record(sentFrame{Kind: "CallResult", MessageID: messageID, Payload: payload})
+    return nil
+}
+
+func (m *mockClient) SendCallError(ctx context.Context, messageID string, callErr *ocpp.CallError) error {
+    m.record(sentFrame{Kind: "CallError", MessageID: messageID, Payload: callErr})
+    return nil
+}
+
+func (m *mockClient) ResumeQueue() {}
+
+func (m *mockClient) Start(ctx context.Context) error { return m.Connect(ctx) }
+
+func (m *mockClient) Stop(ctx context.Context) error { return m.Disconnect(ctx) }
+
+func (m *mockClient) record(frame sentFrame) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.frames = append(m.frames, frame)
+}
+
+// sent returns a copy of all recorded frames
+func (m *mockClient) sent() []sentFrame {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return append([]sentFrame(nil), m.frames...)
+}
+
+// sentCalls returns the recorded Calls for an action
+func (m *mockClient) sentCalls(action string) []sentFrame {
+    var calls []sentFrame
+    for _, frame := range m.sent() {
+        if frame.Kind == "Call" && frame.Action == action {
+            calls = append(calls, frame)
+        }
+    }
+    return calls
+}
+
+// newTestCharger creates a charger wired to a mock client
+func newTestCharger(connectors int) (*VirtualCharger, *mockClient) {
+    client := newMockClient()
+    vc := NewVirtualCharger(ChargerConfig{
+        Identifier:     "TEST001",
+        Model:          "TestModel",
+        Vendor:         "TestVendor",
+        ConnectorCount: connectors,
+        OCPPVersion:    "1.6",
+        CSMSEndpoint:   "ws://localhost:8080/ocpp",
+    }, eventbus.NewInMemoryBus())
+    vc.ocppClient = client
+    vc.setRegistrationStatus(RegistrationAccepted)
+    client.SetMessageHandler(vc)
+    return vc, client
+}
+
+// keepaliveMockClient is a mock client that records keepalive adjustments
+type keepaliveMockClient struct {
+    *mockClient
+    intervals   chan time.Duration
+    ignorePings bool
+}
+
+func (m *keepaliveMockClient) SetPingInterval(interval time.Duration) {
+    m.intervals <- interval
+}
+
+func (m *keepaliveMockClient) SetIgnorePings(ignore bool) {
+    m.mu.Lock()
+    m.ignorePings = ignore
+    m.mu.Unlock()
+}
+
+func (m *keepaliveMockClient) KeepaliveStats() ocpp.KeepaliveStats {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.ignorePings {
+        return ocpp.KeepaliveStats{PingsIgnored: 1}
+    }
+    return ocpp.KeepaliveStats{}
+}
+
+// queueMockClient is a mock client that reports messages waiting in its
+// offline queue
+type queueMockClient struct {
+    *mockClient
+    queued int
+}
+
+func (m *queueMockClient) QueuedMessages() int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.queued
+}
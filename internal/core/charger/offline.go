@@ -0,0 +1,145 @@
+package charger
+
+import (
+	"fmt"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// OfflineQueuePolicy configures how a charger buffers messages while it is
+// not connected to the CSMS. Zero values fall back to the client defaults.
+type OfflineQueuePolicy struct {
+	Disabled    bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Size        int    `json:"size,omitempty" yaml:"size,omitempty"`
+	Overflow    string `json:"overflow,omitempty" yaml:"overflow,omitempty"` // drop_oldest, drop_newest or block
+	Dir         string `json:"dir,omitempty" yaml:"dir,omitempty"`           // Persist the queue in this directory
+	QueueAll    bool   `json:"queue_all,omitempty" yaml:"queue_all,omitempty"`
+	MaxAttempts int    `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+}
+
+// clientConfig converts the policy into the OCPP client queue settings
+func (p OfflineQueuePolicy) clientConfig() ocpp.OfflineQueueConfig {
+	return ocpp.OfflineQueueConfig{
+		Disabled:    p.Disabled,
+		Size:        p.Size,
+		Overflow:    ocpp.OverflowPolicy(p.Overflow),
+		Dir:         p.Dir,
+		QueueAll:    p.QueueAll,
+		MaxAttempts: p.MaxAttempts,
+	}
+}
+
+// queuedMessages returns the number of messages the OCPP client holds back
+// for replay
+func (vc *VirtualCharger) queuedMessages() int {
+	if monitor, ok := vc.ocppClient.(ocpp.OfflineQueueMonitor); ok {
+		return monitor.QueuedMessages()
+	}
+	return 0
+}
+
+// startQueuedTransaction starts a transaction whose StartTransaction goes
+// through the offline queue, because the CSMS is unreachable or earlier
+// messages are still queued. Until the CSMS answers it the transaction is
+// reported with a placeholder transaction ID.
+func (vc *VirtualCharger) startQueuedTransaction(transaction *Transaction, connector *Connector) (*Transaction, error) {
+	msg := &ocpp.OCPP16Message{
+		MessageType: "Call",
+		MessageID:   vc.messageIDs.NewMessageID(ocpp.MessageTypeStartTransaction),
+		Action:      ocpp.MessageTypeStartTransaction,
+		Payload: &ocpp.StartTransactionRequest{
+			ConnectorId:   connector.ID,
+			IdTag:         transaction.IDTag,
+			MeterStart:    transaction.MeterStart,
+			ReservationId: transaction.ReservationID,
+			Timestamp:     transaction.StartTime,
+		},
+	}
+
+	offline := !vc.IsConnected()
+	if err := vc.sendMessage(msg); err != nil {
+		vc.mu.Lock()
+		transaction.Fail("StartFailed")
+		vc.releaseConnectorLocked(connector)
+		vc.mu.Unlock()
+		vc.flushStatusNotifications()
+		return nil, fmt.Errorf("failed to queue start transaction: %w", err)
+	}
+
+	vc.mu.Lock()
+	transaction.Offline = offline
+	transaction.Confirm(ocpp.OfflineTransactionID(connector.ID), "")
+	vc.transactions[transaction.ID] = transaction
+	vc.beginTransactionDataLocked(transaction, vc.charging.start(transaction))
+	vc.offlineStarts[msg.MessageID] = transaction.ID
+	connector.starting = false
+	if err := vc.setConnectorStatusLocked(connector, ConnectorStatusCharging, ""); err != nil {
+		vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to set connector status")
+	}
+	vc.mu.Unlock()
+	vc.flushStatusNotifications()
+
+	vc.logger.WithFields(logrus.Fields{
+		"transaction_id": transaction.ID,
+		"offline":        transaction.Offline,
+	}).Info("Transaction started, StartTransaction queued")
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
+		"charger.transaction.started",
+		vc.id,
+		map[string]interface{}{
+			"transaction_id": transaction.ID,
+			"connector_id":   connector.ID,
+			"id_tag":         transaction.IDTag,
+			"offline":        transaction.Offline,
+		},
+	))
+
+	return transaction, nil
+}
+
+// confirmOfflineTransaction adopts the transaction ID the CSMS assigned when a
+// queued StartTransaction is finally answered
+func (vc *VirtualCharger) confirmOfflineTransaction(messageID string, resp *ocpp.StartTransactionResponse) {
+	vc.mu.Lock()
+	transactionID, exists := vc.offlineStarts[messageID]
+	if !exists {
+		vc.mu.Unlock()
+		return
+	}
+	delete(vc.offlineStarts, messageID)
+
+	transaction := vc.transactions[transactionID]
+	transaction.Confirm(resp.TransactionId, resp.IdTagInfo.Status)
+	if session, exists := vc.charging.sessions[transactionID]; exists {
+		session.setTransactionID(resp.TransactionId)
+	}
+	active := transaction.IsActive()
+	vc.mu.Unlock()
+	vc.cacheIdTag(transaction.IDTag, resp.IdTagInfo)
+
+	vc.logger.WithFields(logrus.Fields{
+		"transaction_id":      transactionID,
+		"csms_transaction_id": resp.TransactionId,
+		"id_tag_status":       resp.IdTagInfo.Status,
+	}).Info("Offline transaction confirmed by CSMS")
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
+		"charger.transaction.confirmed",
+		vc.id,
+		map[string]interface{}{
+			"transaction_id":      transactionID,
+			"csms_transaction_id": resp.TransactionId,
+			"connector_id":        transaction.ConnectorID,
+			"id_tag_status":       resp.IdTagInfo.Status,
+		},
+	))
+
+	if active && resp.IdTagInfo.Status != "Accepted" && vc.configuration.GetBool(KeyStopTransactionOnInvalidId, true) {
+		if err := vc.StopTransaction(transactionID, "DeAuthorized"); err != nil {
+			vc.logger.WithError(err).WithField("transaction_id", transactionID).Error("Failed to stop deauthorized transaction")
+		}
+	}
+}
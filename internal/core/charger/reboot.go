@@ -0,0 +1,162 @@
+package charger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// ResetType is how a charger reboots, after the OCPP 1.6 Reset types
+type ResetType string
+
+const (
+	// ResetSoft stops running transactions before the charger goes down
+	ResetSoft ResetType = "Soft"
+	// ResetHard cuts the power: transactions end while the charger is down
+	// and their StopTransactions wait in the offline queue until it is back
+	ResetHard ResetType = "Hard"
+)
+
+// Reasons a charger boots for, reported with the boot_notification.sent
+// event. OCPP 1.6 has no boot reason, they follow the OCPP 2.0.1 BootReason.
+const (
+	BootReasonPowerUp          = "PowerUp"
+	BootReasonRemoteReset      = "RemoteReset"
+	BootReasonFirmwareUpdate   = "FirmwareUpdate"
+	BootReasonApplicationReset = "ApplicationReset"
+)
+
+// powerCycle is the time from powering on a charger until it stops or
+// reboots. Background routines end with its context.
+type powerCycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newPowerCycle() *powerCycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &powerCycle{ctx: ctx, cancel: cancel}
+}
+
+// context returns the context of the current power cycle
+func (vc *VirtualCharger) context() context.Context {
+	return vc.power.Load().(*powerCycle).ctx
+}
+
+// cancel ends the current power cycle
+func (vc *VirtualCharger) cancel() {
+	vc.powerMu.Lock()
+	defer vc.powerMu.Unlock()
+	vc.power.Load().(*powerCycle).cancel()
+}
+
+// powerOn begins a new power cycle once the previous one has ended
+func (vc *VirtualCharger) powerOn() {
+	vc.powerMu.Lock()
+	defer vc.powerMu.Unlock()
+	if vc.context().Err() != nil {
+		vc.power.Store(newPowerCycle())
+	}
+}
+
+// nextPowerCycle ends the current power cycle and begins the next one. It
+// fails if the current one has already been ended by Stop.
+func (vc *VirtualCharger) nextPowerCycle(current *powerCycle) bool {
+	vc.powerMu.Lock()
+	defer vc.powerMu.Unlock()
+	if current.ctx.Err() != nil {
+		return false
+	}
+	current.cancel()
+	vc.power.Store(newPowerCycle())
+	return true
+}
+
+// BootReason returns why the charger booted last
+func (vc *VirtualCharger) BootReason() string {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return vc.bootReason
+}
+
+// Reboot restarts the charger without being asked by the CSMS. A soft reboot
+// stops transactions with reason Reboot, a hard one is a power cut stopping
+// them with PowerLoss. It returns once the charger has booted again.
+func (vc *VirtualCharger) Reboot(resetType ResetType) error {
+	switch resetType {
+	case ResetSoft:
+		return vc.reboot(resetType, "Reboot", BootReasonApplicationReset)
+	case ResetHard:
+		return vc.reboot(resetType, "PowerLoss", BootReasonPowerUp)
+	}
+	return fmt.Errorf("invalid reset type: %s", resetType)
+}
+
+// reboot takes the charger down, stopping running transactions with the
+// stop reason, and boots it again with the boot reason after RebootDelay
+func (vc *VirtualCharger) reboot(resetType ResetType, stopReason, bootReason string) error {
+	current := vc.power.Load().(*powerCycle)
+	if current.ctx.Err() != nil {
+		return fmt.Errorf("charger is stopped")
+	}
+
+	vc.logger.WithFields(logrus.Fields{
+		"type":   resetType,
+		"reason": stopReason,
+	}).Info("Rebooting virtual charger")
+
+	transactions := vc.activeTransactions()
+	if resetType == ResetSoft {
+		vc.stopTransactions(transactions, stopReason)
+	}
+
+	vc.stopBootRetry()
+	if err := vc.ocppClient.Disconnect(context.Background()); err != nil {
+		vc.logger.WithError(err).Error("Failed to disconnect for reboot")
+	}
+	vc.setStatus(StatusOffline)
+
+	// Without power the StopTransactions are queued until the charger is back
+	if resetType == ResetHard {
+		vc.stopTransactions(transactions, stopReason)
+	}
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.rebooting", vc.id, map[string]interface{}{
+		"type":                string(resetType),
+		"reason":              stopReason,
+		"boot_reason":         bootReason,
+		"active_transactions": len(transactions),
+	}))
+
+	// The CSMS has to accept the charger again after it boots. Stopping the
+	// charger while it is down keeps it down.
+	vc.setRegistrationStatus(RegistrationUnknown)
+	if !vc.nextPowerCycle(current) {
+		return fmt.Errorf("charger stopped while rebooting")
+	}
+
+	delay := time.NewTimer(time.Duration(vc.config.RebootDelay * float64(time.Second)))
+	defer delay.Stop()
+	select {
+	case <-delay.C:
+	case <-vc.context().Done():
+		return fmt.Errorf("charger stopped while rebooting")
+	}
+
+	if err := vc.boot(bootReason); err != nil {
+		return fmt.Errorf("failed to boot after reboot: %w", err)
+	}
+	return nil
+}
+
+// stopTransactions stops the given transactions, logging failures
+func (vc *VirtualCharger) stopTransactions(transactions []*Transaction, reason string) {
+	for _, tx := range transactions {
+		if err := vc.StopTransaction(tx.ID, reason); err != nil {
+			vc.logger.WithError(err).WithField("transaction_id", tx.ID).Error("Failed to stop transaction for reboot")
+		}
+	}
+}
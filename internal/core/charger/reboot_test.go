@@ -0,0 +1,253 @@
+package charger
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// newRebootCharger returns a charger whose BootNotifications are accepted
+func newRebootCharger(connectors int) (*VirtualCharger, *mockClient) {
+    vc, client := newTestCharger(connectors)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        if action == ocpp.MessageTypeBootNotification {
+            return &ocpp.BootNotificationResponse{Status: "Accepted", Interval: 120, CurrentTime: time.Now()}, nil
+        }
+        return nil, nil
+    }
+    return vc, client
+}
+
+// frameIndex returns the position of the first recorded Call of an action
+func frameIndex(client *mockClient, action string) int {
+    for i, frame := range client.sent() {
+        if frame.Kind == "Call" && frame.Action == action {
+            return i
+        }
+    }
+    return -1
+}
+
+func TestHandleReset_Soft(t *testing.T) {
+    vc, client := newRebootCharger(2)
+    defer vc.Stop(context.Background())
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeReset, &ocpp.ResetRequest{Type: "Soft"})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ResetResponse).Status)
+    assert.Eventually(t, func() bool { return vc.GetStatus() == StatusConnected && vc.IsConnected() }, time.Second, 10*time.Millisecond)
+
+    // Transactions are stopped before the charger goes down and boots again
+    assert.False(t, tx.IsActive())
+    stop := client.sentCalls(ocpp.MessageTypeStopTransaction)[0].Payload.(*ocpp.StopTransactionRequest)
+    assert.Equal(t, "SoftReset", *stop.Reason)
+    assert.Less(t, frameIndex(client, ocpp.MessageTypeStopTransaction), frameIndex(client, ocpp.MessageTypeBootNotification))
+    assert.Equal(t, BootReasonRemoteReset, vc.BootReason())
+    assert.Equal(t, RegistrationAccepted, vc.GetRegistrationStatus())
+    assert.NoError(t, vc.context().Err())
+}
+
+func TestHandleReset_Hard(t *testing.T) {
+    vc, client := newRebootCharger(2)
+    vc.config.RebootDelay = 0.3
+    defer vc.Stop(context.Background())
+    _, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    deliverCall(t, vc, client, ocpp.MessageTypeReset, &ocpp.ResetRequest{Type: "Hard"})
+
+    // The charger is down for the reboot delay, its transaction stopped offline
+    assert.Eventually(t, func() bool { return len(vc.activeTransactions()) == 0 }, time.Second, 10*time.Millisecond)
+    assert.False(t, vc.IsConnected())
+    assert.Equal(t, StatusOffline, vc.GetStatus())
+    assert.Equal(t, RegistrationUnknown, vc.GetRegistrationStatus())
+    stop := client.sentCalls(ocpp.MessageTypeStopTransaction)[0].Payload.(*ocpp.StopTransactionRequest)
+    assert.Equal(t, "HardReset", *stop.Reason)
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeBootNotification))
+
+    assert.Eventually(t, func() bool { return vc.GetStatus() == StatusConnected }, 2*time.Second, 10*time.Millisecond)
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeBootNotification), 1)
+    assert.Equal(t, RegistrationAccepted, vc.GetRegistrationStatus())
+}
+
+// csmsServer is a CSMS accepting every charger, except that it keeps the
+// charger pending once when it boots again. It records the Calls it receives
+// over all connections.
+type csmsServer struct {
+    *httptest.Server
+    mu    sync.Mutex
+    calls []csmsCall
+}
+
+type csmsCall struct {
+    Action  string
+    Payload json.RawMessage
+}
+
+func newCSMSServer(t *testing.T) *csmsServer {
+    s := &csmsServer{}
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        for {
+            var frame []json.RawMessage
+            if err := conn.ReadJSON(&frame); err != nil {
+                return
+            }
+            var messageType int
+            json.Unmarshal(frame[0], &messageType)
+            if messageType != 2 {
+                continue
+            }
+
+            var messageID, action string
+            json.Unmarshal(frame[1], &messageID)
+            json.Unmarshal(frame[2], &action)
+            s.mu.Lock()
+            s.calls = append(s.calls, csmsCall{Action: action, Payload: frame[3]})
+            s.mu.Unlock()
+
+            payload := map[string]interface{}{}
+            switch action {
+            case ocpp.MessageTypeBootNotification:
+                status := "Accepted"
+                if len(s.callIndexes(action)) == 2 {
+                    status = "Pending"
+                }
+                payload = map[string]interface{}{"status": status, "currentTime": time.Now().UTC(), "interval": 1}
+            case ocpp.MessageTypeAuthorize:
+                payload = map[string]interface{}{"idTagInfo": map[string]string{"status": "Accepted"}}
+            case ocpp.MessageTypeStartTransaction:
+                payload = map[string]interface{}{"transactionId": 42, "idTagInfo": map[string]string{"status": "Accepted"}}
+            }
+            conn.WriteJSON([]interface{}{3, messageID, payload})
+        }
+    }))
+    t.Cleanup(s.Close)
+    return s
+}
+
+// callIndexes returns the positions of the received Calls of an action
+func (s *csmsServer) callIndexes(action string) []int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var indexes []int
+    for i, call := range s.calls {
+        if call.Action == action {
+            indexes = append(indexes, i)
+        }
+    }
+    return indexes
+}
+
+func (s *csmsServer) call(i int) csmsCall {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.calls[i]
+}
+
+func TestVirtualCharger_HardRebootReplaysAfterBoot(t *testing.T) {
+    server := newCSMSServer(t)
+    vc := NewVirtualCharger(ChargerConfig{
+        Identifier:     "TEST001",
+        Model:          "TestModel",
+        Vendor:         "TestVendor",
+        ConnectorCount: 1,
+        OCPPVersion:    "1.6",
+        CSMSEndpoint:   "ws" + strings.TrimPrefix(server.URL, "http"),
+        RebootDelay:    0.1,
+    }, eventbus.NewInMemoryBus())
+    require.NoError(t, vc.Start(context.Background()))
+    defer vc.Stop(context.Background())
+
+    _, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    require.NoError(t, vc.Reboot(ResetHard))
+
+    // The StopTransaction queued during the power cut waits while the CSMS
+    // keeps the charger pending, until it accepts the BootNotification
+    var stops []int
+    require.Eventually(t, func() bool {
+        stops = server.callIndexes(ocpp.MessageTypeStopTransaction)
+        return len(stops) == 1
+    }, 3*time.Second, 10*time.Millisecond)
+    boots := server.callIndexes(ocpp.MessageTypeBootNotification)
+    require.Len(t, boots, 3)
+    assert.Less(t, boots[2], stops[0])
+
+    var stop ocpp.StopTransactionRequest
+    require.NoError(t, json.Unmarshal(server.call(stops[0]).Payload, &stop))
+    assert.Equal(t, 42, stop.TransactionId)
+    assert.Equal(t, "PowerLoss", *stop.Reason)
+}
+
+func TestVirtualCharger_Reboot(t *testing.T) {
+    vc, client := newRebootCharger(1)
+    defer vc.Stop(context.Background())
+    _, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    require.NoError(t, vc.Reboot(ResetHard))
+    stop := client.sentCalls(ocpp.MessageTypeStopTransaction)[0].Payload.(*ocpp.StopTransactionRequest)
+    assert.Equal(t, "PowerLoss", *stop.Reason)
+    assert.Equal(t, BootReasonPowerUp, vc.BootReason())
+    assert.True(t, vc.IsConnected())
+
+    require.NoError(t, vc.Reboot(ResetSoft))
+    assert.Equal(t, BootReasonApplicationReset, vc.BootReason())
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeBootNotification), 2)
+
+    assert.Error(t, vc.Reboot("Cold"))
+}
+
+func TestVirtualCharger_StopWhileRebooting(t *testing.T) {
+    vc, client := newRebootCharger(1)
+    vc.config.RebootDelay = 5
+
+    done := make(chan error, 1)
+    go func() { done <- vc.Reboot(ResetHard) }()
+    assert.Eventually(t, func() bool { return vc.GetRegistrationStatus() == RegistrationUnknown }, time.Second, 10*time.Millisecond)
+    require.NoError(t, vc.Stop(context.Background()))
+
+    select {
+    case err := <-done:
+        assert.Error(t, err)
+    case <-time.After(time.Second):
+        t.Fatal("reboot did not end with the charger stopped")
+    }
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeBootNotification))
+    assert.False(t, vc.IsConnected())
+}
+
+func TestVirtualCharger_Restart(t *testing.T) {
+    vc, client := newRebootCharger(1)
+
+    for i := 1; i <= 3; i++ {
+        require.NoError(t, vc.Start(context.Background()))
+        assert.NoError(t, vc.context().Err())
+        assert.Equal(t, StatusConnected, vc.GetStatus())
+        assert.Equal(t, BootReasonPowerUp, vc.BootReason())
+        assert.Len(t, client.sentCalls(ocpp.MessageTypeBootNotification), i)
+
+        require.NoError(t, vc.Stop(context.Background()))
+        assert.Error(t, vc.context().Err())
+        assert.Equal(t, StatusOffline, vc.GetStatus())
+    }
+}
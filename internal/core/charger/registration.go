@@ -0,0 +1,191 @@
+package charger
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// RegistrationStatus represents the BootNotification status assigned by the CSMS
+type RegistrationStatus string
+
+const (
+	RegistrationUnknown  RegistrationStatus = ""
+	RegistrationAccepted RegistrationStatus = "Accepted"
+	RegistrationPending  RegistrationStatus = "Pending"
+	RegistrationRejected RegistrationStatus = "Rejected"
+)
+
+// defaultBootRetryInterval is used when the CSMS does not return an interval
+const defaultBootRetryInterval = 30 * time.Second
+
+// BootBehavior configures deviations from the specified boot sequence, used
+// to emulate chargers that do not follow the OCPP 1.6 registration rules
+type BootBehavior struct {
+	// IgnoreInterval keeps the local HeartbeatInterval instead of adopting the
+	// interval returned in the BootNotification response
+	IgnoreInterval bool `json:"ignore_interval,omitempty" yaml:"ignore_interval,omitempty"`
+	// SendWhilePending allows all messages before the charger is accepted
+	SendWhilePending bool `json:"send_while_pending,omitempty" yaml:"send_while_pending,omitempty"`
+	// RetryInterval overrides the CSMS interval for BootNotification retries (seconds)
+	RetryInterval int `json:"retry_interval,omitempty" yaml:"retry_interval,omitempty"`
+	// NoRetry never re-sends a Pending or Rejected BootNotification
+	NoRetry bool `json:"no_retry,omitempty" yaml:"no_retry,omitempty"`
+}
+
+// GetRegistrationStatus returns the registration status assigned by the CSMS
+func (vc *VirtualCharger) GetRegistrationStatus() RegistrationStatus {
+	status, _ := vc.registration.Load().(RegistrationStatus)
+	return status
+}
+
+// setRegistrationStatus updates the registration status and returns the old one
+func (vc *VirtualCharger) setRegistrationStatus(status RegistrationStatus) RegistrationStatus {
+	old, _ := vc.registration.Swap(status).(RegistrationStatus)
+	return old
+}
+
+// checkRegistration returns an error if the action may not be sent with the
+// current registration status. Until the CSMS accepts the charger only
+// BootNotification is permitted, and while Pending the messages the CSMS
+// triggers.
+func (vc *VirtualCharger) checkRegistration(action string) error {
+	if action == ocpp.MessageTypeBootNotification || vc.config.Boot.SendWhilePending {
+		return nil
+	}
+	if vc.config.VendorProfile.sendsStatusWithoutBoot(action) {
+		return nil
+	}
+
+	status := vc.GetRegistrationStatus()
+	if status == RegistrationAccepted {
+		return nil
+	}
+	if status == RegistrationPending && vc.triggeringAction(action) {
+		return nil
+	}
+	if status == RegistrationUnknown {
+		return fmt.Errorf("%s not permitted before BootNotification is accepted", action)
+	}
+	return fmt.Errorf("%s not permitted while registration is %s", action, status)
+}
+
+// registeredFor reports whether the registration status permits sending an
+// action. Periodic loops skip their ticks until it does, so a Pending or
+// Rejected charger waits quietly instead of failing every interval.
+func (vc *VirtualCharger) registeredFor(action string) bool {
+	return vc.checkRegistration(action) == nil
+}
+
+// sendMessage sends a charger-initiated message without waiting for the response
+func (vc *VirtualCharger) sendMessage(msg *ocpp.OCPP16Message) error {
+	return vc.sendMessageContext(vc.context(), msg)
+}
+
+// sendMessageContext is sendMessage bounded by ctx instead of the power cycle
+func (vc *VirtualCharger) sendMessageContext(ctx context.Context, msg *ocpp.OCPP16Message) error {
+	if err := vc.checkRegistration(msg.Action); err != nil {
+		return err
+	}
+	vc.reuseMessageID(msg)
+	return vc.ocppClient.SendMessage(ctx, msg)
+}
+
+// call sends a charger-initiated request and waits for the CSMS response
+func (vc *VirtualCharger) call(action string, payload interface{}) (interface{}, error) {
+	if err := vc.checkRegistration(action); err != nil {
+		return nil, err
+	}
+	return vc.ocppClient.Call(vc.context(), action, payload)
+}
+
+// handleBootNotificationResponse processes the CSMS answer to a BootNotification
+func (vc *VirtualCharger) handleBootNotificationResponse(resp *ocpp.BootNotificationResponse) {
+	status := RegistrationStatus(resp.Status)
+
+	oldStatus := vc.setRegistrationStatus(status)
+
+	interval := time.Duration(resp.Interval) * time.Second
+
+	switch status {
+	case RegistrationAccepted:
+		vc.logger.WithField("interval", resp.Interval).Info("Boot notification accepted by CSMS")
+		vc.stopBootRetry()
+		// Adopt the heartbeat interval assigned by the CSMS
+		if resp.Interval > 0 && !vc.config.Boot.IgnoreInterval {
+			vc.configuration.Set(KeyHeartbeatInterval, strconv.Itoa(resp.Interval))
+		}
+	case RegistrationPending, RegistrationRejected:
+		vc.logger.WithFields(logrus.Fields{
+			"status":   resp.Status,
+			"interval": resp.Interval,
+		}).Warn("Boot notification not accepted")
+		vc.scheduleBootRetry(interval)
+	default:
+		vc.logger.WithField("status", resp.Status).Error("Invalid boot notification status")
+		vc.scheduleBootRetry(interval)
+	}
+
+	// Messages queued while offline follow once the charger may send them
+	if vc.registeredFor(ocpp.MessageTypeStopTransaction) {
+		vc.ocppClient.ResumeQueue()
+	}
+
+	if oldStatus != status {
+		vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
+			"charger.registration.changed",
+			vc.id,
+			map[string]interface{}{
+				"old_status": string(oldStatus),
+				"new_status": string(status),
+				"interval":   resp.Interval,
+			},
+		))
+	}
+}
+
+// scheduleBootRetry re-sends the BootNotification after the given interval
+func (vc *VirtualCharger) scheduleBootRetry(interval time.Duration) {
+	if vc.config.Boot.NoRetry {
+		return
+	}
+	if vc.config.Boot.RetryInterval > 0 {
+		interval = time.Duration(vc.config.Boot.RetryInterval) * time.Second
+	}
+	if interval <= 0 {
+		interval = defaultBootRetryInterval
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.bootRetry != nil {
+		vc.bootRetry.Stop()
+	}
+	vc.bootRetry = time.AfterFunc(interval, func() {
+		if vc.context().Err() != nil || !vc.IsConnected() {
+			return
+		}
+		vc.logger.Info("Retrying boot notification")
+		if err := vc.sendBootNotification(); err != nil {
+			vc.logger.WithError(err).Error("Failed to retry boot notification")
+			vc.scheduleBootRetry(interval)
+		}
+	})
+}
+
+// stopBootRetry cancels a scheduled BootNotification retry
+func (vc *VirtualCharger) stopBootRetry() {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.bootRetry != nil {
+		vc.bootRetry.Stop()
+		vc.bootRetry = nil
+	}
+}
@@ -0,0 +1,97 @@
+package charger
+
+import (
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    logtest "github.com/sirupsen/logrus/hooks/test"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestRegistration_AcceptedAdoptsInterval(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.setRegistrationStatus(RegistrationUnknown)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        return &ocpp.BootNotificationResponse{Status: "Accepted", Interval: 120, CurrentTime: time.Now()}, nil
+    }
+
+    require.NoError(t, vc.sendBootNotification())
+    assert.Equal(t, RegistrationAccepted, vc.GetRegistrationStatus())
+    assert.Equal(t, 120, vc.Configuration().GetInt(KeyHeartbeatInterval, 0))
+}
+
+func TestRegistration_IgnoreInterval(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.config.Boot.IgnoreInterval = true
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        return &ocpp.BootNotificationResponse{Status: "Accepted", Interval: 120, CurrentTime: time.Now()}, nil
+    }
+
+    require.NoError(t, vc.sendBootNotification())
+    assert.Equal(t, 30, vc.Configuration().GetInt(KeyHeartbeatInterval, 0))
+}
+
+func TestRegistration_PendingBlocksMessagesAndRetries(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.setRegistrationStatus(RegistrationUnknown)
+    defer vc.stopBootRetry()
+
+    boots := 0
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        boots++
+        status := "Pending"
+        if boots > 1 {
+            status = "Accepted"
+        }
+        return &ocpp.BootNotificationResponse{Status: status, Interval: 1, CurrentTime: time.Now()}, nil
+    }
+
+    require.NoError(t, vc.sendBootNotification())
+    assert.Equal(t, RegistrationPending, vc.GetRegistrationStatus())
+
+    err := vc.sendHeartbeat()
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "not permitted while registration is Pending")
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeHeartbeat))
+
+    // The BootNotification is re-sent after the interval returned by the CSMS
+    assert.Eventually(t, func() bool {
+        return vc.GetRegistrationStatus() == RegistrationAccepted
+    }, 3*time.Second, 50*time.Millisecond)
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeBootNotification), 2)
+    assert.NoError(t, vc.sendHeartbeat())
+}
+
+func TestRegistration_SendWhilePending(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.setRegistrationStatus(RegistrationPending)
+    vc.config.Boot.SendWhilePending = true
+
+    assert.NoError(t, vc.sendHeartbeat())
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeHeartbeat), 1)
+}
+
+func TestRegistration_LoopsWaitForAcceptance(t *testing.T) {
+    vc, client := newTestCharger(1)
+    logger, hook := logtest.NewNullLogger()
+    vc.logger = logger.WithField("charger_id", vc.id)
+    vc.setRegistrationStatus(RegistrationPending)
+    vc.Configuration().Set(KeyHeartbeatInterval, "1")
+    vc.Configuration().Set(KeyStatusNotificationInterval, "1")
+    defer vc.cancel()
+
+    go vc.heartbeatLoop()
+    go vc.statusLoop()
+
+    // Pending ticks are skipped instead of failing every interval
+    time.Sleep(1500 * time.Millisecond)
+    assert.Empty(t, hook.AllEntries())
+    assert.Empty(t, client.sent())
+
+    vc.setRegistrationStatus(RegistrationAccepted)
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeHeartbeat)) > 0 && len(client.sentCalls(ocpp.MessageTypeStatusNotification)) > 0
+    }, 2*time.Second, 50*time.Millisecond)
+}
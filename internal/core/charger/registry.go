@@ -0,0 +1,53 @@
+package charger
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/ocpp201"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// Constructor creates a charger speaking one OCPP version. It is given the
+// protocol registered for that version to create its OCPP client with.
+type Constructor func(config ChargerConfig, protocol ocpp.Protocol, eventBus eventbus.EventBus) Charger
+
+var (
+	constructorsMu sync.RWMutex
+	constructors   = make(map[string]Constructor)
+)
+
+func init() {
+	RegisterCharger(ocpp.Version16, func(config ChargerConfig, protocol ocpp.Protocol, eventBus eventbus.EventBus) Charger {
+		return newVirtualCharger(config, protocol, eventBus)
+	})
+	RegisterCharger(ocpp201.Version, func(config ChargerConfig, protocol ocpp.Protocol, eventBus eventbus.EventBus) Charger {
+		return newChargingStation(config, protocol, eventBus)
+	})
+}
+
+// RegisterCharger makes New create chargers for an OCPP version with the
+// constructor, next to the protocol registered with ocpp.RegisterProtocol.
+// It panics if the version is registered twice.
+func RegisterCharger(version string, constructor Constructor) {
+	constructorsMu.Lock()
+	defer constructorsMu.Unlock()
+
+	if _, exists := constructors[version]; exists {
+		panic(fmt.Sprintf("charger: charger for OCPP %s registered twice", version))
+	}
+	constructors[version] = constructor
+}
+
+// lookupCharger returns the constructor registered for an OCPP version
+func lookupCharger(version string) (Constructor, error) {
+	constructorsMu.RLock()
+	defer constructorsMu.RUnlock()
+
+	constructor, exists := constructors[version]
+	if !exists {
+		return nil, fmt.Errorf("no charger registered for OCPP version %q", version)
+	}
+	return constructor, nil
+}
@@ -0,0 +1,179 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/sirupsen/logrus"
+)
+
+// handleTriggerMessage sends the message requested by the CSMS after the
+// CallResult. Messages of feature profiles the charger does not support are
+// not implemented.
+func (vc *VirtualCharger) handleTriggerMessage(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.TriggerMessageRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	respond := func(status string, trigger func() error) (interface{}, func(), error) {
+		vc.logger.WithFields(logrus.Fields{
+			"requested_message": req.RequestedMessage,
+			"status":            status,
+		}).Info("Message triggered by CSMS")
+		return &ocpp.TriggerMessageResponse{Status: status}, vc.runTrigger(req.RequestedMessage, trigger), nil
+	}
+
+	trigger := vc.coreTrigger(req.RequestedMessage, req.ConnectorId)
+	if vc.checkFeature(FeatureProfileFirmwareManagement) == nil {
+		switch req.RequestedMessage {
+		case ocpp.MessageTypeDiagnosticsStatusNotification:
+			trigger = func() error { return vc.sendDiagnosticsStatus(vc.triggeredDiagnosticsStatus()) }
+		case ocpp.MessageTypeFirmwareStatusNotification:
+			trigger = func() error { return vc.sendFirmwareStatus(vc.triggeredFirmwareStatus()) }
+		}
+	}
+
+	switch {
+	case trigger == nil:
+		return respond(ocpp.TriggerMessageStatusNotImplemented, nil)
+	case !vc.validTriggerConnector(req.ConnectorId), !vc.mayTrigger(req.RequestedMessage):
+		return respond(ocpp.TriggerMessageStatusRejected, nil)
+	}
+	return respond(ocpp.TriggerMessageStatusAccepted, trigger)
+}
+
+// coreTrigger returns the sender of a Core profile message the CSMS may
+// trigger, nil for other messages. Without a connector ID StatusNotification
+// and MeterValues cover the whole charge point.
+func (vc *VirtualCharger) coreTrigger(requestedMessage string, connectorID *int) func() error {
+	switch requestedMessage {
+	case ocpp.MessageTypeBootNotification:
+		return vc.sendBootNotification
+	case ocpp.MessageTypeHeartbeat:
+		return vc.sendHeartbeat
+	case ocpp.MessageTypeStatusNotification:
+		return func() error { return vc.sendTriggeredStatus(connectorID) }
+	case ocpp.MessageTypeMeterValues:
+		return func() error { return vc.sendTriggeredMeterValues(connectorID) }
+	}
+	return nil
+}
+
+// runTrigger returns the follow-up sending a triggered message, nil when
+// there is nothing to send
+func (vc *VirtualCharger) runTrigger(requestedMessage string, trigger func() error) func() {
+	if trigger == nil {
+		return nil
+	}
+	return func() {
+		vc.triggerMu.Lock()
+		vc.triggering[requestedMessage]++
+		vc.triggerMu.Unlock()
+		defer func() {
+			vc.triggerMu.Lock()
+			vc.triggering[requestedMessage]--
+			vc.triggerMu.Unlock()
+		}()
+
+		if err := trigger(); err != nil {
+			vc.logger.WithError(err).WithFields(logrus.Fields{
+				"requested_message": requestedMessage,
+			}).Error("Failed to send triggered message")
+		}
+	}
+}
+
+// mayTrigger reports whether the registration status lets the charger send
+// a triggered message. OCPP 1.6 permits them while Pending.
+func (vc *VirtualCharger) mayTrigger(requestedMessage string) bool {
+	return vc.GetRegistrationStatus() == RegistrationPending || vc.registeredFor(requestedMessage)
+}
+
+// triggeringAction reports whether a triggered message of the action is
+// being sent
+func (vc *VirtualCharger) triggeringAction(action string) bool {
+	vc.triggerMu.Lock()
+	defer vc.triggerMu.Unlock()
+	return vc.triggering[action] > 0
+}
+
+// validTriggerConnector reports whether a triggered message may address a
+// connector, 0 being the charge point
+func (vc *VirtualCharger) validTriggerConnector(connectorID *int) bool {
+	if connectorID == nil {
+		return true
+	}
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return *connectorID >= 0 && *connectorID <= len(vc.connectors)
+}
+
+// sendTriggeredStatus reports the status of a connector, or of the charge
+// point and all connectors
+func (vc *VirtualCharger) sendTriggeredStatus(connectorID *int) error {
+	vc.mu.RLock()
+	connectors := make([]Connector, 0, len(vc.connectors)+1)
+	for _, connector := range append([]*Connector{vc.chargePoint}, vc.connectors...) {
+		if connectorID == nil || *connectorID == connector.ID {
+			connectors = append(connectors, *connector)
+		}
+	}
+	vc.mu.RUnlock()
+
+	for _, connector := range connectors {
+		if err := vc.sendConnectorStatus(connector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendTriggeredMeterValues sends the MeterValuesSampledData of a connector,
+// or of all connectors for the charge point, with the transaction running on
+// it if any
+func (vc *VirtualCharger) sendTriggeredMeterValues(connectorID *int) error {
+	now := time.Now()
+	for _, connector := range vc.GetConnectors() {
+		if connectorID != nil && *connectorID != 0 && *connectorID != connector.ID {
+			continue
+		}
+
+		reading := vc.connectorReading(connector.ID, now)
+		meterValue, ok := vc.sampleMeterValue(KeyMeterValuesSampledData, now, reading, readingContextTrigger)
+		if !ok {
+			continue
+		}
+		if err := vc.sendMeterValues(connector.ID, vc.activeTransaction(connector.ID), meterValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// triggeredFirmwareStatus is the step of a running firmware update, Idle
+// when no update is running
+func (vc *VirtualCharger) triggeredFirmwareStatus() string {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	switch vc.firmwareStatus {
+	case ocpp.FirmwareStatusDownloading, ocpp.FirmwareStatusDownloaded, ocpp.FirmwareStatusInstalling:
+		return vc.firmwareStatus
+	}
+	return ocpp.FirmwareStatusIdle
+}
+
+// triggeredDiagnosticsStatus is Uploading while diagnostics are uploaded,
+// Idle otherwise
+func (vc *VirtualCharger) triggeredDiagnosticsStatus() string {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if vc.diagnosticsStatus == ocpp.DiagnosticsStatusUploading {
+		return ocpp.DiagnosticsStatusUploading
+	}
+	return ocpp.DiagnosticsStatusIdle
+}
@@ -0,0 +1,116 @@
+package charger
+
+import (
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// triggerMessage delivers a TriggerMessage and returns its status
+func triggerMessage(t *testing.T, vc *VirtualCharger, client *mockClient, requestedMessage string, connectorID *int) string {
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeTriggerMessage, &ocpp.TriggerMessageRequest{
+        RequestedMessage: requestedMessage,
+        ConnectorId:      connectorID,
+    })
+    return reply.Payload.(*ocpp.TriggerMessageResponse).Status
+}
+
+func TestHandleTriggerMessage(t *testing.T) {
+    vc, client := newTestCharger(2)
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core")
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeTriggerMessage, &ocpp.TriggerMessageRequest{RequestedMessage: "Heartbeat"})
+    assert.Equal(t, "CallError", reply.Kind)
+    assert.Equal(t, ocpp.ErrorCodeNotSupported, reply.Payload.(*ocpp.CallError).ErrorCode)
+
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core,RemoteTrigger")
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "Heartbeat", nil))
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeHeartbeat)) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    // The requested message follows the CallResult
+    var replied bool
+    for _, frame := range client.sent() {
+        if frame.Kind == "CallResult" {
+            replied = true
+        }
+        if frame.Action == ocpp.MessageTypeHeartbeat {
+            assert.True(t, replied)
+        }
+    }
+
+    connectorID := 2
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "StatusNotification", &connectorID))
+    assert.Eventually(t, func() bool { return len(sentStatuses(client)) == 1 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "StatusNotification", nil))
+    assert.Eventually(t, func() bool { return len(sentStatuses(client)) == 4 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"2:Available", "0:Available", "1:Available", "2:Available"}, sentStatuses(client))
+
+    connectorID = 3
+    assert.Equal(t, "Rejected", triggerMessage(t, vc, client, "StatusNotification", &connectorID))
+
+    // Firmware and diagnostics status belong to the Firmware Management profile
+    assert.Equal(t, "NotImplemented", triggerMessage(t, vc, client, "FirmwareStatusNotification", nil))
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core,RemoteTrigger,FirmwareManagement")
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "FirmwareStatusNotification", nil))
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "DiagnosticsStatusNotification", nil))
+    assert.Eventually(t, func() bool {
+        return len(firmwareStatuses(client)) == 1 && len(diagnosticsStatuses(client)) == 1
+    }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"Idle"}, firmwareStatuses(client))
+    assert.Equal(t, []string{"Idle"}, diagnosticsStatuses(client))
+
+    assert.Equal(t, "NotImplemented", triggerMessage(t, vc, client, "SignChargePointCertificate", nil))
+
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "BootNotification", nil))
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeBootNotification)) == 1
+    }, time.Second, 10*time.Millisecond)
+}
+
+func TestHandleTriggerMessage_MeterValues(t *testing.T) {
+    vc, client := newTestCharger(2)
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core,RemoteTrigger")
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    connectorID := 1
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "MeterValues", &connectorID))
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeMeterValues)) == 1
+    }, time.Second, 10*time.Millisecond)
+    req := client.sentCalls(ocpp.MessageTypeMeterValues)[0].Payload.(*ocpp.MeterValuesRequest)
+    assert.Equal(t, 1, req.ConnectorId)
+    assert.Equal(t, tx.CSMSID, *req.TransactionId)
+    assert.Equal(t, "Trigger", *req.MeterValue[0].SampledValue[0].Context)
+
+    // The whole charge point reports every connector, idle ones without a transaction
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "MeterValues", nil))
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeMeterValues)) == 3
+    }, time.Second, 10*time.Millisecond)
+    assert.Nil(t, client.sentCalls(ocpp.MessageTypeMeterValues)[2].Payload.(*ocpp.MeterValuesRequest).TransactionId)
+}
+
+func TestHandleTriggerMessage_WhilePending(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.Configuration().Set(KeySupportedFeatureProfiles, "Core,RemoteTrigger")
+    vc.setRegistrationStatus(RegistrationPending)
+
+    // A Pending charger sends the messages the CSMS triggers, and only those
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "StatusNotification", nil))
+    assert.Eventually(t, func() bool { return len(sentStatuses(client)) == 2 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "Heartbeat", nil))
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeHeartbeat)) == 1
+    }, time.Second, 10*time.Millisecond)
+    assert.Error(t, vc.sendHeartbeat())
+
+    // A Rejected charger cannot send them
+    vc.setRegistrationStatus(RegistrationRejected)
+    assert.Equal(t, "Rejected", triggerMessage(t, vc, client, "Heartbeat", nil))
+    assert.Equal(t, "Accepted", triggerMessage(t, vc, client, "BootNotification", nil))
+}
@@ -0,0 +1,371 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// Reasons a reservation ends for
+const (
+	reservationEndedUsed      = "Used"
+	reservationEndedCancelled = "Cancelled"
+	reservationEndedExpired   = "Expired"
+	reservationEndedIgnored   = "Ignored" // A driver without the reservation took the connector
+)
+
+// ReservationBehavior configures how the drivers of a charger treat
+// reservations, used by chaos scenarios
+type ReservationBehavior struct {
+	// IgnoreReservations lets any idTag start on a reserved connector, which
+	// ends the reservation, instead of keeping the connector for its idTag
+	IgnoreReservations bool `json:"ignore_reservations,omitempty" yaml:"ignore_reservations,omitempty"`
+}
+
+// Reservation keeps a connector, or any connector for connector 0, for an
+// idTag until it expires
+type Reservation struct {
+	ID          int       `json:"id"`
+	ConnectorID int       `json:"connector_id"`
+	IDTag       string    `json:"id_tag"`
+	ParentIDTag string    `json:"parent_id_tag,omitempty"` // Every idTag of the group may use the reservation
+	ExpiryDate  time.Time `json:"expiry_date"`
+
+	timer *time.Timer
+}
+
+// admits reports whether an idTag, with the parentIdTag the CSMS authorized
+// it with, may use the reservation
+func (r *Reservation) admits(idTag, parentIDTag string) bool {
+	return r.IDTag == idTag || (r.ParentIDTag != "" && r.ParentIDTag == parentIDTag)
+}
+
+// Reservations returns the reservations currently held on the charger
+func (vc *VirtualCharger) Reservations() []Reservation {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	reservations := make([]Reservation, 0, len(vc.reservations))
+	for _, r := range vc.reservations {
+		reservations = append(reservations, *r)
+	}
+	return reservations
+}
+
+// SetIgnoreReservations makes drivers ignore or honor reservations from now on
+func (vc *VirtualCharger) SetIgnoreReservations(ignore bool) {
+	vc.mu.Lock()
+	vc.config.Reservations.IgnoreReservations = ignore
+	vc.mu.Unlock()
+}
+
+// handleReserveNow reserves a connector for an idTag
+func (vc *VirtualCharger) handleReserveNow(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.ReserveNowRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	reservation := &Reservation{
+		ID:          req.ReservationId,
+		ConnectorID: req.ConnectorId,
+		IDTag:       req.IdTag,
+		ExpiryDate:  req.ExpiryDate,
+	}
+	if req.ParentIdTag != nil {
+		reservation.ParentIDTag = *req.ParentIdTag
+	}
+
+	status := vc.reserve(reservation)
+	vc.logger.WithFields(logrus.Fields{
+		"reservation_id": req.ReservationId,
+		"connector_id":   req.ConnectorId,
+		"status":         status,
+	}).Info("Reservation requested by CSMS")
+
+	if status != ocpp.ReservationStatusAccepted {
+		return &ocpp.ReserveNowResponse{Status: status}, nil, nil
+	}
+
+	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.reservation.created", vc.id, map[string]interface{}{
+		"reservation_id": reservation.ID,
+		"connector_id":   reservation.ConnectorID,
+		"id_tag":         reservation.IDTag,
+		"expiry_date":    reservation.ExpiryDate,
+	}))
+	return &ocpp.ReserveNowResponse{Status: status}, vc.flushStatusNotifications, nil
+}
+
+// reserve installs a reservation, replacing one with the same ID, and
+// returns the ReserveNow status
+func (vc *VirtualCharger) reserve(reservation *Reservation) string {
+	if !reservation.ExpiryDate.After(time.Now()) {
+		return ocpp.ReservationStatusRejected
+	}
+	if reservation.ConnectorID == 0 && !vc.configuration.GetBool(KeyReserveConnectorZeroSupported, false) {
+		return ocpp.ReservationStatusRejected
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	connector, err := vc.connectorLocked(reservation.ConnectorID)
+	if err != nil {
+		return ocpp.ReservationStatusRejected
+	}
+
+	// A reservation with the same ID is replaced, even on another connector
+	previous := vc.reservations[reservation.ID]
+	if status := vc.reservableLocked(connector, previous); status != ocpp.ReservationStatusAccepted {
+		return status
+	}
+	if previous != nil {
+		vc.endReservationLocked(previous, previous.ConnectorID != reservation.ConnectorID)
+	}
+
+	if connector.ID != 0 {
+		if err := vc.setConnectorStatusLocked(connector, ConnectorStatusReserved, ""); err != nil {
+			vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to reserve connector")
+			return ocpp.ReservationStatusRejected
+		}
+	}
+	vc.reservations[reservation.ID] = reservation
+	reservation.timer = time.AfterFunc(time.Until(reservation.ExpiryDate), func() {
+		vc.expireReservation(reservation)
+	})
+	return ocpp.ReservationStatusAccepted
+}
+
+// reservableLocked returns the ReserveNow status for a connector, ignoring
+// the reservation about to be replaced. The caller must hold vc.mu.
+func (vc *VirtualCharger) reservableLocked(connector *Connector, replaced *Reservation) string {
+	switch connector.Status {
+	case ConnectorStatusFaulted:
+		return ocpp.ReservationStatusFaulted
+	case ConnectorStatusUnavailable:
+		return ocpp.ReservationStatusUnavailable
+	}
+
+	// Connector 0 needs a free connector for each of its reservations
+	if connector.ID == 0 {
+		reserved := 0
+		for _, r := range vc.reservations {
+			if r.ConnectorID == 0 && r != replaced {
+				reserved++
+			}
+		}
+		if vc.freeConnectorsLocked(nil) <= reserved {
+			return ocpp.ReservationStatusOccupied
+		}
+		return ocpp.ReservationStatusAccepted
+	}
+
+	if r := vc.connectorReservationLocked(connector.ID); r != nil && r != replaced {
+		return ocpp.ReservationStatusOccupied
+	}
+	if connector.Status == ConnectorStatusReserved && replaced != nil && replaced.ConnectorID == connector.ID {
+		return ocpp.ReservationStatusAccepted
+	}
+	if connector.Status != ConnectorStatusAvailable || connector.starting {
+		return ocpp.ReservationStatusOccupied
+	}
+	return ocpp.ReservationStatusAccepted
+}
+
+// freeConnectorsLocked counts the Available connectors nobody is starting a
+// transaction on, except the given one. The caller must hold vc.mu.
+func (vc *VirtualCharger) freeConnectorsLocked(except *Connector) int {
+	free := 0
+	for _, connector := range vc.connectors {
+		if connector != except && connector.Status == ConnectorStatusAvailable && !connector.starting {
+			free++
+		}
+	}
+	return free
+}
+
+// connectorReservationLocked returns the reservation of a connector, nil if
+// it has none. The caller must hold vc.mu.
+func (vc *VirtualCharger) connectorReservationLocked(connectorID int) *Reservation {
+	for _, r := range vc.reservations {
+		if r.ConnectorID == connectorID {
+			return r
+		}
+	}
+	return nil
+}
+
+// handleCancelReservation ends a reservation on request of the CSMS
+func (vc *VirtualCharger) handleCancelReservation(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.CancelReservationRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	vc.mu.Lock()
+	reservation, exists := vc.reservations[req.ReservationId]
+	if exists {
+		vc.endReservationLocked(reservation, true)
+	}
+	vc.mu.Unlock()
+
+	if !exists {
+		return &ocpp.CancelReservationResponse{Status: "Rejected"}, nil, nil
+	}
+	return &ocpp.CancelReservationResponse{Status: "Accepted"}, func() {
+		vc.publishReservationEnded(reservation, reservationEndedCancelled)
+		vc.flushStatusNotifications()
+	}, nil
+}
+
+// expireReservation ends a reservation nobody used before its expiry date
+func (vc *VirtualCharger) expireReservation(reservation *Reservation) {
+	vc.mu.Lock()
+	current := vc.reservations[reservation.ID] == reservation
+	if current {
+		vc.endReservationLocked(reservation, true)
+	}
+	vc.mu.Unlock()
+
+	if current {
+		vc.logger.WithField("reservation_id", reservation.ID).Info("Reservation expired")
+		vc.publishReservationEnded(reservation, reservationEndedExpired)
+		vc.flushStatusNotifications()
+	}
+}
+
+// endReservationLocked removes a reservation, and frees its connector if
+// release is set rather than leaving it to a transaction. The caller must
+// hold vc.mu and call flushStatusNotifications after releasing it.
+func (vc *VirtualCharger) endReservationLocked(reservation *Reservation, release bool) {
+	reservation.timer.Stop()
+	delete(vc.reservations, reservation.ID)
+
+	if reservation.ConnectorID == 0 || !release {
+		return
+	}
+	connector := vc.connectors[reservation.ConnectorID-1]
+	if connector.Status == ConnectorStatusReserved {
+		if err := vc.setConnectorStatusLocked(connector, vc.idleStatusLocked(connector), ""); err != nil {
+			vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to free reserved connector")
+		}
+	}
+}
+
+// publishReservationEnded reports the end of a reservation
+func (vc *VirtualCharger) publishReservationEnded(reservation *Reservation, reason string) {
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.reservation.ended", vc.id, map[string]interface{}{
+		"reservation_id": reservation.ID,
+		"connector_id":   reservation.ConnectorID,
+		"reason":         reason,
+	}))
+}
+
+// blockingReservation returns the reservation that keeps an idTag from
+// starting on a connector, nil if the idTag may start there
+func (vc *VirtualCharger) blockingReservation(connectorID int, idTag string) *Reservation {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	if connectorID < 1 || connectorID > len(vc.connectors) {
+		return nil
+	}
+	return vc.blockingReservationLocked(vc.connectors[connectorID-1], idTag, "")
+}
+
+// blockingReservationLocked returns the reservation of the connector, or
+// the connector 0 reservation it is kept free for, that does not admit the
+// idTag. The caller must hold vc.mu.
+func (vc *VirtualCharger) blockingReservationLocked(connector *Connector, idTag, parentIDTag string) *Reservation {
+	if r := vc.connectorReservationLocked(connector.ID); r != nil {
+		if r.admits(idTag, parentIDTag) {
+			return nil
+		}
+		return r
+	}
+
+	// Connector 0 reservations take the last free connectors
+	var others []*Reservation
+	for _, r := range vc.reservations {
+		if r.ConnectorID != 0 {
+			continue
+		}
+		if r.admits(idTag, parentIDTag) {
+			return nil
+		}
+		others = append(others, r)
+	}
+	if len(others) > 0 && vc.freeConnectorsLocked(connector) < len(others) {
+		return others[0]
+	}
+	return nil
+}
+
+// takeReservationLocked returns the reservation a transaction of the idTag
+// on the connector uses, nil if there is none. A reservation held for
+// another idTag fails the start unless drivers ignore reservations. The
+// caller must hold vc.mu and publish the end of the returned reservations.
+func (vc *VirtualCharger) takeReservationLocked(connector *Connector, idTag, parentIDTag string) (used *Reservation, ignored *Reservation, err error) {
+	if blocking := vc.blockingReservationLocked(connector, idTag, parentIDTag); blocking != nil {
+		if !vc.config.Reservations.IgnoreReservations {
+			return nil, nil, fmt.Errorf("connector %d is reserved for another id tag", connector.ID)
+		}
+		// Reservations of connector 0 can still be served by another connector
+		if blocking.ConnectorID != 0 {
+			vc.endReservationLocked(blocking, false)
+			ignored = blocking
+		}
+		return nil, ignored, nil
+	}
+
+	if r := vc.connectorReservationLocked(connector.ID); r != nil {
+		used = r
+	} else {
+		for _, r := range vc.reservations {
+			if r.ConnectorID == 0 && r.admits(idTag, parentIDTag) {
+				used = r
+				break
+			}
+		}
+	}
+	if used != nil {
+		vc.endReservationLocked(used, false)
+	}
+	return used, nil, nil
+}
+
+// reservedParentIDTag looks up the parentIdTag of an idTag when a
+// reservation made for a group could admit it
+func (vc *VirtualCharger) reservedParentIDTag(connectorID int, idTag string) (string, error) {
+	r := vc.blockingReservation(connectorID, idTag)
+	if r == nil || r.ParentIDTag == "" {
+		return "", nil
+	}
+
+	info, err := vc.authorizeIdTag(idTag)
+	if err != nil {
+		return "", err
+	}
+	if info.Status != "Accepted" || info.ParentIdTag == nil {
+		return "", nil
+	}
+	return *info.ParentIdTag, nil
+}
+
+// restoreReservationLocked puts back a reservation a transaction failed to
+// start with, unless it expired or was replaced meanwhile. The caller must
+// hold vc.mu.
+func (vc *VirtualCharger) restoreReservationLocked(reservation *Reservation) {
+	if _, replaced := vc.reservations[reservation.ID]; replaced || !reservation.ExpiryDate.After(time.Now()) {
+		return
+	}
+	vc.reservations[reservation.ID] = reservation
+	reservation.timer = time.AfterFunc(time.Until(reservation.ExpiryDate), func() {
+		vc.expireReservation(reservation)
+	})
+}
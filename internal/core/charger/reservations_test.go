@@ -0,0 +1,166 @@
+package charger
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// reserveNow delivers a ReserveNow and returns its status
+func reserveNow(t *testing.T, vc *VirtualCharger, client *mockClient, reservationID, connectorID int, idTag string, expiry time.Duration) string {
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeReserveNow, map[string]interface{}{
+        "connectorId":   connectorID,
+        "expiryDate":    time.Now().Add(expiry),
+        "idTag":         idTag,
+        "reservationId": reservationID,
+    })
+    return reply.Payload.(*ocpp.ReserveNowResponse).Status
+}
+
+func TestHandleReserveNow(t *testing.T) {
+    vc, client := newTestCharger(2)
+
+    assert.Equal(t, "Accepted", reserveNow(t, vc, client, 1, 1, "TAG001", time.Hour))
+    assert.Equal(t, ConnectorStatusReserved, vc.GetConnectors()[0].Status)
+    assert.Eventually(t, func() bool {
+        return len(sentStatuses(client)) == 1
+    }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"1:Reserved"}, sentStatuses(client))
+
+    // Another reservation cannot take the connector, the same ID replaces it
+    assert.Equal(t, "Occupied", reserveNow(t, vc, client, 2, 1, "TAG002", time.Hour))
+    assert.Equal(t, "Accepted", reserveNow(t, vc, client, 1, 2, "TAG001", time.Hour))
+    assert.Equal(t, ConnectorStatusAvailable, vc.GetConnectors()[0].Status)
+    assert.Equal(t, ConnectorStatusReserved, vc.GetConnectors()[1].Status)
+
+    require.NoError(t, vc.Fault(1, ErrorCodeGroundFailure))
+    assert.Equal(t, "Faulted", reserveNow(t, vc, client, 3, 1, "TAG003", time.Hour))
+    assert.Equal(t, "Rejected", reserveNow(t, vc, client, 3, 3, "TAG003", time.Hour))
+    assert.Equal(t, "Rejected", reserveNow(t, vc, client, 3, 2, "TAG003", -time.Minute))
+    assert.Len(t, vc.Reservations(), 1)
+}
+
+func TestVirtualCharger_ReservationUsedByIdTag(t *testing.T) {
+    vc, client := newTestCharger(1)
+    require.Equal(t, "Accepted", reserveNow(t, vc, client, 7, 1, "TAG001", time.Hour))
+
+    // A plugged in EV waits for the reserved idTag
+    require.NoError(t, vc.PlugIn(1))
+    assert.Equal(t, ConnectorStatusReserved, vc.GetConnectors()[0].Status)
+
+    _, err := vc.StartTransaction(1, "TAG002")
+    assert.Error(t, err)
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeStartTransaction))
+
+    _, err = vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    starts := client.sentCalls(ocpp.MessageTypeStartTransaction)
+    require.Len(t, starts, 1)
+    assert.Equal(t, 7, *starts[0].Payload.(*ocpp.StartTransactionRequest).ReservationId)
+    assert.Empty(t, vc.Reservations())
+    assert.Equal(t, ConnectorStatusCharging, vc.GetConnectors()[0].Status)
+}
+
+func TestVirtualCharger_ReservationParentIdTag(t *testing.T) {
+    vc, client := newTestCharger(1)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        if action == ocpp.MessageTypeAuthorize {
+            parent := "FLEET"
+            if payload.(*ocpp.AuthorizeRequest).IdTag == "OTHER" {
+                parent = "PRIVATE"
+            }
+            return &ocpp.AuthorizeResponse{IdTagInfo: ocpp.IdTagInfo{Status: "Accepted", ParentIdTag: &parent}}, nil
+        }
+        return nil, nil
+    }
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeReserveNow, map[string]interface{}{
+        "connectorId":   1,
+        "expiryDate":    time.Now().Add(time.Hour),
+        "idTag":         "DRIVER1",
+        "parentIdTag":   "FLEET",
+        "reservationId": 3,
+    })
+    require.Equal(t, "Accepted", reply.Payload.(*ocpp.ReserveNowResponse).Status)
+
+    _, err := vc.StartTransaction(1, "OTHER")
+    assert.Error(t, err)
+
+    // A colleague of the same fleet may use the reservation
+    _, err = vc.StartTransaction(1, "DRIVER2")
+    require.NoError(t, err)
+    assert.Equal(t, 3, *client.sentCalls(ocpp.MessageTypeStartTransaction)[0].Payload.(*ocpp.StartTransactionRequest).ReservationId)
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeAuthorize), 2)
+}
+
+func TestVirtualCharger_ReservationEnds(t *testing.T) {
+    vc, client := newTestCharger(2)
+
+    events := make(chan eventbus.Event, 10)
+    vc.eventBus.Subscribe("charger.reservation.ended", func(ctx context.Context, event eventbus.Event) error {
+        events <- event
+        return nil
+    })
+    reason := func() string {
+        select {
+        case event := <-events:
+            return event.Data().(eventbus.ChargerEvent).Data["reason"].(string)
+        case <-time.After(time.Second):
+            t.Fatal("reservation did not end")
+            return ""
+        }
+    }
+
+    require.Equal(t, "Accepted", reserveNow(t, vc, client, 1, 1, "TAG001", 50*time.Millisecond))
+    assert.Equal(t, "Expired", reason())
+    assert.Equal(t, ConnectorStatusAvailable, vc.GetConnectors()[0].Status)
+
+    require.Equal(t, "Accepted", reserveNow(t, vc, client, 2, 2, "TAG002", time.Hour))
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeCancelReservation, map[string]interface{}{"reservationId": 2})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.CancelReservationResponse).Status)
+    assert.Equal(t, "Cancelled", reason())
+    assert.Equal(t, ConnectorStatusAvailable, vc.GetConnectors()[1].Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeCancelReservation, map[string]interface{}{"reservationId": 2})
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.CancelReservationResponse).Status)
+
+    // Drivers ignoring reservations take the connector and end the reservation
+    require.Equal(t, "Accepted", reserveNow(t, vc, client, 3, 1, "TAG001", time.Hour))
+    vc.SetIgnoreReservations(true)
+    _, err := vc.StartTransaction(1, "TAG002")
+    require.NoError(t, err)
+    assert.Equal(t, "Ignored", reason())
+    assert.Nil(t, client.sentCalls(ocpp.MessageTypeStartTransaction)[0].Payload.(*ocpp.StartTransactionRequest).ReservationId)
+}
+
+func TestVirtualCharger_ConnectorZeroReservation(t *testing.T) {
+    vc, client := newTestCharger(2)
+
+    require.Equal(t, "Accepted", reserveNow(t, vc, client, 1, 0, "TAG001", time.Hour))
+    assert.Equal(t, ConnectorStatusAvailable, vc.GetConnectors()[0].Status)
+
+    // One connector stays free for the reservation
+    _, err := vc.StartTransaction(1, "TAG002")
+    require.NoError(t, err)
+    assert.Equal(t, "Occupied", reserveNow(t, vc, client, 2, 0, "TAG003", time.Hour))
+    _, err = vc.StartTransaction(2, "TAG003")
+    assert.Error(t, err)
+
+    // A remote start picks the free connector for the reserved idTag
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeRemoteStartTransaction, map[string]interface{}{"idTag": "TAG001"})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.RemoteStartTransactionResponse).Status)
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeStartTransaction)) == 2
+    }, time.Second, 10*time.Millisecond)
+    start := client.sentCalls(ocpp.MessageTypeStartTransaction)[1].Payload.(*ocpp.StartTransactionRequest)
+    assert.Equal(t, 2, start.ConnectorId)
+    assert.Equal(t, 1, *start.ReservationId)
+
+    vc.Configuration().Set(KeyReserveConnectorZeroSupported, "false")
+    assert.Equal(t, "Rejected", reserveNow(t, vc, client, 4, 0, "TAG004", time.Hour))
+}
@@ -0,0 +1,71 @@
+package charger
+
+import (
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/schema"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// SchemaValidationPolicy configures the validation of OCPP payloads against
+// the JSON schemas. CSMS payloads are validated unless validation is disabled.
+type SchemaValidationPolicy struct {
+	Disabled     bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	SkipOutgoing bool `json:"skip_outgoing,omitempty" yaml:"skip_outgoing,omitempty"` // Allow sending invalid payloads
+}
+
+// clientConfig converts the policy into the OCPP client validation settings
+func (p SchemaValidationPolicy) clientConfig() ocpp.SchemaValidationConfig {
+	return ocpp.SchemaValidationConfig{
+		Disabled:     p.Disabled,
+		SkipOutgoing: p.SkipOutgoing,
+	}
+}
+
+// SchemaViolation is a finding about a payload that did not match its schema
+type SchemaViolation struct {
+	Direction  string             `json:"direction"` // "incoming" or "outgoing"
+	MessageID  string             `json:"message_id"`
+	Action     string             `json:"action"`
+	Violations []schema.Violation `json:"violations"`
+	Error      string             `json:"error"`
+	DetectedAt time.Time          `json:"detected_at"`
+}
+
+// OnSchemaViolation is called by the OCPP client when a payload does not
+// conform to its schema. Incoming violations are CSMS bugs and are recorded
+// as findings of the run.
+func (vc *VirtualCharger) OnSchemaViolation(violation *ocpp.SchemaViolation) {
+	finding := SchemaViolation{
+		Direction:  violation.Direction,
+		MessageID:  violation.MessageID,
+		Action:     violation.Action,
+		Error:      violation.Err.Error(),
+		DetectedAt: time.Now(),
+	}
+	if validationErr, ok := violation.Err.(*schema.ValidationError); ok {
+		finding.Violations = validationErr.Violations
+	}
+
+	vc.findingsMu.Lock()
+	vc.schemaViolations = append(vc.schemaViolations, finding)
+	vc.findingsMu.Unlock()
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.schema_violation", vc.id, map[string]interface{}{
+		"direction":    finding.Direction,
+		"message_type": violation.MessageType,
+		"message_id":   finding.MessageID,
+		"action":       finding.Action,
+		"error_code":   violation.ErrorCode(),
+		"violations":   finding.Violations,
+	}))
+}
+
+// SchemaViolations returns the schema violations detected so far
+func (vc *VirtualCharger) SchemaViolations() []SchemaViolation {
+	vc.findingsMu.Lock()
+	defer vc.findingsMu.Unlock()
+
+	return append([]SchemaViolation(nil), vc.schemaViolations...)
+}
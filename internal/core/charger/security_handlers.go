@@ -0,0 +1,311 @@
+package charger
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+)
+
+// Security events reported through SecurityEventNotification
+const (
+	SecurityEventInvalidChargePointCertificate     = "InvalidChargePointCertificate"
+	SecurityEventInvalidFirmwareSignature          = "InvalidFirmwareSignature"
+	SecurityEventInvalidFirmwareSigningCertificate = "InvalidFirmwareSigningCertificate"
+)
+
+// firmwareState tracks the progress of the last signed firmware update
+type firmwareState struct {
+	status    string // SignedFirmwareStatusNotification status, empty while idle
+	requestID int
+}
+
+// SignCertificate generates a new key pair and asks the CSMS to sign it. The
+// CSMS answers with a CertificateSigned Call carrying the new certificate.
+func (vc *VirtualCharger) SignCertificate() error {
+	cpoName, _ := vc.configuration.Get(KeyCpoName)
+	csr, err := vc.certificates.GenerateCSR(vc.id, cpoName)
+	if err != nil {
+		return err
+	}
+
+	resp, err := vc.call(ocpp.MessageTypeSignCertificate, &ocpp.SignCertificateRequest{Csr: csr})
+	if err != nil {
+		return fmt.Errorf("failed to send sign certificate request: %w", err)
+	}
+	signResp, ok := resp.(*ocpp.SignCertificateResponse)
+	if !ok {
+		return fmt.Errorf("invalid sign certificate response")
+	}
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.certificate.requested", vc.id, map[string]interface{}{
+		"status": signResp.Status,
+	}))
+	if signResp.Status != "Accepted" {
+		return fmt.Errorf("certificate signing request was %s", signResp.Status)
+	}
+	return nil
+}
+
+// SendSecurityEvent notifies the CSMS about a security event
+func (vc *VirtualCharger) SendSecurityEvent(eventType, techInfo string) error {
+	req := &ocpp.SecurityEventNotificationRequest{Type: eventType, Timestamp: time.Now()}
+	if techInfo != "" {
+		// techInfo is limited to 255 characters
+		if runes := []rune(techInfo); len(runes) > 255 {
+			techInfo = string(runes[:255])
+		}
+		req.TechInfo = &techInfo
+	}
+
+	if _, err := vc.call(ocpp.MessageTypeSecurityEventNotification, req); err != nil {
+		return fmt.Errorf("failed to send security event: %w", err)
+	}
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.security_event.sent", vc.id, map[string]interface{}{
+		"type":      eventType,
+		"tech_info": techInfo,
+	}))
+	return nil
+}
+
+// reportSecurityEvent returns a follow-up sending a security event
+func (vc *VirtualCharger) reportSecurityEvent(eventType, techInfo string) func() {
+	return func() {
+		if err := vc.SendSecurityEvent(eventType, techInfo); err != nil {
+			vc.logger.WithError(err).WithField("type", eventType).Error("Failed to report security event")
+		}
+	}
+}
+
+// handleCertificateSigned installs the charge point certificate signed by the CSMS
+func (vc *VirtualCharger) handleCertificateSigned(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.CertificateSignedRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	var err error
+	if maxSize := vc.configuration.GetInt(KeyCertificateSignedMaxChainSize, 0); maxSize > 0 && len(req.CertificateChain) > maxSize {
+		err = fmt.Errorf("certificate chain of %d bytes exceeds %d", len(req.CertificateChain), maxSize)
+	} else {
+		err = vc.certificates.InstallChargePointCertificate(req.CertificateChain, time.Now())
+	}
+
+	if err != nil {
+		vc.logger.WithError(err).Warn("Rejecting charge point certificate")
+		vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.certificate.rejected", vc.id, map[string]interface{}{
+			"reason": err.Error(),
+		}))
+		return &ocpp.CertificateSignedResponse{Status: "Rejected"}, vc.reportSecurityEvent(SecurityEventInvalidChargePointCertificate, err.Error()), nil
+	}
+
+	cert := vc.certificates.ChargePointCertificate()
+	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.certificate.installed", vc.id, map[string]interface{}{
+		"subject":   cert.Subject.String(),
+		"serial":    cert.SerialNumber.Text(16),
+		"not_after": cert.NotAfter,
+	}))
+
+	return &ocpp.CertificateSignedResponse{Status: "Accepted"}, nil, nil
+}
+
+// handleInstallCertificate installs a root certificate sent by the CSMS
+func (vc *VirtualCharger) handleInstallCertificate(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.InstallCertificateRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+	if err := validCertificateType(req.CertificateType); err != nil {
+		return nil, nil, err
+	}
+
+	if maxLength := vc.configuration.GetInt(KeyCertificateStoreMaxLength, 0); maxLength > 0 && vc.certificates.RootCount() >= maxLength {
+		return &ocpp.InstallCertificateResponse{Status: "Rejected"}, nil, nil
+	}
+
+	if err := vc.certificates.InstallRoot(req.CertificateType, req.Certificate); err != nil {
+		vc.logger.WithError(err).WithField("certificate_type", req.CertificateType).Warn("Rejecting root certificate")
+		return &ocpp.InstallCertificateResponse{Status: "Rejected"}, nil, nil
+	}
+
+	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.certificate.root_installed", vc.id, map[string]interface{}{
+		"certificate_type": req.CertificateType,
+	}))
+	return &ocpp.InstallCertificateResponse{Status: "Accepted"}, nil, nil
+}
+
+// handleGetInstalledCertificateIds lists the installed root certificates of a type
+func (vc *VirtualCharger) handleGetInstalledCertificateIds(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.GetInstalledCertificateIdsRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+	if err := validCertificateType(req.CertificateType); err != nil {
+		return nil, nil, err
+	}
+
+	ids := vc.certificates.CertificateIDs(req.CertificateType)
+	if len(ids) == 0 {
+		return &ocpp.GetInstalledCertificateIdsResponse{Status: "NotFound"}, nil, nil
+	}
+	return &ocpp.GetInstalledCertificateIdsResponse{Status: "Accepted", CertificateHashData: ids}, nil, nil
+}
+
+// handleDeleteCertificate removes an installed root certificate
+func (vc *VirtualCharger) handleDeleteCertificate(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.DeleteCertificateRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	found, err := vc.certificates.DeleteRoot(req.CertificateHashData)
+	switch {
+	case err != nil:
+		vc.logger.WithError(err).Warn("Refusing to delete certificate")
+		return &ocpp.DeleteCertificateResponse{Status: "Failed"}, nil, nil
+	case !found:
+		return &ocpp.DeleteCertificateResponse{Status: "NotFound"}, nil, nil
+	}
+
+	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.certificate.deleted", vc.id, map[string]interface{}{
+		"serial": req.CertificateHashData.SerialNumber,
+	}))
+	return &ocpp.DeleteCertificateResponse{Status: "Accepted"}, nil, nil
+}
+
+// validCertificateType rejects unknown root certificate types
+func validCertificateType(certificateType string) error {
+	if certificateType != ocpp.CertificateTypeCentralSystemRoot && certificateType != ocpp.CertificateTypeManufacturerRoot {
+		return ocpp.NewCallError(ocpp.ErrorCodePropertyConstraintViolation, fmt.Sprintf("invalid certificate type: %s", certificateType))
+	}
+	return nil
+}
+
+// handleSignedUpdateFirmware verifies the signing certificate of a firmware
+// update and simulates its download and installation
+func (vc *VirtualCharger) handleSignedUpdateFirmware(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.SignedUpdateFirmwareRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if err := vc.certificates.VerifyFirmwareSigningCertificate(req.Firmware.SigningCertificate, time.Now()); err != nil {
+		vc.logger.WithError(err).WithField("request_id", req.RequestId).Warn("Rejecting firmware signing certificate")
+		return &ocpp.SignedUpdateFirmwareResponse{Status: "InvalidCertificate"}, vc.reportSecurityEvent(SecurityEventInvalidFirmwareSigningCertificate, err.Error()), nil
+	}
+
+	return &ocpp.SignedUpdateFirmwareResponse{Status: "Accepted"}, func() { vc.installSignedFirmware(req) }, nil
+}
+
+// installSignedFirmware reports the steps of a signed firmware update. The
+// image is not downloaded: a signature that is not valid base64 is treated
+// as invalid.
+func (vc *VirtualCharger) installSignedFirmware(req ocpp.SignedUpdateFirmwareRequest) {
+	report := func(status string) bool {
+		if err := vc.sendSignedFirmwareStatus(status, req.RequestId); err != nil {
+			vc.logger.WithError(err).WithField("status", status).Error("Failed to send signed firmware status")
+			return false
+		}
+		return true
+	}
+
+	if time.Now().Before(req.Firmware.RetrieveDateTime) {
+		if !report("DownloadScheduled") || !vc.waitUntil(req.Firmware.RetrieveDateTime) {
+			return
+		}
+	}
+	if !report("Downloading") || !report("Downloaded") {
+		return
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(req.Firmware.Signature)
+	if err != nil || len(signature) == 0 {
+		if report("InvalidSignature") {
+			vc.reportSecurityEvent(SecurityEventInvalidFirmwareSignature, fmt.Sprintf("request %d", req.RequestId))()
+		}
+		return
+	}
+	if !report("SignatureVerified") {
+		return
+	}
+
+	if install := req.Firmware.InstallDateTime; install != nil && time.Now().Before(*install) {
+		if !report("InstallScheduled") || !vc.waitUntil(*install) {
+			return
+		}
+	}
+	if report("Installing") {
+		report("Installed")
+	}
+}
+
+// sendSignedFirmwareStatus records and reports the firmware update status
+func (vc *VirtualCharger) sendSignedFirmwareStatus(status string, requestID int) error {
+	vc.mu.Lock()
+	vc.signedFirmware = firmwareState{status: status, requestID: requestID}
+	vc.mu.Unlock()
+
+	req := &ocpp.SignedFirmwareStatusNotificationRequest{Status: status, RequestId: &requestID}
+	if _, err := vc.call(ocpp.MessageTypeSignedFirmwareStatusNotification, req); err != nil {
+		return err
+	}
+
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent("charger.firmware.status", vc.id, map[string]interface{}{
+		"status":     status,
+		"request_id": requestID,
+	}))
+	return nil
+}
+
+// waitUntil blocks until the given time, returning false if the charger stops first
+func (vc *VirtualCharger) waitUntil(t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-vc.context().Done():
+		return false
+	}
+}
+
+// handleExtendedTriggerMessage sends the message requested by the CSMS
+func (vc *VirtualCharger) handleExtendedTriggerMessage(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.ExtendedTriggerMessageRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if !vc.validTriggerConnector(req.ConnectorId) {
+		return &ocpp.ExtendedTriggerMessageResponse{Status: ocpp.TriggerMessageStatusRejected}, nil, nil
+	}
+
+	trigger := vc.coreTrigger(req.RequestedMessage, req.ConnectorId)
+	switch req.RequestedMessage {
+	case "FirmwareStatusNotification":
+		vc.mu.RLock()
+		firmware := vc.signedFirmware
+		vc.mu.RUnlock()
+		trigger = func() error {
+			// Idle is reported once an update has finished or when there was none
+			if firmware.status == "" || firmware.status == "Installed" {
+				_, err := vc.call(ocpp.MessageTypeSignedFirmwareStatusNotification, &ocpp.SignedFirmwareStatusNotificationRequest{Status: "Idle"})
+				return err
+			}
+			return vc.sendSignedFirmwareStatus(firmware.status, firmware.requestID)
+		}
+	case "SignChargePointCertificate":
+		trigger = vc.SignCertificate
+	}
+	if trigger == nil {
+		return &ocpp.ExtendedTriggerMessageResponse{Status: ocpp.TriggerMessageStatusNotImplemented}, nil, nil
+	}
+
+	return &ocpp.ExtendedTriggerMessageResponse{Status: ocpp.TriggerMessageStatusAccepted}, vc.runTrigger(req.RequestedMessage, trigger), nil
+}
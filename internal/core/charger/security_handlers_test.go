@@ -0,0 +1,274 @@
+package charger
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// testCA is a local CA signing charge point and firmware certificates
+type testCA struct {
+    cert *x509.Certificate
+    key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    require.NoError(t, err)
+    template := &x509.Certificate{
+        SerialNumber:          big.NewInt(1),
+        Subject:               pkix.Name{CommonName: name},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().Add(time.Hour),
+        KeyUsage:              x509.KeyUsageCertSign,
+        BasicConstraintsValid: true,
+        IsCA:                  true,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+    require.NoError(t, err)
+    cert, err := x509.ParseCertificate(der)
+    require.NoError(t, err)
+    return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() string {
+    return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+}
+
+// sign issues a certificate for the public key and subject of a PEM CSR
+func (ca *testCA) sign(t *testing.T, csrPEM string, notAfter time.Time) string {
+    block, _ := pem.Decode([]byte(csrPEM))
+    require.NotNil(t, block)
+    csr, err := x509.ParseCertificateRequest(block.Bytes)
+    require.NoError(t, err)
+    require.NoError(t, csr.CheckSignature())
+
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(time.Now().UnixNano()),
+        Subject:      csr.Subject,
+        NotBefore:    time.Now().Add(-2 * time.Hour),
+        NotAfter:     notAfter,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+    require.NoError(t, err)
+    return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// requestCertificate runs SignCertificate and returns the CSR sent to the CSMS
+func requestCertificate(t *testing.T, vc *VirtualCharger, client *mockClient) string {
+    require.NoError(t, vc.SignCertificate())
+    calls := client.sentCalls(ocpp.MessageTypeSignCertificate)
+    require.NotEmpty(t, calls)
+    return calls[len(calls)-1].Payload.(*ocpp.SignCertificateRequest).Csr
+}
+
+func TestCertificateRenewal(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.Configuration().Set(KeyCpoName, "Test CPO")
+    ca := newTestCA(t, "CSMS CA")
+
+    csr := requestCertificate(t, vc, client)
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeCertificateSigned, &ocpp.CertificateSignedRequest{
+        CertificateChain: ca.sign(t, csr, time.Now().Add(time.Hour)),
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.CertificateSignedResponse).Status)
+
+    cert := vc.Certificates().ChargePointCertificate()
+    require.NotNil(t, cert)
+    assert.Equal(t, "TEST001", cert.Subject.CommonName)
+    assert.Equal(t, []string{"Test CPO"}, cert.Subject.Organization)
+
+    // The renewed certificate is presented on the next TLS connection
+    clientCert := vc.Certificates().ClientCertificate()
+    require.NotNil(t, clientCert)
+    assert.Equal(t, cert.Raw, clientCert.Certificate[0])
+
+    // The signing request was answered, so the same chain cannot be installed twice
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeCertificateSigned, &ocpp.CertificateSignedRequest{
+        CertificateChain: ca.sign(t, csr, time.Now().Add(time.Hour)),
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.CertificateSignedResponse).Status)
+}
+
+func TestHandleCertificateSigned_RejectsInvalidCertificates(t *testing.T) {
+    ca := newTestCA(t, "CSMS CA")
+    otherCSR, err := NewCertificateStore().GenerateCSR("TEST001", "")
+    require.NoError(t, err)
+    otherName, err := NewCertificateStore().GenerateCSR("OTHER", "")
+    require.NoError(t, err)
+
+    tests := []struct {
+        name  string
+        chain func(csr string) string
+    }{
+        {"expired", func(csr string) string { return ca.sign(t, csr, time.Now().Add(-time.Hour)) }},
+        {"other key", func(string) string { return ca.sign(t, otherCSR, time.Now().Add(time.Hour)) }},
+        {"other common name", func(string) string { return ca.sign(t, otherName, time.Now().Add(time.Hour)) }},
+        {"not a certificate", func(string) string { return "garbage" }},
+        {"untrusted", func(csr string) string { return newTestCA(t, "Rogue CA").sign(t, csr, time.Now().Add(time.Hour)) }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            vc, client := newTestCharger(1)
+            require.NoError(t, vc.Certificates().InstallRoot(ocpp.CertificateTypeCentralSystemRoot, ca.pem()))
+            csr := requestCertificate(t, vc, client)
+
+            reply := deliverCall(t, vc, client, ocpp.MessageTypeCertificateSigned, &ocpp.CertificateSignedRequest{
+                CertificateChain: tt.chain(csr),
+            })
+            assert.Equal(t, "Rejected", reply.Payload.(*ocpp.CertificateSignedResponse).Status)
+            assert.Nil(t, vc.Certificates().ChargePointCertificate())
+
+            assert.Eventually(t, func() bool {
+                events := client.sentCalls(ocpp.MessageTypeSecurityEventNotification)
+                return len(events) == 1 &&
+                    events[0].Payload.(*ocpp.SecurityEventNotificationRequest).Type == SecurityEventInvalidChargePointCertificate
+            }, time.Second, 10*time.Millisecond)
+        })
+    }
+}
+
+func TestRootCertificateManagement(t *testing.T) {
+    vc, client := newTestCharger(1)
+    ca := newTestCA(t, "CSMS CA")
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeGetInstalledCertificateIds, &ocpp.GetInstalledCertificateIdsRequest{
+        CertificateType: ocpp.CertificateTypeCentralSystemRoot,
+    })
+    assert.Equal(t, "NotFound", reply.Payload.(*ocpp.GetInstalledCertificateIdsResponse).Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeInstallCertificate, &ocpp.InstallCertificateRequest{
+        CertificateType: ocpp.CertificateTypeCentralSystemRoot,
+        Certificate:     ca.pem(),
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.InstallCertificateResponse).Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeInstallCertificate, &ocpp.InstallCertificateRequest{
+        CertificateType: ocpp.CertificateTypeCentralSystemRoot,
+        Certificate:     "not a certificate",
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.InstallCertificateResponse).Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeGetInstalledCertificateIds, &ocpp.GetInstalledCertificateIdsRequest{
+        CertificateType: ocpp.CertificateTypeCentralSystemRoot,
+    })
+    ids := reply.Payload.(*ocpp.GetInstalledCertificateIdsResponse)
+    assert.Equal(t, "Accepted", ids.Status)
+    require.Len(t, ids.CertificateHashData, 1)
+    assert.Equal(t, "SHA256", ids.CertificateHashData[0].HashAlgorithm)
+    assert.Equal(t, "1", ids.CertificateHashData[0].SerialNumber)
+    assert.Len(t, ids.CertificateHashData[0].IssuerNameHash, 64)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeDeleteCertificate, &ocpp.DeleteCertificateRequest{
+        CertificateHashData: ids.CertificateHashData[0],
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.DeleteCertificateResponse).Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeDeleteCertificate, &ocpp.DeleteCertificateRequest{
+        CertificateHashData: ids.CertificateHashData[0],
+    })
+    assert.Equal(t, "NotFound", reply.Payload.(*ocpp.DeleteCertificateResponse).Status)
+
+    // CertificateStoreMaxLength limits the number of installed certificates
+    vc.Configuration().keys[KeyCertificateStoreMaxLength].Value = "1"
+    for _, status := range []string{"Accepted", "Rejected"} {
+        reply = deliverCall(t, vc, client, ocpp.MessageTypeInstallCertificate, &ocpp.InstallCertificateRequest{
+            CertificateType: ocpp.CertificateTypeManufacturerRoot,
+            Certificate:     newTestCA(t, "Manufacturer").pem(),
+        })
+        assert.Equal(t, status, reply.Payload.(*ocpp.InstallCertificateResponse).Status)
+    }
+}
+
+func TestHandleSignedUpdateFirmware(t *testing.T) {
+    vc, client := newTestCharger(1)
+    manufacturer := newTestCA(t, "Manufacturer")
+    signingCSR, err := NewCertificateStore().GenerateCSR("Firmware Signing", "")
+    require.NoError(t, err)
+    firmware := ocpp.Firmware{
+        Location:           "https://firmware.example.com/v2.bin",
+        RetrieveDateTime:   time.Now().Add(-time.Minute),
+        SigningCertificate: manufacturer.sign(t, signingCSR, time.Now().Add(time.Hour)),
+        Signature:          "c2lnbmF0dXJl",
+    }
+
+    // The signing certificate cannot be verified without a manufacturer root
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeSignedUpdateFirmware, &ocpp.SignedUpdateFirmwareRequest{RequestId: 1, Firmware: firmware})
+    assert.Equal(t, "InvalidCertificate", reply.Payload.(*ocpp.SignedUpdateFirmwareResponse).Status)
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeSecurityEventNotification)) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    require.NoError(t, vc.Certificates().InstallRoot(ocpp.CertificateTypeManufacturerRoot, manufacturer.pem()))
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeSignedUpdateFirmware, &ocpp.SignedUpdateFirmwareRequest{RequestId: 2, Firmware: firmware})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.SignedUpdateFirmwareResponse).Status)
+
+    statuses := func() []string {
+        var statuses []string
+        for _, call := range client.sentCalls(ocpp.MessageTypeSignedFirmwareStatusNotification) {
+            req := call.Payload.(*ocpp.SignedFirmwareStatusNotificationRequest)
+            if req.RequestId != nil && *req.RequestId == 2 {
+                statuses = append(statuses, req.Status)
+            }
+        }
+        return statuses
+    }
+    assert.Eventually(t, func() bool { return len(statuses()) == 5 }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"Downloading", "Downloaded", "SignatureVerified", "Installing", "Installed"}, statuses())
+}
+
+func TestHandleExtendedTriggerMessage(t *testing.T) {
+    vc, client := newTestCharger(2)
+
+    connectorID := 2
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeExtendedTriggerMessage, &ocpp.ExtendedTriggerMessageRequest{
+        RequestedMessage: "StatusNotification",
+        ConnectorId:      &connectorID,
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ExtendedTriggerMessageResponse).Status)
+    assert.Eventually(t, func() bool {
+        calls := client.sentCalls(ocpp.MessageTypeStatusNotification)
+        return len(calls) == 1 && calls[0].Payload.(*ocpp.StatusNotificationRequest).ConnectorId == 2
+    }, time.Second, 10*time.Millisecond)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeExtendedTriggerMessage, &ocpp.ExtendedTriggerMessageRequest{
+        RequestedMessage: "SignChargePointCertificate",
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ExtendedTriggerMessageResponse).Status)
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeSignCertificate)) == 1
+    }, time.Second, 10*time.Millisecond)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeExtendedTriggerMessage, &ocpp.ExtendedTriggerMessageRequest{
+        RequestedMessage: "FirmwareStatusNotification",
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ExtendedTriggerMessageResponse).Status)
+    assert.Eventually(t, func() bool {
+        calls := client.sentCalls(ocpp.MessageTypeSignedFirmwareStatusNotification)
+        return len(calls) == 1 && calls[0].Payload.(*ocpp.SignedFirmwareStatusNotificationRequest).Status == "Idle"
+    }, time.Second, 10*time.Millisecond)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeExtendedTriggerMessage, &ocpp.ExtendedTriggerMessageRequest{
+        RequestedMessage: "LogStatusNotification",
+    })
+    assert.Equal(t, "NotImplemented", reply.Payload.(*ocpp.ExtendedTriggerMessageResponse).Status)
+
+    connectorID = 3
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeExtendedTriggerMessage, &ocpp.ExtendedTriggerMessageRequest{
+        RequestedMessage: "StatusNotification",
+        ConnectorId:      &connectorID,
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.ExtendedTriggerMessageResponse).Status)
+}
@@ -0,0 +1,149 @@
+package charger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	"github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+	"github.com/sirupsen/logrus"
+)
+
+// chargingContextOf describes the transaction active on a connector, nil if
+// there is none
+func (vc *VirtualCharger) chargingContextOf(connectorID int) *chargingContext {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	for _, tx := range vc.transactions {
+		if tx.ConnectorID == connectorID && tx.IsActive() {
+			return &chargingContext{transactionID: tx.CSMSID, start: tx.StartTime}
+		}
+	}
+	return nil
+}
+
+// ChargingLimit returns the power in watts a connector may draw right now
+// under the installed charging profiles and the rated power of the charger
+func (vc *VirtualCharger) ChargingLimit(connectorID int) float64 {
+	limit, _ := vc.chargingProfiles.limitAt(connectorID, vc.chargingContextOf(connectorID), time.Now(), vc.config.ratedPowerW(), vc.charging.chargePointMaxShares(connectorID))
+	return limit
+}
+
+// CompositeSchedule combines the charging profiles of a connector into the
+// schedule that applies from now on, in "A" or "W"
+func (vc *VirtualCharger) CompositeSchedule(connectorID int, duration time.Duration, unit string) ocpp.ChargingSchedule {
+	start := time.Now().Truncate(time.Second)
+	return vc.chargingProfiles.compositeSchedule(connectorID, vc.chargingContextOf(connectorID), start, duration, unit, vc.config.ratedPowerW(), vc.charging.chargePointMaxShares(connectorID))
+}
+
+// handleSetChargingProfile installs a charging profile sent by the CSMS
+func (vc *VirtualCharger) handleSetChargingProfile(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.SetChargingProfileRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	if err := vc.acceptChargingProfile(req.ConnectorId, &req.CsChargingProfiles); err != nil {
+		vc.logger.WithError(err).WithFields(logrus.Fields{
+			"connector_id":        req.ConnectorId,
+			"charging_profile_id": req.CsChargingProfiles.ChargingProfileId,
+		}).Warn("Rejecting charging profile")
+		return &ocpp.SetChargingProfileResponse{Status: "Rejected"}, nil, nil
+	}
+
+	vc.installChargingProfile(ctx, req.ConnectorId, req.CsChargingProfiles)
+	return &ocpp.SetChargingProfileResponse{Status: "Accepted"}, nil, nil
+}
+
+// acceptChargingProfile checks whether a profile may be installed on a
+// connector. TxProfiles without a transaction ID are bound to the active
+// transaction of the connector.
+func (vc *VirtualCharger) acceptChargingProfile(connectorID int, profile *ocpp.ChargingProfile) error {
+	if connectorID < 0 || connectorID > len(vc.GetConnectors()) {
+		return fmt.Errorf("invalid connector ID: %d", connectorID)
+	}
+	if err := validateChargingProfile(*profile, vc.configuration); err != nil {
+		return err
+	}
+
+	switch profile.ChargingProfilePurpose {
+	case ocpp.ChargingProfilePurposeChargePointMax:
+		if connectorID != 0 {
+			return fmt.Errorf("%s is only valid on connector 0", profile.ChargingProfilePurpose)
+		}
+	case ocpp.ChargingProfilePurposeTx:
+		tx := vc.chargingContextOf(connectorID)
+		if connectorID == 0 || tx == nil {
+			return fmt.Errorf("no transaction active on connector %d", connectorID)
+		}
+		if profile.TransactionId == nil {
+			profile.TransactionId = &tx.transactionID
+		} else if *profile.TransactionId != tx.transactionID {
+			return fmt.Errorf("transaction %d is not active on connector %d", *profile.TransactionId, connectorID)
+		}
+	}
+
+	if maxProfiles := vc.configuration.GetInt(KeyMaxChargingProfilesInstalled, 0); maxProfiles > 0 && vc.chargingProfiles.CountAfterInstall(connectorID, *profile) > maxProfiles {
+		return fmt.Errorf("more than %d charging profiles installed", maxProfiles)
+	}
+	return nil
+}
+
+// installChargingProfile stores an accepted profile
+func (vc *VirtualCharger) installChargingProfile(ctx context.Context, connectorID int, profile ocpp.ChargingProfile) {
+	vc.chargingProfiles.Install(connectorID, profile)
+
+	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.charging_profile.installed", vc.id, map[string]interface{}{
+		"connector_id":        connectorID,
+		"charging_profile_id": profile.ChargingProfileId,
+		"purpose":             profile.ChargingProfilePurpose,
+		"stack_level":         profile.StackLevel,
+		"limit_w":             vc.ChargingLimit(connectorID),
+	}))
+}
+
+// handleClearChargingProfile removes charging profiles on request of the CSMS
+func (vc *VirtualCharger) handleClearChargingProfile(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.ClearChargingProfileRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	cleared := vc.chargingProfiles.Clear(req)
+	if cleared == 0 {
+		return &ocpp.ClearChargingProfileResponse{Status: "Unknown"}, nil, nil
+	}
+
+	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent("charger.charging_profile.cleared", vc.id, map[string]interface{}{
+		"cleared": cleared,
+	}))
+	return &ocpp.ClearChargingProfileResponse{Status: "Accepted"}, nil, nil
+}
+
+// handleGetCompositeSchedule reports the schedule resulting from the
+// installed charging profiles
+func (vc *VirtualCharger) handleGetCompositeSchedule(ctx context.Context, payload json.RawMessage) (interface{}, func(), error) {
+	var req ocpp.GetCompositeScheduleRequest
+	if err := decodeCallPayload(payload, &req); err != nil {
+		return nil, nil, err
+	}
+
+	unit := ocpp.ChargingRateUnitWatts
+	if req.ChargingRateUnit != nil {
+		unit = *req.ChargingRateUnit
+	}
+	if req.ConnectorId < 0 || req.ConnectorId > len(vc.GetConnectors()) || req.Duration <= 0 || !chargingRateUnitAllowed(unit, vc.configuration) {
+		return &ocpp.GetCompositeScheduleResponse{Status: "Rejected"}, nil, nil
+	}
+
+	schedule := vc.CompositeSchedule(req.ConnectorId, time.Duration(req.Duration)*time.Second, unit)
+	return &ocpp.GetCompositeScheduleResponse{
+		Status:           "Accepted",
+		ConnectorId:      &req.ConnectorId,
+		ScheduleStart:    schedule.StartSchedule,
+		ChargingSchedule: &schedule,
+	}, nil, nil
+}
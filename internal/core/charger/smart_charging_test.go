@@ -0,0 +1,303 @@
+package charger
+
+import (
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// absoluteProfile builds a profile starting at start with periods of
+// {startPeriod, limit} pairs
+func absoluteProfile(id int, purpose string, stackLevel int, start time.Time, unit string, periods ...[2]float64) ocpp.ChargingProfile {
+    schedule := ocpp.ChargingSchedule{StartSchedule: &start, ChargingRateUnit: unit}
+    for _, p := range periods {
+        schedule.ChargingSchedulePeriod = append(schedule.ChargingSchedulePeriod, ocpp.ChargingSchedulePeriod{
+            StartPeriod: int(p[0]),
+            Limit:       p[1],
+        })
+    }
+    return ocpp.ChargingProfile{
+        ChargingProfileId:      id,
+        StackLevel:             stackLevel,
+        ChargingProfilePurpose: purpose,
+        ChargingProfileKind:    ocpp.ChargingProfileKindAbsolute,
+        ChargingSchedule:       schedule,
+    }
+}
+
+func TestChargingProfileStore_StackingAndPurposes(t *testing.T) {
+    store := NewChargingProfileStore()
+    start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    tx := &chargingContext{transactionID: 1001, start: start}
+
+    store.Install(0, absoluteProfile(1, ocpp.ChargingProfilePurposeTxDefault, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 11000}))
+    store.Install(1, absoluteProfile(2, ocpp.ChargingProfilePurposeTxDefault, 1, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 7000}, [2]float64{600, 0}))
+
+    // The higher stack level wins while its schedule runs
+    limit, _ := store.limitAt(1, tx, start.Add(time.Minute), 22000, 1)
+    assert.Equal(t, 7000.0, limit)
+    limit, _ = store.limitAt(1, tx, start.Add(15*time.Minute), 22000, 1)
+    assert.Equal(t, 0.0, limit)
+
+    // Connector 2 only sees the default of connector 0
+    limit, _ = store.limitAt(2, tx, start.Add(time.Minute), 22000, 1)
+    assert.Equal(t, 11000.0, limit)
+
+    // A TxProfile overrules the defaults, the ChargePointMaxProfile caps everything
+    txProfile := absoluteProfile(3, ocpp.ChargingProfilePurposeTx, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 16000})
+    txProfile.TransactionId = &tx.transactionID
+    store.Install(1, txProfile)
+    limit, _ = store.limitAt(1, tx, start.Add(15*time.Minute), 22000, 1)
+    assert.Equal(t, 16000.0, limit)
+
+    store.Install(0, absoluteProfile(4, ocpp.ChargingProfilePurposeChargePointMax, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 12000}))
+    limit, _ = store.limitAt(1, tx, start.Add(15*time.Minute), 22000, 1)
+    assert.Equal(t, 12000.0, limit)
+
+    // Without the transaction the TxProfile no longer applies
+    limit, _ = store.limitAt(1, nil, start.Add(time.Minute), 22000, 1)
+    assert.Equal(t, 7000.0, limit)
+
+    assert.Equal(t, 1, store.ClearTransaction(1))
+    assert.Equal(t, 3, store.Count())
+}
+
+func TestChargingProfileStore_InstallReplaces(t *testing.T) {
+    store := NewChargingProfileStore()
+    start := time.Now()
+
+    store.Install(1, absoluteProfile(1, ocpp.ChargingProfilePurposeTxDefault, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 7000}))
+    store.Install(1, absoluteProfile(2, ocpp.ChargingProfilePurposeTxDefault, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 5000}))
+    store.Install(2, absoluteProfile(2, ocpp.ChargingProfilePurposeTxDefault, 1, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 3000}))
+
+    assert.Empty(t, store.Profiles(1))
+    require.Len(t, store.Profiles(2), 1)
+    assert.Equal(t, 1, store.Profiles(2)[0].StackLevel)
+
+    purpose := ocpp.ChargingProfilePurposeTxDefault
+    assert.Equal(t, 0, store.Clear(ocpp.ClearChargingProfileRequest{ConnectorId: intPtr(1)}))
+    assert.Equal(t, 1, store.Clear(ocpp.ClearChargingProfileRequest{ChargingProfilePurpose: &purpose}))
+}
+
+func TestChargingProfileStore_CompositeSchedule(t *testing.T) {
+    store := NewChargingProfileStore()
+    midnight := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+    // Daily off-peak window: 16 A from 22:00 until 06:00, 6 A otherwise
+    daily := ocpp.RecurrencyKindDaily
+    store.Install(1, ocpp.ChargingProfile{
+        ChargingProfileId:      1,
+        ChargingProfilePurpose: ocpp.ChargingProfilePurposeTxDefault,
+        ChargingProfileKind:    ocpp.ChargingProfileKindRecurring,
+        RecurrencyKind:         &daily,
+        ChargingSchedule: ocpp.ChargingSchedule{
+            StartSchedule:    &midnight,
+            ChargingRateUnit: ocpp.ChargingRateUnitAmperes,
+            ChargingSchedulePeriod: []ocpp.ChargingSchedulePeriod{
+                {StartPeriod: 0, Limit: 16},
+                {StartPeriod: 6 * 3600, Limit: 6},
+                {StartPeriod: 22 * 3600, Limit: 16},
+            },
+        },
+    })
+
+    // From 20:00 on the second day, for 12 hours
+    start := midnight.Add(44 * time.Hour)
+    schedule := store.compositeSchedule(1, nil, start, 12*time.Hour, ocpp.ChargingRateUnitAmperes, 22000, 1)
+    assert.Equal(t, 12*3600, *schedule.Duration)
+    assert.Equal(t, []ocpp.ChargingSchedulePeriod{
+        {StartPeriod: 0, Limit: 6},
+        {StartPeriod: 2 * 3600, Limit: 16},
+        {StartPeriod: 10 * 3600, Limit: 6},
+    }, schedule.ChargingSchedulePeriod)
+
+    // The same schedule in watts, 3 phases at 230 V
+    schedule = store.compositeSchedule(1, nil, start, 12*time.Hour, ocpp.ChargingRateUnitWatts, 22000, 1)
+    assert.Equal(t, 4140.0, schedule.ChargingSchedulePeriod[0].Limit)
+    assert.Equal(t, 11040.0, schedule.ChargingSchedulePeriod[1].Limit)
+}
+
+func TestChargingProfileStore_RelativeAndValidity(t *testing.T) {
+    store := NewChargingProfileStore()
+    start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    validTo := start.Add(time.Hour)
+    phases := 1
+    duration := 1800
+
+    store.Install(1, ocpp.ChargingProfile{
+        ChargingProfileId:      1,
+        ChargingProfilePurpose: ocpp.ChargingProfilePurposeTxDefault,
+        ChargingProfileKind:    ocpp.ChargingProfileKindRelative,
+        ValidTo:                &validTo,
+        ChargingSchedule: ocpp.ChargingSchedule{
+            Duration:               &duration,
+            ChargingRateUnit:       ocpp.ChargingRateUnitAmperes,
+            ChargingSchedulePeriod: []ocpp.ChargingSchedulePeriod{{StartPeriod: 0, Limit: 10, NumberPhases: &phases}},
+        },
+    })
+
+    // Relative schedules need a transaction to start from
+    limit, _ := store.limitAt(1, nil, start, 22000, 1)
+    assert.Equal(t, 22000.0, limit)
+
+    tx := &chargingContext{transactionID: 1, start: start.Add(45 * time.Minute)}
+    limit, got := store.limitAt(1, tx, tx.start, 22000, 1)
+    assert.Equal(t, 2300.0, limit)
+    assert.Equal(t, 1, got)
+
+    // The profile expires before its duration is over
+    limit, _ = store.limitAt(1, tx, validTo, 22000, 1)
+    assert.Equal(t, 22000.0, limit)
+}
+
+func TestHandleSetChargingProfile(t *testing.T) {
+    vc, client := newTestCharger(2)
+    start := time.Now().Add(-time.Minute).UTC()
+
+    setProfile := func(connectorID int, profile ocpp.ChargingProfile) string {
+        reply := deliverCall(t, vc, client, ocpp.MessageTypeSetChargingProfile, ocpp.SetChargingProfileRequest{
+            ConnectorId:        connectorID,
+            CsChargingProfiles: profile,
+        })
+        require.Equal(t, "CallResult", reply.Kind)
+        return reply.Payload.(*ocpp.SetChargingProfileResponse).Status
+    }
+
+    assert.Equal(t, "Accepted", setProfile(0, absoluteProfile(1, ocpp.ChargingProfilePurposeChargePointMax, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 15000})))
+    assert.Equal(t, "Rejected", setProfile(1, absoluteProfile(2, ocpp.ChargingProfilePurposeChargePointMax, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 15000})))
+    assert.Equal(t, "Rejected", setProfile(1, absoluteProfile(3, ocpp.ChargingProfilePurposeTxDefault, 11, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 15000})))
+    assert.Equal(t, 15000.0, vc.ChargingLimit(1))
+
+    // TxProfiles need a transaction and are bound to it
+    txProfile := absoluteProfile(4, ocpp.ChargingProfilePurposeTx, 0, start, ocpp.ChargingRateUnitAmperes, [2]float64{0, 10})
+    assert.Equal(t, "Rejected", setProfile(1, txProfile))
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.Equal(t, "Accepted", setProfile(1, txProfile))
+    require.Len(t, vc.ChargingProfiles().Profiles(1), 1)
+    assert.Equal(t, tx.CSMSID, *vc.ChargingProfiles().Profiles(1)[0].TransactionId)
+    assert.Equal(t, 6900.0, vc.ChargingLimit(1))
+    // Connector 2 would share the ChargePointMaxProfile with connector 1
+    assert.Equal(t, 7500.0, vc.ChargingLimit(2))
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeGetCompositeSchedule, ocpp.GetCompositeScheduleRequest{
+        ConnectorId: 1,
+        Duration:    3600,
+    })
+    response := reply.Payload.(*ocpp.GetCompositeScheduleResponse)
+    require.Equal(t, "Accepted", response.Status)
+    assert.Equal(t, ocpp.ChargingRateUnitWatts, response.ChargingSchedule.ChargingRateUnit)
+    assert.Equal(t, []ocpp.ChargingSchedulePeriod{{StartPeriod: 0, Limit: 6900}}, response.ChargingSchedule.ChargingSchedulePeriod)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeGetCompositeSchedule, ocpp.GetCompositeScheduleRequest{
+        ConnectorId: 3,
+        Duration:    3600,
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.GetCompositeScheduleResponse).Status)
+
+    // Stopping the transaction drops its TxProfile
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    assert.Empty(t, vc.ChargingProfiles().Profiles(1))
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeClearChargingProfile, ocpp.ClearChargingProfileRequest{Id: intPtr(1)})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.ClearChargingProfileResponse).Status)
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeClearChargingProfile, ocpp.ClearChargingProfileRequest{Id: intPtr(1)})
+    assert.Equal(t, "Unknown", reply.Payload.(*ocpp.ClearChargingProfileResponse).Status)
+}
+
+func TestHandleRemoteStartTransaction_ChargingProfile(t *testing.T) {
+    vc, client := newTestCharger(1)
+    start := time.Now().Add(-time.Minute).UTC()
+
+    reply := deliverCall(t, vc, client, ocpp.MessageTypeRemoteStartTransaction, ocpp.RemoteStartTransactionRequest{
+        IdTag:           "TAG001",
+        ChargingProfile: profilePtr(absoluteProfile(1, ocpp.ChargingProfilePurposeTxDefault, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 5000})),
+    })
+    assert.Equal(t, "Rejected", reply.Payload.(*ocpp.RemoteStartTransactionResponse).Status)
+
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeRemoteStartTransaction, ocpp.RemoteStartTransactionRequest{
+        IdTag:           "TAG001",
+        ChargingProfile: profilePtr(absoluteProfile(1, ocpp.ChargingProfilePurposeTx, 0, start, ocpp.ChargingRateUnitWatts, [2]float64{0, 5000})),
+    })
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.RemoteStartTransactionResponse).Status)
+
+    assert.Eventually(t, func() bool {
+        return vc.ChargingLimit(1) == 5000
+    }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, 1001, *vc.ChargingProfiles().Profiles(1)[0].TransactionId)
+}
+
+func TestAdvanceCharging_FollowsLimit(t *testing.T) {
+    vc, client := newTestCharger(1)
+    require.NoError(t, vc.PlugInEV(1, NewBatteryEV(EVProfile{BatteryCapacityKWh: 100, InitialSoC: 10, MaxACPowerKW: 22}, CurrentTypeAC)))
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+
+    now := tx.StartTime
+    session := vc.charging.sessions[tx.ID]
+    session.setCap(11000)
+
+    // One hour at the requested power
+    vc.advanceCharging(session, now.Add(time.Hour))
+    assert.InDelta(t, 11000, session.meterWh(), 1)
+
+    // A limit of zero suspends charging, raising it resumes
+    pause := absoluteProfile(1, ocpp.ChargingProfilePurposeTxDefault, 0, now.Add(time.Hour), ocpp.ChargingRateUnitWatts, [2]float64{0, 0}, [2]float64{3600, 4000})
+    vc.ChargingProfiles().Install(1, pause)
+
+    vc.advanceCharging(session, now.Add(2*time.Hour))
+    assert.InDelta(t, 11000, session.meterWh(), 1)
+    assert.Equal(t, ConnectorStatusSuspendedEVSE, vc.GetConnectors()[0].Status)
+
+    vc.advanceCharging(session, now.Add(3*time.Hour))
+    assert.InDelta(t, 15000, session.meterWh(), 1)
+    assert.Equal(t, ConnectorStatusCharging, vc.GetConnectors()[0].Status)
+
+    var statuses []string
+    for _, call := range client.sentCalls(ocpp.MessageTypeStatusNotification) {
+        statuses = append(statuses, call.Payload.(*ocpp.StatusNotificationRequest).Status)
+    }
+    assert.Subset(t, statuses, []string{"SuspendedEVSE", "Charging"})
+}
+
+func TestAdvanceCharging_ChargePointMaxSharedByConnectors(t *testing.T) {
+    vc, _ := newTestCharger(2)
+    ev := EVProfile{BatteryCapacityKWh: 100, InitialSoC: 10, MaxACPowerKW: 22}
+    vc.ChargingProfiles().Install(0, absoluteProfile(1, ocpp.ChargingProfilePurposeChargePointMax, 0, time.Now().Add(-time.Minute), ocpp.ChargingRateUnitWatts, [2]float64{0, 12000}))
+
+    // One connector charging gets the whole station maximum
+    require.NoError(t, vc.PlugInEV(1, NewBatteryEV(ev, CurrentTypeAC)))
+    tx1, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.Equal(t, 12000.0, vc.ChargingLimit(1))
+    assert.Equal(t, 6000.0, vc.ChargingLimit(2), "a second connector would share the maximum")
+    assert.Equal(t, 12000.0, vc.ChargingLimit(0))
+
+    // With two connectors charging they draw the maximum combined
+    require.NoError(t, vc.PlugInEV(2, NewBatteryEV(ev, CurrentTypeAC)))
+    tx2, err := vc.StartTransaction(2, "TAG002")
+    require.NoError(t, err)
+
+    session1 := vc.charging.sessions[tx1.ID]
+    session2 := vc.charging.sessions[tx2.ID]
+    vc.advanceCharging(session1, tx1.StartTime.Add(time.Hour))
+    vc.advanceCharging(session2, tx2.StartTime.Add(time.Hour))
+    assert.InDelta(t, 6000, session1.meterWh(), 1)
+    assert.InDelta(t, 6000, session2.meterWh(), 1)
+
+    schedule := vc.CompositeSchedule(1, time.Hour, ocpp.ChargingRateUnitWatts)
+    require.NotEmpty(t, schedule.ChargingSchedulePeriod)
+    assert.Equal(t, 6000.0, schedule.ChargingSchedulePeriod[0].Limit)
+
+    // Once a transaction ends the other connector gets the whole maximum again
+    require.NoError(t, vc.StopTransaction(tx2.ID, "Local"))
+    assert.Equal(t, 12000.0, vc.ChargingLimit(1))
+}
+
+func intPtr(v int) *int { return &v }
+
+func profilePtr(profile ocpp.ChargingProfile) *ocpp.ChargingProfile { return &profile }
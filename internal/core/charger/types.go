@@ -6,8 +6,13 @@ import (
 
 // Connector represents a charging connector
 type Connector struct {
-	ID     int             `json:"id"`
-	Status ConnectorStatus `json:"status"`
+	ID        int             `json:"id"`
+	Status    ConnectorStatus `json:"status"`
+	ErrorCode string          `json:"error_code,omitempty"` // OCPP 1.6 ChargePointErrorCode while Faulted
+	PluggedIn bool            `json:"plugged_in"`
+
+	autoUnplug bool // The EV was plugged in by StartTransaction and leaves after the transaction
+	starting   bool // A transaction is being started on the connector
 }
 
 // ConnectorStatus represents the status of a connector
@@ -27,15 +32,22 @@ const (
 
 // Transaction represents a charging transaction
 type Transaction struct {
-	ID          int       `json:"id"`
-	ConnectorID int       `json:"connector_id"`
-	IDTag       string    `json:"id_tag"`
-	StartTime   time.Time `json:"start_time"`
-	EndTime     *time.Time `json:"end_time,omitempty"`
-	MeterStart  int       `json:"meter_start"`
-	MeterStop   *int      `json:"meter_stop,omitempty"`
-	Reason      string    `json:"reason,omitempty"`
-	Status      TransactionStatus `json:"status"`
+	ID            int               `json:"id"`                       // Local ID assigned by the charger
+	CSMSID        int               `json:"csms_id,omitempty"`        // transactionId assigned by the CSMS
+	TransactionID string            `json:"transaction_id,omitempty"` // OCPP 2.0.1 transactionId assigned by the charger
+	IDTagStatus   string            `json:"id_tag_status,omitempty"`  // IdTagInfo.Status returned by the CSMS
+	Offline       bool              `json:"offline,omitempty"`        // Started while the CSMS was unreachable
+	ConnectorID   int               `json:"connector_id"`
+	IDTag         string            `json:"id_tag"`
+	ReservationID *int              `json:"reservation_id,omitempty"` // Reservation the transaction used
+	StartTime     time.Time         `json:"start_time"`
+	EndTime       *time.Time        `json:"end_time,omitempty"`
+	MeterStart    int               `json:"meter_start"`
+	MeterStop     *int              `json:"meter_stop,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	Status        TransactionStatus `json:"status"`
+
+	stopping bool // The StopTransaction is being sent
 }
 
 // TransactionStatus represents the status of a transaction
@@ -55,7 +67,8 @@ func NewConnector(id int, status ConnectorStatus) *Connector {
 	}
 }
 
-// SetStatus updates the connector status
+// SetStatus updates the connector status without checking the transition.
+// VirtualCharger connectors change status through setConnectorStatusLocked.
 func (c *Connector) SetStatus(status ConnectorStatus) {
 	c.Status = status
 }
@@ -77,6 +90,12 @@ func NewTransaction(id, connectorID int, idTag string, meterStart int) *Transact
 	}
 }
 
+// Confirm records the transaction ID and authorization status assigned by the CSMS
+func (t *Transaction) Confirm(csmsID int, idTagStatus string) {
+	t.CSMSID = csmsID
+	t.IDTagStatus = idTagStatus
+}
+
 // Complete completes the transaction
 func (t *Transaction) Complete(meterStop int, reason string) {
 	now := time.Now()
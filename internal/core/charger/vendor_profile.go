@@ -0,0 +1,81 @@
+package charger
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+)
+
+// VendorProfile describes how the firmware of a vendor deviates from OCPP
+// 1.6, so a CSMS can be tested against the quirks of real chargers. Profiles
+// are declared in YAML files and attached to chargers by name.
+type VendorProfile struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// StatusBeforeBoot reports the connector status right after connecting,
+	// before the BootNotification, and while the charger is not accepted
+	StatusBeforeBoot bool `json:"status_before_boot,omitempty" yaml:"status_before_boot,omitempty"`
+	// OmitTimestamps leaves the optional timestamp out of StatusNotification
+	OmitTimestamps bool `json:"omit_timestamps,omitempty" yaml:"omit_timestamps,omitempty"`
+	// MeterValuesInKWh reports sampled energy registers in kWh, still
+	// labelled Wh
+	MeterValuesInKWh bool `json:"meter_values_in_kwh,omitempty" yaml:"meter_values_in_kwh,omitempty"`
+	// ReuseMessageIDs sends every Heartbeat, StatusNotification and
+	// MeterValues with the message ID of the first one
+	ReuseMessageIDs bool `json:"reuse_message_ids,omitempty" yaml:"reuse_message_ids,omitempty"`
+	// AcceptUnknownActions answers Calls of unknown actions with an empty
+	// CallResult instead of a NotImplemented CallError
+	AcceptUnknownActions bool `json:"accept_unknown_actions,omitempty" yaml:"accept_unknown_actions,omitempty"`
+}
+
+// reusedMessageIDActions are the messages whose IDs a vendor reusing message
+// IDs repeats. Their responses carry nothing the charger depends on.
+var reusedMessageIDActions = map[string]bool{
+	ocpp.MessageTypeHeartbeat:          true,
+	ocpp.MessageTypeStatusNotification: true,
+	ocpp.MessageTypeMeterValues:        true,
+}
+
+// sendsStatusWithoutBoot reports whether StatusNotification is sent
+// regardless of the registration status
+func (p VendorProfile) sendsStatusWithoutBoot(action string) bool {
+	return p.StatusBeforeBoot && action == ocpp.MessageTypeStatusNotification
+}
+
+// energyValues converts sampled energy registers from Wh into kWh for
+// vendors reporting kWh, leaving the unit as it is
+func (p VendorProfile) energyValues(values []ocpp.SampledValue) {
+	if !p.MeterValuesInKWh {
+		return
+	}
+	for i, value := range values {
+		if value.Unit == nil || *value.Unit != "Wh" {
+			continue
+		}
+		if wh, err := strconv.ParseFloat(value.Value, 64); err == nil {
+			values[i].Value = strconv.FormatFloat(wh/1000, 'f', -1, 64)
+		}
+	}
+}
+
+// reuseMessageID gives a message the ID of the first message of its kind
+// for vendors reusing message IDs
+func (vc *VirtualCharger) reuseMessageID(msg *ocpp.OCPP16Message) {
+	if !vc.config.VendorProfile.ReuseMessageIDs || !reusedMessageIDActions[msg.Action] {
+		return
+	}
+	if !vc.reusedMessageID.CompareAndSwap(nil, msg.MessageID) {
+		msg.MessageID = vc.reusedMessageID.Load().(string)
+	}
+}
+
+// acceptUnknownCall answers a Call of an action without handler with an
+// empty CallResult for vendors doing so. It reports whether it answered.
+func (vc *VirtualCharger) acceptUnknownCall(ctx context.Context, msg *ocpp.OCPP16Message) (bool, error) {
+	if _, exists := vc.callHandlers[msg.Action]; exists || !vc.config.VendorProfile.AcceptUnknownActions {
+		return false, nil
+	}
+	vc.logger.WithField("action", msg.Action).Warn("Accepting unknown action as vendor profile requires")
+	return true, vc.ocppClient.SendCallResult(ctx, msg.MessageID, struct{}{})
+}
@@ -0,0 +1,93 @@
+package charger
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestVendorProfile_StatusBeforeBoot(t *testing.T) {
+    vc, client := newRebootCharger(2)
+    vc.setRegistrationStatus(RegistrationUnknown)
+    assert.Error(t, vc.checkRegistration(ocpp.MessageTypeStatusNotification))
+
+    vc.config.VendorProfile.StatusBeforeBoot = true
+    assert.NoError(t, vc.checkRegistration(ocpp.MessageTypeStatusNotification))
+    assert.Error(t, vc.checkRegistration(ocpp.MessageTypeHeartbeat))
+
+    require.NoError(t, vc.Start(context.Background()))
+    defer vc.Stop(context.Background())
+    assert.Less(t, frameIndex(client, ocpp.MessageTypeStatusNotification), frameIndex(client, ocpp.MessageTypeBootNotification))
+    assert.Equal(t, []string{"0:Available", "1:Available", "2:Available"}, sentStatuses(client)[:3])
+}
+
+func TestVendorProfile_OmitTimestamps(t *testing.T) {
+    vc, client := newTestCharger(1)
+    require.NoError(t, vc.sendStatusNotificationAt(1, "Available", ErrorCodeNoError, time.Now()))
+    vc.config.VendorProfile.OmitTimestamps = true
+    require.NoError(t, vc.sendStatusNotificationAt(1, "Available", ErrorCodeNoError, time.Now()))
+
+    statuses := client.sentCalls(ocpp.MessageTypeStatusNotification)
+    require.Len(t, statuses, 2)
+    assert.NotNil(t, statuses[0].Payload.(*ocpp.StatusNotificationRequest).Timestamp)
+    assert.Nil(t, statuses[1].Payload.(*ocpp.StatusNotificationRequest).Timestamp)
+}
+
+func TestVendorProfile_MeterValuesInKWh(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.config.VendorProfile.MeterValuesInKWh = true
+    vc.Configuration().Set(KeyMeterValuesSampledData, "Energy.Active.Import.Register,Power.Active.Import")
+    require.NoError(t, vc.PlugInEV(1, NewBatteryEV(EVProfile{MaxACPowerKW: 7.2, Phases: 1}, CurrentTypeAC)))
+
+    tx, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    session := vc.charging.sessions[tx.ID]
+    vc.advanceCharging(session, tx.StartTime.Add(5*time.Minute))
+    require.NoError(t, vc.SendMeterValues(tx.ID, session.meterWh()))
+
+    // The register is off by a factor of 1000, power and the unit stay as they are
+    values := client.sentCalls(ocpp.MessageTypeMeterValues)[0].Payload.(*ocpp.MeterValuesRequest).MeterValue[0].SampledValue
+    require.Len(t, values, 2)
+    assert.Equal(t, "0.6", values[0].Value)
+    assert.Equal(t, "Wh", *values[0].Unit)
+    assert.Equal(t, "7200", values[1].Value)
+
+    // MeterStop keeps reporting Wh
+    require.NoError(t, vc.StopTransaction(tx.ID, "Local"))
+    assert.Equal(t, 600, *tx.MeterStop)
+}
+
+func TestVendorProfile_ReuseMessageIDs(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.config.VendorProfile.ReuseMessageIDs = true
+
+    require.NoError(t, vc.sendHeartbeat())
+    require.NoError(t, vc.sendStatusNotificationAt(1, "Available", ErrorCodeNoError, time.Now()))
+    _, err := vc.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    vc.sampleTransactions()
+
+    heartbeatID := client.sentCalls(ocpp.MessageTypeHeartbeat)[0].MessageID
+    for _, action := range []string{ocpp.MessageTypeStatusNotification, ocpp.MessageTypeMeterValues} {
+        for _, frame := range client.sentCalls(action) {
+            assert.Equal(t, heartbeatID, frame.MessageID)
+        }
+    }
+    assert.NotEqual(t, heartbeatID, client.sentCalls(ocpp.MessageTypeStartTransaction)[0].MessageID)
+}
+
+func TestVendorProfile_AcceptUnknownActions(t *testing.T) {
+    vc, client := newTestCharger(1)
+    vc.config.VendorProfile.AcceptUnknownActions = true
+
+    reply := deliverCall(t, vc, client, "GetLog", map[string]interface{}{})
+    assert.Equal(t, "CallResult", reply.Kind)
+
+    // Implemented actions are handled as usual
+    reply = deliverCall(t, vc, client, ocpp.MessageTypeReset, &ocpp.ResetRequest{Type: "Cold"})
+    assert.Equal(t, "CallError", reply.Kind)
+}
@@ -3,7 +3,9 @@ package charger
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
@@ -13,32 +15,125 @@ import (
 
 // VirtualCharger represents a single virtual charger instance
 type VirtualCharger struct {
-	id           string
-	config       ChargerConfig
-	ocppClient   ocpp.Client
-	eventBus     eventbus.EventBus
-	status       ChargerStatus
-	connectors   []*Connector
-	transactions map[int]*Transaction
-	mu           sync.RWMutex
-	logger       *logrus.Entry
-	ctx          context.Context
-	cancel       context.CancelFunc
+	id                string
+	config            ChargerConfig
+	ocppClient        ocpp.Client
+	eventBus          eventbus.EventBus
+	status            ChargerStatus
+	connectors        []*Connector
+	transactions      map[int]*Transaction // Keyed by local transaction ID
+	nextTransactionID int
+	callHandlers      map[string]callHandler
+	messageIDs        ocpp.MessageIDGenerator // Shared with the OCPP client
+	configuration     *ConfigurationStore
+	certificates      *CertificateStore
+	authorizations    *AuthorizationStore
+	chargingProfiles  *ChargingProfileStore
+	charging          *chargingSessions // EVs and their charging sessions, guarded by mu
+	registration      atomic.Value      // RegistrationStatus, readable while vc.mu is held
+	bootRetry         *time.Timer
+	triggering        map[string]int // Triggered sends in progress by action, guarded by triggerMu
+	triggerMu         sync.Mutex
+	// Availability changes deferred until the connector's transaction ends
+	scheduledAvailability map[int]ConnectorStatus
+	offlineStarts         map[string]int            // Local IDs of queued StartTransactions by message ID
+	transactionData       map[int][]ocpp.MeterValue // StopTxn*Data samples by local transaction ID
+	chargePoint           *Connector                // Connector 0, the status of the charge point as a whole
+	reservations          map[int]*Reservation      // Keyed by reservation ID
+	statusQueue           []statusNotification      // Status changes not yet reported
+	statusSendMu          sync.Mutex                // Keeps status notifications in order, held without mu
+	signedFirmware        firmwareState             // Progress of the last SignedUpdateFirmware
+	firmwareVersion       string                    // Installed firmware, changed by UpdateFirmware
+	firmwareStatus        string                    // Last FirmwareStatusNotification status
+	diagnosticsStatus     string                    // Last DiagnosticsStatusNotification status
+	firmwareBehavior      FirmwareBehavior          // Faults injected into file transfers
+	bootReason            string                    // Why the charger booted last
+	reusedMessageID       atomic.Value              // Message ID repeated by the vendor profile
+	schemaViolations      []SchemaViolation         // Findings, guarded by findingsMu rather than mu
+	findingsMu            sync.Mutex
+	mu                    sync.RWMutex
+	logger                *logrus.Entry
+	power                 atomic.Value // *powerCycle, replaced when the charger powers on again
+	powerMu               sync.Mutex   // Serializes power cycle changes
 }
 
 // ChargerConfig holds configuration for a virtual charger
 type ChargerConfig struct {
-	Identifier     string            `json:"identifier"`
-	Model          string            `json:"model"`
-	Vendor         string            `json:"vendor"`
-	SerialNumber   string            `json:"serial_number"`
-	ConnectorCount int               `json:"connector_count"`
-	Features       []string          `json:"features"`
-	CSMSEndpoint   string            `json:"csms_endpoint"`
-	OCPPVersion    string            `json:"ocpp_version"`
-	BasicAuthUser  string            `json:"basic_auth_user,omitempty"`
-	BasicAuthPass  string            `json:"basic_auth_pass,omitempty"`
-	CustomData     map[string]string `json:"custom_data"`
+	Identifier     string             `json:"identifier"`
+	Model          string             `json:"model"`
+	Vendor         string             `json:"vendor"`
+	SerialNumber   string             `json:"serial_number"`
+	ConnectorCount int                `json:"connector_count"`
+	Features       []string           `json:"features"`
+	MaxPowerKW     float64            `json:"max_power_kw,omitempty"` // Rated power, defaults to 22 kW
+	CurrentType    string             `json:"current_type,omitempty"` // "AC" (default) or "DC"
+	EVFleet        []EVType           `json:"ev_fleet,omitempty"`     // EVs drawn for each transaction
+	CSMSEndpoint   string             `json:"csms_endpoint"`
+	OCPPVersion    string             `json:"ocpp_version"`
+	BasicAuthUser  string             `json:"basic_auth_user,omitempty"`
+	BasicAuthPass  string             `json:"basic_auth_pass,omitempty"`
+	CustomData     map[string]string  `json:"custom_data"`
+	Configuration  map[string]string  `json:"configuration,omitempty"` // Initial OCPP configuration key values
+	Boot           BootBehavior       `json:"boot,omitempty"`          // Deviations from the boot sequence
+	Reconnect      ReconnectPolicy    `json:"reconnect,omitempty"`     // Backoff after losing the CSMS connection
+	OfflineQueue   OfflineQueuePolicy `json:"offline_queue,omitempty"` // Buffering of messages while offline
+
+	SchemaValidation SchemaValidationPolicy `json:"schema_validation,omitempty"` // Validation of OCPP payloads
+	ConnectorStates  ConnectorBehavior      `json:"connector_states,omitempty"`  // Deviations from the connector state machine
+	Reservations     ReservationBehavior    `json:"reservations,omitempty"`      // How drivers treat reservations
+	LocalAuthList    LocalAuthList          `json:"local_auth_list,omitempty"`   // Local authorization list installed at start
+	FirmwareVersion  string                 `json:"firmware_version,omitempty"`  // Installed firmware, reported in BootNotification
+	Firmware         FirmwareBehavior       `json:"firmware,omitempty"`          // Faults of firmware updates and diagnostics uploads
+	RebootDelay      float64                `json:"reboot_delay,omitempty"`      // Seconds offline while rebooting
+	SecurityProfile  int                    `json:"security_profile,omitempty"`  // OCPP security profile 1-3, 0 to not enforce one
+	TLS              TLSPolicy              `json:"tls,omitempty"`               // Settings for wss:// endpoints
+	Keepalive        KeepalivePolicy        `json:"keepalive,omitempty"`         // WebSocket pings and read deadline
+	Pipeline         PipelinePolicy         `json:"pipeline,omitempty"`          // Message queues of the connection
+	Profile          string                 `json:"profile,omitempty"`           // Name of the vendor profile emulating firmware quirks
+	VendorProfile    VendorProfile          `json:"-"`                           // The named profile, resolved when the charger is created
+	MessageIDs       MessageIDPolicy        `json:"message_ids,omitempty"`       // Generation of message IDs
+}
+
+// Validate checks the config against the registered OCPP versions and the
+// requirements of its security profile
+func (c ChargerConfig) Validate() error {
+	if _, err := ocpp.LookupProtocol(c.OCPPVersion); err != nil {
+		return fmt.Errorf("charger %s: %w", c.Identifier, err)
+	}
+	if err := c.TLS.Validate(); err != nil {
+		return fmt.Errorf("charger %s: tls: %w", c.Identifier, err)
+	}
+	if err := c.LocalAuthList.Validate(); err != nil {
+		return fmt.Errorf("charger %s: local_auth_list: %w", c.Identifier, err)
+	}
+	if err := c.MessageIDs.Validate(); err != nil {
+		return fmt.Errorf("charger %s: message_ids: %w", c.Identifier, err)
+	}
+
+	if err := ocpp.ValidateSecurityProfile(c.SecurityProfile, c.CSMSEndpoint,
+		c.BasicAuthUser != "" && c.BasicAuthPass != "", c.TLS.clientConfig().HasClientCertificate()); err != nil {
+		return fmt.Errorf("charger %s: %w", c.Identifier, err)
+	}
+	return nil
+}
+
+// clientConfig returns the settings of the OCPP client of the charger
+func (c ChargerConfig) clientConfig() ocpp.ClientConfig {
+	return ocpp.ClientConfig{
+		ChargerID:     c.Identifier,
+		Endpoint:      c.CSMSEndpoint,
+		BasicAuthUser: c.BasicAuthUser,
+		BasicAuthPass: c.BasicAuthPass,
+		Reconnect:     c.Reconnect.clientConfig(),
+		OfflineQueue:  c.OfflineQueue.clientConfig(),
+
+		SchemaValidation: c.SchemaValidation.clientConfig(),
+		SecurityProfile:  c.SecurityProfile,
+		TLS:              c.TLS.clientConfig(),
+		Keepalive:        c.Keepalive.clientConfig(),
+		Pipeline:         c.Pipeline.clientConfig(),
+		MessageIDs:       ocpp.NewMessageIDGenerator(c.MessageIDs.clientConfig(c.Identifier)),
+	}
 }
 
 // ChargerStatus represents the current status of a charger
@@ -51,48 +146,57 @@ const (
 	StatusError      ChargerStatus = "error"
 )
 
-// NewVirtualCharger creates a new virtual charger instance
+// NewVirtualCharger creates a new OCPP 1.6 virtual charger instance. New
+// creates the charger registered for the configured OCPP version.
 func NewVirtualCharger(config ChargerConfig, eventBus eventbus.EventBus) *VirtualCharger {
-	ctx, cancel := context.WithCancel(context.Background())
-	
+	return newVirtualCharger(config, ocpp.OCPP16Protocol, eventBus)
+}
+
+// newVirtualCharger creates a virtual charger whose client speaks protocol
+func newVirtualCharger(config ChargerConfig, protocol ocpp.Protocol, eventBus eventbus.EventBus) *VirtualCharger {
 	logger := logrus.WithFields(logrus.Fields{
 		"component":  "charger",
 		"charger_id": config.Identifier,
 	})
 
-	// Create OCPP client based on version
-	var ocppClient ocpp.Client
-	switch config.OCPPVersion {
-	case "1.6":
-		ocppClient = ocpp.NewOCCP16ClientWithConfig(ocpp.ClientConfig{
-			ChargerID:     config.Identifier,
-			Endpoint:      config.CSMSEndpoint,
-			BasicAuthUser: config.BasicAuthUser,
-			BasicAuthPass: config.BasicAuthPass,
-		})
-	default:
-		logger.Warnf("Unsupported OCPP version %s, defaulting to 1.6", config.OCPPVersion)
-		ocppClient = ocpp.NewOCCP16ClientWithConfig(ocpp.ClientConfig{
-			ChargerID:     config.Identifier,
-			Endpoint:      config.CSMSEndpoint,
-			BasicAuthUser: config.BasicAuthUser,
-			BasicAuthPass: config.BasicAuthPass,
-		})
-	}
+	// Certificates renewed through CertificateSigned are used on the next connection
+	certificates := NewCertificateStore()
+	configuration := NewConfigurationStore(config)
+	clientConfig := config.clientConfig()
+	clientConfig.TLS.ClientCertificate = certificates.ClientCertificate
+	clientConfig.Keepalive.PingInterval = configuration.GetInterval(KeyWebSocketPingInterval)
+
+	ocppClient := protocol.CreateClientWithConfig(clientConfig)
 
 	charger := &VirtualCharger{
 		id:           config.Identifier,
 		config:       config,
 		ocppClient:   ocppClient,
+		messageIDs:   clientConfig.MessageIDs,
 		eventBus:     eventBus,
 		status:       StatusOffline,
 		connectors:   make([]*Connector, config.ConnectorCount),
 		transactions: make(map[int]*Transaction),
 		logger:       logger,
-		ctx:          ctx,
-		cancel:       cancel,
+
+		triggering:            make(map[string]int),
+		scheduledAvailability: make(map[int]ConnectorStatus),
+		offlineStarts:         make(map[string]int),
+		transactionData:       make(map[int][]ocpp.MeterValue),
+		chargePoint:           NewConnector(0, ConnectorStatusAvailable),
+		firmwareVersion:       config.FirmwareVersion,
+		firmwareBehavior:      config.Firmware,
+		reservations:          make(map[int]*Reservation),
+		configuration:         configuration,
+		certificates:          certificates,
+		authorizations:        NewAuthorizationStore(config.LocalAuthList),
+		chargingProfiles:      NewChargingProfileStore(),
+		charging:              newChargingSessions(config),
 	}
 
+	charger.power.Store(newPowerCycle())
+	charger.registerCallHandlers()
+
 	// Initialize connectors
 	for i := 0; i < config.ConnectorCount; i++ {
 		charger.connectors[i] = NewConnector(i+1, ConnectorStatusAvailable)
@@ -101,20 +205,22 @@ func NewVirtualCharger(config ChargerConfig, eventBus eventbus.EventBus) *Virtua
 	return charger
 }
 
-// Start starts the virtual charger
+// Start starts the virtual charger. A stopped charger can be started again.
 func (vc *VirtualCharger) Start(ctx context.Context) error {
 	vc.logger.Info("Starting virtual charger")
 
+	vc.powerOn()
+	return vc.boot(BootReasonPowerUp)
+}
+
+// boot connects to the CSMS and registers, then starts the background
+// routines of the power cycle
+func (vc *VirtualCharger) boot(reason string) error {
 	vc.mu.Lock()
 	vc.status = StatusConnecting
+	vc.bootReason = reason
 	vc.mu.Unlock()
 
-	// TODO: Implement charger startup logic
-	// - Connect to CSMS via OCPP
-	// - Send BootNotification
-	// - Start heartbeat
-	// - Register message handlers
-
 	if err := vc.connect(); err != nil {
 		vc.setStatus(StatusError)
 		return fmt.Errorf("failed to connect: %w", err)
@@ -126,6 +232,9 @@ func (vc *VirtualCharger) Start(ctx context.Context) error {
 	// Start background routines
 	go vc.heartbeatLoop()
 	go vc.statusLoop()
+	go vc.meterValuesLoop()
+	go vc.clockAlignedLoop()
+	go watchPingInterval(vc.context(), vc.configuration, KeyWebSocketPingInterval, vc.ocppClient)
 
 	return nil
 }
@@ -135,18 +244,12 @@ func (vc *VirtualCharger) Stop(ctx context.Context) error {
 	vc.logger.Info("Stopping virtual charger")
 
 	// Stop all active transactions
-	vc.mu.RLock()
-	activeTransactions := make([]*Transaction, 0)
-	for _, tx := range vc.transactions {
-		if tx.IsActive() {
-			activeTransactions = append(activeTransactions, tx)
-		}
-	}
-	vc.mu.RUnlock()
+	activeTransactions := vc.activeTransactions()
 
-	// Stop each active transaction
+	// Stop each active transaction, waiting for a full offline queue no
+	// longer than ctx allows
 	for _, tx := range activeTransactions {
-		if err := vc.StopTransaction(tx.ID, "ChargerShutdown"); err != nil {
+		if err := vc.stopTransaction(ctx, tx.ID, "ChargerShutdown"); err != nil {
 			vc.logger.WithError(err).WithField("transaction_id", tx.ID).Error("Failed to stop transaction")
 		}
 	}
@@ -160,10 +263,11 @@ func (vc *VirtualCharger) Stop(ctx context.Context) error {
 
 	// Cancel context to stop background routines
 	vc.cancel()
+	vc.stopBootRetry()
 
 	// Update status
 	vc.setStatus(StatusOffline)
-	
+
 	// Publish shutdown event
 	vc.eventBus.Publish(ctx, eventbus.NewChargerEvent(
 		"charger.stopped",
@@ -177,6 +281,11 @@ func (vc *VirtualCharger) Stop(ctx context.Context) error {
 	return nil
 }
 
+// GetID returns the charge point identifier
+func (vc *VirtualCharger) GetID() string {
+	return vc.id
+}
+
 // GetStatus returns the current status of the charger
 func (vc *VirtualCharger) GetStatus() ChargerStatus {
 	vc.mu.RLock()
@@ -191,153 +300,378 @@ func (vc *VirtualCharger) GetConnectors() []*Connector {
 	return vc.connectors
 }
 
+// activeTransactions returns a snapshot of all active transactions
+func (vc *VirtualCharger) activeTransactions() []*Transaction {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	active := make([]*Transaction, 0)
+	for _, tx := range vc.transactions {
+		if tx.IsActive() {
+			active = append(active, tx)
+		}
+	}
+	return active
+}
+
+// hasActiveTransaction reports whether a transaction runs on the connector.
+// The caller must hold vc.mu.
+func (vc *VirtualCharger) hasActiveTransaction(connectorID int) bool {
+	for _, tx := range vc.transactions {
+		if tx.ConnectorID == connectorID && tx.IsActive() {
+			return true
+		}
+	}
+	return false
+}
+
+// Configuration returns the OCPP configuration key store of the charger
+func (vc *VirtualCharger) Configuration() *ConfigurationStore {
+	return vc.configuration
+}
+
+// Certificates returns the certificate store of the charger
+func (vc *VirtualCharger) Certificates() *CertificateStore {
+	return vc.certificates
+}
+
+// ChargingProfiles returns the smart charging profiles of the charger
+func (vc *VirtualCharger) ChargingProfiles() *ChargingProfileStore {
+	return vc.chargingProfiles
+}
+
 // IsConnected returns true if charger is connected to CSMS
 func (vc *VirtualCharger) IsConnected() bool {
 	return vc.ocppClient.IsConnected()
 }
 
-// StartTransaction starts a charging transaction on a connector
+// StartTransaction starts a locally initiated charging transaction on a
+// connector. The idTag is authorized with the CSMS first.
 func (vc *VirtualCharger) StartTransaction(connectorID int, idTag string) (*Transaction, error) {
+	return vc.startTransaction(connectorID, idTag, true)
+}
+
+// startTransaction authorizes the idTag if requested, sends StartTransaction
+// and waits for the CSMS to assign the transaction ID
+func (vc *VirtualCharger) startTransaction(connectorID int, idTag string, authorize bool) (*Transaction, error) {
 	vc.logger.WithFields(logrus.Fields{
 		"connector_id": connectorID,
 		"id_tag":       idTag,
 	}).Info("Starting transaction")
 
+	parentIDTag, err := vc.reservedParentIDTag(connectorID, idTag)
+	if err != nil {
+		return nil, err
+	}
+
 	vc.mu.Lock()
-	defer vc.mu.Unlock()
 
 	// Validate connector ID
 	if connectorID < 1 || connectorID > len(vc.connectors) {
+		vc.mu.Unlock()
 		return nil, fmt.Errorf("invalid connector ID: %d", connectorID)
 	}
 
 	connector := vc.connectors[connectorID-1]
-	
-	// Check if connector is available
-	if !connector.IsAvailable() {
+
+	// Check if connector is available, an EV may already be plugged in
+	if !vc.startableLocked(connector) {
+		vc.mu.Unlock()
 		return nil, fmt.Errorf("connector %d not available: %s", connectorID, connector.Status)
 	}
 
-	// Update connector status
-	connector.SetStatus(ConnectorStatusPreparing)
+	// A reservation for the idTag is used up, one for another idTag keeps the connector
+	reservation, ignored, err := vc.takeReservationLocked(connector, idTag, parentIDTag)
+	if err != nil {
+		vc.mu.Unlock()
+		return nil, err
+	}
+
+	// Without a PlugIn event the EV is plugged in now and leaves after the transaction
+	if !connector.PluggedIn {
+		connector.PluggedIn = true
+		connector.autoUnplug = true
+	}
+	if err := vc.setConnectorStatusLocked(connector, ConnectorStatusPreparing, ""); err != nil {
+		vc.mu.Unlock()
+		return nil, err
+	}
+	// The connector is reserved for this transaction while we wait for the CSMS
+	connector.starting = true
 
 	// Create local transaction record
-	transactionID := len(vc.transactions) + 1 // Simple ID generation
-	meterValue := 0 // Starting meter value
+	vc.nextTransactionID++
+	transactionID := vc.nextTransactionID
+	meterValue := vc.charging.register(connectorID) // The meter keeps counting across transactions
 	transaction := NewTransaction(transactionID, connectorID, idTag, meterValue)
-	
+	if reservation != nil {
+		transaction.ReservationID = &reservation.ID
+	}
+	vc.mu.Unlock()
+	vc.flushStatusNotifications()
+	if ignored != nil {
+		vc.publishReservationEnded(ignored, reservationEndedIgnored)
+	}
+
+	// abort releases the connector when the transaction cannot start, the
+	// reservation it used holds it again
+	abort := func(reason string) {
+		vc.mu.Lock()
+		transaction.Fail(reason)
+		if reservation != nil {
+			vc.restoreReservationLocked(reservation)
+		}
+		vc.releaseConnectorLocked(connector)
+		vc.mu.Unlock()
+		vc.flushStatusNotifications()
+	}
+
+	// The idTag was authorized already if the reservation needed its
+	// parentIdTag. Offline the local list and cache decide.
+	if authorize && parentIDTag == "" {
+		info, err := vc.authorizeIdTag(idTag)
+		if err != nil {
+			abort("AuthorizeFailed")
+			return nil, err
+		}
+		if info.Status != "Accepted" {
+			abort("DeAuthorized")
+			return nil, fmt.Errorf("id tag %s not authorized: %s", idTag, info.Status)
+		}
+	}
+
+	// Without a connection the transaction starts locally and is reported to
+	// the CSMS from the offline queue after reconnecting. While messages of
+	// earlier transactions wait in the queue, the StartTransaction queues
+	// behind them.
+	if !vc.IsConnected() || vc.queuedMessages() > 0 {
+		transaction, err := vc.startQueuedTransaction(transaction, connector)
+		if err == nil && reservation != nil {
+			vc.publishReservationEnded(reservation, reservationEndedUsed)
+		}
+		return transaction, err
+	}
+
 	// Send StartTransaction to CSMS
 	startReq := &ocpp.StartTransactionRequest{
-		ConnectorId: connectorID,
-		IdTag:       idTag,
-		MeterStart:  meterValue,
-		Timestamp:   time.Now(),
+		ConnectorId:   connectorID,
+		IdTag:         idTag,
+		MeterStart:    meterValue,
+		ReservationId: transaction.ReservationID,
+		Timestamp:     transaction.StartTime,
 	}
-	
-	msg := &ocpp.OCPP16Message{
-		MessageType: "Call",
-		MessageID:   fmt.Sprintf("start-%s-%d", vc.id, transactionID),
-		Action:      ocpp.MessageTypeStartTransaction,
-		Payload:     startReq,
-	}
-	
-	if err := vc.ocppClient.SendMessage(vc.ctx, msg); err != nil {
-		connector.SetStatus(ConnectorStatusAvailable)
+
+	resp, err := vc.call(ocpp.MessageTypeStartTransaction, startReq)
+	if err != nil {
+		abort("StartFailed")
 		return nil, fmt.Errorf("failed to send start transaction: %w", err)
 	}
-	
-	// Store transaction
+
+	startResp, ok := resp.(*ocpp.StartTransactionResponse)
+	if !ok {
+		abort("StartFailed")
+		return nil, fmt.Errorf("invalid start transaction response")
+	}
+	vc.cacheIdTag(idTag, startResp.IdTagInfo)
+
+	// Store transaction with the ID assigned by the CSMS
+	vc.mu.Lock()
+	transaction.Confirm(startResp.TransactionId, startResp.IdTagInfo.Status)
 	vc.transactions[transactionID] = transaction
-	
+	session := vc.charging.start(transaction)
+	vc.beginTransactionDataLocked(transaction, session)
+
 	// Update connector status to charging
-	connector.SetStatus(ConnectorStatusCharging)
-	
+	connector.starting = false
+	if err := vc.setConnectorStatusLocked(connector, ConnectorStatusCharging, ""); err != nil {
+		vc.logger.WithError(err).WithField("connector_id", connectorID).Error("Failed to set connector status")
+	}
+	vc.mu.Unlock()
+	vc.flushStatusNotifications()
+	if reservation != nil {
+		vc.publishReservationEnded(reservation, reservationEndedUsed)
+	}
+
+	vc.logger.WithFields(logrus.Fields{
+		"transaction_id":      transactionID,
+		"csms_transaction_id": startResp.TransactionId,
+		"id_tag_status":       startResp.IdTagInfo.Status,
+	}).Info("Transaction started")
+
 	// Publish event
-	vc.eventBus.Publish(vc.ctx, eventbus.NewChargerEvent(
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
 		"charger.transaction.started",
 		vc.id,
 		map[string]interface{}{
-			"transaction_id": transactionID,
-			"connector_id":   connectorID,
-			"id_tag":         idTag,
+			"transaction_id":      transactionID,
+			"csms_transaction_id": startResp.TransactionId,
+			"connector_id":        connectorID,
+			"id_tag":              idTag,
+			"id_tag_status":       startResp.IdTagInfo.Status,
 		},
 	))
 
+	// The CSMS may still reject the idTag in its StartTransaction response
+	if startResp.IdTagInfo.Status != "Accepted" {
+		if vc.configuration.GetBool(KeyStopTransactionOnInvalidId, true) {
+			if err := vc.StopTransaction(transactionID, "DeAuthorized"); err != nil {
+				vc.logger.WithError(err).WithField("transaction_id", transactionID).Error("Failed to stop deauthorized transaction")
+			}
+			return transaction, fmt.Errorf("id tag %s not accepted by CSMS: %s", idTag, startResp.IdTagInfo.Status)
+		}
+
+		// Keep the transaction but stop delivering energy
+		session.suspend()
+		vc.reportCharging(session, session.reevaluate(vc.sessionLimit))
+	}
+
 	return transaction, nil
 }
 
+// authorize sends an Authorize request and returns the IdTagInfo
+func (vc *VirtualCharger) authorize(idTag string) (ocpp.IdTagInfo, error) {
+	resp, err := vc.call(ocpp.MessageTypeAuthorize, &ocpp.AuthorizeRequest{IdTag: idTag})
+	if err != nil {
+		return ocpp.IdTagInfo{}, fmt.Errorf("failed to authorize id tag: %w", err)
+	}
+
+	authResp, ok := resp.(*ocpp.AuthorizeResponse)
+	if !ok {
+		return ocpp.IdTagInfo{}, fmt.Errorf("invalid authorize response")
+	}
+
+	vc.logger.WithFields(logrus.Fields{
+		"id_tag": idTag,
+		"status": authResp.IdTagInfo.Status,
+	}).Debug("Authorize response received")
+
+	return authResp.IdTagInfo, nil
+}
+
+// transactionByCSMSID finds a transaction by the ID the CSMS assigned to it.
+// The caller must hold vc.mu.
+func (vc *VirtualCharger) transactionByCSMSID(csmsID int) *Transaction {
+	for _, tx := range vc.transactions {
+		if tx.CSMSID == csmsID {
+			return tx
+		}
+	}
+	return nil
+}
+
 // StopTransaction stops a charging transaction
 func (vc *VirtualCharger) StopTransaction(transactionID int, reason string) error {
+	return vc.stopTransaction(vc.context(), transactionID, reason)
+}
+
+// stopTransaction stops a transaction, giving up when ctx ends while the
+// StopTransaction waits for room in a full offline queue. The charger is not
+// locked while the message is sent.
+func (vc *VirtualCharger) stopTransaction(ctx context.Context, transactionID int, reason string) error {
 	vc.logger.WithFields(logrus.Fields{
 		"transaction_id": transactionID,
 		"reason":         reason,
 	}).Info("Stopping transaction")
 
+	defer vc.flushStatusNotifications()
 	vc.mu.Lock()
-	defer vc.mu.Unlock()
 
 	// Find transaction
 	transaction, exists := vc.transactions[transactionID]
 	if !exists {
+		vc.mu.Unlock()
 		return fmt.Errorf("transaction %d not found", transactionID)
 	}
 
 	// Check if already stopped
-	if !transaction.IsActive() {
+	if !transaction.IsActive() || transaction.stopping {
+		vc.mu.Unlock()
 		return fmt.Errorf("transaction %d already stopped", transactionID)
 	}
 
 	// Get connector
 	if transaction.ConnectorID < 1 || transaction.ConnectorID > len(vc.connectors) {
+		vc.mu.Unlock()
 		return fmt.Errorf("invalid connector ID in transaction: %d", transaction.ConnectorID)
 	}
 	connector := vc.connectors[transaction.ConnectorID-1]
 
-	// Calculate final meter value (simulate energy usage)
-	meterStop := transaction.MeterStart + 5000 // Simulated 5kWh usage
-	
+	// Final meter value of the charging session, which ends once the
+	// StopTransaction has been sent or queued
+	reading := vc.charging.finish(transaction, vc.sessionLimit)
+	meterStop := reading.meterWh()
+	stoppedAt := time.Now()
+
+	// Samples collected for the CSMS during the transaction and at its end
+	transactionData := vc.transactionData[transactionID]
+	if meterValue, ok := vc.sampleMeterValue(KeyStopTxnSampledData, stoppedAt, reading, readingContextTransactionEnd); ok {
+		transactionData = append(transactionData, meterValue)
+	}
+
 	// Send StopTransaction to CSMS
+	idTag := transaction.IDTag
 	stopReq := &ocpp.StopTransactionRequest{
-		TransactionId: transactionID,
-		MeterStop:     meterStop,
-		Timestamp:     time.Now(),
-		Reason:        &reason,
+		IdTag:           &idTag,
+		TransactionId:   transaction.CSMSID,
+		MeterStop:       meterStop,
+		Timestamp:       stoppedAt,
+		Reason:          &reason,
+		TransactionData: transactionData,
 	}
-	
+
 	msg := &ocpp.OCPP16Message{
 		MessageType: "Call",
-		MessageID:   fmt.Sprintf("stop-%s-%d", vc.id, transactionID),
+		MessageID:   vc.messageIDs.NewMessageID(ocpp.MessageTypeStopTransaction),
 		Action:      ocpp.MessageTypeStopTransaction,
 		Payload:     stopReq,
 	}
-	
-	if err := vc.ocppClient.SendMessage(vc.ctx, msg); err != nil {
+	transaction.stopping = true
+	vc.mu.Unlock()
+
+	err := vc.sendMessageContext(ctx, msg)
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	transaction.stopping = false
+	if err != nil {
 		return fmt.Errorf("failed to send stop transaction: %w", err)
 	}
-	
-	// Update transaction
+
+	// Update transaction, its TxProfiles end with it
+	vc.charging.end(transaction, reading)
 	transaction.Complete(meterStop, reason)
-	
+	delete(vc.transactionData, transactionID)
+	vc.chargingProfiles.ClearTransaction(transaction.ConnectorID)
+
 	// Update connector status
-	connector.SetStatus(ConnectorStatusFinishing)
-	
-	// Schedule connector to become available after a delay
-	go func() {
-		time.Sleep(2 * time.Second)
-		vc.mu.Lock()
-		connector.SetStatus(ConnectorStatusAvailable)
-		vc.mu.Unlock()
-	}()
-	
+	if err := vc.setConnectorStatusLocked(connector, ConnectorStatusFinishing, ""); err != nil {
+		vc.logger.WithError(err).WithField("connector_id", connector.ID).Error("Failed to set connector status")
+	}
+
+	// An EV plugged in by StartTransaction, or already gone, leaves the
+	// connector after a delay; otherwise it stays Finishing until PlugOut
+	if connector.autoUnplug || !connector.PluggedIn {
+		go func() {
+			time.Sleep(2 * time.Second)
+			vc.mu.Lock()
+			if connector.Status == ConnectorStatusFinishing && (connector.autoUnplug || !connector.PluggedIn) {
+				vc.releaseConnectorLocked(connector)
+			}
+			vc.mu.Unlock()
+			vc.flushStatusNotifications()
+		}()
+	}
+
 	// Publish event
-	vc.eventBus.Publish(vc.ctx, eventbus.NewChargerEvent(
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
 		"charger.transaction.stopped",
 		vc.id,
 		map[string]interface{}{
-			"transaction_id": transactionID,
-			"connector_id":   transaction.ConnectorID,
-			"meter_stop":     meterStop,
-			"reason":         reason,
+			"transaction_id":      transactionID,
+			"csms_transaction_id": transaction.CSMSID,
+			"connector_id":        transaction.ConnectorID,
+			"meter_stop":          meterStop,
+			"reason":              reason,
 		},
 	))
 
@@ -347,21 +681,27 @@ func (vc *VirtualCharger) StopTransaction(transactionID int, reason string) erro
 // connect establishes connection to CSMS
 func (vc *VirtualCharger) connect() error {
 	vc.logger.Debug("Establishing connection to CSMS")
-	
+
 	// Connect via OCPP client
-	if err := vc.ocppClient.Connect(vc.ctx); err != nil {
+	if err := vc.ocppClient.Connect(vc.context()); err != nil {
 		return fmt.Errorf("failed to connect to CSMS: %w", err)
 	}
-	
-	// Set message handler
+
+	// Set message and connection handlers
 	vc.ocppClient.SetMessageHandler(vc)
-	
+	vc.ocppClient.SetConnectionHandler(vc)
+
+	// Some firmwares report their connectors before registering
+	if vc.config.VendorProfile.StatusBeforeBoot {
+		vc.reportConnectorStatus()
+	}
+
 	// Send BootNotification
 	if err := vc.sendBootNotification(); err != nil {
-		vc.ocppClient.Disconnect(vc.ctx)
+		vc.ocppClient.Disconnect(vc.context())
 		return fmt.Errorf("failed to send boot notification: %w", err)
 	}
-	
+
 	return nil
 }
 
@@ -379,73 +719,78 @@ func (vc *VirtualCharger) setStatus(status ChargerStatus) {
 	}).Info("Charger status changed")
 }
 
-// heartbeatLoop sends periodic heartbeat messages
+// heartbeatLoop sends heartbeat messages every HeartbeatInterval seconds
 func (vc *VirtualCharger) heartbeatLoop() {
-	ticker := time.NewTicker(30 * time.Second) // TODO: Make configurable
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-vc.ctx.Done():
-			return
-		case <-ticker.C:
-			if vc.IsConnected() {
-				if err := vc.sendHeartbeat(); err != nil {
-					vc.logger.WithError(err).Error("Failed to send heartbeat")
-				}
+	vc.runConfiguredLoop(KeyHeartbeatInterval, func() {
+		if vc.IsConnected() && vc.registeredFor(ocpp.MessageTypeHeartbeat) {
+			if err := vc.sendHeartbeat(); err != nil {
+				vc.logger.WithError(err).Error("Failed to send heartbeat")
 			}
 		}
-	}
+	})
 }
 
-// statusLoop periodically updates charger status
+// statusLoop re-sends the status of the charge point and every connector each
+// StatusNotificationInterval seconds, disabled by default since status
+// changes are reported as they happen
 func (vc *VirtualCharger) statusLoop() {
-	ticker := time.NewTicker(10 * time.Second) // TODO: Make configurable
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-vc.ctx.Done():
-			return
-		case <-ticker.C:
-			// Send StatusNotification for each connector
-			for _, connector := range vc.connectors {
-				if err := vc.sendStatusNotification(connector.ID, string(connector.Status)); err != nil {
-					vc.logger.WithError(err).Error("Failed to send status notification")
-				}
-			}
+	vc.runConfiguredLoop(KeyStatusNotificationInterval, func() {
+		if vc.registeredFor(ocpp.MessageTypeStatusNotification) {
+			vc.reportConnectorStatus()
 		}
-	}
+	})
 }
 
-// sendBootNotification sends boot notification to CSMS
+// runConfiguredLoop runs fn every interval given by a configuration key in
+// seconds until the charger stops. Changes to the key take effect immediately,
+// an interval of 0 pauses the loop.
+func (vc *VirtualCharger) runConfiguredLoop(key string, fn func()) {
+	vc.runConfiguredLoopContext(vc.context(), key, fn)
+}
+
+// runConfiguredLoopContext is runConfiguredLoop bound to a custom context
+func (vc *VirtualCharger) runConfiguredLoopContext(ctx context.Context, key string, fn func()) {
+	vc.configuration.runLoop(ctx, key, fn)
+}
+
+// sendBootNotification sends boot notification to CSMS and waits for the response
 func (vc *VirtualCharger) sendBootNotification() error {
 	bootReq := ocpp.NewBootNotificationRequest(vc.config.Model, vc.config.Vendor)
 	if vc.config.SerialNumber != "" {
 		bootReq.ChargePointSerialNumber = &vc.config.SerialNumber
 	}
-	
-	msg := &ocpp.OCPP16Message{
-		MessageType: "Call",
-		MessageID:   fmt.Sprintf("boot-%s-%d", vc.id, time.Now().Unix()),
-		Action:      ocpp.MessageTypeBootNotification,
-		Payload:     bootReq,
+	if firmwareVersion := vc.FirmwareVersion(); firmwareVersion != "" {
+		bootReq.FirmwareVersion = &firmwareVersion
 	}
-	
-	if err := vc.ocppClient.SendMessage(vc.ctx, msg); err != nil {
-		return fmt.Errorf("failed to send boot notification: %w", err)
-	}
-	
+
 	// Publish event
-	vc.eventBus.Publish(vc.ctx, eventbus.NewChargerEvent(
+	vc.eventBus.Publish(vc.context(), eventbus.NewChargerEvent(
 		"charger.boot_notification.sent",
 		vc.id,
 		map[string]interface{}{
-			"model":  vc.config.Model,
-			"vendor": vc.config.Vendor,
+			"model":            vc.config.Model,
+			"vendor":           vc.config.Vendor,
+			"firmware_version": vc.FirmwareVersion(),
+			"reason":           vc.BootReason(),
 		},
 	))
-	
+
+	resp, err := vc.call(ocpp.MessageTypeBootNotification, bootReq)
+	if err != nil {
+		return fmt.Errorf("failed to send boot notification: %w", err)
+	}
+
+	bootResp, ok := resp.(*ocpp.BootNotificationResponse)
+	if !ok {
+		return fmt.Errorf("invalid boot notification response")
+	}
+
+	vc.handleBootNotificationResponse(bootResp)
+
+	// An accepted charger reports the status of all its connectors
+	if vc.GetRegistrationStatus() == RegistrationAccepted {
+		vc.reportConnectorStatus()
+	}
 	return nil
 }
 
@@ -453,31 +798,36 @@ func (vc *VirtualCharger) sendBootNotification() error {
 func (vc *VirtualCharger) sendHeartbeat() error {
 	msg := &ocpp.OCPP16Message{
 		MessageType: "Call",
-		MessageID:   fmt.Sprintf("hb-%s-%d", vc.id, time.Now().Unix()),
+		MessageID:   vc.messageIDs.NewMessageID(ocpp.MessageTypeHeartbeat),
 		Action:      ocpp.MessageTypeHeartbeat,
 		Payload:     ocpp.NewHeartbeatRequest(),
 	}
-	
-	if err := vc.ocppClient.SendMessage(vc.ctx, msg); err != nil {
+
+	if err := vc.sendMessage(msg); err != nil {
 		return fmt.Errorf("failed to send heartbeat: %w", err)
 	}
-	
+
 	return nil
 }
 
-// sendStatusNotification sends status notification for a connector
-func (vc *VirtualCharger) sendStatusNotification(connectorID int, status string) error {
+// sendStatusNotificationAt sends the status of a connector as of timestamp
+func (vc *VirtualCharger) sendStatusNotificationAt(connectorID int, status, errorCode string, timestamp time.Time) error {
+	req := ocpp.NewStatusNotificationRequest(connectorID, errorCode, status)
+	req.Timestamp = &timestamp
+	if vc.config.VendorProfile.OmitTimestamps {
+		req.Timestamp = nil
+	}
 	msg := &ocpp.OCPP16Message{
 		MessageType: "Call",
-		MessageID:   fmt.Sprintf("status-%s-%d-%d", vc.id, connectorID, time.Now().Unix()),
+		MessageID:   vc.messageIDs.NewMessageID(ocpp.MessageTypeStatusNotification),
 		Action:      ocpp.MessageTypeStatusNotification,
-		Payload:     ocpp.NewStatusNotificationRequest(connectorID, "NoError", status),
+		Payload:     req,
 	}
-	
-	if err := vc.ocppClient.SendMessage(vc.ctx, msg); err != nil {
+
+	if err := vc.sendMessage(msg); err != nil {
 		return fmt.Errorf("failed to send status notification: %w", err)
 	}
-	
+
 	return nil
 }
 
@@ -487,13 +837,13 @@ func (vc *VirtualCharger) HandleMessage(ctx context.Context, message ocpp.Messag
 		"message_type": message.GetMessageType(),
 		"message_id":   message.GetMessageID(),
 	}).Debug("Handling OCPP message")
-	
+
 	// Type assert to OCPP16Message
 	msg, ok := message.(*ocpp.OCPP16Message)
 	if !ok {
 		return fmt.Errorf("unsupported message type")
 	}
-	
+
 	// Handle different message types
 	switch msg.MessageType {
 	case "CallResult":
@@ -510,7 +860,7 @@ func (vc *VirtualCharger) HandleMessage(ctx context.Context, message ocpp.Messag
 // handleCallResult handles OCPP CallResult messages
 func (vc *VirtualCharger) handleCallResult(ctx context.Context, msg *ocpp.OCPP16Message) error {
 	vc.logger.WithField("action", msg.Action).Debug("Handling CallResult")
-	
+
 	switch msg.Action {
 	case ocpp.MessageTypeBootNotification:
 		// Handle boot notification response
@@ -518,29 +868,24 @@ func (vc *VirtualCharger) handleCallResult(ctx context.Context, msg *ocpp.OCPP16
 		if !ok {
 			return fmt.Errorf("invalid boot notification response")
 		}
-		
-		if resp.Status == "Accepted" {
-			vc.logger.Info("Boot notification accepted by CSMS")
-			// Update heartbeat interval if needed
-		} else {
-			vc.logger.WithField("status", resp.Status).Warn("Boot notification not accepted")
-		}
-		
+
+		vc.handleBootNotificationResponse(resp)
+
 	case ocpp.MessageTypeStartTransaction:
 		// Handle start transaction response
 		resp, ok := msg.Payload.(*ocpp.StartTransactionResponse)
 		if !ok {
 			return fmt.Errorf("invalid start transaction response")
 		}
-		
+
 		vc.logger.WithField("transaction_id", resp.TransactionId).Info("Transaction started")
-		// Update transaction with CSMS transaction ID
-		
+		vc.confirmOfflineTransaction(msg.MessageID, resp)
+
 	case ocpp.MessageTypeStopTransaction:
 		// Handle stop transaction response
 		vc.logger.Info("Transaction stopped")
 	}
-	
+
 	return nil
 }
 
@@ -550,107 +895,107 @@ func (vc *VirtualCharger) handleCallError(ctx context.Context, msg *ocpp.OCPP16M
 		"action": msg.Action,
 		"error":  msg.Payload,
 	}).Error("Received CallError from CSMS")
-	
-	return nil
-}
 
-// handleCall handles incoming OCPP Call messages from CSMS
-func (vc *VirtualCharger) handleCall(ctx context.Context, msg *ocpp.OCPP16Message) error {
-	vc.logger.WithField("action", msg.Action).Debug("Handling Call from CSMS")
-	
-	// TODO: Implement handlers for CSMS-initiated messages
-	// For now, return not implemented error
-	return fmt.Errorf("handler not implemented for action: %s", msg.Action)
+	return nil
 }
 
-// SendMeterValues sends meter values for an active transaction
+// SendMeterValues sends the MeterValuesSampledData of an active transaction:
+// the energy register given and the power, current, voltage and SoC of its
+// session
 func (vc *VirtualCharger) SendMeterValues(transactionID int, meterValue int) error {
 	vc.mu.RLock()
 	transaction, exists := vc.transactions[transactionID]
+	session := vc.charging.sessions[transactionID]
 	vc.mu.RUnlock()
-	
+
 	if !exists {
 		return fmt.Errorf("transaction %d not found", transactionID)
 	}
-	
+
 	if !transaction.IsActive() {
 		return fmt.Errorf("transaction %d is not active", transactionID)
 	}
-	
-	// Create meter value
-	sampledValue := ocpp.SampledValue{
-		Value: fmt.Sprintf("%d", meterValue),
-	}
-	measurand := "Energy.Active.Import.Register"
-	unit := "Wh"
-	sampledValue.Measurand = &measurand
-	sampledValue.Unit = &unit
-	
-	meterValueReq := &ocpp.MeterValuesRequest{
-		ConnectorId:   transaction.ConnectorID,
-		TransactionId: &transactionID,
-		MeterValue: []ocpp.MeterValue{
-			{
-				Timestamp:    time.Now(),
-				SampledValue: []ocpp.SampledValue{sampledValue},
-			},
-		},
+
+	reading := meterReading{EnergyWh: float64(meterValue)}
+	if session != nil {
+		reading = session.reading()
+		reading.EnergyWh = float64(meterValue)
 	}
-	
-	msg := &ocpp.OCPP16Message{
-		MessageType: "Call",
-		MessageID:   fmt.Sprintf("mv-%s-%d-%d", vc.id, transactionID, time.Now().Unix()),
-		Action:      ocpp.MessageTypeMeterValues,
-		Payload:     meterValueReq,
+
+	meterValueSample, ok := vc.sampleMeterValue(KeyMeterValuesSampledData, time.Now(), reading, readingContextSamplePeriodic)
+	if !ok {
+		return nil
 	}
-	
-	if err := vc.ocppClient.SendMessage(vc.ctx, msg); err != nil {
-		return fmt.Errorf("failed to send meter values: %w", err)
+	if err := vc.sendMeterValues(transaction.ConnectorID, transaction, meterValueSample); err != nil {
+		return err
 	}
-	
+
 	vc.logger.WithFields(logrus.Fields{
 		"transaction_id": transactionID,
 		"meter_value":    meterValue,
 	}).Debug("Sent meter values")
-	
+
 	return nil
 }
 
-// SimulateCharging simulates a charging session with periodic meter updates
+// sampledValues converts the samples of a meter reading for the given
+// measurands into OCPP 1.6 sampled values
+func sampledValues(reading meterReading, measurands []string, readingContext string) []ocpp.SampledValue {
+	samples := selectSamples(reading.samples(), measurands)
+
+	values := make([]ocpp.SampledValue, 0, len(samples))
+	for _, sample := range samples {
+		sample := sample
+		value := ocpp.SampledValue{
+			Value:     strconv.FormatFloat(sample.value, 'f', -1, 64),
+			Context:   &readingContext,
+			Measurand: &sample.measurand,
+			Location:  &sample.location,
+			Unit:      &sample.unit,
+		}
+		if sample.phase != "" {
+			value.Phase = &sample.phase
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// SimulateCharging lets the EV of a transaction draw up to powerKW, 0 for as
+// much as it accepts, capped in real time by the charging profiles. Meter
+// values are sampled by the charger as configured. It returns after duration
+// or early once the EV is full.
 func (vc *VirtualCharger) SimulateCharging(ctx context.Context, transactionID int, duration time.Duration, powerKW float64) error {
-	ticker := time.NewTicker(30 * time.Second) // Send meter values every 30 seconds
-	defer ticker.Stop()
-	
-	startTime := time.Now()
-	initialMeter := 0
-	
 	vc.mu.RLock()
-	transaction, exists := vc.transactions[transactionID]
-	if exists {
-		initialMeter = transaction.MeterStart
-	}
+	_, exists := vc.transactions[transactionID]
+	session := vc.charging.sessions[transactionID]
 	vc.mu.RUnlock()
-	
+
 	if !exists {
 		return fmt.Errorf("transaction %d not found", transactionID)
 	}
-	
+	if session == nil {
+		return fmt.Errorf("transaction %d is not active", transactionID)
+	}
+	session.setCap(powerKW * 1000)
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	// Follow limit changes in real time and stop once the EV is full
+	ticker := time.NewTicker(chargingStep)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			elapsed := time.Since(startTime)
-			if elapsed >= duration {
+			if ctx.Err() == context.DeadlineExceeded {
 				return nil
 			}
-			
-			// Calculate energy consumed (kWh to Wh)
-			energyWh := int(powerKW * elapsed.Hours() * 1000)
-			currentMeter := initialMeter + energyWh
-			
-			if err := vc.SendMeterValues(transactionID, currentMeter); err != nil {
-				vc.logger.WithError(err).Error("Failed to send meter values")
+			return ctx.Err()
+		case now := <-ticker.C:
+			vc.advanceCharging(session, now)
+			if session.ev.Full() {
+				return nil
 			}
 		}
 	}
@@ -3,7 +3,9 @@ package charger
 import (
     "context"
     "testing"
+    "time"
     
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
     "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/require"
@@ -94,3 +96,339 @@ func TestVirtualCharger_EventPublishing(t *testing.T) {
     // For now, just verify the charger is created with event bus
     assert.NotNil(t, charger)
 }
+
+func TestVirtualCharger_StartTransactionUsesCSMSID(t *testing.T) {
+    charger, client := newTestCharger(1)
+    
+    tx, err := charger.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.Equal(t, 1, tx.ID)
+    assert.Equal(t, 1001, tx.CSMSID)
+    assert.Equal(t, "Accepted", tx.IDTagStatus)
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeAuthorize), 1)
+    assert.Equal(t, ConnectorStatusCharging, charger.GetConnectors()[0].Status)
+    
+    require.NoError(t, charger.SendMeterValues(tx.ID, 1500))
+    meterValues := client.sentCalls(ocpp.MessageTypeMeterValues)
+    require.Len(t, meterValues, 1)
+    assert.Equal(t, 1001, *meterValues[0].Payload.(*ocpp.MeterValuesRequest).TransactionId)
+    
+    require.NoError(t, charger.StopTransaction(tx.ID, "Local"))
+    stops := client.sentCalls(ocpp.MessageTypeStopTransaction)
+    require.Len(t, stops, 1)
+    assert.Equal(t, 1001, stops[0].Payload.(*ocpp.StopTransactionRequest).TransactionId)
+}
+
+func TestVirtualCharger_StartTransactionAuthorizeRejected(t *testing.T) {
+    charger, client := newTestCharger(1)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        if action == ocpp.MessageTypeAuthorize {
+            return &ocpp.AuthorizeResponse{IdTagInfo: ocpp.IdTagInfo{Status: "Blocked"}}, nil
+        }
+        return nil, nil
+    }
+    
+    _, err := charger.StartTransaction(1, "BLOCKED")
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "Blocked")
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeStartTransaction))
+    assert.True(t, charger.GetConnectors()[0].IsAvailable())
+}
+
+func TestVirtualCharger_StartTransactionDeAuthorizedByCSMS(t *testing.T) {
+    charger, client := newTestCharger(1)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        if action == ocpp.MessageTypeStartTransaction {
+            return &ocpp.StartTransactionResponse{IdTagInfo: ocpp.IdTagInfo{Status: "Invalid"}, TransactionId: 77}, nil
+        }
+        return nil, nil
+    }
+    
+    tx, err := charger.StartTransaction(1, "TAG001")
+    require.Error(t, err)
+    require.NotNil(t, tx)
+    assert.False(t, tx.IsActive())
+    
+    stops := client.sentCalls(ocpp.MessageTypeStopTransaction)
+    require.Len(t, stops, 1)
+    stopReq := stops[0].Payload.(*ocpp.StopTransactionRequest)
+    assert.Equal(t, 77, stopReq.TransactionId)
+    assert.Equal(t, "DeAuthorized", *stopReq.Reason)
+}
+
+func TestVirtualCharger_RemoteTransactionsFollowConfiguration(t *testing.T) {
+    charger, client := newTestCharger(1)
+    
+    // AuthorizeRemoteTxRequests defaults to false
+    deliverCall(t, charger, client, ocpp.MessageTypeRemoteStartTransaction, map[string]interface{}{"idTag": "TAG001"})
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeStartTransaction)) == 1
+    }, time.Second, 10*time.Millisecond)
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeAuthorize))
+    
+    // The CSMS stops the transaction by the ID it assigned
+    reply := deliverCall(t, charger, client, ocpp.MessageTypeRemoteStopTransaction, map[string]interface{}{"transactionId": 1001})
+    assert.Equal(t, "Accepted", reply.Payload.(*ocpp.RemoteStopTransactionResponse).Status)
+    assert.Eventually(t, func() bool {
+        return len(client.sentCalls(ocpp.MessageTypeStopTransaction)) == 1
+    }, time.Second, 10*time.Millisecond)
+}
+
+func TestVirtualCharger_ReconnectRestoresSession(t *testing.T) {
+    charger, client := newTestCharger(2)
+    client.respond = func(action string, payload interface{}) (interface{}, error) {
+        if action == ocpp.MessageTypeBootNotification {
+            return &ocpp.BootNotificationResponse{Status: "Accepted", Interval: 60}, nil
+        }
+        return nil, nil
+    }
+    
+    events := make(chan eventbus.Event, 10)
+    for _, eventType := range []string{"charger.disconnected", "charger.reconnected"} {
+        charger.eventBus.Subscribe(eventType, func(ctx context.Context, event eventbus.Event) error {
+            events <- event
+            return nil
+        })
+    }
+    
+    charger.OnDisconnected(assert.AnError)
+    assert.Equal(t, StatusConnecting, charger.GetStatus())
+    
+    charger.OnReconnected(3)
+    assert.Eventually(t, func() bool {
+        return charger.GetStatus() == StatusConnected
+    }, time.Second, 10*time.Millisecond)
+    
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeBootNotification), 1)
+    // Connector 0 reports the charge point status before both connectors
+    assert.Len(t, client.sentCalls(ocpp.MessageTypeStatusNotification), 3)
+    
+    var types []string
+    for len(types) < 2 {
+        select {
+        case event := <-events:
+            types = append(types, event.Type())
+        case <-time.After(time.Second):
+            t.Fatalf("missing connection events, got %v", types)
+        }
+    }
+    assert.ElementsMatch(t, []string{"charger.disconnected", "charger.reconnected"}, types)
+}
+
+func TestVirtualCharger_OfflineTransaction(t *testing.T) {
+    charger, client := newTestCharger(1)
+    require.NoError(t, client.Disconnect(context.Background()))
+    
+    // Offline the idTag cannot be authorized unless unknown tags are allowed
+    _, err := charger.StartTransaction(1, "TAG001")
+    require.Error(t, err)
+    assert.Empty(t, client.sentCalls(ocpp.MessageTypeStartTransaction))
+    
+    charger.Configuration().Set(KeyAllowOfflineTxForUnknownId, "true")
+    tx, err := charger.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.True(t, tx.Offline)
+    assert.Equal(t, ocpp.OfflineTransactionID(1), tx.CSMSID)
+    assert.Equal(t, ConnectorStatusCharging, charger.GetConnectors()[0].Status)
+    
+    starts := client.sentCalls(ocpp.MessageTypeStartTransaction)
+    require.Len(t, starts, 1)
+    
+    // Messages for the transaction carry the placeholder until the CSMS answers
+    require.NoError(t, charger.SendMeterValues(tx.ID, 1200))
+    meterReq := client.sentCalls(ocpp.MessageTypeMeterValues)[0].Payload.(*ocpp.MeterValuesRequest)
+    assert.Equal(t, ocpp.OfflineTransactionID(1), *meterReq.TransactionId)
+    
+    // The replayed StartTransaction is answered after reconnecting
+    require.NoError(t, charger.HandleMessage(context.Background(), &ocpp.OCPP16Message{
+        MessageType: "CallResult",
+        MessageID:   starts[0].MessageID,
+        Action:      ocpp.MessageTypeStartTransaction,
+        Payload:     &ocpp.StartTransactionResponse{TransactionId: 55, IdTagInfo: ocpp.IdTagInfo{Status: "Accepted"}},
+    }))
+    assert.Equal(t, 55, tx.CSMSID)
+    assert.Equal(t, "Accepted", tx.IDTagStatus)
+    assert.True(t, tx.IsActive())
+}
+
+func TestVirtualCharger_StartTransactionBehindQueuedMessages(t *testing.T) {
+    charger, mock := newTestCharger(2)
+    client := &queueMockClient{mockClient: mock, queued: 1}
+    charger.ocppClient = client
+    
+    // Messages of an earlier transaction are still being replayed, so the
+    // StartTransaction must not overtake them with a synchronous Call
+    tx, err := charger.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    assert.False(t, tx.Offline)
+    assert.Equal(t, ocpp.OfflineTransactionID(1), tx.CSMSID)
+    
+    starts := client.sentCalls(ocpp.MessageTypeStartTransaction)
+    require.Len(t, starts, 1)
+    require.NotEmpty(t, starts[0].MessageID, "StartTransaction must go through the ordered send path")
+    
+    require.NoError(t, charger.HandleMessage(context.Background(), &ocpp.OCPP16Message{
+        MessageType: "CallResult",
+        MessageID:   starts[0].MessageID,
+        Action:      ocpp.MessageTypeStartTransaction,
+        Payload:     &ocpp.StartTransactionResponse{TransactionId: 77, IdTagInfo: ocpp.IdTagInfo{Status: "Accepted"}},
+    }))
+    assert.Equal(t, 77, tx.CSMSID)
+    
+    // With the queue drained transactions start with a synchronous Call again
+    client.mu.Lock()
+    client.queued = 0
+    client.mu.Unlock()
+    tx2, err := charger.StartTransaction(2, "TAG002")
+    require.NoError(t, err)
+    assert.Equal(t, 1001, tx2.CSMSID)
+}
+
+func TestVirtualCharger_StopWhileOfflineQueueFull(t *testing.T) {
+    charger := NewVirtualCharger(ChargerConfig{
+        Identifier:     "TEST001",
+        Model:          "TestModel",
+        Vendor:         "TestVendor",
+        ConnectorCount: 1,
+        OCPPVersion:    "1.6",
+        CSMSEndpoint:   "ws://127.0.0.1:1/ocpp",
+        OfflineQueue:   OfflineQueuePolicy{Size: 1, Overflow: "block"},
+    }, eventbus.NewInMemoryBus())
+    charger.setRegistrationStatus(RegistrationAccepted)
+    charger.Configuration().Set(KeyAllowOfflineTxForUnknownId, "true")
+    
+    // The queued StartTransaction fills the queue, the StopTransaction waits
+    tx, err := charger.StartTransaction(1, "TAG001")
+    require.NoError(t, err)
+    ctx, cancel := context.WithCancel(context.Background())
+    stopped := make(chan error, 1)
+    go func() { stopped <- charger.stopTransaction(ctx, tx.ID, "Local") }()
+    
+    // The charger is not locked meanwhile, and does not stop twice
+    assert.Eventually(t, func() bool {
+        charger.mu.RLock()
+        defer charger.mu.RUnlock()
+        return tx.stopping
+    }, time.Second, 10*time.Millisecond)
+    assert.Error(t, charger.StopTransaction(tx.ID, "Local"))
+    cancel()
+    assert.Error(t, <-stopped)
+    assert.True(t, tx.IsActive())
+    
+    // The failed stop leaves the charging session running
+    charger.mu.RLock()
+    _, charging := charger.charging.sessions[tx.ID]
+    charger.mu.RUnlock()
+    assert.True(t, charging)
+    
+    // Stop gives up waiting once its context ends
+    ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    done := make(chan struct{})
+    go func() {
+        charger.Stop(ctx)
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(2 * time.Second):
+        t.Fatal("Stop blocked on the full offline queue")
+    }
+    assert.Equal(t, StatusOffline, charger.GetStatus())
+}
+
+func TestVirtualCharger_RecordsSchemaViolations(t *testing.T) {
+    charger, _ := newTestCharger(1)
+    
+    events := make(chan eventbus.Event, 1)
+    charger.eventBus.Subscribe("charger.schema_violation", func(ctx context.Context, event eventbus.Event) error {
+        events <- event
+        return nil
+    })
+    
+    err := ocpp.ValidatePayload(ocpp.MessageTypeHeartbeat, true, []byte(`{}`))
+    require.Error(t, err)
+    charger.OnSchemaViolation(&ocpp.SchemaViolation{
+        Direction:   ocpp.DirectionIncoming,
+        MessageType: "CallResult",
+        MessageID:   "hb-1",
+        Action:      ocpp.MessageTypeHeartbeat,
+        Err:         err,
+    })
+    
+    findings := charger.SchemaViolations()
+    require.Len(t, findings, 1)
+    assert.Equal(t, ocpp.MessageTypeHeartbeat, findings[0].Action)
+    require.Len(t, findings[0].Violations, 1)
+    assert.Equal(t, "currentTime", findings[0].Violations[0].Path)
+    
+    select {
+    case event := <-events:
+        data := event.Data().(eventbus.ChargerEvent).Data
+        assert.Equal(t, ocpp.ErrorCodeOccurenceConstraintViolation, data["error_code"])
+        assert.Equal(t, "incoming", data["direction"])
+    case <-time.After(time.Second):
+        t.Fatal("schema violation event not published")
+    }
+}
+
+func TestVirtualCharger_WebSocketPingInterval(t *testing.T) {
+    config := ChargerConfig{
+        Identifier:    "TEST001",
+        OCPPVersion:   "1.6",
+        Configuration: map[string]string{KeyWebSocketPingInterval: "30"},
+        Keepalive:     KeepalivePolicy{PongTimeout: 5, ReadTimeout: 120, IgnorePings: true},
+    }
+    assert.Equal(t, ocpp.KeepaliveConfig{
+        PongTimeout: 5 * time.Second,
+        ReadTimeout: 2 * time.Minute,
+        IgnorePings: true,
+    }, config.clientConfig().Keepalive)
+
+    charger, mock := newTestCharger(1)
+    client := &keepaliveMockClient{mockClient: mock, intervals: make(chan time.Duration, 4)}
+    charger.ocppClient = client
+    go watchPingInterval(charger.context(), charger.configuration, KeyWebSocketPingInterval, client)
+    defer charger.cancel()
+
+    nextInterval := func() time.Duration {
+        select {
+        case interval := <-client.intervals:
+            return interval
+        case <-time.After(time.Second):
+            t.Fatal("ping interval was not applied")
+            return 0
+        }
+    }
+    assert.Equal(t, time.Duration(0), nextInterval())
+
+    // ChangeConfiguration reaches the client while connected
+    reply := deliverCall(t, charger, mock, ocpp.MessageTypeChangeConfiguration, map[string]interface{}{
+        "key": KeyWebSocketPingInterval, "value": "15",
+    })
+    assert.Equal(t, ConfigurationAccepted, reply.Payload.(*ocpp.ChangeConfigurationResponse).Status)
+    assert.Equal(t, 15*time.Second, nextInterval())
+
+    charger.SetIgnorePings(true)
+    assert.Equal(t, 1, charger.KeepaliveStats().PingsIgnored)
+}
+
+func TestVirtualCharger_MessageIDs(t *testing.T) {
+    charger, client := newTestCharger(1)
+    
+    // Heartbeats within the same second no longer share an ID
+    require.NoError(t, charger.sendHeartbeat())
+    require.NoError(t, charger.sendHeartbeat())
+    heartbeats := client.sentCalls(ocpp.MessageTypeHeartbeat)
+    assert.NotEqual(t, heartbeats[0].MessageID, heartbeats[1].MessageID)
+    
+    charger.config.MessageIDs = MessageIDPolicy{Format: ocpp.MessageIDFormatPrefixed}
+    charger.messageIDs = charger.config.clientConfig().MessageIDs
+    require.NoError(t, charger.sendHeartbeat())
+    require.NoError(t, charger.sendStatusNotificationAt(1, "Available", ErrorCodeNoError, time.Now()))
+    assert.Equal(t, "hb-TEST001-1", client.sentCalls(ocpp.MessageTypeHeartbeat)[2].MessageID)
+    assert.Equal(t, "status-TEST001-2", client.sentCalls(ocpp.MessageTypeStatusNotification)[0].MessageID)
+    
+    charger.config.MessageIDs.Format = "sequential"
+    assert.ErrorContains(t, charger.config.Validate(), "message_ids")
+}
@@ -0,0 +1,103 @@
+// Package filetransfer moves files between chargers and the locations a CSMS
+// names in UpdateFirmware and GetDiagnostics. Locations are http, https or
+// ftp URLs.
+package filetransfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Download fetches the file at location
+func Download(ctx context.Context, location string) ([]byte, error) {
+	u, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "ftp" {
+		return ftpRetrieve(ctx, u)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download from %s failed: %s", u.Redacted(), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Upload stores data as name at location. HTTP locations receive a
+// multipart/form-data POST with the file in the "file" field, FTP locations
+// are directories the file is stored in.
+func Upload(ctx context.Context, location, name string, data []byte) error {
+	u, err := parseLocation(location)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "ftp" {
+		u.Path = path.Join(u.Path, name)
+		return ftpStore(ctx, u, data)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("upload to %s failed: %s", u.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// parseLocation checks that a location uses a supported scheme
+func parseLocation(location string) (*url.URL, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid location: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp":
+		u.Scheme = strings.ToLower(u.Scheme)
+	default:
+		return nil, fmt.Errorf("unsupported location scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("location %s has no host", u.Redacted())
+	}
+	return u, nil
+}
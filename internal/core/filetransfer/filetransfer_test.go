@@ -0,0 +1,168 @@
+package filetransfer
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// fakeFTPServer serves files from memory over passive mode FTP
+type fakeFTPServer struct {
+    listener net.Listener
+    files    map[string][]byte
+    mu       sync.Mutex
+}
+
+func newFakeFTPServer(t *testing.T) *fakeFTPServer {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    require.NoError(t, err)
+    s := &fakeFTPServer{listener: listener, files: make(map[string][]byte)}
+    t.Cleanup(func() { listener.Close() })
+
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go s.serve(conn)
+        }
+    }()
+    return s
+}
+
+func (s *fakeFTPServer) url(path string) string {
+    return "ftp://" + s.listener.Addr().String() + path
+}
+
+func (s *fakeFTPServer) file(path string) []byte {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.files[path]
+}
+
+func (s *fakeFTPServer) serve(conn net.Conn) {
+    defer conn.Close()
+    reader := bufio.NewReader(conn)
+    reply := func(format string, args ...interface{}) {
+        fmt.Fprintf(conn, format+"\r\n", args...)
+    }
+
+    var data net.Listener
+    reply("220 ready")
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return
+        }
+        command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+        switch command {
+        case "USER":
+            reply("331 password please")
+        case "PASS":
+            reply("230 logged in")
+        case "TYPE":
+            reply("200 binary")
+        case "PASV":
+            data, _ = net.Listen("tcp", "127.0.0.1:0")
+            port := data.Addr().(*net.TCPAddr).Port
+            reply("227 Entering Passive Mode (127,0,0,1,%d,%d)", port>>8, port&0xff)
+        case "RETR":
+            s.mu.Lock()
+            content, exists := s.files[arg]
+            s.mu.Unlock()
+            if !exists {
+                data.Close()
+                reply("550 not found")
+                continue
+            }
+            reply("150 sending")
+            dc, _ := data.Accept()
+            dc.Write(content)
+            dc.Close()
+            data.Close()
+            reply("226 done")
+        case "STOR":
+            reply("150 receiving")
+            dc, _ := data.Accept()
+            content, _ := io.ReadAll(dc)
+            dc.Close()
+            data.Close()
+            s.mu.Lock()
+            s.files[arg] = content
+            s.mu.Unlock()
+            reply("226 stored")
+        case "QUIT":
+            reply("221 bye")
+            return
+        default:
+            reply("502 not implemented")
+        }
+    }
+}
+
+func TestHTTPTransfer(t *testing.T) {
+    var uploaded []byte
+    var name string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch {
+        case r.Method == http.MethodGet && r.URL.Path == "/fw/v2.bin":
+            w.Write([]byte("image"))
+        case r.Method == http.MethodPost:
+            file, header, err := r.FormFile("file")
+            require.NoError(t, err)
+            uploaded, _ = io.ReadAll(file)
+            name = header.Filename
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    content, err := Download(ctx, server.URL+"/fw/v2.bin")
+    require.NoError(t, err)
+    assert.Equal(t, "image", string(content))
+
+    _, err = Download(ctx, server.URL+"/fw/missing.bin")
+    assert.Error(t, err)
+
+    require.NoError(t, Upload(ctx, server.URL+"/diagnostics", "diag.log", []byte("log")))
+    assert.Equal(t, "log", string(uploaded))
+    assert.Equal(t, "diag.log", name)
+}
+
+func TestFTPTransfer(t *testing.T) {
+    server := newFakeFTPServer(t)
+    server.files["/fw/v2.bin"] = []byte("image")
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    content, err := Download(ctx, server.url("/fw/v2.bin"))
+    require.NoError(t, err)
+    assert.Equal(t, "image", string(content))
+
+    _, err = Download(ctx, server.url("/fw/missing.bin"))
+    assert.Error(t, err)
+
+    require.NoError(t, Upload(ctx, server.url("/upload"), "diag.log", []byte("log")))
+    assert.Equal(t, "log", string(server.file("/upload/diag.log")))
+}
+
+func TestUnsupportedLocation(t *testing.T) {
+    _, err := Download(context.Background(), "sftp://localhost/fw.bin")
+    assert.Error(t, err)
+    assert.Error(t, Upload(context.Background(), "/tmp/diagnostics", "diag.log", nil))
+}
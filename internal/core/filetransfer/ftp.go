@@ -0,0 +1,176 @@
+package filetransfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ftpConn is a passive mode FTP control connection, enough for a single
+// binary RETR or STOR
+type ftpConn struct {
+	text *textproto.Conn
+	conn net.Conn
+	host string
+}
+
+// ftpRetrieve downloads the file at an ftp URL
+func ftpRetrieve(ctx context.Context, u *url.URL) ([]byte, error) {
+	c, err := dialFTP(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	data, err := c.transfer(ctx, "RETR", u.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(data)
+	data.Close()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return nil, fmt.Errorf("ftp RETR %s: %w", u.Path, err)
+	}
+	return content, nil
+}
+
+// ftpStore uploads content to an ftp URL
+func ftpStore(ctx context.Context, u *url.URL, content []byte) error {
+	c, err := dialFTP(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	data, err := c.transfer(ctx, "STOR", u.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(content); err != nil {
+		data.Close()
+		return err
+	}
+	// Closing the data connection marks the end of the file
+	if err := data.Close(); err != nil {
+		return err
+	}
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return fmt.Errorf("ftp STOR %s: %w", u.Path, err)
+	}
+	return nil
+}
+
+// dialFTP connects and logs in, anonymously unless the URL has credentials
+func dialFTP(ctx context.Context, u *url.URL) (*ftpConn, error) {
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "21"
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &ftpConn{text: textproto.NewConn(conn), conn: conn, host: host}
+
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		c.close()
+		return nil, fmt.Errorf("ftp greeting: %w", err)
+	}
+
+	user, password := "anonymous", "anonymous"
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		_, _, err = c.cmd(230, "PASS %s", password)
+	} else if err == nil && code != 230 {
+		err = fmt.Errorf("unexpected reply %d", code)
+	}
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("ftp login: %w", err)
+	}
+
+	if _, _, err := c.cmd(200, "TYPE I"); err != nil {
+		c.close()
+		return nil, fmt.Errorf("ftp TYPE: %w", err)
+	}
+	return c, nil
+}
+
+// cmd sends a command and reads its reply, expectCode as for textproto
+func (c *ftpConn) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expectCode)
+}
+
+// transfer opens a passive data connection and starts a RETR or STOR on it
+func (c *ftpConn) transfer(ctx context.Context, command, path string) (net.Conn, error) {
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return nil, fmt.Errorf("ftp PASV: %w", err)
+	}
+	port, err := parsePassivePort(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The advertised address is ignored, servers behind NAT often get it wrong
+	var dialer net.Dialer
+	data, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		data.SetDeadline(deadline)
+	}
+
+	if _, _, err := c.cmd(1, "%s %s", command, path); err != nil {
+		data.Close()
+		return nil, fmt.Errorf("ftp %s %s: %w", command, path, err)
+	}
+	return data, nil
+}
+
+// close ends the session
+func (c *ftpConn) close() {
+	c.text.Cmd("QUIT")
+	c.conn.Close()
+}
+
+// parsePassivePort extracts the data port of a 227 reply, e.g.
+// "Entering Passive Mode (127,0,0,1,195,80)"
+func parsePassivePort(msg string) (int, error) {
+	start, end := strings.Index(msg, "("), strings.Index(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	high, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	low, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	return high<<8 | low, nil
+}
@@ -0,0 +1,45 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Dialect describes an OCPP version on top of the OCPP-J RPC framework.
+// OCPP 1.6 and 2.0.1 share the framing of Call, CallResult and CallError
+// frames; they differ in the WebSocket subprotocol and the action payloads.
+// Frames of every dialect are represented as *OCPP16Message.
+type Dialect struct {
+	Version     string // OCPP version, e.g. "1.6"
+	Subprotocol string // WebSocket subprotocol, e.g. "ocpp1.6"
+
+	// DecodeCallResult unmarshals a CallResult payload into the typed
+	// response for the action
+	DecodeCallResult func(action string, payload json.RawMessage) (interface{}, error)
+
+	// IsTransactionMessage reports whether an action is queued while offline
+	// and has priority in the offline queue
+	IsTransactionMessage func(action string) bool
+
+	// ValidatePayload checks a Call (response false) or CallResult (response
+	// true) payload against the JSON schema of the action. Nil disables
+	// schema validation for the dialect.
+	ValidatePayload func(action string, response bool, payload json.RawMessage) error
+}
+
+// Version16 is the OCPP version of the OCPP16 dialect
+const Version16 = "1.6"
+
+// OCPP16 is the OCPP 1.6J dialect
+var OCPP16 = Dialect{
+	Version:              Version16,
+	Subprotocol:          "ocpp1.6",
+	DecodeCallResult:     DecodeCallResult,
+	IsTransactionMessage: IsTransactionMessage,
+	ValidatePayload:      ValidatePayload,
+}
+
+// component returns the logger component name of the dialect, e.g. "ocpp16"
+func (d Dialect) component() string {
+	return "ocpp" + strings.ReplaceAll(d.Version, ".", "")
+}
@@ -2,6 +2,7 @@ package ocpp
 
 import (
 	"context"
+	"time"
 )
 
 // Client defines the interface for OCPP client implementations
@@ -14,6 +15,19 @@ type Client interface {
 	// Message handling
 	SendMessage(ctx context.Context, message Message) error
 	SetMessageHandler(handler MessageHandler)
+	SetConnectionHandler(handler ConnectionHandler)
+
+	// Call sends a request and waits for the matching CallResult or CallError.
+	// The response is decoded into the typed response struct for the action.
+	Call(ctx context.Context, action string, payload interface{}) (interface{}, error)
+
+	// Replies to Calls initiated by the CSMS
+	SendCallResult(ctx context.Context, messageID string, payload interface{}) error
+	SendCallError(ctx context.Context, messageID string, callErr *CallError) error
+
+	// ResumeQueue replays the messages queued while offline. Each connection
+	// holds them back until the CSMS has accepted the BootNotification.
+	ResumeQueue()
 
 	// Lifecycle
 	Start(ctx context.Context) error
@@ -32,10 +46,20 @@ type MessageHandler interface {
 	HandleMessage(ctx context.Context, message Message) error
 }
 
-// Protocol defines the OCPP protocol interface
+// ConnectionHandler is notified when the client loses and regains its
+// connection to the CSMS outside of Connect and Disconnect
+type ConnectionHandler interface {
+	OnDisconnected(err error)
+	OnReconnected(attempts int)
+}
+
+// Protocol defines the OCPP protocol interface. Implementations register
+// themselves with RegisterProtocol; ParseMessage and SerializeMessage are the
+// frame codec used by the clients.
 type Protocol interface {
 	Version() string
 	CreateClient(chargerID, endpoint string) Client
+	CreateClientWithConfig(config ClientConfig) Client
 	ParseMessage(data []byte) (Message, error)
 	SerializeMessage(message Message) ([]byte, error)
 }
@@ -46,4 +70,15 @@ type ClientConfig struct {
 	Endpoint      string
 	BasicAuthUser string
 	BasicAuthPass string
+	CallTimeout   time.Duration      // How long Call waits for a response, defaults to 30s
+	Reconnect     ReconnectConfig    // Automatic reconnection after connection loss
+	OfflineQueue  OfflineQueueConfig // Buffering of messages while offline
+	Keepalive     KeepaliveConfig    // WebSocket pings and read deadline
+	Pipeline      PipelineConfig     // Outbound and inbound message queues
+	MessageIDs    MessageIDGenerator // IDs of Calls, UUIDv4s when nil
+
+	SchemaValidation SchemaValidationConfig // Validation of payloads against the JSON schemas
+
+	SecurityProfile int       // OCPP security profile 1-3 the connection must satisfy, 0 to not check
+	TLS             TLSConfig // Used for wss:// endpoints
 }
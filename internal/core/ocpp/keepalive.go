@@ -0,0 +1,232 @@
+package ocpp
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// KeepaliveConfig controls WebSocket pings and how long a silent connection
+// is kept open
+type KeepaliveConfig struct {
+	PingInterval time.Duration // Ping the CSMS this often, 0 disables pings
+	PongTimeout  time.Duration // Extra time to wait for the pong of a ping, defaults to the ping interval
+
+	// ReadTimeout drops the connection after this long without any frame from
+	// the CSMS, pongs included. Without it the connection only times out
+	// while pings are enabled, after PingInterval + PongTimeout.
+	ReadTimeout time.Duration
+
+	IgnorePings bool // Do not answer pings from the CSMS, so it sees a dead connection
+}
+
+// readTimeout returns how long the connection may stay silent, 0 for no limit
+func (k KeepaliveConfig) readTimeout() time.Duration {
+	if k.ReadTimeout > 0 {
+		return k.ReadTimeout
+	}
+	if k.PingInterval <= 0 {
+		return 0
+	}
+	if k.PongTimeout > 0 {
+		return k.PingInterval + k.PongTimeout
+	}
+	return 2 * k.PingInterval
+}
+
+// KeepaliveStats reports the ping traffic of a client
+type KeepaliveStats struct {
+	PingsSent     int           `json:"pings_sent"`
+	PongsReceived int           `json:"pongs_received"`
+	PingsReceived int           `json:"pings_received"` // Pings sent by the CSMS
+	PingsIgnored  int           `json:"pings_ignored"`  // CSMS pings left unanswered
+	LastRTT       time.Duration `json:"last_rtt"`
+	MinRTT        time.Duration `json:"min_rtt"`
+	MaxRTT        time.Duration `json:"max_rtt"`
+	AvgRTT        time.Duration `json:"avg_rtt"`
+}
+
+// KeepaliveController is implemented by clients whose keepalive can be
+// adjusted while connected
+type KeepaliveController interface {
+	SetPingInterval(interval time.Duration)
+	SetIgnorePings(ignore bool)
+	KeepaliveStats() KeepaliveStats
+}
+
+// keepalive holds the mutable keepalive state of a client
+type keepalive struct {
+	config   KeepaliveConfig
+	changed  chan struct{}        // Closed when the ping interval changes
+	sent     map[string]time.Time // Send times of unanswered pings by payload
+	nextPing int
+	stats    KeepaliveStats
+	totalRTT time.Duration
+	mu       sync.Mutex
+}
+
+func newKeepalive(config KeepaliveConfig) *keepalive {
+	return &keepalive{
+		config:  config,
+		changed: make(chan struct{}),
+		sent:    make(map[string]time.Time),
+	}
+}
+
+// SetPingInterval changes the ping interval, taking effect immediately
+func (c *OCPP16Client) SetPingInterval(interval time.Duration) {
+	k := c.keepalive
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.config.PingInterval == interval {
+		return
+	}
+	k.config.PingInterval = interval
+	close(k.changed)
+	k.changed = make(chan struct{})
+}
+
+// SetIgnorePings stops or resumes answering pings from the CSMS
+func (c *OCPP16Client) SetIgnorePings(ignore bool) {
+	c.keepalive.mu.Lock()
+	c.keepalive.config.IgnorePings = ignore
+	c.keepalive.mu.Unlock()
+}
+
+// KeepaliveStats returns the ping statistics of the client
+func (c *OCPP16Client) KeepaliveStats() KeepaliveStats {
+	c.keepalive.mu.Lock()
+	defer c.keepalive.mu.Unlock()
+	return c.keepalive.stats
+}
+
+// startKeepalive installs the ping and pong handlers on a new connection and
+// starts pinging the CSMS until ctx is done
+func (c *OCPP16Client) startKeepalive(ctx context.Context, conn *websocket.Conn) {
+	k := c.keepalive
+
+	conn.SetPingHandler(func(data string) error {
+		k.mu.Lock()
+		k.stats.PingsReceived++
+		ignore := k.config.IgnorePings
+		if ignore {
+			k.stats.PingsIgnored++
+		}
+		k.mu.Unlock()
+
+		c.extendReadDeadline(conn)
+		if ignore {
+			c.logger.Debug("Ignoring ping from CSMS")
+			return nil
+		}
+
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
+	conn.SetPongHandler(func(data string) error {
+		k.mu.Lock()
+		if sentAt, ok := k.sent[data]; ok {
+			delete(k.sent, data)
+			k.recordRTT(time.Since(sentAt))
+		}
+		k.mu.Unlock()
+
+		c.extendReadDeadline(conn)
+		return nil
+	})
+
+	c.extendReadDeadline(conn)
+	go c.pingLoop(ctx, conn)
+}
+
+// pingLoop pings the CSMS every ping interval until ctx is done
+func (c *OCPP16Client) pingLoop(ctx context.Context, conn *websocket.Conn) {
+	k := c.keepalive
+
+	for {
+		k.mu.Lock()
+		interval := k.config.PingInterval
+		changed := k.changed
+		k.mu.Unlock()
+
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if interval > 0 {
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+			// The new interval also changes how long the connection may stay silent
+			c.extendReadDeadline(conn)
+		case <-tick:
+			if err := c.ping(conn); err != nil {
+				c.logger.WithError(err).Warn("Failed to send ping")
+			}
+		}
+	}
+}
+
+// ping sends a ping whose payload identifies it for measuring the round trip
+func (c *OCPP16Client) ping(conn *websocket.Conn) error {
+	k := c.keepalive
+	k.mu.Lock()
+	k.nextPing++
+	payload := strconv.Itoa(k.nextPing)
+	k.sent[payload] = time.Now()
+	k.stats.PingsSent++
+	// Forget pings that were never answered
+	for id, sentAt := range k.sent {
+		if time.Since(sentAt) > time.Minute {
+			delete(k.sent, id)
+		}
+	}
+	k.mu.Unlock()
+
+	return conn.WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(time.Second))
+}
+
+// recordRTT adds a round trip time to the statistics. The caller must hold k.mu.
+func (k *keepalive) recordRTT(rtt time.Duration) {
+	k.stats.PongsReceived++
+	k.stats.LastRTT = rtt
+	if k.stats.MinRTT == 0 || rtt < k.stats.MinRTT {
+		k.stats.MinRTT = rtt
+	}
+	if rtt > k.stats.MaxRTT {
+		k.stats.MaxRTT = rtt
+	}
+	k.totalRTT += rtt
+	k.stats.AvgRTT = k.totalRTT / time.Duration(k.stats.PongsReceived)
+}
+
+// extendReadDeadline allows the connection to stay silent for another read
+// timeout, or removes the deadline when there is none
+func (c *OCPP16Client) extendReadDeadline(conn *websocket.Conn) {
+	c.keepalive.mu.Lock()
+	timeout := c.keepalive.config.readTimeout()
+	c.keepalive.mu.Unlock()
+
+	if timeout <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+}
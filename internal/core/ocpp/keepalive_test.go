@@ -0,0 +1,148 @@
+package ocpp
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestOCPP16Client_PingsMeasureRoundTrip(t *testing.T) {
+    // The test CSMS answers pings while it reads
+    server := newTestCSMS(t, func(messageID, action string) []interface{} { return nil })
+    client := connectTestClient(t, server, time.Second)
+
+    client.SetPingInterval(20 * time.Millisecond)
+    assert.Eventually(t, func() bool {
+        return client.KeepaliveStats().PongsReceived >= 3
+    }, 2*time.Second, 10*time.Millisecond)
+
+    stats := client.KeepaliveStats()
+    assert.GreaterOrEqual(t, stats.PingsSent, stats.PongsReceived)
+    assert.Greater(t, stats.LastRTT, time.Duration(0))
+    assert.LessOrEqual(t, stats.MinRTT, stats.AvgRTT)
+    assert.LessOrEqual(t, stats.AvgRTT, stats.MaxRTT)
+    assert.True(t, client.IsConnected())
+
+    // A zero interval stops pinging
+    client.SetPingInterval(0)
+    time.Sleep(50 * time.Millisecond)
+    sent := client.KeepaliveStats().PingsSent
+    time.Sleep(100 * time.Millisecond)
+    assert.Equal(t, sent, client.KeepaliveStats().PingsSent)
+}
+
+func TestOCPP16Client_DropsConnectionWithoutPongs(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    done := make(chan struct{})
+    // Never reads, so pings stay unanswered
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        <-done
+    }))
+    defer server.Close()
+    defer close(done)
+
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID: "TEST001",
+        Endpoint:  "ws" + strings.TrimPrefix(server.URL, "http"),
+        Reconnect: ReconnectConfig{Disabled: true},
+        Keepalive: KeepaliveConfig{PingInterval: 30 * time.Millisecond, PongTimeout: 30 * time.Millisecond},
+    }).(*OCPP16Client)
+    events := &connectionEvents{disconnected: make(chan error, 1), reconnected: make(chan int, 1)}
+    client.SetConnectionHandler(events)
+
+    require.NoError(t, client.Connect(context.Background()))
+    defer client.Disconnect(context.Background())
+
+    select {
+    case err := <-events.disconnected:
+        assert.Error(t, err)
+    case <-time.After(2 * time.Second):
+        t.Fatal("dead connection was not detected")
+    }
+    assert.Zero(t, client.KeepaliveStats().PongsReceived)
+}
+
+func TestOCPP16Client_IdleConnectionStaysOpen(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} { return nil })
+    client := connectTestClient(t, server, time.Second)
+
+    events := &connectionEvents{disconnected: make(chan error, 1), reconnected: make(chan int, 1)}
+    client.SetConnectionHandler(events)
+
+    // Without pings or a read timeout there is no read deadline
+    select {
+    case <-events.disconnected:
+        t.Fatal("idle connection was dropped")
+    case <-time.After(200 * time.Millisecond):
+    }
+    assert.True(t, client.IsConnected())
+}
+
+func TestOCPP16Client_IgnorePings(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    pongs := make(chan string, 4)
+    pings := make(chan string)
+
+    // Pings the charger on request and reports its pongs
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        conn.SetPongHandler(func(data string) error {
+            pongs <- data
+            return nil
+        })
+        go func() {
+            for data := range pings {
+                conn.WriteControl(websocket.PingMessage, []byte(data), time.Now().Add(time.Second))
+            }
+        }()
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                return
+            }
+        }
+    }))
+    defer server.Close()
+    defer close(pings)
+
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID: "TEST001",
+        Endpoint:  "ws" + strings.TrimPrefix(server.URL, "http"),
+        Keepalive: KeepaliveConfig{IgnorePings: true},
+    }).(*OCPP16Client)
+    require.NoError(t, client.Connect(context.Background()))
+    defer client.Disconnect(context.Background())
+
+    pings <- "ignored"
+    select {
+    case data := <-pongs:
+        t.Fatalf("unexpected pong %q", data)
+    case <-time.After(100 * time.Millisecond):
+    }
+    assert.Equal(t, 1, client.KeepaliveStats().PingsIgnored)
+
+    client.SetIgnorePings(false)
+    pings <- "answered"
+    select {
+    case data := <-pongs:
+        assert.Equal(t, "answered", data)
+    case <-time.After(time.Second):
+        t.Fatal("ping was not answered")
+    }
+    assert.Equal(t, 2, client.KeepaliveStats().PingsReceived)
+}
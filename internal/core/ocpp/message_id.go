@@ -0,0 +1,149 @@
+package ocpp
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Message ID formats of MessageIDConfig
+const (
+	MessageIDFormatUUID     = "uuid"     // Random UUIDv4, the default
+	MessageIDFormatCounter  = "counter"  // 1, 2, 3, ...
+	MessageIDFormatPrefixed = "prefixed" // <action prefix>-<charger ID>-<sequence>, e.g. hb-CP001-7
+)
+
+// messageIDHistory is how many issued IDs the chaos mode can reuse
+const messageIDHistory = 32
+
+// MessageIDGenerator issues the message IDs of charger-initiated Calls
+type MessageIDGenerator interface {
+	NewMessageID(action string) string
+}
+
+// MessageIDConfig selects how message IDs are generated. The chaos rates
+// repeat IDs on purpose to test how a CSMS deduplicates messages.
+type MessageIDConfig struct {
+	Format        string  // One of the MessageIDFormat constants, uuid when empty
+	ChargerID     string  // Part of prefixed IDs
+	ReuseRate     float64 // Share of IDs repeating one issued earlier, 0-1
+	DuplicateRate float64 // Share of IDs repeating the previous one, 0-1
+}
+
+// Validate checks the format and the chaos rates
+func (c MessageIDConfig) Validate() error {
+	switch c.Format {
+	case "", MessageIDFormatUUID, MessageIDFormatCounter, MessageIDFormatPrefixed:
+	default:
+		return fmt.Errorf("unknown message ID format %q", c.Format)
+	}
+	if c.ReuseRate < 0 || c.ReuseRate > 1 {
+		return fmt.Errorf("reuse_rate must be between 0 and 1")
+	}
+	if c.DuplicateRate < 0 || c.DuplicateRate > 1 {
+		return fmt.Errorf("duplicate_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// NewMessageIDGenerator creates the generator a config selects. Invalid
+// formats are rejected by Validate and fall back to UUIDs.
+func NewMessageIDGenerator(config MessageIDConfig) MessageIDGenerator {
+	var generator MessageIDGenerator
+	switch config.Format {
+	case MessageIDFormatCounter:
+		generator = &counterMessageIDs{}
+	case MessageIDFormatPrefixed:
+		generator = &prefixedMessageIDs{chargerID: config.ChargerID}
+	default:
+		generator = uuidMessageIDs{}
+	}
+
+	if config.ReuseRate > 0 || config.DuplicateRate > 0 {
+		generator = &chaosMessageIDs{
+			next:          generator,
+			reuseRate:     config.ReuseRate,
+			duplicateRate: config.DuplicateRate,
+			rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+	}
+	return generator
+}
+
+// uuidMessageIDs issues random UUIDv4s
+type uuidMessageIDs struct{}
+
+func (uuidMessageIDs) NewMessageID(string) string {
+	return NewUUID()
+}
+
+// counterMessageIDs issues a sequence starting at 1
+type counterMessageIDs struct {
+	sequence atomic.Uint64
+}
+
+func (g *counterMessageIDs) NewMessageID(string) string {
+	return strconv.FormatUint(g.sequence.Add(1), 10)
+}
+
+// messageIDPrefixes are the short prefixes of prefixed IDs, other actions
+// are prefixed with their lower case name
+var messageIDPrefixes = map[string]string{
+	MessageTypeHeartbeat:          "hb",
+	MessageTypeStatusNotification: "status",
+	MessageTypeStartTransaction:   "start",
+	MessageTypeStopTransaction:    "stop",
+	MessageTypeMeterValues:        "mv",
+}
+
+// prefixedMessageIDs issues readable IDs naming the action and the charger,
+// kept unique by a sequence shared by all actions
+type prefixedMessageIDs struct {
+	chargerID string
+	sequence  atomic.Uint64
+}
+
+func (g *prefixedMessageIDs) NewMessageID(action string) string {
+	prefix, ok := messageIDPrefixes[action]
+	if !ok {
+		prefix = strings.ToLower(action)
+	}
+	return fmt.Sprintf("%s-%s-%d", prefix, g.chargerID, g.sequence.Add(1))
+}
+
+// chaosMessageIDs repeats IDs of another generator: duplicates repeat the
+// previous ID, reuses one of the recently issued ones
+type chaosMessageIDs struct {
+	next          MessageIDGenerator
+	reuseRate     float64
+	duplicateRate float64
+	mu            sync.Mutex
+	rng           *rand.Rand
+	issued        []string // Most recent last
+}
+
+func (g *chaosMessageIDs) NewMessageID(action string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.issued) > 0 {
+		roll := g.rng.Float64()
+		if roll < g.duplicateRate {
+			return g.issued[len(g.issued)-1]
+		}
+		if roll < g.duplicateRate+g.reuseRate {
+			return g.issued[g.rng.Intn(len(g.issued))]
+		}
+	}
+
+	id := g.next.NewMessageID(action)
+	g.issued = append(g.issued, id)
+	if len(g.issued) > messageIDHistory {
+		g.issued = g.issued[1:]
+	}
+	return id
+}
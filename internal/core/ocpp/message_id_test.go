@@ -0,0 +1,44 @@
+package ocpp
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestMessageIDGenerator_Formats(t *testing.T) {
+    uuids := NewMessageIDGenerator(MessageIDConfig{})
+    assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, uuids.NewMessageID(MessageTypeHeartbeat))
+    assert.NotEqual(t, uuids.NewMessageID(MessageTypeHeartbeat), uuids.NewMessageID(MessageTypeHeartbeat))
+
+    counter := NewMessageIDGenerator(MessageIDConfig{Format: MessageIDFormatCounter})
+    assert.Equal(t, "1", counter.NewMessageID(MessageTypeHeartbeat))
+    assert.Equal(t, "2", counter.NewMessageID(MessageTypeMeterValues))
+
+    // The sequence is shared, so IDs stay unique within the same second
+    prefixed := NewMessageIDGenerator(MessageIDConfig{Format: MessageIDFormatPrefixed, ChargerID: "CP001"})
+    assert.Equal(t, "hb-CP001-1", prefixed.NewMessageID(MessageTypeHeartbeat))
+    assert.Equal(t, "hb-CP001-2", prefixed.NewMessageID(MessageTypeHeartbeat))
+    assert.Equal(t, "status-CP001-3", prefixed.NewMessageID(MessageTypeStatusNotification))
+    assert.Equal(t, "bootnotification-CP001-4", prefixed.NewMessageID(MessageTypeBootNotification))
+}
+
+func TestMessageIDGenerator_Chaos(t *testing.T) {
+    duplicates := NewMessageIDGenerator(MessageIDConfig{Format: MessageIDFormatCounter, DuplicateRate: 1})
+    assert.Equal(t, "1", duplicates.NewMessageID(MessageTypeHeartbeat))
+    assert.Equal(t, "1", duplicates.NewMessageID(MessageTypeHeartbeat))
+
+    // About half of the IDs repeat earlier ones
+    config := MessageIDConfig{Format: MessageIDFormatCounter, ReuseRate: 0.5}
+    reuses := NewMessageIDGenerator(config)
+    issued := map[string]int{}
+    for i := 0; i < 200; i++ {
+        issued[reuses.NewMessageID(MessageTypeHeartbeat)]++
+    }
+    assert.Less(t, len(issued), 200)
+
+    assert.NoError(t, config.Validate())
+    assert.Error(t, MessageIDConfig{Format: "snowflake"}.Validate())
+    assert.Error(t, MessageIDConfig{ReuseRate: 1.5}.Validate())
+    assert.Error(t, MessageIDConfig{DuplicateRate: -0.1}.Validate())
+}
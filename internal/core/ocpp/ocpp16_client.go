@@ -2,6 +2,7 @@ package ocpp
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -17,17 +18,46 @@ import (
 // OCPP16Client implements the OCPP 1.6 client
 type OCPP16Client struct {
 	config         ClientConfig
+	dialect        Dialect
+	protocol       Protocol // Frame codec of the dialect
 	conn           *websocket.Conn
+	writer         *connWriter         // Writes all data frames of conn
+	inbound        chan *OCPP16Message // Received frames waiting for the message handler
 	messageHandler MessageHandler
+	connHandler    ConnectionHandler
 	connected      bool
 	mu             sync.RWMutex
 	logger         *logrus.Entry
 	ctx            context.Context
 	cancel         context.CancelFunc
-	pendingCalls   map[string]chan *OCPP16Message // For tracking call responses
-	messageQueue   chan []byte
+	pendingCalls   map[string]*pendingCall // Outstanding Calls keyed by message ID
+	pendingMu      sync.Mutex
+	inboundCalls   map[string]string // Actions of CSMS Calls awaiting a reply, keyed by message ID
+	queue          *messageQueue     // nil when offline queueing is disabled
+	queueResumed   bool              // The queue may be replayed on the current connection
+	keepalive      *keepalive
+	pipeline       *pipelineCounters
 }
 
+// pendingCall tracks a Call that is waiting for a CallResult or CallError
+type pendingCall struct {
+	action   string
+	response chan *OCPP16Message // nil for fire-and-forget messages
+	dispatch bool                // The message handler receives the response too
+}
+
+// callRoute says who receives the response to a Call
+type callRoute int
+
+const (
+	routeToHandler callRoute = iota // Fire-and-forget, the message handler
+	routeToCaller                   // The Call waiting for it
+	routeToBoth                     // The waiting Call, then the message handler in arrival order
+)
+
+// defaultCallTimeout is used when ClientConfig.CallTimeout is not set
+const defaultCallTimeout = 30 * time.Second
+
 // NewOCCP16Client creates a new OCPP 1.6 client
 func NewOCCP16Client(chargerID, endpoint string) Client {
 	return NewOCCP16ClientWithConfig(ClientConfig{
@@ -38,32 +68,82 @@ func NewOCCP16Client(chargerID, endpoint string) Client {
 
 // NewOCCP16ClientWithConfig creates a new OCPP 1.6 client with full config
 func NewOCCP16ClientWithConfig(config ClientConfig) Client {
+	return NewClientWithDialect(config, OCPP16)
+}
+
+// NewClientWithDialect creates an OCPP-J client speaking the given dialect
+func NewClientWithDialect(config ClientConfig, dialect Dialect) *OCPP16Client {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = defaultCallTimeout
+	}
+	config.Reconnect = config.Reconnect.withDefaults()
+	config.OfflineQueue = config.OfflineQueue.withDefaults()
+	config.Pipeline = config.Pipeline.withDefaults()
+	if config.MessageIDs == nil {
+		config.MessageIDs = uuidMessageIDs{}
+	}
+
 	logger := logrus.WithFields(logrus.Fields{
-		"component":  "ocpp16",
+		"component":  dialect.component(),
 		"charger_id": config.ChargerID,
 	})
 
-	return &OCPP16Client{
+	client := &OCPP16Client{
 		config:       config,
+		dialect:      dialect,
+		protocol:     NewProtocol(dialect),
 		connected:    false,
 		logger:       logger,
 		ctx:          ctx,
 		cancel:       cancel,
-		pendingCalls: make(map[string]chan *OCPP16Message),
-		messageQueue: make(chan []byte, 100),
+		pendingCalls: make(map[string]*pendingCall),
+		inboundCalls: make(map[string]string),
+		keepalive:    newKeepalive(config.Keepalive),
+		pipeline:     &pipelineCounters{},
+	}
+	if !config.OfflineQueue.Disabled {
+		client.queue = newMessageQueue(config.OfflineQueue, config.ChargerID, dialect.IsTransactionMessage, logger)
 	}
+
+	return client
 }
 
 // Connect establishes WebSocket connection to CSMS
 func (c *OCPP16Client) Connect(ctx context.Context) error {
 	c.logger.Info("Connecting to CSMS")
 
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	// Start a new client lifecycle if the previous one was ended by Disconnect
+	c.mu.Lock()
+	if c.ctx.Err() != nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+	lifecycle := c.ctx
+	c.mu.Unlock()
+
+	if !c.attach(lifecycle, conn) {
+		return fmt.Errorf("disconnected while connecting to CSMS")
+	}
+	c.logger.Info("Connected to CSMS successfully")
+
+	return nil
+}
+
+// dial opens a WebSocket connection to the CSMS using the OCPP 1.6 subprotocol
+func (c *OCPP16Client) dial() (*websocket.Conn, error) {
 	// Parse and validate endpoint URL
 	u, err := url.Parse(c.config.Endpoint)
 	if err != nil {
-		return fmt.Errorf("invalid endpoint URL: %w", err)
+		return nil, fmt.Errorf("invalid endpoint URL: %w", err)
+	}
+	if err := c.config.validateSecurity(); err != nil {
+		return nil, err
 	}
 
 	// Add charger ID to path
@@ -71,9 +151,9 @@ func (c *OCPP16Client) Connect(ctx context.Context) error {
 
 	// Set up WebSocket headers with OCPP subprotocol
 	headers := http.Header{
-		"Sec-WebSocket-Protocol": []string{"ocpp1.6"},
+		"Sec-WebSocket-Protocol": []string{c.dialect.Subprotocol},
 	}
-	
+
 	// Add basic auth if credentials provided
 	if c.config.BasicAuthUser != "" && c.config.BasicAuthPass != "" {
 		headers.Set("Authorization", "Basic "+basicAuth(c.config.BasicAuthUser, c.config.BasicAuthPass))
@@ -83,55 +163,97 @@ func (c *OCPP16Client) Connect(ctx context.Context) error {
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
 	}
+	if u.Scheme == "wss" {
+		// Built on every dial so rotated certificates are picked up
+		dialer.TLSClientConfig, err = c.config.TLS.clientTLSConfig(c.config.ChargerID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Connect to CSMS
 	c.logger.WithField("url", u.String()).Debug("Connecting to CSMS")
 	conn, resp, err := dialer.Dial(u.String(), headers)
 	if err != nil {
-		return fmt.Errorf("failed to dial websocket: %w", err)
+		return nil, fmt.Errorf("failed to dial websocket: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Verify OCPP subprotocol was accepted
-	if resp.Header.Get("Sec-WebSocket-Protocol") != "ocpp1.6" {
+	if resp.Header.Get("Sec-WebSocket-Protocol") != c.dialect.Subprotocol {
 		conn.Close()
-		return fmt.Errorf("server did not accept OCPP 1.6 subprotocol")
+		return nil, fmt.Errorf("server did not accept %s subprotocol", c.dialect.Subprotocol)
 	}
 
+	return conn, nil
+}
+
+// attach makes conn the active connection of the client lifecycle ctx and
+// starts its pipeline: a writer, a reader and a dispatcher handing received
+// frames to the message handler. A connection dialled for a lifecycle that
+// Disconnect has ended is closed instead and attach returns false. The
+// connection conn replaces is closed.
+func (c *OCPP16Client) attach(ctx context.Context, conn *websocket.Conn) bool {
+	writer := c.startWriter(conn)
+	inbound := make(chan *OCPP16Message, c.config.Pipeline.InboundQueueSize)
+
 	c.mu.Lock()
+	if ctx.Err() != nil || ctx != c.ctx {
+		c.mu.Unlock()
+		writer.close()
+		conn.Close()
+		return false
+	}
+	oldConn, oldWriter := c.conn, c.writer
 	c.conn = conn
+	c.writer = writer
+	c.inbound = inbound
 	c.connected = true
+	c.queueResumed = false
 	c.mu.Unlock()
 
-	c.logger.Info("Connected to CSMS successfully")
+	if oldConn != nil {
+		oldWriter.close()
+		oldConn.Close()
+	}
 
-	// Start message reading goroutine
-	go c.readMessages()
+	go c.dispatchMessages(ctx, inbound)
 
-	return nil
+	// Start message reading goroutine, pings stop when it ends
+	connCtx, stopKeepalive := context.WithCancel(ctx)
+	c.startKeepalive(connCtx, conn)
+	go func() {
+		defer stopKeepalive()
+		c.readMessages(ctx, conn, inbound)
+	}()
+	return true
 }
 
 // Disconnect closes the WebSocket connection
 func (c *OCPP16Client) Disconnect(ctx context.Context) error {
 	c.logger.Info("Disconnecting from CSMS")
 
-	c.cancel() // Cancel context to stop background routines
-
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.cancel() // Cancel context to stop background routines and reconnection
+
 	if c.conn != nil {
-		// Send close message
+		// Send close message, safe to write next to the writer goroutine
 		deadline := time.Now().Add(5 * time.Second)
-		c.conn.SetWriteDeadline(deadline)
-		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "charger disconnecting"))
-		
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "charger disconnecting"), deadline)
+
 		// Close connection
+		c.writer.close()
 		c.conn.Close()
 		c.conn = nil
+		c.writer = nil
+		c.inbound = nil
 	}
 
 	c.connected = false
+	c.queueResumed = false
+	c.failPendingCalls()
 	c.logger.Info("Disconnected from CSMS")
 	return nil
 }
@@ -143,61 +265,297 @@ func (c *OCPP16Client) IsConnected() bool {
 	return c.connected
 }
 
-// SendMessage sends an OCPP message to the CSMS
+// SendMessage sends an OCPP message to the CSMS without waiting for a response.
+// The matching CallResult or CallError is delivered to the message handler.
+// Transaction messages are queued while offline and replayed on reconnect.
 func (c *OCPP16Client) SendMessage(ctx context.Context, message Message) error {
+	// Ensure message is OCPP16Message
+	ocppMsg, ok := message.(*OCPP16Message)
+	if !ok {
+		return fmt.Errorf("invalid message type, expected OCPP16Message")
+	}
+
+	if err := c.validateOutgoing(ocppMsg, ocppMsg.Action); err != nil {
+		return err
+	}
+
+	if c.shouldQueue(ocppMsg.Action) {
+		return c.enqueue(ctx, ocppMsg)
+	}
+
+	_, err := c.sendCall(ctx, ocppMsg, routeToHandler)
+	return err
+}
+
+// Call sends an OCPP Call to the CSMS and waits for the matching response.
+// A CallResult is decoded into the response type for the action (e.g.
+// *BootNotificationResponse), a CallError is returned as *CallError.
+func (c *OCPP16Client) Call(ctx context.Context, action string, payload interface{}) (interface{}, error) {
+	msg := &OCPP16Message{
+		MessageType: "Call",
+		MessageID:   c.config.MessageIDs.NewMessageID(action),
+		Action:      action,
+		Payload:     payload,
+	}
+
+	if err := c.validateOutgoing(msg, action); err != nil {
+		return nil, err
+	}
+
+	pending, err := c.sendCall(ctx, msg, routeToCaller)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.awaitResponse(ctx, msg, pending)
+	if err != nil {
+		return nil, err
+	}
+	if callErr, isErr := resp.Payload.(*CallError); isErr {
+		return nil, callErr
+	}
+	return resp.Payload, nil
+}
+
+// awaitResponse waits for the CallResult or CallError of a pending Call
+func (c *OCPP16Client) awaitResponse(ctx context.Context, msg *OCPP16Message, pending *pendingCall) (*OCPP16Message, error) {
+	timer := time.NewTimer(c.config.CallTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp, ok := <-pending.response:
+		if !ok {
+			return nil, fmt.Errorf("connection closed while waiting for %s response", msg.Action)
+		}
+		return resp, nil
+	case <-timer.C:
+		c.removePendingCall(msg.MessageID)
+		return nil, fmt.Errorf("timed out waiting for %s response after %s", msg.Action, c.config.CallTimeout)
+	case <-ctx.Done():
+		c.removePendingCall(msg.MessageID)
+		return nil, ctx.Err()
+	}
+}
+
+// sendCall registers the message as pending and writes it to the socket
+func (c *OCPP16Client) sendCall(ctx context.Context, ocppMsg *OCPP16Message, route callRoute) (*pendingCall, error) {
 	if !c.IsConnected() {
-		return fmt.Errorf("not connected to CSMS")
+		return nil, fmt.Errorf("not connected to CSMS")
 	}
 
 	c.logger.WithFields(logrus.Fields{
-		"message_type": message.GetMessageType(),
-		"message_id":   message.GetMessageID(),
+		"message_type": ocppMsg.GetMessageType(),
+		"message_id":   ocppMsg.GetMessageID(),
 	}).Debug("Sending OCPP message")
 
-	// Ensure message is OCPP16Message
-	ocppMsg, ok := message.(*OCPP16Message)
-	if !ok {
-		return fmt.Errorf("invalid message type, expected OCPP16Message")
+	pending := c.addPendingCall(ocppMsg.MessageID, ocppMsg.Action, route)
+
+	if err := c.writeMessage(ctx, ocppMsg); err != nil {
+		c.removePendingCall(ocppMsg.MessageID)
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+// SendCallResult replies to a CSMS-initiated Call with a CallResult
+func (c *OCPP16Client) SendCallResult(ctx context.Context, messageID string, payload interface{}) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected to CSMS")
+	}
+
+	c.logger.WithField("message_id", messageID).Debug("Sending CallResult")
+
+	msg := &OCPP16Message{
+		MessageType: "CallResult",
+		MessageID:   messageID,
+		Payload:     payload,
 	}
+	if err := c.validateOutgoing(msg, c.takeInboundCall(messageID)); err != nil {
+		return err
+	}
+	return c.writeMessage(ctx, msg)
+}
 
-	// Create OCPP 1.6 Call array format: [MessageTypeId, MessageId, Action, Payload]
-	callArray := []interface{}{
-		2, // MessageTypeId for Call
-		ocppMsg.MessageID,
-		ocppMsg.Action,
-		ocppMsg.Payload,
+// SendCallError replies to a CSMS-initiated Call with a CallError
+func (c *OCPP16Client) SendCallError(ctx context.Context, messageID string, callErr *CallError) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected to CSMS")
 	}
 
-	// Marshal to JSON
-	data, err := json.Marshal(callArray)
+	c.logger.WithFields(logrus.Fields{
+		"message_id": messageID,
+		"error_code": callErr.ErrorCode,
+	}).Debug("Sending CallError")
+
+	c.takeInboundCall(messageID)
+	return c.writeMessage(ctx, &OCPP16Message{
+		MessageType: "CallError",
+		MessageID:   messageID,
+		Payload:     callErr,
+	})
+}
+
+// writeMessage serializes a message with the protocol codec and hands it to
+// the writer of the connection, waiting until it has been written
+func (c *OCPP16Client) writeMessage(ctx context.Context, msg *OCPP16Message) error {
+	data, err := c.protocol.SerializeMessage(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
 
 	c.logger.WithFields(logrus.Fields{
 		"data": string(data),
 	}).Debug("Sending OCPP message")
 
-	// Send message
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.mu.RLock()
+	writer := c.writer
+	c.mu.RUnlock()
 
-	if c.conn == nil {
+	if writer == nil {
 		return fmt.Errorf("websocket connection is nil")
 	}
 
-	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+	return c.write(ctx, writer, data)
+}
+
+// addPendingCall records the action of an outgoing Call so its response can be
+// decoded. Fire-and-forget entries are dropped after the call timeout.
+func (c *OCPP16Client) addPendingCall(messageID, action string, route callRoute) *pendingCall {
+	pending := &pendingCall{action: action, dispatch: route != routeToCaller}
+	wait := route != routeToHandler
+	if wait {
+		pending.response = make(chan *OCPP16Message, 1)
 	}
 
-	return nil
+	c.pendingMu.Lock()
+	c.pendingCalls[messageID] = pending
+	c.pendingMu.Unlock()
+
+	if !wait {
+		time.AfterFunc(c.config.CallTimeout, func() {
+			c.pendingMu.Lock()
+			if c.pendingCalls[messageID] == pending {
+				delete(c.pendingCalls, messageID)
+			}
+			c.pendingMu.Unlock()
+		})
+	}
+
+	return pending
+}
+
+// removePendingCall forgets a pending Call
+func (c *OCPP16Client) removePendingCall(messageID string) {
+	c.pendingMu.Lock()
+	delete(c.pendingCalls, messageID)
+	c.pendingMu.Unlock()
+}
+
+// failPendingCalls releases every waiting Call after the connection is lost
+func (c *OCPP16Client) failPendingCalls() {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	for id, pending := range c.pendingCalls {
+		if pending.response != nil {
+			close(pending.response)
+		}
+		delete(c.pendingCalls, id)
+	}
+}
+
+// resolvePendingCall matches a CallResult or CallError to the Call that caused
+// it, fills in the action and decodes the payload. It returns true when the
+// response only goes to a waiting Call and must not reach the message handler.
+func (c *OCPP16Client) resolvePendingCall(msg *OCPP16Message) bool {
+	c.pendingMu.Lock()
+	pending, exists := c.pendingCalls[msg.MessageID]
+	if exists {
+		delete(c.pendingCalls, msg.MessageID)
+	}
+	c.pendingMu.Unlock()
+
+	if !exists {
+		c.logger.WithField("message_id", msg.MessageID).Warn("Received response for unknown message ID")
+		return false
+	}
+
+	msg.Action = pending.action
+	if msg.MessageType == "CallResult" {
+		// Invalid responses fail the Call like responses that cannot be decoded
+		if violation := c.validateIncoming(msg, pending.action); violation != nil {
+			msg.MessageType = "CallError"
+			msg.Payload = violation.CallError()
+		}
+	}
+	if msg.MessageType == "CallResult" {
+		raw, _ := msg.Payload.(json.RawMessage)
+		response, err := c.dialect.DecodeCallResult(pending.action, raw)
+		if err != nil {
+			c.logger.WithError(err).WithField("action", pending.action).Error("Failed to decode CallResult")
+			msg.MessageType = "CallError"
+			response = &CallError{
+				ErrorCode:        ErrorCodeFormationViolation,
+				ErrorDescription: err.Error(),
+			}
+		}
+		msg.Payload = response
+	}
+
+	if pending.response != nil {
+		pending.response <- msg
+	}
+	return !pending.dispatch
+}
+
+// acceptInboundCall validates a Call received from the CSMS and remembers its
+// action for validating the reply. Invalid Calls are answered with a CallError.
+func (c *OCPP16Client) acceptInboundCall(ctx context.Context, msg *OCPP16Message) bool {
+	if violation := c.validateIncoming(msg, msg.Action); violation != nil {
+		if err := c.SendCallError(ctx, msg.MessageID, violation.CallError()); err != nil {
+			c.logger.WithError(err).Error("Failed to reject invalid Call")
+		}
+		return false
+	}
+
+	c.pendingMu.Lock()
+	c.inboundCalls[msg.MessageID] = msg.Action
+	c.pendingMu.Unlock()
+	return true
+}
+
+// takeInboundCall returns and forgets the action of a CSMS Call being answered
+func (c *OCPP16Client) takeInboundCall(messageID string) string {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	action := c.inboundCalls[messageID]
+	delete(c.inboundCalls, messageID)
+	return action
 }
 
 // SetMessageHandler sets the message handler for incoming messages
 func (c *OCPP16Client) SetMessageHandler(handler MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.messageHandler = handler
 }
 
+// currentMessageHandler returns the message handler, nil if none is set
+func (c *OCPP16Client) currentMessageHandler() MessageHandler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.messageHandler
+}
+
+// SetConnectionHandler sets the handler notified about connection loss and recovery
+func (c *OCPP16Client) SetConnectionHandler(handler ConnectionHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connHandler = handler
+}
+
 // Start starts the client
 func (c *OCPP16Client) Start(ctx context.Context) error {
 	return c.Connect(ctx)
@@ -208,35 +566,36 @@ func (c *OCPP16Client) Stop(ctx context.Context) error {
 	return c.Disconnect(ctx)
 }
 
-// readMessages reads incoming messages from WebSocket
-func (c *OCPP16Client) readMessages() {
+// readMessages reads incoming messages from WebSocket and queues them for
+// the dispatcher, closing inbound when the connection ends
+func (c *OCPP16Client) readMessages(ctx context.Context, conn *websocket.Conn, inbound chan *OCPP16Message) {
+	var readErr error
+	defer close(inbound)
 	defer func() {
 		if r := recover(); r != nil {
 			c.logger.Errorf("Panic in readMessages: %v", r)
+			readErr = fmt.Errorf("panic in readMessages: %v", r)
 		}
-		// Mark as disconnected on exit
-		c.mu.Lock()
-		c.connected = false
-		c.mu.Unlock()
+		c.connectionLost(ctx, conn, readErr)
 	}()
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
-			// Set read deadline
-			c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-			
-			// Read message from WebSocket
-			messageType, data, err := c.conn.ReadMessage()
+			// Read message from WebSocket, the keepalive maintains the read deadline
+			messageType, data, err := conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					c.logger.WithError(err).Error("WebSocket connection closed unexpectedly")
 				}
+				readErr = err
 				return
 			}
 
+			c.extendReadDeadline(conn)
+
 			if messageType != websocket.TextMessage {
 				c.logger.WithField("type", messageType).Warn("Received non-text message")
 				continue
@@ -244,99 +603,47 @@ func (c *OCPP16Client) readMessages() {
 
 			// Parse OCPP message
 			c.logger.WithField("data", string(data)).Debug("Received raw message")
-			
+
 			msg, err := c.parseOCPPMessage(data)
 			if err != nil {
 				c.logger.WithError(err).Error("Failed to parse OCPP message")
 				continue
 			}
 
-			// Handle message
-			if c.messageHandler != nil {
-				go func(m *OCPP16Message) {
-					if err := c.messageHandler.HandleMessage(c.ctx, m); err != nil {
-						c.logger.WithError(err).Error("Failed to handle message")
-					}
-				}(msg)
+			// Route responses to the Call waiting for them
+			if msg.MessageType != "Call" && c.resolvePendingCall(msg) {
+				continue
+			}
+
+			// Reject CSMS Calls with invalid payloads before they reach the handler
+			if msg.MessageType == "Call" && !c.acceptInboundCall(ctx, msg) {
+				continue
+			}
+
+			// Handle messages in the order they arrived
+			if !c.queueInbound(ctx, inbound, msg) {
+				return
 			}
 		}
 	}
 }
 
-// parseOCPPMessage parses raw OCPP 1.6 message
+// parseOCPPMessage parses a raw frame with the protocol codec
 func (c *OCPP16Client) parseOCPPMessage(data []byte) (*OCPP16Message, error) {
-	// OCPP 1.6 uses array format: [MessageTypeId, MessageId, ...]
-	var msgArray []json.RawMessage
-	if err := json.Unmarshal(data, &msgArray); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal message array: %w", err)
-	}
-
-	if len(msgArray) < 2 {
-		return nil, fmt.Errorf("invalid message format: too few elements")
-	}
-
-	// Parse message type ID
-	var messageTypeID int
-	if err := json.Unmarshal(msgArray[0], &messageTypeID); err != nil {
-		return nil, fmt.Errorf("failed to parse message type ID: %w", err)
-	}
-
-	// Parse message ID
-	var messageID string
-	if err := json.Unmarshal(msgArray[1], &messageID); err != nil {
-		return nil, fmt.Errorf("failed to parse message ID: %w", err)
-	}
-
-	msg := &OCPP16Message{
-		MessageID: messageID,
-	}
-
-	switch messageTypeID {
-	case 2: // Call
-		if len(msgArray) < 4 {
-			return nil, fmt.Errorf("invalid Call message format")
-		}
-		
-		var action string
-		if err := json.Unmarshal(msgArray[2], &action); err != nil {
-			return nil, fmt.Errorf("failed to parse action: %w", err)
-		}
-		
-		msg.MessageType = "Call"
-		msg.Action = action
-		msg.Payload = msgArray[3] // Keep as raw JSON for now
-		
-	case 3: // CallResult
-		if len(msgArray) < 3 {
-			return nil, fmt.Errorf("invalid CallResult message format")
-		}
-		
-		msg.MessageType = "CallResult"
-		msg.Payload = msgArray[2] // Keep as raw JSON for now
-		
-	case 4: // CallError
-		if len(msgArray) < 5 {
-			return nil, fmt.Errorf("invalid CallError message format")
-		}
-		
-		msg.MessageType = "CallError"
-		// Parse error details
-		var errorCode string
-		var errorDescription string
-		json.Unmarshal(msgArray[2], &errorCode)
-		json.Unmarshal(msgArray[3], &errorDescription)
-		
-		msg.Payload = map[string]interface{}{
-			"errorCode":        errorCode,
-			"errorDescription": errorDescription,
-			"errorDetails":     msgArray[4],
-		}
-		
-	default:
-		return nil, fmt.Errorf("unknown message type ID: %d", messageTypeID)
+	message, err := c.protocol.ParseMessage(data)
+	if err != nil {
+		return nil, err
 	}
+	return message.(*OCPP16Message), nil
+}
 
-	return msg, nil
+// NewUUID returns a random UUIDv4
+func NewUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
 // basicAuth creates a basic auth string from username and password
@@ -1,12 +1,69 @@
 package ocpp
 
 import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "sync/atomic"
     "testing"
+    "time"
     
+    "github.com/gorilla/websocket"
+    "github.com/sirupsen/logrus"
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/require"
 )
 
+// newTestCSMS starts a WebSocket server speaking ocpp1.6 that answers every
+// Call with the frame returned by respond (nil means no answer)
+func newTestCSMS(t *testing.T, respond func(messageID, action string) []interface{}) *httptest.Server {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        
+        for {
+            _, data, err := conn.ReadMessage()
+            if err != nil {
+                return
+            }
+            
+            var frame []json.RawMessage
+            if err := json.Unmarshal(data, &frame); err != nil || len(frame) < 3 {
+                continue
+            }
+            var messageID, action string
+            json.Unmarshal(frame[1], &messageID)
+            json.Unmarshal(frame[2], &action)
+            
+            if reply := respond(messageID, action); reply != nil {
+                conn.WriteJSON(reply)
+            }
+        }
+    }))
+    t.Cleanup(server.Close)
+    return server
+}
+
+func connectTestClient(t *testing.T, server *httptest.Server, callTimeout time.Duration) *OCPP16Client {
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID:   "TEST001",
+        Endpoint:    "ws" + strings.TrimPrefix(server.URL, "http"),
+        CallTimeout: callTimeout,
+    }).(*OCPP16Client)
+    
+    require.NoError(t, client.Connect(context.Background()))
+    t.Cleanup(func() { client.Disconnect(context.Background()) })
+    return client
+}
+
 func TestOCPP16Client_Creation(t *testing.T) {
     client := NewOCCP16Client("TEST001", "ws://localhost:8080/ocpp")
     require.NotNil(t, client)
@@ -59,6 +116,597 @@ func TestOCPP16Client_MessageParsing(t *testing.T) {
     assert.Equal(t, "12345", msg.MessageID)
 }
 
+func TestOCPP16Client_CallDecodesTypedResponse(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return []interface{}{3, messageID, map[string]interface{}{
+            "currentTime": "2024-01-01T00:00:00Z",
+            "interval":    300,
+            "status":      "Accepted",
+        }}
+    })
+    client := connectTestClient(t, server, time.Second)
+    
+    resp, err := client.Call(context.Background(), MessageTypeBootNotification, NewBootNotificationRequest("model", "vendor"))
+    require.NoError(t, err)
+    
+    bootResp, ok := resp.(*BootNotificationResponse)
+    require.True(t, ok, "expected *BootNotificationResponse, got %T", resp)
+    assert.Equal(t, "Accepted", bootResp.Status)
+    assert.Equal(t, 300, bootResp.Interval)
+}
+
+func TestOCPP16Client_CallReturnsCallError(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return []interface{}{4, messageID, "NotImplemented", "no heartbeats here", map[string]interface{}{}}
+    })
+    client := connectTestClient(t, server, time.Second)
+    
+    _, err := client.Call(context.Background(), MessageTypeHeartbeat, NewHeartbeatRequest())
+    require.Error(t, err)
+    
+    callErr, ok := err.(*CallError)
+    require.True(t, ok, "expected *CallError, got %T", err)
+    assert.Equal(t, "NotImplemented", callErr.ErrorCode)
+    assert.Equal(t, "no heartbeats here", callErr.ErrorDescription)
+}
+
+func TestOCPP16Client_CallTimeout(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return nil
+    })
+    client := connectTestClient(t, server, 100*time.Millisecond)
+    
+    _, err := client.Call(context.Background(), MessageTypeHeartbeat, NewHeartbeatRequest())
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "timed out")
+    
+    client.pendingMu.Lock()
+    defer client.pendingMu.Unlock()
+    assert.Empty(t, client.pendingCalls)
+}
+
+func TestOCPP16Client_SendMessageResolvesAction(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return []interface{}{3, messageID, map[string]interface{}{
+            "idTagInfo":     map[string]interface{}{"status": "Accepted"},
+            "transactionId": 42,
+        }}
+    })
+    client := connectTestClient(t, server, time.Second)
+    
+    received := make(chan Message, 1)
+    client.SetMessageHandler(messageHandlerFunc(func(ctx context.Context, message Message) error {
+        received <- message
+        return nil
+    }))
+    
+    err := client.SendMessage(context.Background(), &OCPP16Message{
+        MessageType: "Call",
+        MessageID:   "start-1",
+        Action:      MessageTypeStartTransaction,
+        Payload:     &StartTransactionRequest{ConnectorId: 1, IdTag: "TAG"},
+    })
+    require.NoError(t, err)
+    
+    select {
+    case message := <-received:
+        msg := message.(*OCPP16Message)
+        assert.Equal(t, "CallResult", msg.MessageType)
+        assert.Equal(t, MessageTypeStartTransaction, msg.Action)
+        resp, ok := msg.Payload.(*StartTransactionResponse)
+        require.True(t, ok, "expected *StartTransactionResponse, got %T", msg.Payload)
+        assert.Equal(t, 42, resp.TransactionId)
+    case <-time.After(time.Second):
+        t.Fatal("CallResult not delivered to handler")
+    }
+}
+
+type messageHandlerFunc func(ctx context.Context, message Message) error
+
+func (f messageHandlerFunc) HandleMessage(ctx context.Context, message Message) error {
+    return f(ctx, message)
+}
+
+// violationRecorder is a message handler collecting schema violations
+type violationRecorder struct {
+    violations chan *SchemaViolation
+}
+
+func (r *violationRecorder) HandleMessage(ctx context.Context, message Message) error { return nil }
+func (r *violationRecorder) OnSchemaViolation(violation *SchemaViolation) { r.violations <- violation }
+
+func TestOCPP16Client_RejectsInvalidCallResult(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return []interface{}{3, messageID, map[string]interface{}{
+            "interval": 300,
+            "status":   "Acepted",
+        }}
+    })
+    client := connectTestClient(t, server, time.Second)
+    recorder := &violationRecorder{violations: make(chan *SchemaViolation, 1)}
+    client.SetMessageHandler(recorder)
+    
+    _, err := client.Call(context.Background(), MessageTypeBootNotification, NewBootNotificationRequest("model", "vendor"))
+    require.Error(t, err)
+    
+    callErr, ok := err.(*CallError)
+    require.True(t, ok, "expected *CallError, got %T", err)
+    assert.Equal(t, ErrorCodeOccurenceConstraintViolation, callErr.ErrorCode)
+    assert.Contains(t, callErr.ErrorDescription, "currentTime: required property is missing")
+    assert.Contains(t, callErr.ErrorDescription, `status: Acepted is not one of`)
+    
+    violation := <-recorder.violations
+    assert.Equal(t, DirectionIncoming, violation.Direction)
+    assert.Equal(t, MessageTypeBootNotification, violation.Action)
+    assert.Equal(t, "CallResult", violation.MessageType)
+}
+
+func TestOCPP16Client_RejectsInvalidCSMSCall(t *testing.T) {
+    replies := make(chan []string, 1)
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        if action == MessageTypeHeartbeat {
+            return []interface{}{2, "csms-1", MessageTypeReset, map[string]interface{}{"type": "Later"}}
+        }
+        // The client answers the Reset with [4, "csms-1", errorCode, ...]
+        replies <- []string{messageID, action}
+        return nil
+    })
+    client := connectTestClient(t, server, time.Second)
+    
+    handled := make(chan Message, 1)
+    client.SetMessageHandler(messageHandlerFunc(func(ctx context.Context, message Message) error {
+        handled <- message
+        return nil
+    }))
+    
+    require.NoError(t, client.SendMessage(context.Background(), &OCPP16Message{
+        MessageType: "Call",
+        MessageID:   "hb-1",
+        Action:      MessageTypeHeartbeat,
+        Payload:     NewHeartbeatRequest(),
+    }))
+    
+    select {
+    case reply := <-replies:
+        assert.Equal(t, []string{"csms-1", ErrorCodePropertyConstraintViolation}, reply)
+    case <-time.After(time.Second):
+        t.Fatal("invalid Call was not rejected")
+    }
+    assert.Empty(t, handled, "invalid Calls must not reach the handler")
+}
+
+func TestOCPP16Client_ValidatesOutgoingPayloads(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return []interface{}{3, messageID, map[string]interface{}{
+            "currentTime": "2024-01-01T00:00:00Z",
+            "interval":    300,
+            "status":      "Accepted",
+        }}
+    })
+    client := connectTestClient(t, server, time.Second)
+    
+    invalid := NewBootNotificationRequest(strings.Repeat("M", 21), "vendor")
+    _, err := client.Call(context.Background(), MessageTypeBootNotification, invalid)
+    require.Error(t, err)
+    var violation *SchemaViolation
+    require.ErrorAs(t, err, &violation)
+    assert.Equal(t, DirectionOutgoing, violation.Direction)
+    
+    // Chaos strategies opt out per message
+    require.NoError(t, client.SendMessage(context.Background(), &OCPP16Message{
+        MessageType:    "Call",
+        MessageID:      "boot-1",
+        Action:         MessageTypeBootNotification,
+        Payload:        invalid,
+        SkipValidation: true,
+    }))
+    
+    // or for every message of the client
+    client.config.SchemaValidation.SkipOutgoing = true
+    _, err = client.Call(context.Background(), MessageTypeBootNotification, invalid)
+    assert.NoError(t, err)
+}
+
+// connectionEvents records connection loss and recovery on channels
+type connectionEvents struct {
+    disconnected chan error
+    reconnected  chan int
+}
+
+func (e *connectionEvents) OnDisconnected(err error) { e.disconnected <- err }
+func (e *connectionEvents) OnReconnected(attempts int) { e.reconnected <- attempts }
+
+func TestOCPP16Client_ReconnectsAfterConnectionLoss(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    var connections int32
+    
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        
+        // Drop the first connection straight away
+        if atomic.AddInt32(&connections, 1) == 1 {
+            return
+        }
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                return
+            }
+        }
+    }))
+    defer server.Close()
+    
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID: "TEST001",
+        Endpoint:  "ws" + strings.TrimPrefix(server.URL, "http"),
+        Reconnect: ReconnectConfig{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond},
+    }).(*OCPP16Client)
+    
+    events := &connectionEvents{disconnected: make(chan error, 1), reconnected: make(chan int, 1)}
+    client.SetConnectionHandler(events)
+    
+    require.NoError(t, client.Connect(context.Background()))
+    defer client.Disconnect(context.Background())
+    
+    select {
+    case <-events.disconnected:
+    case <-time.After(2 * time.Second):
+        t.Fatal("connection loss was not reported")
+    }
+    
+    select {
+    case attempts := <-events.reconnected:
+        assert.Equal(t, 1, attempts)
+    case <-time.After(2 * time.Second):
+        t.Fatal("client did not reconnect")
+    }
+    
+    assert.True(t, client.IsConnected())
+    assert.Equal(t, int32(2), atomic.LoadInt32(&connections))
+}
+
+func TestOCPP16Client_NoReconnectAfterDisconnect(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} { return nil })
+    client := connectTestClient(t, server, time.Second)
+    
+    events := &connectionEvents{disconnected: make(chan error, 1), reconnected: make(chan int, 1)}
+    client.SetConnectionHandler(events)
+    
+    require.NoError(t, client.Disconnect(context.Background()))
+    
+    select {
+    case <-events.disconnected:
+        t.Fatal("intentional disconnect reported as connection loss")
+    case <-time.After(100 * time.Millisecond):
+    }
+    assert.False(t, client.IsConnected())
+}
+
+func TestOCPP16Client_ClosesStaleConnections(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    var open int32
+    
+    // Counts the connections the client has not closed
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        atomic.AddInt32(&open, 1)
+        defer atomic.AddInt32(&open, -1)
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                return
+            }
+        }
+    }))
+    defer server.Close()
+    openConnections := func(n int32) func() bool {
+        return func() bool { return atomic.LoadInt32(&open) == n }
+    }
+    
+    client := connectTestClient(t, server, time.Second)
+    
+    // A new connection replaces the current one
+    require.NoError(t, client.Connect(context.Background()))
+    assert.Eventually(t, openConnections(1), time.Second, 10*time.Millisecond)
+    assert.True(t, client.IsConnected())
+    
+    // A connection dialled before Disconnect is not attached after it
+    client.mu.RLock()
+    lifecycle := client.ctx
+    client.mu.RUnlock()
+    conn, err := client.dial()
+    require.NoError(t, err)
+    require.NoError(t, client.Disconnect(context.Background()))
+    assert.False(t, client.attach(lifecycle, conn))
+    assert.Eventually(t, openConnections(0), time.Second, 10*time.Millisecond)
+    assert.False(t, client.IsConnected())
+}
+
+func TestReconnectConfig_Backoff(t *testing.T) {
+    config := ReconnectConfig{
+        InitialBackoff: time.Second,
+        MaxBackoff:     10 * time.Second,
+        Multiplier:     2,
+        Jitter:         0.2,
+    }.withDefaults()
+    
+    for attempt, base := range []time.Duration{1, 2, 4, 8, 10, 10} {
+        delay := config.Backoff(attempt)
+        assert.GreaterOrEqual(t, delay, base*time.Second*8/10, "attempt %d", attempt)
+        assert.LessOrEqual(t, delay, base*time.Second*12/10, "attempt %d", attempt)
+    }
+    
+    config.Jitter = 0
+    assert.Equal(t, 10*time.Second, config.Backoff(50))
+}
+
+func TestOCPP16Client_ReplaysOfflineQueueInOrder(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    received := make(chan []json.RawMessage, 10)
+    
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        
+        for {
+            var frame []json.RawMessage
+            if err := conn.ReadJSON(&frame); err != nil {
+                return
+            }
+            received <- frame
+            
+            var messageID, action string
+            json.Unmarshal(frame[1], &messageID)
+            json.Unmarshal(frame[2], &action)
+            payload := map[string]interface{}{}
+            switch action {
+            case MessageTypeBootNotification:
+                payload = map[string]interface{}{"status": "Accepted", "currentTime": time.Now().UTC(), "interval": 300}
+            case MessageTypeStartTransaction:
+                payload = map[string]interface{}{"transactionId": 42, "idTagInfo": map[string]string{"status": "Accepted"}}
+                // A CSMS Call arriving before the replayed response is handled first
+                conn.WriteJSON([]interface{}{2, "csms-1", MessageTypeClearCache, map[string]interface{}{}})
+            case "":
+                continue
+            }
+            conn.WriteJSON([]interface{}{3, messageID, payload})
+        }
+    }))
+    defer server.Close()
+    
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID: "TEST001",
+        Endpoint:  "ws" + strings.TrimPrefix(server.URL, "http"),
+    }).(*OCPP16Client)
+    
+    // Replayed responses reach the handler in arrival order with other messages
+    var handledMu sync.Mutex
+    var handled []string
+    client.SetMessageHandler(messageHandlerFunc(func(ctx context.Context, message Message) error {
+        if message.GetMessageType() == "Call" {
+            time.Sleep(100 * time.Millisecond)
+        }
+        handledMu.Lock()
+        handled = append(handled, message.GetMessageID())
+        handledMu.Unlock()
+        return nil
+    }))
+    
+    // Queue an offline transaction before the client ever connects
+    startedAt := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+    placeholder := OfflineTransactionID(1)
+    ctx := context.Background()
+    require.NoError(t, client.SendMessage(ctx, &OCPP16Message{MessageType: "Call", MessageID: "start-1", Action: MessageTypeStartTransaction,
+        Payload: &StartTransactionRequest{ConnectorId: 1, IdTag: "TAG001", Timestamp: startedAt}}))
+    require.NoError(t, client.SendMessage(ctx, &OCPP16Message{MessageType: "Call", MessageID: "mv-1", Action: MessageTypeMeterValues,
+        Payload: &MeterValuesRequest{ConnectorId: 1, TransactionId: &placeholder,
+            MeterValue: []MeterValue{{Timestamp: startedAt, SampledValue: []SampledValue{{Value: "2500"}}}}}}))
+    require.NoError(t, client.SendMessage(ctx, &OCPP16Message{MessageType: "Call", MessageID: "stop-1", Action: MessageTypeStopTransaction,
+        Payload: &StopTransactionRequest{TransactionId: placeholder, MeterStop: 5000, Timestamp: startedAt.Add(time.Hour)}}))
+    
+    // Heartbeats are not worth replaying
+    assert.Error(t, client.SendMessage(ctx, &OCPP16Message{MessageType: "Call", MessageID: "hb-1", Action: MessageTypeHeartbeat, Payload: &HeartbeatRequest{}}))
+    assert.Equal(t, 3, client.queue.len())
+    
+    require.NoError(t, client.Connect(ctx))
+    defer client.Disconnect(ctx)
+    
+    // The queue waits for the CSMS to accept the BootNotification
+    _, err := client.Call(ctx, MessageTypeBootNotification, &BootNotificationRequest{ChargePointModel: "Model", ChargePointVendor: "Vendor"})
+    require.NoError(t, err)
+    boot := <-received
+    var action string
+    json.Unmarshal(boot[2], &action)
+    assert.Equal(t, MessageTypeBootNotification, action)
+    select {
+    case frame := <-received:
+        t.Fatalf("queued message %s replayed before the queue was resumed", frame[1])
+    case <-time.After(100 * time.Millisecond):
+    }
+    assert.Equal(t, 3, client.queue.len())
+    
+    client.ResumeQueue()
+    
+    var frames [][]json.RawMessage
+    for len(frames) < 3 {
+        select {
+        case frame := <-received:
+            frames = append(frames, frame)
+        case <-time.After(2 * time.Second):
+            t.Fatalf("only %d queued messages replayed", len(frames))
+        }
+    }
+    
+    for i, expected := range []string{"start-1", "mv-1", "stop-1"} {
+        var messageID string
+        json.Unmarshal(frames[i][1], &messageID)
+        assert.Equal(t, expected, messageID)
+    }
+    
+    var start StartTransactionRequest
+    require.NoError(t, json.Unmarshal(frames[0][3], &start))
+    assert.True(t, startedAt.Equal(start.Timestamp))
+    
+    var meter MeterValuesRequest
+    require.NoError(t, json.Unmarshal(frames[1][3], &meter))
+    assert.Equal(t, 42, *meter.TransactionId)
+    
+    var stop StopTransactionRequest
+    require.NoError(t, json.Unmarshal(frames[2][3], &stop))
+    assert.Equal(t, 42, stop.TransactionId)
+    assert.True(t, startedAt.Add(time.Hour).Equal(stop.Timestamp))
+    
+    assert.Eventually(t, func() bool { return client.queue.len() == 0 }, time.Second, 10*time.Millisecond)
+    
+    assert.Eventually(t, func() bool {
+        handledMu.Lock()
+        defer handledMu.Unlock()
+        return len(handled) == 4
+    }, time.Second, 10*time.Millisecond)
+    assert.Equal(t, []string{"csms-1", "start-1", "mv-1", "stop-1"}, handled)
+}
+
+func TestMessageQueue_OverflowPolicies(t *testing.T) {
+    logger := logrus.WithField("test", t.Name())
+    ctx := context.Background()
+    message := func(id, action string) *queuedMessage {
+        return &queuedMessage{MessageID: id, Action: action, Payload: json.RawMessage("{}")}
+    }
+    ids := func(q *messageQueue) []string {
+        var result []string
+        for _, entry := range q.entries {
+            result = append(result, entry.MessageID)
+        }
+        return result
+    }
+    
+    t.Run("drop oldest evicts non-transaction messages first", func(t *testing.T) {
+        q := newMessageQueue(OfflineQueueConfig{Size: 2, QueueAll: true}.withDefaults(), "TEST001", IsTransactionMessage, logger)
+        require.NoError(t, q.push(ctx, message("start", MessageTypeStartTransaction)))
+        require.NoError(t, q.push(ctx, message("status", MessageTypeStatusNotification)))
+        require.NoError(t, q.push(ctx, message("stop", MessageTypeStopTransaction)))
+        assert.Equal(t, []string{"start", "stop"}, ids(q))
+        
+        // Non-transaction messages never displace transaction messages
+        assert.ErrorIs(t, q.push(ctx, message("status2", MessageTypeStatusNotification)), ErrQueueFull)
+        
+        require.NoError(t, q.push(ctx, message("mv", MessageTypeMeterValues)))
+        assert.Equal(t, []string{"stop", "mv"}, ids(q))
+    })
+    
+    t.Run("drop newest rejects incoming messages", func(t *testing.T) {
+        q := newMessageQueue(OfflineQueueConfig{Size: 2, Overflow: OverflowDropNewest, QueueAll: true}.withDefaults(), "TEST001", IsTransactionMessage, logger)
+        require.NoError(t, q.push(ctx, message("start", MessageTypeStartTransaction)))
+        require.NoError(t, q.push(ctx, message("status", MessageTypeStatusNotification)))
+        assert.ErrorIs(t, q.push(ctx, message("status2", MessageTypeStatusNotification)), ErrQueueFull)
+        
+        require.NoError(t, q.push(ctx, message("stop", MessageTypeStopTransaction)))
+        assert.Equal(t, []string{"start", "stop"}, ids(q))
+        assert.ErrorIs(t, q.push(ctx, message("mv", MessageTypeMeterValues)), ErrQueueFull)
+    })
+    
+    t.Run("block waits for room", func(t *testing.T) {
+        q := newMessageQueue(OfflineQueueConfig{Size: 1, Overflow: OverflowBlock}.withDefaults(), "TEST001", IsTransactionMessage, logger)
+        require.NoError(t, q.push(ctx, message("start", MessageTypeStartTransaction)))
+        
+        pushed := make(chan error, 1)
+        go func() { pushed <- q.push(ctx, message("stop", MessageTypeStopTransaction)) }()
+        
+        select {
+        case <-pushed:
+            t.Fatal("push did not block on a full queue")
+        case <-time.After(50 * time.Millisecond):
+        }
+        
+        q.remove("start")
+        select {
+        case err := <-pushed:
+            require.NoError(t, err)
+        case <-time.After(time.Second):
+            t.Fatal("push still blocked after room was made")
+        }
+        assert.Equal(t, 1, q.len())
+        
+        timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+        defer cancel()
+        assert.ErrorIs(t, q.push(timeout, message("mv", MessageTypeMeterValues)), context.DeadlineExceeded)
+    })
+}
+
+func TestMessageQueue_Persistence(t *testing.T) {
+    logger := logrus.WithField("test", t.Name())
+    config := OfflineQueueConfig{Dir: t.TempDir()}.withDefaults()
+    
+    q := newMessageQueue(config, "TEST001", IsTransactionMessage, logger)
+    require.NoError(t, q.push(context.Background(), &queuedMessage{
+        MessageID: "stop-1",
+        Action:    MessageTypeStopTransaction,
+        Payload:   json.RawMessage(`{"transactionId":7}`),
+    }))
+    
+    restored := newMessageQueue(config, "TEST001", IsTransactionMessage, logger)
+    require.Equal(t, 1, restored.len())
+    entry, ok := restored.next()
+    require.True(t, ok)
+    assert.Equal(t, "stop-1", entry.MessageID)
+    assert.JSONEq(t, `{"transactionId":7}`, string(entry.Payload))
+    
+    // Queues are kept per charger
+    assert.Equal(t, 0, newMessageQueue(config, "TEST002", IsTransactionMessage, logger).len())
+}
+
+func TestMessageQueue_OfflineTransactionIDs(t *testing.T) {
+    logger := logrus.WithField("test", t.Name())
+    config := OfflineQueueConfig{Dir: t.TempDir()}.withDefaults()
+    ctx := context.Background()
+    push := func(q *messageQueue, id, action, payload string) {
+        require.NoError(t, q.push(ctx, &queuedMessage{MessageID: id, Action: action, Payload: json.RawMessage(payload)}))
+    }
+    payloads := func(q *messageQueue) map[string]string {
+        result := make(map[string]string)
+        for _, entry := range q.entries {
+            result[entry.MessageID] = string(entry.Payload)
+        }
+        return result
+    }
+    
+    // Two offline transactions on connector 1 share its placeholder ID
+    q := newMessageQueue(config, "TEST001", IsTransactionMessage, logger)
+    push(q, "start-1", MessageTypeStartTransaction, `{"connectorId":1}`)
+    push(q, "stop-1", MessageTypeStopTransaction, `{"transactionId":-1}`)
+    push(q, "start-2", MessageTypeStartTransaction, `{"connectorId":1}`)
+    push(q, "mv-2", MessageTypeMeterValues, `{"connectorId":1,"transactionId":-1}`)
+    
+    // Their links survive a restart
+    q = newMessageQueue(config, "TEST001", IsTransactionMessage, logger)
+    push(q, "stop-2", MessageTypeStopTransaction, `{"transactionId":-1}`)
+    
+    q.resolve("start-1", 10)
+    assert.JSONEq(t, `{"transactionId":10}`, payloads(q)["stop-1"])
+    assert.JSONEq(t, `{"connectorId":1,"transactionId":-1}`, payloads(q)["mv-2"])
+    
+    // Resolved IDs are persisted
+    q = newMessageQueue(config, "TEST001", IsTransactionMessage, logger)
+    assert.JSONEq(t, `{"transactionId":10}`, payloads(q)["stop-1"])
+    
+    q.resolve("start-2", 20)
+    assert.JSONEq(t, `{"connectorId":1,"transactionId":20}`, payloads(q)["mv-2"])
+    assert.JSONEq(t, `{"transactionId":20}`, payloads(q)["stop-2"])
+    
+    // Messages queued after the CSMS answered get its ID right away
+    push(q, "mv-3", MessageTypeMeterValues, `{"connectorId":1,"transactionId":-1}`)
+    assert.JSONEq(t, `{"connectorId":1,"transactionId":20}`, payloads(q)["mv-3"])
+}
+
 func TestBasicAuth(t *testing.T) {
     result := basicAuth("admin", "password")
     expected := "YWRtaW46cGFzc3dvcmQ=" // base64 of "admin:password"
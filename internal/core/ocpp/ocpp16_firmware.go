@@ -0,0 +1,75 @@
+package ocpp
+
+import "time"
+
+// OCPP 1.6 Firmware Management profile message types
+const (
+	// Initiated by the charger
+	MessageTypeDiagnosticsStatusNotification = "DiagnosticsStatusNotification"
+	MessageTypeFirmwareStatusNotification    = "FirmwareStatusNotification"
+
+	// Initiated by the CSMS
+	MessageTypeGetDiagnostics = "GetDiagnostics"
+	MessageTypeUpdateFirmware = "UpdateFirmware"
+)
+
+// FirmwareStatusNotification statuses
+const (
+	FirmwareStatusDownloaded         = "Downloaded"
+	FirmwareStatusDownloadFailed     = "DownloadFailed"
+	FirmwareStatusDownloading        = "Downloading"
+	FirmwareStatusIdle               = "Idle"
+	FirmwareStatusInstallationFailed = "InstallationFailed"
+	FirmwareStatusInstalling         = "Installing"
+	FirmwareStatusInstalled          = "Installed"
+)
+
+// DiagnosticsStatusNotification statuses
+const (
+	DiagnosticsStatusIdle         = "Idle"
+	DiagnosticsStatusUploaded     = "Uploaded"
+	DiagnosticsStatusUploadFailed = "UploadFailed"
+	DiagnosticsStatusUploading    = "Uploading"
+)
+
+// UpdateFirmwareRequest represents OCPP 1.6 UpdateFirmware request
+type UpdateFirmwareRequest struct {
+	Location      string    `json:"location"`
+	Retries       *int      `json:"retries,omitempty"`
+	RetrieveDate  time.Time `json:"retrieveDate"`
+	RetryInterval *int      `json:"retryInterval,omitempty"` // Seconds
+}
+
+// UpdateFirmwareResponse represents OCPP 1.6 UpdateFirmware response
+type UpdateFirmwareResponse struct{}
+
+// FirmwareStatusNotificationRequest represents OCPP 1.6 FirmwareStatusNotification request
+type FirmwareStatusNotificationRequest struct {
+	Status string `json:"status"`
+}
+
+// FirmwareStatusNotificationResponse represents OCPP 1.6 FirmwareStatusNotification response
+type FirmwareStatusNotificationResponse struct{}
+
+// GetDiagnosticsRequest represents OCPP 1.6 GetDiagnostics request
+type GetDiagnosticsRequest struct {
+	Location      string     `json:"location"`
+	Retries       *int       `json:"retries,omitempty"`
+	RetryInterval *int       `json:"retryInterval,omitempty"` // Seconds
+	StartTime     *time.Time `json:"startTime,omitempty"`
+	StopTime      *time.Time `json:"stopTime,omitempty"`
+}
+
+// GetDiagnosticsResponse represents OCPP 1.6 GetDiagnostics response. Without
+// a file name there is no diagnostics information to upload.
+type GetDiagnosticsResponse struct {
+	FileName *string `json:"fileName,omitempty"`
+}
+
+// DiagnosticsStatusNotificationRequest represents OCPP 1.6 DiagnosticsStatusNotification request
+type DiagnosticsStatusNotificationRequest struct {
+	Status string `json:"status"`
+}
+
+// DiagnosticsStatusNotificationResponse represents OCPP 1.6 DiagnosticsStatusNotification response
+type DiagnosticsStatusNotificationResponse struct{}
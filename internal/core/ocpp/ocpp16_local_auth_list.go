@@ -0,0 +1,49 @@
+package ocpp
+
+// OCPP 1.6 Local Auth List Management profile message types, all initiated
+// by the CSMS
+const (
+	MessageTypeGetLocalListVersion = "GetLocalListVersion"
+	MessageTypeSendLocalList       = "SendLocalList"
+)
+
+// SendLocalList update types
+const (
+	UpdateTypeDifferential = "Differential"
+	UpdateTypeFull         = "Full"
+)
+
+// SendLocalList statuses
+const (
+	UpdateStatusAccepted        = "Accepted"
+	UpdateStatusFailed          = "Failed"
+	UpdateStatusNotSupported    = "NotSupported"
+	UpdateStatusVersionMismatch = "VersionMismatch"
+)
+
+// AuthorizationData is an entry of the local authorization list. In a
+// differential update an entry without IdTagInfo removes the idTag.
+type AuthorizationData struct {
+	IdTag     string     `json:"idTag"`
+	IdTagInfo *IdTagInfo `json:"idTagInfo,omitempty"`
+}
+
+// SendLocalListRequest represents OCPP 1.6 SendLocalList request
+type SendLocalListRequest struct {
+	ListVersion            int                 `json:"listVersion"`
+	LocalAuthorizationList []AuthorizationData `json:"localAuthorizationList,omitempty"`
+	UpdateType             string              `json:"updateType"`
+}
+
+// SendLocalListResponse represents OCPP 1.6 SendLocalList response
+type SendLocalListResponse struct {
+	Status string `json:"status"` // Accepted, Failed, NotSupported or VersionMismatch
+}
+
+// GetLocalListVersionRequest represents OCPP 1.6 GetLocalListVersion request
+type GetLocalListVersionRequest struct{}
+
+// GetLocalListVersionResponse represents OCPP 1.6 GetLocalListVersion response
+type GetLocalListVersionResponse struct {
+	ListVersion int `json:"listVersion"` // 0 for an empty list, -1 when the list is not supported
+}
@@ -17,6 +17,30 @@ const (
 	MessageTypeStartTransaction   = "StartTransaction"
 	MessageTypeStatusNotification = "StatusNotification"
 	MessageTypeStopTransaction    = "StopTransaction"
+
+	// Core Profile, initiated by the CSMS
+	MessageTypeChangeAvailability     = "ChangeAvailability"
+	MessageTypeChangeConfiguration    = "ChangeConfiguration"
+	MessageTypeClearCache             = "ClearCache"
+	MessageTypeGetConfiguration       = "GetConfiguration"
+	MessageTypeRemoteStartTransaction = "RemoteStartTransaction"
+	MessageTypeRemoteStopTransaction  = "RemoteStopTransaction"
+	MessageTypeReset                  = "Reset"
+	MessageTypeUnlockConnector        = "UnlockConnector"
+)
+
+// OCPP 1.6 CallError codes
+const (
+	ErrorCodeNotImplemented               = "NotImplemented"
+	ErrorCodeNotSupported                 = "NotSupported"
+	ErrorCodeInternalError                = "InternalError"
+	ErrorCodeProtocolError                = "ProtocolError"
+	ErrorCodeSecurityError                = "SecurityError"
+	ErrorCodeFormationViolation           = "FormationViolation"
+	ErrorCodePropertyConstraintViolation  = "PropertyConstraintViolation"
+	ErrorCodeOccurenceConstraintViolation = "OccurenceConstraintViolation"
+	ErrorCodeTypeConstraintViolation      = "TypeConstraintViolation"
+	ErrorCodeGenericError                 = "GenericError"
 )
 
 // OCPP16Message represents a generic OCPP 1.6 message
@@ -25,6 +49,10 @@ type OCPP16Message struct {
 	MessageID   string      `json:"message_id"`
 	Action      string      `json:"action"`
 	Payload     interface{} `json:"payload"`
+
+	// SkipValidation sends the payload without checking it against the
+	// schema, so chaos strategies can send invalid messages on purpose
+	SkipValidation bool `json:"skip_validation,omitempty"`
 }
 
 // GetMessageType returns the message type
@@ -48,16 +76,62 @@ func (m *OCPP16Message) Validate() error {
 	return nil
 }
 
+// CallError represents an OCPP 1.6 CallError returned by the CSMS
+type CallError struct {
+	ErrorCode        string          `json:"errorCode"`
+	ErrorDescription string          `json:"errorDescription"`
+	ErrorDetails     json.RawMessage `json:"errorDetails,omitempty"`
+}
+
+// Error implements the error interface
+func (e *CallError) Error() string {
+	if e.ErrorDescription == "" {
+		return fmt.Sprintf("CallError %s", e.ErrorCode)
+	}
+	return fmt.Sprintf("CallError %s: %s", e.ErrorCode, e.ErrorDescription)
+}
+
+// AuthorizeRequest represents OCPP 1.6 Authorize request
+type AuthorizeRequest struct {
+	IdTag string `json:"idTag"`
+}
+
+// AuthorizeResponse represents OCPP 1.6 Authorize response
+type AuthorizeResponse struct {
+	IdTagInfo IdTagInfo `json:"idTagInfo"`
+}
+
+// DataTransferRequest represents OCPP 1.6 DataTransfer request
+type DataTransferRequest struct {
+	VendorId  string  `json:"vendorId"`
+	MessageId *string `json:"messageId,omitempty"`
+	Data      *string `json:"data,omitempty"`
+}
+
+// DataTransferResponse represents OCPP 1.6 DataTransfer response
+type DataTransferResponse struct {
+	Status string  `json:"status"`
+	Data   *string `json:"data,omitempty"`
+}
+
+// NewCallError creates a CallError with the given code and description
+func NewCallError(code, description string) *CallError {
+	return &CallError{
+		ErrorCode:        code,
+		ErrorDescription: description,
+	}
+}
+
 // BootNotificationRequest represents OCPP 1.6 BootNotification request
 type BootNotificationRequest struct {
-	ChargePointModel         string  `json:"chargePointModel"`
-	ChargePointVendor        string  `json:"chargePointVendor"`
-	ChargePointSerialNumber  *string `json:"chargePointSerialNumber,omitempty"`
-	FirmwareVersion          *string `json:"firmwareVersion,omitempty"`
-	Iccid                    *string `json:"iccid,omitempty"`
-	Imsi                     *string `json:"imsi,omitempty"`
-	MeterSerialNumber        *string `json:"meterSerialNumber,omitempty"`
-	MeterType                *string `json:"meterType,omitempty"`
+	ChargePointModel        string  `json:"chargePointModel"`
+	ChargePointVendor       string  `json:"chargePointVendor"`
+	ChargePointSerialNumber *string `json:"chargePointSerialNumber,omitempty"`
+	FirmwareVersion         *string `json:"firmwareVersion,omitempty"`
+	Iccid                   *string `json:"iccid,omitempty"`
+	Imsi                    *string `json:"imsi,omitempty"`
+	MeterSerialNumber       *string `json:"meterSerialNumber,omitempty"`
+	MeterType               *string `json:"meterType,omitempty"`
 }
 
 // BootNotificationResponse represents OCPP 1.6 BootNotification response
@@ -77,13 +151,13 @@ type HeartbeatResponse struct {
 
 // StatusNotificationRequest represents OCPP 1.6 StatusNotification request
 type StatusNotificationRequest struct {
-	ConnectorId     int       `json:"connectorId"`
-	ErrorCode       string    `json:"errorCode"`
-	Status          string    `json:"status"`
-	Info            *string   `json:"info,omitempty"`
-	Timestamp       time.Time `json:"timestamp"`
-	VendorId        *string   `json:"vendorId,omitempty"`
-	VendorErrorCode *string   `json:"vendorErrorCode,omitempty"`
+	ConnectorId     int        `json:"connectorId"`
+	ErrorCode       string     `json:"errorCode"`
+	Status          string     `json:"status"`
+	Info            *string    `json:"info,omitempty"`
+	Timestamp       *time.Time `json:"timestamp,omitempty"`
+	VendorId        *string    `json:"vendorId,omitempty"`
+	VendorErrorCode *string    `json:"vendorErrorCode,omitempty"`
 }
 
 // StatusNotificationResponse represents OCPP 1.6 StatusNotification response
@@ -91,10 +165,10 @@ type StatusNotificationResponse struct{}
 
 // StartTransactionRequest represents OCPP 1.6 StartTransaction request
 type StartTransactionRequest struct {
-	ConnectorId   int    `json:"connectorId"`
-	IdTag         string `json:"idTag"`
-	MeterStart    int    `json:"meterStart"`
-	ReservationId *int   `json:"reservationId,omitempty"`
+	ConnectorId   int       `json:"connectorId"`
+	IdTag         string    `json:"idTag"`
+	MeterStart    int       `json:"meterStart"`
+	ReservationId *int      `json:"reservationId,omitempty"`
 	Timestamp     time.Time `json:"timestamp"`
 }
 
@@ -106,11 +180,11 @@ type StartTransactionResponse struct {
 
 // StopTransactionRequest represents OCPP 1.6 StopTransaction request
 type StopTransactionRequest struct {
-	IdTag         *string       `json:"idTag,omitempty"`
-	MeterStop     int           `json:"meterStop"`
-	Timestamp     time.Time     `json:"timestamp"`
-	TransactionId int           `json:"transactionId"`
-	Reason        *string       `json:"reason,omitempty"`
+	IdTag           *string      `json:"idTag,omitempty"`
+	MeterStop       int          `json:"meterStop"`
+	Timestamp       time.Time    `json:"timestamp"`
+	TransactionId   int          `json:"transactionId"`
+	Reason          *string      `json:"reason,omitempty"`
 	TransactionData []MeterValue `json:"transactionData,omitempty"`
 }
 
@@ -129,6 +203,96 @@ type MeterValuesRequest struct {
 // MeterValuesResponse represents OCPP 1.6 MeterValues response
 type MeterValuesResponse struct{}
 
+// RemoteStartTransactionRequest represents OCPP 1.6 RemoteStartTransaction request
+type RemoteStartTransactionRequest struct {
+	ConnectorId     *int             `json:"connectorId,omitempty"`
+	IdTag           string           `json:"idTag"`
+	ChargingProfile *ChargingProfile `json:"chargingProfile,omitempty"` // TxProfile for the new transaction
+}
+
+// RemoteStartTransactionResponse represents OCPP 1.6 RemoteStartTransaction response
+type RemoteStartTransactionResponse struct {
+	Status string `json:"status"`
+}
+
+// RemoteStopTransactionRequest represents OCPP 1.6 RemoteStopTransaction request
+type RemoteStopTransactionRequest struct {
+	TransactionId int `json:"transactionId"`
+}
+
+// RemoteStopTransactionResponse represents OCPP 1.6 RemoteStopTransaction response
+type RemoteStopTransactionResponse struct {
+	Status string `json:"status"`
+}
+
+// ResetRequest represents OCPP 1.6 Reset request
+type ResetRequest struct {
+	Type string `json:"type"` // Hard or Soft
+}
+
+// ResetResponse represents OCPP 1.6 Reset response
+type ResetResponse struct {
+	Status string `json:"status"`
+}
+
+// ChangeAvailabilityRequest represents OCPP 1.6 ChangeAvailability request
+type ChangeAvailabilityRequest struct {
+	ConnectorId int    `json:"connectorId"`
+	Type        string `json:"type"` // Inoperative or Operative
+}
+
+// ChangeAvailabilityResponse represents OCPP 1.6 ChangeAvailability response
+type ChangeAvailabilityResponse struct {
+	Status string `json:"status"` // Accepted, Rejected or Scheduled
+}
+
+// UnlockConnectorRequest represents OCPP 1.6 UnlockConnector request
+type UnlockConnectorRequest struct {
+	ConnectorId int `json:"connectorId"`
+}
+
+// UnlockConnectorResponse represents OCPP 1.6 UnlockConnector response
+type UnlockConnectorResponse struct {
+	Status string `json:"status"` // Unlocked, UnlockFailed or NotSupported
+}
+
+// ClearCacheRequest represents OCPP 1.6 ClearCache request
+type ClearCacheRequest struct{}
+
+// ClearCacheResponse represents OCPP 1.6 ClearCache response
+type ClearCacheResponse struct {
+	Status string `json:"status"`
+}
+
+// GetConfigurationRequest represents OCPP 1.6 GetConfiguration request
+type GetConfigurationRequest struct {
+	Key []string `json:"key,omitempty"`
+}
+
+// GetConfigurationResponse represents OCPP 1.6 GetConfiguration response
+type GetConfigurationResponse struct {
+	ConfigurationKey []KeyValue `json:"configurationKey,omitempty"`
+	UnknownKey       []string   `json:"unknownKey,omitempty"`
+}
+
+// KeyValue represents OCPP 1.6 KeyValue used in GetConfiguration
+type KeyValue struct {
+	Key      string  `json:"key"`
+	Readonly bool    `json:"readonly"`
+	Value    *string `json:"value,omitempty"`
+}
+
+// ChangeConfigurationRequest represents OCPP 1.6 ChangeConfiguration request
+type ChangeConfigurationRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ChangeConfigurationResponse represents OCPP 1.6 ChangeConfiguration response
+type ChangeConfigurationResponse struct {
+	Status string `json:"status"` // Accepted, Rejected, RebootRequired or NotSupported
+}
+
 // IdTagInfo represents OCPP 1.6 IdTagInfo
 type IdTagInfo struct {
 	ExpiryDate  *time.Time `json:"expiryDate,omitempty"`
@@ -138,8 +302,8 @@ type IdTagInfo struct {
 
 // MeterValue represents OCPP 1.6 MeterValue
 type MeterValue struct {
-	Timestamp    time.Time           `json:"timestamp"`
-	SampledValue []SampledValue      `json:"sampledValue"`
+	Timestamp    time.Time      `json:"timestamp"`
+	SampledValue []SampledValue `json:"sampledValue"`
 }
 
 // SampledValue represents OCPP 1.6 SampledValue
@@ -153,6 +317,40 @@ type SampledValue struct {
 	Unit      *string `json:"unit,omitempty"`
 }
 
+// callResultTypes maps each charger-initiated action to its response type
+var callResultTypes = map[string]func() interface{}{
+	MessageTypeAuthorize:          func() interface{} { return &AuthorizeResponse{} },
+	MessageTypeBootNotification:   func() interface{} { return &BootNotificationResponse{} },
+	MessageTypeDataTransfer:       func() interface{} { return &DataTransferResponse{} },
+	MessageTypeHeartbeat:          func() interface{} { return &HeartbeatResponse{} },
+	MessageTypeMeterValues:        func() interface{} { return &MeterValuesResponse{} },
+	MessageTypeStartTransaction:   func() interface{} { return &StartTransactionResponse{} },
+	MessageTypeStatusNotification: func() interface{} { return &StatusNotificationResponse{} },
+	MessageTypeStopTransaction:    func() interface{} { return &StopTransactionResponse{} },
+
+	MessageTypeDiagnosticsStatusNotification: func() interface{} { return &DiagnosticsStatusNotificationResponse{} },
+	MessageTypeFirmwareStatusNotification:    func() interface{} { return &FirmwareStatusNotificationResponse{} },
+
+	MessageTypeSecurityEventNotification:        func() interface{} { return &SecurityEventNotificationResponse{} },
+	MessageTypeSignCertificate:                  func() interface{} { return &SignCertificateResponse{} },
+	MessageTypeSignedFirmwareStatusNotification: func() interface{} { return &SignedFirmwareStatusNotificationResponse{} },
+}
+
+// DecodeCallResult unmarshals a CallResult payload into the typed response
+// struct for the given action. Unknown actions are returned as json.RawMessage.
+func DecodeCallResult(action string, payload json.RawMessage) (interface{}, error) {
+	newResponse, ok := callResultTypes[action]
+	if !ok {
+		return payload, nil
+	}
+
+	response := newResponse()
+	if err := json.Unmarshal(payload, response); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", action, err)
+	}
+	return response, nil
+}
+
 // NewBootNotificationRequest creates a new BootNotification request
 func NewBootNotificationRequest(model, vendor string) *BootNotificationRequest {
 	return &BootNotificationRequest{
@@ -168,11 +366,12 @@ func NewHeartbeatRequest() *HeartbeatRequest {
 
 // NewStatusNotificationRequest creates a new StatusNotification request
 func NewStatusNotificationRequest(connectorID int, errorCode, status string) *StatusNotificationRequest {
+	now := time.Now()
 	return &StatusNotificationRequest{
 		ConnectorId: connectorID,
 		ErrorCode:   errorCode,
 		Status:      status,
-		Timestamp:   time.Now(),
+		Timestamp:   &now,
 	}
 }
 
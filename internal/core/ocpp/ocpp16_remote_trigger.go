@@ -0,0 +1,22 @@
+package ocpp
+
+// OCPP 1.6 Remote Trigger profile message type, initiated by the CSMS
+const MessageTypeTriggerMessage = "TriggerMessage"
+
+// TriggerMessage statuses, shared with ExtendedTriggerMessage
+const (
+	TriggerMessageStatusAccepted       = "Accepted"
+	TriggerMessageStatusNotImplemented = "NotImplemented"
+	TriggerMessageStatusRejected       = "Rejected"
+)
+
+// TriggerMessageRequest represents OCPP 1.6 TriggerMessage request
+type TriggerMessageRequest struct {
+	RequestedMessage string `json:"requestedMessage"`
+	ConnectorId      *int   `json:"connectorId,omitempty"`
+}
+
+// TriggerMessageResponse represents OCPP 1.6 TriggerMessage response
+type TriggerMessageResponse struct {
+	Status string `json:"status"` // Accepted, Rejected or NotImplemented
+}
@@ -0,0 +1,43 @@
+package ocpp
+
+import "time"
+
+// OCPP 1.6 Reservation profile message types, all initiated by the CSMS
+const (
+	MessageTypeCancelReservation = "CancelReservation"
+	MessageTypeReserveNow        = "ReserveNow"
+)
+
+// ReserveNow statuses
+const (
+	ReservationStatusAccepted    = "Accepted"
+	ReservationStatusFaulted     = "Faulted"
+	ReservationStatusOccupied    = "Occupied"
+	ReservationStatusRejected    = "Rejected"
+	ReservationStatusUnavailable = "Unavailable"
+)
+
+// ReserveNowRequest represents OCPP 1.6 ReserveNow request. Connector 0
+// reserves any connector of the charge point.
+type ReserveNowRequest struct {
+	ConnectorId   int       `json:"connectorId"`
+	ExpiryDate    time.Time `json:"expiryDate"`
+	IdTag         string    `json:"idTag"`
+	ParentIdTag   *string   `json:"parentIdTag,omitempty"`
+	ReservationId int       `json:"reservationId"`
+}
+
+// ReserveNowResponse represents OCPP 1.6 ReserveNow response
+type ReserveNowResponse struct {
+	Status string `json:"status"` // Accepted, Faulted, Occupied, Rejected or Unavailable
+}
+
+// CancelReservationRequest represents OCPP 1.6 CancelReservation request
+type CancelReservationRequest struct {
+	ReservationId int `json:"reservationId"`
+}
+
+// CancelReservationResponse represents OCPP 1.6 CancelReservation response
+type CancelReservationResponse struct {
+	Status string `json:"status"` // Accepted or Rejected
+}
@@ -0,0 +1,137 @@
+package ocpp
+
+import "time"
+
+// OCPP 1.6 security extension message types, see the OCPP 1.6 security whitepaper
+const (
+	// Initiated by the charger
+	MessageTypeSecurityEventNotification        = "SecurityEventNotification"
+	MessageTypeSignCertificate                  = "SignCertificate"
+	MessageTypeSignedFirmwareStatusNotification = "SignedFirmwareStatusNotification"
+
+	// Initiated by the CSMS
+	MessageTypeCertificateSigned          = "CertificateSigned"
+	MessageTypeDeleteCertificate          = "DeleteCertificate"
+	MessageTypeExtendedTriggerMessage     = "ExtendedTriggerMessage"
+	MessageTypeGetInstalledCertificateIds = "GetInstalledCertificateIds"
+	MessageTypeInstallCertificate         = "InstallCertificate"
+	MessageTypeSignedUpdateFirmware       = "SignedUpdateFirmware"
+)
+
+// Certificate types of InstallCertificate and GetInstalledCertificateIds
+const (
+	CertificateTypeCentralSystemRoot = "CentralSystemRootCertificate"
+	CertificateTypeManufacturerRoot  = "ManufacturerRootCertificate"
+)
+
+// CertificateHashData identifies an installed certificate
+type CertificateHashData struct {
+	HashAlgorithm  string `json:"hashAlgorithm"` // SHA256, SHA384 or SHA512
+	IssuerNameHash string `json:"issuerNameHash"`
+	IssuerKeyHash  string `json:"issuerKeyHash"`
+	SerialNumber   string `json:"serialNumber"`
+}
+
+// SignCertificateRequest represents OCPP 1.6 SignCertificate request
+type SignCertificateRequest struct {
+	Csr string `json:"csr"` // PEM encoded certificate signing request
+}
+
+// SignCertificateResponse represents OCPP 1.6 SignCertificate response
+type SignCertificateResponse struct {
+	Status string `json:"status"` // Accepted or Rejected
+}
+
+// CertificateSignedRequest represents OCPP 1.6 CertificateSigned request
+type CertificateSignedRequest struct {
+	CertificateChain string `json:"certificateChain"` // PEM encoded chain, leaf first
+}
+
+// CertificateSignedResponse represents OCPP 1.6 CertificateSigned response
+type CertificateSignedResponse struct {
+	Status string `json:"status"` // Accepted or Rejected
+}
+
+// InstallCertificateRequest represents OCPP 1.6 InstallCertificate request
+type InstallCertificateRequest struct {
+	CertificateType string `json:"certificateType"`
+	Certificate     string `json:"certificate"` // PEM encoded
+}
+
+// InstallCertificateResponse represents OCPP 1.6 InstallCertificate response
+type InstallCertificateResponse struct {
+	Status string `json:"status"` // Accepted, Failed or Rejected
+}
+
+// GetInstalledCertificateIdsRequest represents OCPP 1.6 GetInstalledCertificateIds request
+type GetInstalledCertificateIdsRequest struct {
+	CertificateType string `json:"certificateType"`
+}
+
+// GetInstalledCertificateIdsResponse represents OCPP 1.6 GetInstalledCertificateIds response
+type GetInstalledCertificateIdsResponse struct {
+	CertificateHashData []CertificateHashData `json:"certificateHashData,omitempty"`
+	Status              string                `json:"status"` // Accepted or NotFound
+}
+
+// DeleteCertificateRequest represents OCPP 1.6 DeleteCertificate request
+type DeleteCertificateRequest struct {
+	CertificateHashData CertificateHashData `json:"certificateHashData"`
+}
+
+// DeleteCertificateResponse represents OCPP 1.6 DeleteCertificate response
+type DeleteCertificateResponse struct {
+	Status string `json:"status"` // Accepted, Failed or NotFound
+}
+
+// SecurityEventNotificationRequest represents OCPP 1.6 SecurityEventNotification request
+type SecurityEventNotificationRequest struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	TechInfo  *string   `json:"techInfo,omitempty"`
+}
+
+// SecurityEventNotificationResponse represents OCPP 1.6 SecurityEventNotification response
+type SecurityEventNotificationResponse struct{}
+
+// Firmware describes a signed firmware image
+type Firmware struct {
+	Location           string     `json:"location"`
+	RetrieveDateTime   time.Time  `json:"retrieveDateTime"`
+	InstallDateTime    *time.Time `json:"installDateTime,omitempty"`
+	SigningCertificate string     `json:"signingCertificate"` // PEM encoded
+	Signature          string     `json:"signature"`          // Base64 encoded
+}
+
+// SignedUpdateFirmwareRequest represents OCPP 1.6 SignedUpdateFirmware request
+type SignedUpdateFirmwareRequest struct {
+	Retries       *int     `json:"retries,omitempty"`
+	RetryInterval *int     `json:"retryInterval,omitempty"`
+	RequestId     int      `json:"requestId"`
+	Firmware      Firmware `json:"firmware"`
+}
+
+// SignedUpdateFirmwareResponse represents OCPP 1.6 SignedUpdateFirmware response
+type SignedUpdateFirmwareResponse struct {
+	Status string `json:"status"` // Accepted, Rejected, AcceptedCanceled, InvalidCertificate or RevokedCertificate
+}
+
+// SignedFirmwareStatusNotificationRequest represents OCPP 1.6 SignedFirmwareStatusNotification request
+type SignedFirmwareStatusNotificationRequest struct {
+	Status    string `json:"status"`
+	RequestId *int   `json:"requestId,omitempty"`
+}
+
+// SignedFirmwareStatusNotificationResponse represents OCPP 1.6 SignedFirmwareStatusNotification response
+type SignedFirmwareStatusNotificationResponse struct{}
+
+// ExtendedTriggerMessageRequest represents OCPP 1.6 ExtendedTriggerMessage request
+type ExtendedTriggerMessageRequest struct {
+	RequestedMessage string `json:"requestedMessage"`
+	ConnectorId      *int   `json:"connectorId,omitempty"`
+}
+
+// ExtendedTriggerMessageResponse represents OCPP 1.6 ExtendedTriggerMessage response
+type ExtendedTriggerMessageResponse struct {
+	Status string `json:"status"` // Accepted, Rejected or NotImplemented
+}
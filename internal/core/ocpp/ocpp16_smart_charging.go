@@ -0,0 +1,106 @@
+package ocpp
+
+import "time"
+
+// OCPP 1.6 Smart Charging profile message types, all initiated by the CSMS
+const (
+	MessageTypeClearChargingProfile = "ClearChargingProfile"
+	MessageTypeGetCompositeSchedule = "GetCompositeSchedule"
+	MessageTypeSetChargingProfile   = "SetChargingProfile"
+)
+
+// Charging profile purposes
+const (
+	ChargingProfilePurposeChargePointMax = "ChargePointMaxProfile"
+	ChargingProfilePurposeTxDefault      = "TxDefaultProfile"
+	ChargingProfilePurposeTx             = "TxProfile"
+)
+
+// Charging profile kinds
+const (
+	ChargingProfileKindAbsolute  = "Absolute"
+	ChargingProfileKindRecurring = "Recurring"
+	ChargingProfileKindRelative  = "Relative"
+)
+
+// Recurrency kinds of recurring charging profiles
+const (
+	RecurrencyKindDaily  = "Daily"
+	RecurrencyKindWeekly = "Weekly"
+)
+
+// Charging rate units
+const (
+	ChargingRateUnitAmperes = "A"
+	ChargingRateUnitWatts   = "W"
+)
+
+// ChargingSchedulePeriod is a limit that applies from StartPeriod seconds
+// after the start of the schedule until the next period
+type ChargingSchedulePeriod struct {
+	StartPeriod  int     `json:"startPeriod"`
+	Limit        float64 `json:"limit"`
+	NumberPhases *int    `json:"numberPhases,omitempty"`
+}
+
+// ChargingSchedule is a list of charging limits over time
+type ChargingSchedule struct {
+	Duration               *int                     `json:"duration,omitempty"` // Seconds, open ended when nil
+	StartSchedule          *time.Time               `json:"startSchedule,omitempty"`
+	ChargingRateUnit       string                   `json:"chargingRateUnit"`
+	ChargingSchedulePeriod []ChargingSchedulePeriod `json:"chargingSchedulePeriod"`
+	MinChargingRate        *float64                 `json:"minChargingRate,omitempty"`
+}
+
+// ChargingProfile represents an OCPP 1.6 ChargingProfile
+type ChargingProfile struct {
+	ChargingProfileId      int              `json:"chargingProfileId"`
+	TransactionId          *int             `json:"transactionId,omitempty"`
+	StackLevel             int              `json:"stackLevel"`
+	ChargingProfilePurpose string           `json:"chargingProfilePurpose"`
+	ChargingProfileKind    string           `json:"chargingProfileKind"`
+	RecurrencyKind         *string          `json:"recurrencyKind,omitempty"`
+	ValidFrom              *time.Time       `json:"validFrom,omitempty"`
+	ValidTo                *time.Time       `json:"validTo,omitempty"`
+	ChargingSchedule       ChargingSchedule `json:"chargingSchedule"`
+}
+
+// SetChargingProfileRequest represents OCPP 1.6 SetChargingProfile request
+type SetChargingProfileRequest struct {
+	ConnectorId        int             `json:"connectorId"`
+	CsChargingProfiles ChargingProfile `json:"csChargingProfiles"`
+}
+
+// SetChargingProfileResponse represents OCPP 1.6 SetChargingProfile response
+type SetChargingProfileResponse struct {
+	Status string `json:"status"` // Accepted, Rejected or NotSupported
+}
+
+// ClearChargingProfileRequest represents OCPP 1.6 ClearChargingProfile request.
+// Profiles matching all given criteria are cleared.
+type ClearChargingProfileRequest struct {
+	Id                     *int    `json:"id,omitempty"`
+	ConnectorId            *int    `json:"connectorId,omitempty"`
+	ChargingProfilePurpose *string `json:"chargingProfilePurpose,omitempty"`
+	StackLevel             *int    `json:"stackLevel,omitempty"`
+}
+
+// ClearChargingProfileResponse represents OCPP 1.6 ClearChargingProfile response
+type ClearChargingProfileResponse struct {
+	Status string `json:"status"` // Accepted or Unknown
+}
+
+// GetCompositeScheduleRequest represents OCPP 1.6 GetCompositeSchedule request
+type GetCompositeScheduleRequest struct {
+	ConnectorId      int     `json:"connectorId"`
+	Duration         int     `json:"duration"` // Seconds
+	ChargingRateUnit *string `json:"chargingRateUnit,omitempty"`
+}
+
+// GetCompositeScheduleResponse represents OCPP 1.6 GetCompositeSchedule response
+type GetCompositeScheduleResponse struct {
+	Status           string            `json:"status"` // Accepted or Rejected
+	ConnectorId      *int              `json:"connectorId,omitempty"`
+	ScheduleStart    *time.Time        `json:"scheduleStart,omitempty"`
+	ChargingSchedule *ChargingSchedule `json:"chargingSchedule,omitempty"`
+}
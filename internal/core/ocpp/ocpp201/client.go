@@ -0,0 +1,29 @@
+package ocpp201
+
+import (
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+)
+
+// Version is the OCPP version implemented by this package
+const Version = "2.0.1"
+
+// Dialect is the OCPP 2.0.1 dialect of the OCPP-J RPC framework
+var Dialect = ocpp.Dialect{
+	Version:              Version,
+	Subprotocol:          "ocpp2.0.1",
+	DecodeCallResult:     DecodeCallResult,
+	IsTransactionMessage: IsTransactionMessage,
+}
+
+// Protocol is the OCPP 2.0.1 protocol, registered under Version
+var Protocol = ocpp.NewProtocol(Dialect)
+
+func init() {
+	ocpp.RegisterProtocol(Protocol)
+}
+
+// NewClient creates an OCPP 2.0.1 client. It shares connection handling,
+// reconnection and offline queueing with the OCPP 1.6 client.
+func NewClient(config ocpp.ClientConfig) ocpp.Client {
+	return ocpp.NewClientWithDialect(config, Dialect)
+}
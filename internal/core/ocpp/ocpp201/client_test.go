@@ -0,0 +1,92 @@
+package ocpp201
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestClient_NegotiatesSubprotocolAndDecodesResponses(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp2.0.1"}}
+    subprotocol := make(chan string, 1)
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        subprotocol <- r.Header.Get("Sec-WebSocket-Protocol")
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        for {
+            var frame []json.RawMessage
+            if err := conn.ReadJSON(&frame); err != nil {
+                return
+            }
+            var messageID string
+            json.Unmarshal(frame[1], &messageID)
+            conn.WriteJSON([]interface{}{3, messageID, map[string]interface{}{
+                "currentTime": "2024-01-01T00:00:00Z",
+                "interval":    300,
+                "status":      "Accepted",
+            }})
+        }
+    }))
+    defer server.Close()
+
+    client := NewClient(ocpp.ClientConfig{
+        ChargerID:   "CS001",
+        Endpoint:    "ws" + strings.TrimPrefix(server.URL, "http"),
+        CallTimeout: time.Second,
+    })
+    require.NoError(t, client.Connect(context.Background()))
+    defer client.Disconnect(context.Background())
+
+    assert.Equal(t, "ocpp2.0.1", <-subprotocol)
+
+    resp, err := client.Call(context.Background(), ActionBootNotification, &BootNotificationRequest{
+        ChargingStation: ChargingStation{Model: "model", VendorName: "vendor"},
+        Reason:          "PowerUp",
+    })
+    require.NoError(t, err)
+
+    bootResp, ok := resp.(*BootNotificationResponse)
+    require.True(t, ok, "expected *BootNotificationResponse, got %T", resp)
+    assert.Equal(t, "Accepted", bootResp.Status)
+    assert.Equal(t, 300, bootResp.Interval)
+}
+
+func TestDecodeCallResult(t *testing.T) {
+    resp, err := DecodeCallResult(ActionTransactionEvent, json.RawMessage(`{"idTokenInfo":{"status":"Invalid"}}`))
+    require.NoError(t, err)
+    eventResp, ok := resp.(*TransactionEventResponse)
+    require.True(t, ok)
+    require.NotNil(t, eventResp.IdTokenInfo)
+    assert.Equal(t, "Invalid", eventResp.IdTokenInfo.Status)
+
+    // Unknown actions are passed through untouched
+    raw, err := DecodeCallResult("VendorAction", json.RawMessage(`{"a":1}`))
+    require.NoError(t, err)
+    assert.Equal(t, json.RawMessage(`{"a":1}`), raw)
+
+    _, err = DecodeCallResult(ActionAuthorize, json.RawMessage(`{"idTokenInfo":1}`))
+    assert.Error(t, err)
+
+    assert.True(t, IsTransactionMessage(ActionTransactionEvent))
+    assert.False(t, IsTransactionMessage(ActionStatusNotification))
+}
+
+func TestProtocolIsRegistered(t *testing.T) {
+    protocol, err := ocpp.LookupProtocol(Version)
+    require.NoError(t, err)
+    assert.Same(t, Protocol, protocol)
+}
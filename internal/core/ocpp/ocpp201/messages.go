@@ -0,0 +1,342 @@
+package ocpp201
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+)
+
+// OCPP 2.0.1 actions
+const (
+	// Initiated by the charging station
+	ActionAuthorize          = "Authorize"
+	ActionBootNotification   = "BootNotification"
+	ActionHeartbeat          = "Heartbeat"
+	ActionNotifyReport       = "NotifyReport"
+	ActionStatusNotification = "StatusNotification"
+	ActionTransactionEvent   = "TransactionEvent"
+
+	// Initiated by the CSMS
+	ActionGetBaseReport           = "GetBaseReport"
+	ActionGetVariables            = "GetVariables"
+	ActionRequestStartTransaction = "RequestStartTransaction"
+	ActionRequestStopTransaction  = "RequestStopTransaction"
+	ActionReset                   = "Reset"
+	ActionSetVariables            = "SetVariables"
+)
+
+// TransactionEvent event types
+const (
+	TransactionEventStarted = "Started"
+	TransactionEventUpdated = "Updated"
+	TransactionEventEnded   = "Ended"
+)
+
+// OCPP 2.0.1 CallError codes that differ from OCPP 1.6
+const (
+	ErrorCodeFormatViolation = "FormatViolation"
+)
+
+// Message is an OCPP 2.0.1 frame. The OCPP-J framing is the same as in
+// OCPP 1.6, so frames share one representation.
+type Message = ocpp.OCPP16Message
+
+// ChargingStation identifies the charging station in a BootNotification
+type ChargingStation struct {
+	Model           string  `json:"model"`
+	VendorName      string  `json:"vendorName"`
+	SerialNumber    *string `json:"serialNumber,omitempty"`
+	FirmwareVersion *string `json:"firmwareVersion,omitempty"`
+}
+
+// StatusInfo gives details about a status in a response
+type StatusInfo struct {
+	ReasonCode     string  `json:"reasonCode"`
+	AdditionalInfo *string `json:"additionalInfo,omitempty"`
+}
+
+// BootNotificationRequest represents OCPP 2.0.1 BootNotification request
+type BootNotificationRequest struct {
+	ChargingStation ChargingStation `json:"chargingStation"`
+	Reason          string          `json:"reason"`
+}
+
+// BootNotificationResponse represents OCPP 2.0.1 BootNotification response
+type BootNotificationResponse struct {
+	CurrentTime time.Time   `json:"currentTime"`
+	Interval    int         `json:"interval"`
+	Status      string      `json:"status"`
+	StatusInfo  *StatusInfo `json:"statusInfo,omitempty"`
+}
+
+// HeartbeatRequest represents OCPP 2.0.1 Heartbeat request
+type HeartbeatRequest struct{}
+
+// HeartbeatResponse represents OCPP 2.0.1 Heartbeat response
+type HeartbeatResponse struct {
+	CurrentTime time.Time `json:"currentTime"`
+}
+
+// StatusNotificationRequest represents OCPP 2.0.1 StatusNotification request
+type StatusNotificationRequest struct {
+	Timestamp       time.Time `json:"timestamp"`
+	ConnectorStatus string    `json:"connectorStatus"`
+	EvseId          int       `json:"evseId"`
+	ConnectorId     int       `json:"connectorId"`
+}
+
+// StatusNotificationResponse represents OCPP 2.0.1 StatusNotification response
+type StatusNotificationResponse struct{}
+
+// IdToken identifies a user or token
+type IdToken struct {
+	IdToken string `json:"idToken"`
+	Type    string `json:"type"`
+}
+
+// IdTokenInfo contains the authorization status of an IdToken
+type IdTokenInfo struct {
+	Status              string     `json:"status"`
+	CacheExpiryDateTime *time.Time `json:"cacheExpiryDateTime,omitempty"`
+}
+
+// AuthorizeRequest represents OCPP 2.0.1 Authorize request
+type AuthorizeRequest struct {
+	IdToken IdToken `json:"idToken"`
+}
+
+// AuthorizeResponse represents OCPP 2.0.1 Authorize response
+type AuthorizeResponse struct {
+	IdTokenInfo IdTokenInfo `json:"idTokenInfo"`
+}
+
+// EVSE addresses an EVSE and optionally one of its connectors
+type EVSE struct {
+	Id          int  `json:"id"`
+	ConnectorId *int `json:"connectorId,omitempty"`
+}
+
+// SampledValue represents a single measured value
+type SampledValue struct {
+	Value         float64        `json:"value"`
+	Context       *string        `json:"context,omitempty"`
+	Measurand     *string        `json:"measurand,omitempty"`
+	Phase         *string        `json:"phase,omitempty"`
+	Location      *string        `json:"location,omitempty"`
+	UnitOfMeasure *UnitOfMeasure `json:"unitOfMeasure,omitempty"`
+}
+
+// UnitOfMeasure describes the unit of a SampledValue
+type UnitOfMeasure struct {
+	Unit       string `json:"unit,omitempty"`
+	Multiplier int    `json:"multiplier,omitempty"`
+}
+
+// MeterValue represents meter values taken at one point in time
+type MeterValue struct {
+	Timestamp    time.Time      `json:"timestamp"`
+	SampledValue []SampledValue `json:"sampledValue"`
+}
+
+// Transaction describes the transaction in a TransactionEvent
+type Transaction struct {
+	TransactionId string  `json:"transactionId"`
+	ChargingState *string `json:"chargingState,omitempty"`
+	StoppedReason *string `json:"stoppedReason,omitempty"`
+	RemoteStartId *int    `json:"remoteStartId,omitempty"`
+}
+
+// TransactionEventRequest represents OCPP 2.0.1 TransactionEvent request
+type TransactionEventRequest struct {
+	EventType       string       `json:"eventType"`
+	Timestamp       time.Time    `json:"timestamp"`
+	TriggerReason   string       `json:"triggerReason"`
+	SeqNo           int          `json:"seqNo"`
+	Offline         bool         `json:"offline,omitempty"`
+	TransactionInfo Transaction  `json:"transactionInfo"`
+	IdToken         *IdToken     `json:"idToken,omitempty"`
+	Evse            *EVSE        `json:"evse,omitempty"`
+	MeterValue      []MeterValue `json:"meterValue,omitempty"`
+}
+
+// TransactionEventResponse represents OCPP 2.0.1 TransactionEvent response
+type TransactionEventResponse struct {
+	TotalCost   *float64     `json:"totalCost,omitempty"`
+	IdTokenInfo *IdTokenInfo `json:"idTokenInfo,omitempty"`
+}
+
+// Component addresses a component of the device model
+type Component struct {
+	Name     string  `json:"name"`
+	Instance *string `json:"instance,omitempty"`
+	Evse     *EVSE   `json:"evse,omitempty"`
+}
+
+// Variable addresses a variable of a component
+type Variable struct {
+	Name     string  `json:"name"`
+	Instance *string `json:"instance,omitempty"`
+}
+
+// VariableAttribute holds one attribute of a variable in a report
+type VariableAttribute struct {
+	Type       *string `json:"type,omitempty"`
+	Value      *string `json:"value,omitempty"`
+	Mutability *string `json:"mutability,omitempty"`
+}
+
+// VariableCharacteristics describes a variable in a report
+type VariableCharacteristics struct {
+	DataType           string `json:"dataType"`
+	SupportsMonitoring bool   `json:"supportsMonitoring"`
+}
+
+// ReportData describes one variable in a NotifyReport
+type ReportData struct {
+	Component               Component                `json:"component"`
+	Variable                Variable                 `json:"variable"`
+	VariableAttribute       []VariableAttribute      `json:"variableAttribute"`
+	VariableCharacteristics *VariableCharacteristics `json:"variableCharacteristics,omitempty"`
+}
+
+// NotifyReportRequest represents OCPP 2.0.1 NotifyReport request
+type NotifyReportRequest struct {
+	RequestId   int          `json:"requestId"`
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Tbc         bool         `json:"tbc,omitempty"`
+	SeqNo       int          `json:"seqNo"`
+	ReportData  []ReportData `json:"reportData,omitempty"`
+}
+
+// NotifyReportResponse represents OCPP 2.0.1 NotifyReport response
+type NotifyReportResponse struct{}
+
+// GetBaseReportRequest represents OCPP 2.0.1 GetBaseReport request
+type GetBaseReportRequest struct {
+	RequestId  int    `json:"requestId"`
+	ReportBase string `json:"reportBase"`
+}
+
+// GetBaseReportResponse represents OCPP 2.0.1 GetBaseReport response
+type GetBaseReportResponse struct {
+	Status string `json:"status"`
+}
+
+// GetVariableData addresses a variable requested by GetVariables
+type GetVariableData struct {
+	AttributeType *string   `json:"attributeType,omitempty"`
+	Component     Component `json:"component"`
+	Variable      Variable  `json:"variable"`
+}
+
+// GetVariablesRequest represents OCPP 2.0.1 GetVariables request
+type GetVariablesRequest struct {
+	GetVariableData []GetVariableData `json:"getVariableData"`
+}
+
+// GetVariableResult is the result for one requested variable
+type GetVariableResult struct {
+	AttributeStatus string    `json:"attributeStatus"`
+	AttributeType   *string   `json:"attributeType,omitempty"`
+	AttributeValue  *string   `json:"attributeValue,omitempty"`
+	Component       Component `json:"component"`
+	Variable        Variable  `json:"variable"`
+}
+
+// GetVariablesResponse represents OCPP 2.0.1 GetVariables response
+type GetVariablesResponse struct {
+	GetVariableResult []GetVariableResult `json:"getVariableResult"`
+}
+
+// SetVariableData is a variable value to set
+type SetVariableData struct {
+	AttributeType  *string   `json:"attributeType,omitempty"`
+	AttributeValue string    `json:"attributeValue"`
+	Component      Component `json:"component"`
+	Variable       Variable  `json:"variable"`
+}
+
+// SetVariablesRequest represents OCPP 2.0.1 SetVariables request
+type SetVariablesRequest struct {
+	SetVariableData []SetVariableData `json:"setVariableData"`
+}
+
+// SetVariableResult is the result for one variable to set
+type SetVariableResult struct {
+	AttributeType   *string   `json:"attributeType,omitempty"`
+	AttributeStatus string    `json:"attributeStatus"`
+	Component       Component `json:"component"`
+	Variable        Variable  `json:"variable"`
+}
+
+// SetVariablesResponse represents OCPP 2.0.1 SetVariables response
+type SetVariablesResponse struct {
+	SetVariableResult []SetVariableResult `json:"setVariableResult"`
+}
+
+// RequestStartTransactionRequest represents OCPP 2.0.1 RequestStartTransaction request
+type RequestStartTransactionRequest struct {
+	EvseId        *int    `json:"evseId,omitempty"`
+	RemoteStartId int     `json:"remoteStartId"`
+	IdToken       IdToken `json:"idToken"`
+}
+
+// RequestStartTransactionResponse represents OCPP 2.0.1 RequestStartTransaction response
+type RequestStartTransactionResponse struct {
+	Status        string  `json:"status"`
+	TransactionId *string `json:"transactionId,omitempty"`
+}
+
+// RequestStopTransactionRequest represents OCPP 2.0.1 RequestStopTransaction request
+type RequestStopTransactionRequest struct {
+	TransactionId string `json:"transactionId"`
+}
+
+// RequestStopTransactionResponse represents OCPP 2.0.1 RequestStopTransaction response
+type RequestStopTransactionResponse struct {
+	Status string `json:"status"`
+}
+
+// ResetRequest represents OCPP 2.0.1 Reset request
+type ResetRequest struct {
+	Type   string `json:"type"`
+	EvseId *int   `json:"evseId,omitempty"`
+}
+
+// ResetResponse represents OCPP 2.0.1 Reset response
+type ResetResponse struct {
+	Status string `json:"status"`
+}
+
+// callResultTypes maps charging station initiated actions to their response type
+var callResultTypes = map[string]func() interface{}{
+	ActionAuthorize:          func() interface{} { return &AuthorizeResponse{} },
+	ActionBootNotification:   func() interface{} { return &BootNotificationResponse{} },
+	ActionHeartbeat:          func() interface{} { return &HeartbeatResponse{} },
+	ActionNotifyReport:       func() interface{} { return &NotifyReportResponse{} },
+	ActionStatusNotification: func() interface{} { return &StatusNotificationResponse{} },
+	ActionTransactionEvent:   func() interface{} { return &TransactionEventResponse{} },
+}
+
+// DecodeCallResult unmarshals a CallResult payload into the typed response
+// for the action. Unknown actions are returned as json.RawMessage.
+func DecodeCallResult(action string, payload json.RawMessage) (interface{}, error) {
+	newResponse, known := callResultTypes[action]
+	if !known {
+		return payload, nil
+	}
+
+	response := newResponse()
+	if err := json.Unmarshal(payload, response); err != nil {
+		return nil, fmt.Errorf("invalid %s response: %w", action, err)
+	}
+	return response, nil
+}
+
+// IsTransactionMessage reports whether action is transaction-related and is
+// queued while offline
+func IsTransactionMessage(action string) bool {
+	return action == ActionTransactionEvent
+}
@@ -0,0 +1,551 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy decides what happens when the offline queue is full
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // Evict the oldest queued message
+	OverflowDropNewest OverflowPolicy = "drop_newest" // Reject the message being queued
+	OverflowBlock      OverflowPolicy = "block"       // Wait until the queue has room
+)
+
+// Offline queue defaults used when OfflineQueueConfig fields are not set
+const (
+	defaultQueueSize        = 1000
+	defaultQueueMaxAttempts = 3
+)
+
+// ErrQueueFull is returned when a message cannot be queued
+var ErrQueueFull = errors.New("offline queue is full")
+
+// OfflineQueueConfig controls buffering of charger-initiated messages while
+// the client is not connected to the CSMS
+type OfflineQueueConfig struct {
+	Disabled    bool           // Fail immediately while offline instead of queueing
+	Size        int            // Maximum number of queued messages
+	Overflow    OverflowPolicy // What to do when the queue is full
+	Dir         string         // Persist the queue to <Dir>/<ChargerID>.queue.json when set
+	QueueAll    bool           // Also queue non-transaction messages, with lower priority
+	MaxAttempts int            // Replay attempts per message before it is dropped
+}
+
+// withDefaults fills unset fields with the default values
+func (q OfflineQueueConfig) withDefaults() OfflineQueueConfig {
+	if q.Size <= 0 {
+		q.Size = defaultQueueSize
+	}
+	switch q.Overflow {
+	case OverflowDropOldest, OverflowDropNewest, OverflowBlock:
+	default:
+		q.Overflow = OverflowDropOldest
+	}
+	if q.MaxAttempts <= 0 {
+		q.MaxAttempts = defaultQueueMaxAttempts
+	}
+	return q
+}
+
+// IsTransactionMessage reports whether action is transaction-related. These
+// messages are always queued while offline and replayed in order.
+func IsTransactionMessage(action string) bool {
+	switch action {
+	case MessageTypeStartTransaction, MessageTypeStopTransaction, MessageTypeMeterValues:
+		return true
+	}
+	return false
+}
+
+// OfflineTransactionID returns the placeholder transaction ID used in queued
+// messages for a transaction started on connectorID while offline. It is
+// replaced by the ID the CSMS assigns when the StartTransaction is replayed.
+func OfflineTransactionID(connectorID int) int {
+	return -connectorID
+}
+
+// queuedMessage is a Call waiting to be replayed. The payload is stored as
+// sent so the original timestamps are preserved.
+type queuedMessage struct {
+	MessageID string          `json:"message_id"`
+	Action    string          `json:"action"`
+	Payload   json.RawMessage `json:"payload"`
+	QueuedAt  time.Time       `json:"queued_at"`
+	Attempts  int             `json:"attempts"`
+	// StartMessageID is the queued StartTransaction of the offline
+	// transaction whose placeholder ID the payload carries
+	StartMessageID string `json:"start_message_id,omitempty"`
+}
+
+// setTransactionID replaces the placeholder transaction ID of the payload
+func (m *queuedMessage) setTransactionID(transactionID int) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(m.Payload, &fields); err != nil {
+		return
+	}
+	fields["transactionId"], _ = json.Marshal(transactionID)
+	if payload, err := json.Marshal(fields); err == nil {
+		m.Payload = payload
+		m.StartMessageID = ""
+	}
+}
+
+// offlineTransactionID returns the placeholder transaction ID the payload of
+// a StopTransaction or MeterValues carries, if any
+func (m *queuedMessage) offlineTransactionID() (int, bool) {
+	if m.Action != MessageTypeStopTransaction && m.Action != MessageTypeMeterValues {
+		return 0, false
+	}
+	var req struct {
+		TransactionID *int `json:"transactionId"`
+	}
+	if err := json.Unmarshal(m.Payload, &req); err != nil || req.TransactionID == nil || *req.TransactionID >= 0 {
+		return 0, false
+	}
+	return *req.TransactionID, true
+}
+
+// messageQueue is a bounded FIFO of Calls, optionally persisted to disk
+type messageQueue struct {
+	config    OfflineQueueConfig
+	path      string
+	entries   []*queuedMessage
+	space     chan struct{} // Closed when an entry is removed
+	replaying bool
+	// transactional reports whether an action has transaction priority
+	transactional func(action string) bool
+	// Message ID of the last StartTransaction queued for each connector
+	starts map[int]string
+	// Transaction IDs the CSMS assigned to replayed StartTransactions, keyed
+	// by their message ID
+	resolved map[string]int
+	mu       sync.Mutex
+	logger   *logrus.Entry
+}
+
+// newMessageQueue creates the queue of a charger and restores persisted entries
+func newMessageQueue(config OfflineQueueConfig, chargerID string, transactional func(string) bool, logger *logrus.Entry) *messageQueue {
+	q := &messageQueue{
+		config:        config,
+		space:         make(chan struct{}),
+		transactional: transactional,
+		starts:        make(map[int]string),
+		resolved:      make(map[string]int),
+		logger:        logger,
+	}
+
+	if config.Dir != "" {
+		q.path = filepath.Join(config.Dir, chargerID+".queue.json")
+		if err := q.load(); err != nil {
+			logger.WithError(err).Warn("Failed to restore offline queue")
+		}
+	}
+
+	return q
+}
+
+// accepts reports whether messages for action are queued at all
+func (q *messageQueue) accepts(action string) bool {
+	if q.transactional(action) {
+		return true
+	}
+	// Replaying these after a reconnect is meaningless
+	if action == MessageTypeBootNotification || action == MessageTypeHeartbeat {
+		return false
+	}
+	return q.config.QueueAll
+}
+
+// push appends a message, applying the overflow policy when the queue is full
+func (q *messageQueue) push(ctx context.Context, msg *queuedMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.entries) >= q.config.Size {
+		if q.config.Overflow == OverflowBlock {
+			space := q.space
+			q.mu.Unlock()
+			select {
+			case <-space:
+				q.mu.Lock()
+				continue
+			case <-ctx.Done():
+				q.mu.Lock()
+				return ctx.Err()
+			}
+		}
+
+		victim := q.victimLocked(msg)
+		if victim < 0 {
+			q.logger.WithFields(logrus.Fields{
+				"message_id": msg.MessageID,
+				"action":     msg.Action,
+			}).Warn("Offline queue full, dropping message")
+			return ErrQueueFull
+		}
+
+		dropped := q.entries[victim]
+		q.entries = append(q.entries[:victim], q.entries[victim+1:]...)
+		q.logger.WithFields(logrus.Fields{
+			"message_id": dropped.MessageID,
+			"action":     dropped.Action,
+		}).Warn("Offline queue full, dropping queued message")
+	}
+
+	q.linkLocked(msg)
+	q.entries = append(q.entries, msg)
+	q.saveLocked()
+	return nil
+}
+
+// linkLocked ties a message carrying the placeholder ID of an offline
+// transaction to the last StartTransaction queued for its connector, so it
+// gets the ID the CSMS assigns to that transaction even if the connector
+// starts another one meanwhile. The caller must hold q.mu.
+func (q *messageQueue) linkLocked(msg *queuedMessage) {
+	if msg.Action == MessageTypeStartTransaction {
+		var req struct {
+			ConnectorID int `json:"connectorId"`
+		}
+		if err := json.Unmarshal(msg.Payload, &req); err == nil {
+			q.starts[req.ConnectorID] = msg.MessageID
+		}
+		return
+	}
+
+	transactionID, ok := msg.offlineTransactionID()
+	if !ok {
+		return
+	}
+	start, exists := q.starts[-transactionID]
+	if !exists {
+		return
+	}
+	if csmsID, resolved := q.resolved[start]; resolved {
+		msg.setTransactionID(csmsID)
+		return
+	}
+	msg.StartMessageID = start
+}
+
+// resolve stores the transaction ID the CSMS assigned to a replayed
+// StartTransaction in the queued messages of its transaction
+func (q *messageQueue) resolve(startMessageID string, transactionID int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.resolved[startMessageID] = transactionID
+	for _, entry := range q.entries {
+		if entry.StartMessageID == startMessageID {
+			entry.setTransactionID(transactionID)
+		}
+	}
+	q.saveLocked()
+}
+
+// victimLocked returns the index of the entry to evict for msg, or -1 when msg
+// itself must be dropped. Non-transaction messages are evicted first and never
+// displace transaction messages. The caller must hold q.mu.
+func (q *messageQueue) victimLocked(msg *queuedMessage) int {
+	pick := func(transactional bool) int {
+		if q.config.Overflow == OverflowDropNewest {
+			for i := len(q.entries) - 1; i >= 0; i-- {
+				if q.transactional(q.entries[i].Action) == transactional {
+					return i
+				}
+			}
+			return -1
+		}
+		for i, entry := range q.entries {
+			if q.transactional(entry.Action) == transactional {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if !q.transactional(msg.Action) {
+		if q.config.Overflow == OverflowDropNewest {
+			return -1
+		}
+		return pick(false)
+	}
+	if victim := pick(false); victim >= 0 {
+		return victim
+	}
+	if q.config.Overflow == OverflowDropNewest {
+		return -1
+	}
+	return pick(true)
+}
+
+// next returns the oldest entry for replay. When the queue is empty the
+// replay ends, so messages pushed afterwards start a new one.
+func (q *messageQueue) next() (*queuedMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		q.replaying = false
+		return nil, false
+	}
+	return q.entries[0], true
+}
+
+// startReplay marks the queue as being replayed and reports whether the
+// caller should run the replay
+func (q *messageQueue) startReplay() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.replaying || len(q.entries) == 0 {
+		return false
+	}
+	q.replaying = true
+	return true
+}
+
+// stopReplay ends a replay that is interrupted, keeping the remaining entries
+func (q *messageQueue) stopReplay() {
+	q.mu.Lock()
+	q.replaying = false
+	q.mu.Unlock()
+}
+
+// remove deletes the entry with the given message ID
+func (q *messageQueue) remove(messageID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, entry := range q.entries {
+		if entry.MessageID == messageID {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			close(q.space)
+			q.space = make(chan struct{})
+			q.saveLocked()
+			return
+		}
+	}
+}
+
+// failed counts a failed replay attempt of an entry and returns the total
+func (q *messageQueue) failed(entry *queuedMessage) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry.Attempts++
+	q.saveLocked()
+	return entry.Attempts
+}
+
+// len returns the number of queued messages
+func (q *messageQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// load restores the entries saved by a previous run
+func (q *messageQueue) load() error {
+	data, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &q.entries); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", q.path, err)
+	}
+	for _, entry := range q.entries {
+		if entry.Action == MessageTypeStartTransaction {
+			q.linkLocked(entry)
+		}
+	}
+	q.logger.WithField("messages", len(q.entries)).Info("Restored offline queue")
+	return nil
+}
+
+// saveLocked writes the queue to disk if persistence is enabled.
+// The caller must hold q.mu.
+func (q *messageQueue) saveLocked() {
+	if q.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(q.entries)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(q.path), 0755); err == nil {
+			tmp := q.path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0644); err == nil {
+				err = os.Rename(tmp, q.path)
+			}
+		}
+	}
+	if err != nil {
+		q.logger.WithError(err).Error("Failed to persist offline queue")
+	}
+}
+
+// OfflineQueueMonitor is implemented by clients that hold messages back for
+// replay
+type OfflineQueueMonitor interface {
+	QueuedMessages() int
+}
+
+// QueuedMessages returns the number of messages waiting in the offline queue,
+// including the one being replayed
+func (c *OCPP16Client) QueuedMessages() int {
+	if c.queue == nil {
+		return 0
+	}
+	return c.queue.len()
+}
+
+// shouldQueue reports whether a message must go through the offline queue.
+// Once messages are queued, later ones for queued actions wait behind them so
+// the CSMS receives them in order.
+func (c *OCPP16Client) shouldQueue(action string) bool {
+	if c.queue == nil || !c.queue.accepts(action) {
+		return false
+	}
+	return !c.IsConnected() || c.queue.len() > 0
+}
+
+// enqueue stores a Call for replay once the client is connected
+func (c *OCPP16Client) enqueue(ctx context.Context, msg *OCPP16Message) error {
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if err := c.queue.push(ctx, &queuedMessage{
+		MessageID: msg.MessageID,
+		Action:    msg.Action,
+		Payload:   payload,
+		QueuedAt:  time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"message_id": msg.MessageID,
+		"action":     msg.Action,
+		"queued":     c.queue.len(),
+	}).Debug("Queued OCPP message")
+
+	if c.IsConnected() {
+		c.startReplay()
+	}
+	return nil
+}
+
+// ResumeQueue lets the messages queued while offline be replayed on the
+// current connection, once the CSMS has accepted the BootNotification. Every
+// new connection holds the queue back until it is called again.
+func (c *OCPP16Client) ResumeQueue() {
+	c.mu.Lock()
+	c.queueResumed = c.connected
+	c.mu.Unlock()
+
+	c.startReplay()
+}
+
+// startReplay sends the queued messages once the queue is resumed, unless a
+// replay is already running
+func (c *OCPP16Client) startReplay() {
+	c.mu.RLock()
+	ctx, resumed := c.ctx, c.queueResumed
+	c.mu.RUnlock()
+
+	if !resumed || c.queue == nil || !c.queue.startReplay() {
+		return
+	}
+
+	go c.replayQueue(ctx)
+}
+
+// replayQueue sends queued messages one at a time, waiting for each response
+// before the next so the CSMS receives them in their original order
+func (c *OCPP16Client) replayQueue(ctx context.Context) {
+	c.logger.WithField("messages", c.queue.len()).Info("Replaying offline queue")
+
+	for {
+		entry, ok := c.queue.next()
+		if !ok {
+			c.logger.Info("Offline queue replayed")
+			return
+		}
+		if ctx.Err() != nil || !c.IsConnected() {
+			c.queue.stopReplay()
+			return
+		}
+
+		msg := &OCPP16Message{
+			MessageType: "Call",
+			MessageID:   entry.MessageID,
+			Action:      entry.Action,
+			Payload:     entry.Payload,
+
+			// Validated when it was queued
+			SkipValidation: true,
+		}
+
+		resp, err := c.replayCall(ctx, msg)
+		if err != nil {
+			attempts := c.queue.failed(entry)
+			c.logger.WithError(err).WithFields(logrus.Fields{
+				"message_id": entry.MessageID,
+				"action":     entry.Action,
+				"attempts":   attempts,
+			}).Warn("Failed to replay queued message")
+
+			if attempts < c.config.OfflineQueue.MaxAttempts {
+				if !c.IsConnected() {
+					c.queue.stopReplay()
+					return
+				}
+				continue
+			}
+			c.logger.WithField("message_id", entry.MessageID).Error("Dropping queued message after too many attempts")
+			c.queue.remove(entry.MessageID)
+			continue
+		}
+
+		// The read loop also queues the response for the message handler, in
+		// order with the other messages received
+		c.queue.remove(entry.MessageID)
+		c.recordOfflineTransactionID(entry, resp)
+	}
+}
+
+// replayCall sends a queued Call and waits for its CallResult or CallError
+func (c *OCPP16Client) replayCall(ctx context.Context, msg *OCPP16Message) (*OCPP16Message, error) {
+	pending, err := c.sendCall(ctx, msg, routeToBoth)
+	if err != nil {
+		return nil, err
+	}
+	return c.awaitResponse(ctx, msg, pending)
+}
+
+// recordOfflineTransactionID passes the transaction ID the CSMS assigned to a
+// replayed StartTransaction on to the queued messages of its transaction
+func (c *OCPP16Client) recordOfflineTransactionID(entry *queuedMessage, resp *OCPP16Message) {
+	if entry.Action != MessageTypeStartTransaction {
+		return
+	}
+	if startResp, ok := resp.Payload.(*StartTransactionResponse); ok {
+		c.queue.resolve(entry.MessageID, startResp.TransactionId)
+	}
+}
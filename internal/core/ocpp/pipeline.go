@@ -0,0 +1,250 @@
+package ocpp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Pipeline defaults used when PipelineConfig fields are not set
+const (
+	defaultOutboundQueueSize = 64
+	defaultInboundQueueSize  = 64
+	defaultWriteTimeout      = 10 * time.Second
+)
+
+// PipelineConfig controls the per connection message pipeline: one writer
+// goroutine fed by a bounded outbound queue, and one dispatcher handing
+// received frames to the message handler in order
+type PipelineConfig struct {
+	OutboundQueueSize int           // Frames waiting for the writer before senders block
+	InboundQueueSize  int           // Frames waiting for the handler before reading blocks
+	WriteTimeout      time.Duration // Deadline for writing one frame, also bounds the wait for queue space
+}
+
+// withDefaults fills unset fields with the default values
+func (p PipelineConfig) withDefaults() PipelineConfig {
+	if p.OutboundQueueSize <= 0 {
+		p.OutboundQueueSize = defaultOutboundQueueSize
+	}
+	if p.InboundQueueSize <= 0 {
+		p.InboundQueueSize = defaultInboundQueueSize
+	}
+	if p.WriteTimeout <= 0 {
+		p.WriteTimeout = defaultWriteTimeout
+	}
+	return p
+}
+
+// PipelineStats reports the message pipeline of a client. Queue lengths
+// refer to the current connection, counters accumulate across connections.
+type PipelineStats struct {
+	OutboundQueued    int           `json:"outbound_queued"`
+	MaxOutboundQueued int           `json:"max_outbound_queued"`
+	FramesWritten     int           `json:"frames_written"`
+	WriteErrors       int           `json:"write_errors"`
+	SendWaits         int           `json:"send_waits"`     // Sends that found the outbound queue full
+	SendWaitTime      time.Duration `json:"send_wait_time"` // Total time senders waited for queue space
+	InboundQueued     int           `json:"inbound_queued"`
+	MaxInboundQueued  int           `json:"max_inbound_queued"`
+	FramesDispatched  int           `json:"frames_dispatched"`
+	ReadWaits         int           `json:"read_waits"` // Frames read while the handler was behind by a full queue
+}
+
+// PipelineMonitor is implemented by clients that report pipeline statistics
+type PipelineMonitor interface {
+	PipelineStats() PipelineStats
+}
+
+// outboundFrame is a serialized message waiting for the writer
+type outboundFrame struct {
+	data   []byte
+	result chan error // Receives the outcome of the write
+}
+
+// connWriter owns all data frame writes to one connection
+type connWriter struct {
+	conn   *websocket.Conn
+	frames chan outboundFrame
+	stop   chan struct{} // Closed to stop the writer
+	done   chan struct{} // Closed once the writer has exited
+	once   sync.Once
+}
+
+// close stops the writer; queued frames fail with a connection error
+func (w *connWriter) close() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// pipelineCounters holds the accumulated pipeline statistics of a client
+type pipelineCounters struct {
+	stats PipelineStats
+	mu    sync.Mutex
+}
+
+func (p *pipelineCounters) update(fn func(stats *PipelineStats)) {
+	p.mu.Lock()
+	fn(&p.stats)
+	p.mu.Unlock()
+}
+
+// PipelineStats returns the message pipeline statistics of the client
+func (c *OCPP16Client) PipelineStats() PipelineStats {
+	c.pipeline.mu.Lock()
+	stats := c.pipeline.stats
+	c.pipeline.mu.Unlock()
+
+	c.mu.RLock()
+	if c.writer != nil {
+		stats.OutboundQueued = len(c.writer.frames)
+	}
+	if c.inbound != nil {
+		stats.InboundQueued = len(c.inbound)
+	}
+	c.mu.RUnlock()
+	return stats
+}
+
+// startWriter starts the writer goroutine of a new connection
+func (c *OCPP16Client) startWriter(conn *websocket.Conn) *connWriter {
+	w := &connWriter{
+		conn:   conn,
+		frames: make(chan outboundFrame, c.config.Pipeline.OutboundQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.runWriter(w)
+	return w
+}
+
+// runWriter writes queued frames in order until the writer is stopped or a
+// write fails. A failed write leaves the connection unusable, so it is closed
+// and the read loop takes care of reconnecting.
+func (c *OCPP16Client) runWriter(w *connWriter) {
+	defer close(w.done)
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case frame := <-w.frames:
+			w.conn.SetWriteDeadline(time.Now().Add(c.config.Pipeline.WriteTimeout))
+			err := w.conn.WriteMessage(websocket.TextMessage, frame.data)
+
+			c.pipeline.update(func(stats *PipelineStats) {
+				if err != nil {
+					stats.WriteErrors++
+				} else {
+					stats.FramesWritten++
+				}
+			})
+
+			if err != nil {
+				frame.result <- fmt.Errorf("failed to write message: %w", err)
+				c.logger.WithError(err).Warn("Closing connection after failed write")
+				w.conn.Close()
+				return
+			}
+			frame.result <- nil
+		}
+	}
+}
+
+// write queues a frame for the writer and waits until it has been written.
+// When the queue is full the sender blocks for at most the write timeout.
+func (c *OCPP16Client) write(ctx context.Context, w *connWriter, data []byte) error {
+	frame := outboundFrame{data: data, result: make(chan error, 1)}
+
+	select {
+	case w.frames <- frame:
+	default:
+		if err := c.waitForQueueSpace(ctx, w, frame); err != nil {
+			return err
+		}
+	}
+
+	queued := len(w.frames)
+	c.pipeline.update(func(stats *PipelineStats) {
+		if queued > stats.MaxOutboundQueued {
+			stats.MaxOutboundQueued = queued
+		}
+	})
+
+	select {
+	case err := <-frame.result:
+		return err
+	case <-w.done:
+		// The writer may have finished the frame just before exiting
+		select {
+		case err := <-frame.result:
+			return err
+		default:
+			return fmt.Errorf("connection closed before the message was written")
+		}
+	}
+}
+
+// waitForQueueSpace blocks until the frame fits into the full outbound queue
+func (c *OCPP16Client) waitForQueueSpace(ctx context.Context, w *connWriter, frame outboundFrame) error {
+	start := time.Now()
+	defer func() {
+		waited := time.Since(start)
+		c.pipeline.update(func(stats *PipelineStats) {
+			stats.SendWaits++
+			stats.SendWaitTime += waited
+		})
+	}()
+
+	timer := time.NewTimer(c.config.Pipeline.WriteTimeout)
+	defer timer.Stop()
+
+	select {
+	case w.frames <- frame:
+		return nil
+	case <-w.done:
+		return fmt.Errorf("connection closed before the message was written")
+	case <-timer.C:
+		return fmt.Errorf("outbound queue full for %s", c.config.Pipeline.WriteTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queueInbound hands a received frame to the dispatcher, blocking the read
+// loop while the handler is a full queue behind
+func (c *OCPP16Client) queueInbound(ctx context.Context, inbound chan *OCPP16Message, msg *OCPP16Message) bool {
+	select {
+	case inbound <- msg:
+	default:
+		c.pipeline.update(func(stats *PipelineStats) { stats.ReadWaits++ })
+		select {
+		case inbound <- msg:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	queued := len(inbound)
+	c.pipeline.update(func(stats *PipelineStats) {
+		if queued > stats.MaxInboundQueued {
+			stats.MaxInboundQueued = queued
+		}
+	})
+	return true
+}
+
+// dispatchMessages hands received frames to the message handler one at a
+// time, in the order they arrived, until the read loop closes inbound
+func (c *OCPP16Client) dispatchMessages(ctx context.Context, inbound <-chan *OCPP16Message) {
+	for msg := range inbound {
+		if handler := c.currentMessageHandler(); handler != nil {
+			if err := handler.HandleMessage(ctx, msg); err != nil {
+				c.logger.WithError(err).Error("Failed to handle message")
+			}
+		}
+		c.pipeline.update(func(stats *PipelineStats) { stats.FramesDispatched++ })
+	}
+}
@@ -0,0 +1,171 @@
+package ocpp
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestOCPP16Client_DispatchesInOrder(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    const calls = 50
+
+    // Sends a burst of Calls right after connecting
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        for i := 0; i < calls; i++ {
+            conn.WriteJSON([]interface{}{2, fmt.Sprintf("csms-%d", i), MessageTypeClearCache, map[string]interface{}{}})
+        }
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                return
+            }
+        }
+    }))
+    defer server.Close()
+
+    var mu sync.Mutex
+    var order []string
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID: "TEST001",
+        Endpoint:  "ws" + strings.TrimPrefix(server.URL, "http"),
+        Pipeline:  PipelineConfig{InboundQueueSize: 4},
+    }).(*OCPP16Client)
+    client.SetMessageHandler(messageHandlerFunc(func(ctx context.Context, message Message) error {
+        // A slow first handler must not let later frames overtake it
+        if message.GetMessageID() == "csms-0" {
+            time.Sleep(50 * time.Millisecond)
+        }
+        mu.Lock()
+        order = append(order, message.GetMessageID())
+        mu.Unlock()
+        return client.SendCallResult(ctx, message.GetMessageID(), &ClearCacheResponse{Status: "Accepted"})
+    }))
+    require.NoError(t, client.Connect(context.Background()))
+    defer client.Disconnect(context.Background())
+
+    assert.Eventually(t, func() bool {
+        return client.PipelineStats().FramesDispatched == calls
+    }, 2*time.Second, 10*time.Millisecond)
+
+    mu.Lock()
+    defer mu.Unlock()
+    require.Len(t, order, calls)
+    for i, id := range order {
+        assert.Equal(t, fmt.Sprintf("csms-%d", i), id)
+    }
+
+    stats := client.PipelineStats()
+    assert.Equal(t, calls, stats.FramesWritten)
+    assert.LessOrEqual(t, stats.MaxInboundQueued, 4)
+    assert.Positive(t, stats.ReadWaits)
+}
+
+func TestOCPP16Client_ConcurrentCalls(t *testing.T) {
+    server := newTestCSMS(t, func(messageID, action string) []interface{} {
+        return []interface{}{3, messageID, map[string]interface{}{"currentTime": "2024-01-01T00:00:00Z"}}
+    })
+    client := connectTestClient(t, server, 5*time.Second)
+
+    const senders = 100
+    var wg sync.WaitGroup
+    errs := make(chan error, senders)
+    for i := 0; i < senders; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := client.Call(context.Background(), MessageTypeHeartbeat, &HeartbeatRequest{})
+            errs <- err
+        }()
+    }
+
+    // Status checks do not wait for writes in flight
+    for i := 0; i < 10; i++ {
+        assert.True(t, client.IsConnected())
+    }
+
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        assert.NoError(t, err)
+    }
+    stats := client.PipelineStats()
+    assert.Equal(t, senders, stats.FramesWritten)
+    assert.Zero(t, stats.WriteErrors)
+    assert.LessOrEqual(t, stats.MaxOutboundQueued, defaultOutboundQueueSize)
+}
+
+func TestOCPP16Client_WriteTimeoutAndBackpressure(t *testing.T) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    done := make(chan struct{})
+    // Never reads, so large writes stall once the socket buffers are full
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        <-done
+    }))
+    defer server.Close()
+    defer close(done)
+
+    client := NewOCCP16ClientWithConfig(ClientConfig{
+        ChargerID: "TEST001",
+        Endpoint:  "ws" + strings.TrimPrefix(server.URL, "http"),
+        Reconnect: ReconnectConfig{Disabled: true},
+        Pipeline:  PipelineConfig{OutboundQueueSize: 1, WriteTimeout: 200 * time.Millisecond},
+    }).(*OCPP16Client)
+    events := &connectionEvents{disconnected: make(chan error, 1), reconnected: make(chan int, 1)}
+    client.SetConnectionHandler(events)
+    require.NoError(t, client.Connect(context.Background()))
+    defer client.Disconnect(context.Background())
+
+    client.mu.RLock()
+    writer := client.writer
+    client.mu.RUnlock()
+
+    stalled := make(chan error, 1)
+    go func() { stalled <- client.write(context.Background(), writer, make([]byte, 32<<20)) }()
+    time.Sleep(50 * time.Millisecond)
+
+    // One frame fits into the queue, the next has to wait for space
+    results := make(chan error, 2)
+    for i := 0; i < 2; i++ {
+        go func() { results <- client.write(context.Background(), writer, []byte("[]")) }()
+    }
+
+    select {
+    case err := <-stalled:
+        assert.ErrorContains(t, err, "failed to write message")
+    case <-time.After(5 * time.Second):
+        t.Fatal("stalled write did not time out")
+    }
+    for i := 0; i < 2; i++ {
+        assert.Error(t, <-results)
+    }
+
+    select {
+    case <-events.disconnected:
+    case <-time.After(2 * time.Second):
+        t.Fatal("connection was not dropped after the failed write")
+    }
+
+    stats := client.PipelineStats()
+    assert.Equal(t, 1, stats.WriteErrors)
+    assert.Equal(t, 1, stats.SendWaits)
+    assert.Positive(t, stats.SendWaitTime)
+}
@@ -0,0 +1,150 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ocppjProtocol implements Protocol for an OCPP-J dialect. All dialects share
+// the frame codec; they differ in the subprotocol and the payload types.
+type ocppjProtocol struct {
+	dialect Dialect
+}
+
+// NewProtocol returns the Protocol of an OCPP-J dialect
+func NewProtocol(dialect Dialect) Protocol {
+	return &ocppjProtocol{dialect: dialect}
+}
+
+// Version returns the OCPP version of the protocol, e.g. "1.6"
+func (p *ocppjProtocol) Version() string {
+	return p.dialect.Version
+}
+
+// CreateClient creates a client with default settings
+func (p *ocppjProtocol) CreateClient(chargerID, endpoint string) Client {
+	return p.CreateClientWithConfig(ClientConfig{
+		ChargerID: chargerID,
+		Endpoint:  endpoint,
+	})
+}
+
+// CreateClientWithConfig creates a client with full config
+func (p *ocppjProtocol) CreateClientWithConfig(config ClientConfig) Client {
+	return NewClientWithDialect(config, p.dialect)
+}
+
+// ParseMessage decodes an OCPP-J frame into an *OCPP16Message. Call and
+// CallResult payloads are kept as json.RawMessage because their type depends
+// on the action; CallError payloads are decoded into *CallError.
+func (p *ocppjProtocol) ParseMessage(data []byte) (Message, error) {
+	// OCPP-J uses array format: [MessageTypeId, MessageId, ...]
+	var msgArray []json.RawMessage
+	if err := json.Unmarshal(data, &msgArray); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message array: %w", err)
+	}
+
+	if len(msgArray) < 2 {
+		return nil, fmt.Errorf("invalid message format: too few elements")
+	}
+
+	// Parse message type ID
+	var messageTypeID int
+	if err := json.Unmarshal(msgArray[0], &messageTypeID); err != nil {
+		return nil, fmt.Errorf("failed to parse message type ID: %w", err)
+	}
+
+	// Parse message ID
+	var messageID string
+	if err := json.Unmarshal(msgArray[1], &messageID); err != nil {
+		return nil, fmt.Errorf("failed to parse message ID: %w", err)
+	}
+
+	msg := &OCPP16Message{
+		MessageID: messageID,
+	}
+
+	switch messageTypeID {
+	case 2: // Call
+		if len(msgArray) < 4 {
+			return nil, fmt.Errorf("invalid Call message format")
+		}
+
+		var action string
+		if err := json.Unmarshal(msgArray[2], &action); err != nil {
+			return nil, fmt.Errorf("failed to parse action: %w", err)
+		}
+
+		msg.MessageType = "Call"
+		msg.Action = action
+		msg.Payload = msgArray[3]
+
+	case 3: // CallResult
+		if len(msgArray) < 3 {
+			return nil, fmt.Errorf("invalid CallResult message format")
+		}
+
+		msg.MessageType = "CallResult"
+		msg.Payload = msgArray[2]
+
+	case 4: // CallError
+		if len(msgArray) < 5 {
+			return nil, fmt.Errorf("invalid CallError message format")
+		}
+
+		msg.MessageType = "CallError"
+		callErr := &CallError{ErrorDetails: msgArray[4]}
+		json.Unmarshal(msgArray[2], &callErr.ErrorCode)
+		json.Unmarshal(msgArray[3], &callErr.ErrorDescription)
+
+		msg.Payload = callErr
+
+	default:
+		return nil, fmt.Errorf("unknown message type ID: %d", messageTypeID)
+	}
+
+	return msg, nil
+}
+
+// SerializeMessage encodes an *OCPP16Message as OCPP-J frame. The message is
+// not validated, so malformed frames can be crafted on purpose.
+func (p *ocppjProtocol) SerializeMessage(message Message) ([]byte, error) {
+	msg, ok := message.(*OCPP16Message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message type %T", message)
+	}
+
+	var frame []interface{}
+	switch msg.MessageType {
+	case "Call":
+		// [MessageTypeId, MessageId, Action, Payload]
+		frame = []interface{}{2, msg.MessageID, msg.Action, msg.Payload}
+
+	case "CallResult":
+		// [MessageTypeId, MessageId, Payload]
+		frame = []interface{}{3, msg.MessageID, msg.Payload}
+
+	case "CallError":
+		callErr, ok := msg.Payload.(*CallError)
+		if !ok {
+			return nil, fmt.Errorf("CallError payload must be *CallError, got %T", msg.Payload)
+		}
+
+		details := callErr.ErrorDetails
+		if len(details) == 0 {
+			details = json.RawMessage("{}")
+		}
+
+		// [MessageTypeId, MessageId, ErrorCode, ErrorDescription, ErrorDetails]
+		frame = []interface{}{4, msg.MessageID, callErr.ErrorCode, callErr.ErrorDescription, details}
+
+	default:
+		return nil, fmt.Errorf("unknown message type: %s", msg.MessageType)
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,67 @@
+package ocpp
+
+import (
+    "encoding/json"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestLookupProtocol(t *testing.T) {
+    protocol, err := LookupProtocol("1.6")
+    require.NoError(t, err)
+    assert.Equal(t, "1.6", protocol.Version())
+    assert.Contains(t, SupportedVersions(), "1.6")
+
+    _, err = LookupProtocol("1.5")
+    assert.ErrorContains(t, err, `unsupported OCPP version "1.5"`)
+
+    assert.Panics(t, func() { RegisterProtocol(NewProtocol(OCPP16)) })
+}
+
+func TestProtocol_SerializeParseRoundTrip(t *testing.T) {
+    protocol := OCPP16Protocol
+
+    frames := []struct {
+        msg  *OCPP16Message
+        want string
+    }{
+        {
+            msg:  &OCPP16Message{MessageType: "Call", MessageID: "1", Action: "Heartbeat", Payload: &HeartbeatRequest{}},
+            want: `[2,"1","Heartbeat",{}]`,
+        },
+        {
+            msg:  &OCPP16Message{MessageType: "CallResult", MessageID: "2", Payload: map[string]string{"status": "Accepted"}},
+            want: `[3,"2",{"status":"Accepted"}]`,
+        },
+        {
+            msg:  &OCPP16Message{MessageType: "CallError", MessageID: "3", Payload: NewCallError(ErrorCodeNotImplemented, "nope")},
+            want: `[4,"3","NotImplemented","nope",{}]`,
+        },
+    }
+
+    for _, frame := range frames {
+        data, err := protocol.SerializeMessage(frame.msg)
+        require.NoError(t, err)
+        assert.JSONEq(t, frame.want, string(data))
+
+        parsed, err := protocol.ParseMessage(data)
+        require.NoError(t, err)
+        msg := parsed.(*OCPP16Message)
+        assert.Equal(t, frame.msg.MessageType, msg.MessageType)
+        assert.Equal(t, frame.msg.MessageID, msg.MessageID)
+        assert.Equal(t, frame.msg.Action, msg.Action)
+    }
+
+    parsed, err := protocol.ParseMessage([]byte(`[4,"3","NotImplemented","nope",{"a":1}]`))
+    require.NoError(t, err)
+    callErr := parsed.(*OCPP16Message).Payload.(*CallError)
+    assert.Equal(t, ErrorCodeNotImplemented, callErr.ErrorCode)
+    assert.Equal(t, json.RawMessage(`{"a":1}`), callErr.ErrorDetails)
+
+    _, err = protocol.SerializeMessage(&OCPP16Message{MessageType: "Bogus"})
+    assert.Error(t, err)
+    _, err = protocol.ParseMessage([]byte(`[9,"1"]`))
+    assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package ocpp
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// Reconnection defaults used when ReconnectConfig fields are not set
+const (
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 60 * time.Second
+	defaultMultiplier     = 2.0
+	defaultJitter         = 0.2
+)
+
+// ReconnectConfig controls how a client reconnects after losing the connection
+type ReconnectConfig struct {
+	Disabled       bool          // Never reconnect automatically
+	InitialBackoff time.Duration // Delay before the first attempt
+	MaxBackoff     time.Duration // Upper bound for the delay between attempts
+	Multiplier     float64       // Growth factor of the delay per failed attempt
+	Jitter         float64       // Random spread of each delay, 0.2 means +/-20%
+	MaxAttempts    int           // Give up after this many attempts, 0 retries forever
+}
+
+// withDefaults fills unset fields with the default values
+func (r ReconnectConfig) withDefaults() ReconnectConfig {
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = defaultInitialBackoff
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = defaultMaxBackoff
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		r.MaxBackoff = r.InitialBackoff
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = defaultMultiplier
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		r.Jitter = defaultJitter
+	}
+	return r
+}
+
+// Backoff returns the delay before the given reconnection attempt (0-based)
+func (r ReconnectConfig) Backoff(attempt int) time.Duration {
+	delay := float64(r.InitialBackoff) * math.Pow(r.Multiplier, float64(attempt))
+	if delay > float64(r.MaxBackoff) {
+		delay = float64(r.MaxBackoff)
+	}
+	if r.Jitter > 0 {
+		delay += delay * r.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// connectionLost is called when the read loop of conn exits. Unless the client
+// was disconnected on purpose, the connection handler is notified and the
+// reconnection supervisor is started.
+func (c *OCPP16Client) connectionLost(ctx context.Context, conn *websocket.Conn, err error) {
+	c.mu.Lock()
+	if c.conn != conn {
+		// Connection was already replaced or closed by Disconnect
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	writer := c.writer
+	c.conn = nil
+	c.writer = nil
+	c.inbound = nil
+	c.connected = false
+	c.queueResumed = false
+	handler := c.connHandler
+	c.mu.Unlock()
+
+	writer.close()
+	conn.Close()
+	c.failPendingCalls()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.logger.WithError(err).Warn("Connection to CSMS lost")
+	if handler != nil {
+		handler.OnDisconnected(err)
+	}
+
+	if c.config.Reconnect.Disabled {
+		return
+	}
+	go c.reconnectLoop(ctx)
+}
+
+// reconnectLoop dials the CSMS with exponential backoff until it succeeds,
+// the attempts are exhausted or the client is disconnected
+func (c *OCPP16Client) reconnectLoop(ctx context.Context) {
+	policy := c.config.Reconnect
+
+	for attempt := 0; policy.MaxAttempts == 0 || attempt < policy.MaxAttempts; attempt++ {
+		delay := policy.Backoff(attempt)
+		c.logger.WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"delay":   delay,
+		}).Info("Reconnecting to CSMS")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		conn, err := c.dial()
+		if err != nil {
+			c.logger.WithError(err).WithField("attempt", attempt+1).Warn("Reconnection attempt failed")
+			continue
+		}
+
+		// Disconnect may have been called while dialing
+		if !c.attach(ctx, conn) {
+			return
+		}
+		c.mu.RLock()
+		handler := c.connHandler
+		c.mu.RUnlock()
+		c.logger.WithField("attempts", attempt+1).Info("Reconnected to CSMS")
+		if handler != nil {
+			handler.OnReconnected(attempt + 1)
+		}
+		return
+	}
+
+	c.logger.WithField("attempts", policy.MaxAttempts).Error("Giving up reconnecting to CSMS")
+}
@@ -0,0 +1,59 @@
+package ocpp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	protocolsMu sync.RWMutex
+	protocols   = make(map[string]Protocol)
+)
+
+// OCPP16Protocol is the protocol of the OCPP 1.6J dialect
+var OCPP16Protocol = NewProtocol(OCPP16)
+
+func init() {
+	RegisterProtocol(OCPP16Protocol)
+}
+
+// RegisterProtocol makes a protocol available under its version. Packages
+// implementing an OCPP version register themselves from init. It panics if
+// the version is registered twice.
+func RegisterProtocol(protocol Protocol) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+
+	version := protocol.Version()
+	if _, exists := protocols[version]; exists {
+		panic(fmt.Sprintf("ocpp: protocol %s registered twice", version))
+	}
+	protocols[version] = protocol
+}
+
+// LookupProtocol returns the protocol registered for an OCPP version
+func LookupProtocol(version string) (Protocol, error) {
+	protocolsMu.RLock()
+	protocol, exists := protocols[version]
+	protocolsMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unsupported OCPP version %q, supported versions: %s", version, strings.Join(SupportedVersions(), ", "))
+	}
+	return protocol, nil
+}
+
+// SupportedVersions returns the registered OCPP versions in ascending order
+func SupportedVersions() []string {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+
+	versions := make([]string, 0, len(protocols))
+	for version := range protocols {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
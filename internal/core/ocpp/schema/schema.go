@@ -0,0 +1,257 @@
+// Package schema validates OCPP payloads against JSON schemas. It supports
+// the subset of JSON Schema draft-04 used by the official OCPP 1.6 schemas:
+// type, properties, required, additionalProperties, enum, maxLength, format
+// (date-time and uri), items, minItems and multipleOf.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keywords reported in violations
+const (
+	KeywordSyntax               = "syntax" // The payload is not valid JSON
+	KeywordType                 = "type"
+	KeywordRequired             = "required"
+	KeywordAdditionalProperties = "additionalProperties"
+	KeywordEnum                 = "enum"
+	KeywordMaxLength            = "maxLength"
+	KeywordFormat               = "format"
+	KeywordMultipleOf           = "multipleOf"
+	KeywordMinItems             = "minItems"
+)
+
+// Schema is a compiled JSON schema
+type Schema struct {
+	Title                string             `json:"title"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	MaxLength            *int               `json:"maxLength"`
+	Format               string             `json:"format"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MultipleOf           *float64           `json:"multipleOf"`
+}
+
+// Violation is a single way in which a payload breaks its schema
+type Violation struct {
+	Path    string `json:"path"` // JSON path of the offending value, e.g. "idTagInfo.status"
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// String returns the violation as "path: message"
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// ValidationError lists every violation found in a payload
+type ValidationError struct {
+	Schema     string      `json:"schema"`
+	Violations []Violation `json:"violations"`
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return fmt.Sprintf("%s does not match its schema: %s", e.Schema, strings.Join(messages, "; "))
+}
+
+// Compile parses a JSON schema document
+func Compile(data []byte) (*Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// Validate checks a JSON payload against the schema. It returns a
+// *ValidationError if the payload does not conform.
+func (s *Schema) Validate(payload []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var violations []Violation
+	if err := decoder.Decode(&value); err != nil {
+		violations = []Violation{{Keyword: KeywordSyntax, Message: err.Error()}}
+	} else {
+		violations = s.validate("", value, nil)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Schema: s.Title, Violations: violations}
+}
+
+// validate appends the violations of value to violations
+func (s *Schema) validate(path string, value interface{}, violations []Violation) []Violation {
+	fail := func(keyword, format string, args ...interface{}) {
+		violations = append(violations, Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		fail(KeywordType, "expected %s, got %s", s.Type, typeOf(value))
+		return violations
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		fail(KeywordEnum, "%v is not one of %v", value, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				violations = append(violations, Violation{
+					Path:    join(path, name),
+					Keyword: KeywordRequired,
+					Message: "required property is missing",
+				})
+			}
+		}
+
+		// Visit properties in a stable order so violations are reproducible
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					violations = append(violations, Violation{
+						Path:    join(path, name),
+						Keyword: KeywordAdditionalProperties,
+						Message: "property is not allowed",
+					})
+				}
+				continue
+			}
+			violations = property.validate(join(path, name), v[name], violations)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail(KeywordMinItems, "%d items, at least %d required", len(v), *s.MinItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				violations = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+			}
+		}
+
+	case string:
+		if s.MaxLength != nil && len([]rune(v)) > *s.MaxLength {
+			fail(KeywordMaxLength, "length %d exceeds %d", len([]rune(v)), *s.MaxLength)
+		}
+		if err := checkFormat(s.Format, v); err != nil {
+			fail(KeywordFormat, "%q is not a valid %s", v, s.Format)
+		}
+
+	case json.Number:
+		if s.MultipleOf != nil {
+			f, _ := v.Float64()
+			quotient := f / *s.MultipleOf
+			if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+				fail(KeywordMultipleOf, "%s is not a multiple of %v", v, *s.MultipleOf)
+			}
+		}
+	}
+
+	return violations
+}
+
+// hasType reports whether a decoded JSON value is of the given schema type
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		if _, err := n.Int64(); err == nil {
+			return true
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	default:
+		return typeOf(value) == schemaType
+	}
+}
+
+// typeOf returns the schema type name of a decoded JSON value
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// inEnum reports whether value equals one of the enum values
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFormat validates the string formats used by the OCPP schemas
+func checkFormat(format, value string) error {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err
+	case "uri":
+		u, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" {
+			return fmt.Errorf("missing scheme")
+		}
+	}
+	return nil
+}
+
+// join appends a property name to a JSON path
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
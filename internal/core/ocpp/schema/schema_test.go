@@ -0,0 +1,86 @@
+package schema
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestOCPP16_HasEveryAction(t *testing.T) {
+    actions := []string{
+        "Authorize", "BootNotification", "CancelReservation", "ChangeAvailability",
+        "ChangeConfiguration", "ClearCache", "ClearChargingProfile", "DataTransfer",
+        "DiagnosticsStatusNotification", "FirmwareStatusNotification", "GetCompositeSchedule",
+        "GetConfiguration", "GetDiagnostics", "GetLocalListVersion", "Heartbeat", "MeterValues",
+        "RemoteStartTransaction", "RemoteStopTransaction", "ReserveNow", "Reset", "SendLocalList",
+        "SetChargingProfile", "StartTransaction", "StatusNotification", "StopTransaction",
+        "TriggerMessage", "UnlockConnector", "UpdateFirmware",
+
+        // Security extension
+        "CertificateSigned", "DeleteCertificate", "ExtendedTriggerMessage", "GetInstalledCertificateIds",
+        "InstallCertificate", "SecurityEventNotification", "SignCertificate",
+        "SignedFirmwareStatusNotification", "SignedUpdateFirmware",
+    }
+
+    for _, action := range actions {
+        for _, name := range []string{action, action + "Response"} {
+            _, ok := OCPP16.Lookup(name)
+            assert.True(t, ok, "missing schema %s", name)
+        }
+    }
+    assert.Len(t, OCPP16.schemas, 2*len(actions))
+}
+
+func TestSchema_Validate(t *testing.T) {
+    tests := []struct {
+        name     string
+        schema   string
+        payload  string
+        keywords []string
+    }{
+        {"valid", "BootNotificationResponse", `{"status":"Accepted","currentTime":"2024-01-01T00:00:00.123Z","interval":300}`, nil},
+        {"missing required", "HeartbeatResponse", `{}`, []string{KeywordRequired}},
+        {"wrong enum", "ResetResponse", `{"status":"OK"}`, []string{KeywordEnum}},
+        {"integer with fraction", "BootNotificationResponse", `{"status":"Accepted","currentTime":"2024-01-01T00:00:00Z","interval":1.5}`, []string{KeywordType}},
+        {"integer as float", "RemoteStopTransaction", `{"transactionId":7.0}`, nil},
+        {"null", "Authorize", `{"idTag":null}`, []string{KeywordType}},
+        {"too long", "Authorize", `{"idTag":"123456789012345678901"}`, []string{KeywordMaxLength}},
+        {"bad date-time", "HeartbeatResponse", `{"currentTime":"yesterday"}`, []string{KeywordFormat}},
+        {"bad uri", "UpdateFirmware", `{"location":"firmware.bin","retrieveDate":"2024-01-01T00:00:00Z"}`, []string{KeywordFormat}},
+        {"unknown property", "ClearCache", `{"force":true}`, []string{KeywordAdditionalProperties}},
+        {"not json", "ClearCache", `{`, []string{KeywordSyntax}},
+        {"empty array", "GetInstalledCertificateIdsResponse", `{"status":"Accepted","certificateHashData":[]}`, []string{KeywordMinItems}},
+        {"nested", "SetChargingProfile", `{"connectorId":1,"csChargingProfiles":{"chargingProfileId":1,"stackLevel":0,
+            "chargingProfilePurpose":"TxProfile","chargingProfileKind":"Absolute",
+            "chargingSchedule":{"chargingRateUnit":"A","chargingSchedulePeriod":[{"startPeriod":0,"limit":16.05}]}}}`, []string{KeywordMultipleOf}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := OCPP16.Validate(tt.schema, []byte(tt.payload))
+            if tt.keywords == nil {
+                assert.NoError(t, err)
+                return
+            }
+
+            validationErr, ok := err.(*ValidationError)
+            require.True(t, ok, "expected *ValidationError, got %v", err)
+            var keywords []string
+            for _, violation := range validationErr.Violations {
+                keywords = append(keywords, violation.Keyword)
+            }
+            assert.Equal(t, tt.keywords, keywords)
+        })
+    }
+}
+
+func TestSchema_ViolationPaths(t *testing.T) {
+    err := OCPP16.Validate("MeterValues", []byte(`{"connectorId":1,"meterValue":[{"timestamp":"2024-01-01T00:00:00Z","sampledValue":[{"value":"1","unit":"kJ"}]}]}`))
+    require.Error(t, err)
+    assert.Equal(t, "meterValue[0].sampledValue[0].unit", err.(*ValidationError).Violations[0].Path)
+    assert.Contains(t, err.Error(), "MeterValuesRequest does not match its schema")
+
+    // Actions without a schema are not validated
+    assert.NoError(t, OCPP16.Validate("VendorAction", []byte(`{"anything":1}`)))
+}
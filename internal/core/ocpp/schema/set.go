@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+//go:embed ocpp16/*.json
+var ocpp16Files embed.FS
+
+// OCPP16 holds the schemas of every OCPP 1.6 action. Request schemas are
+// named after the action, response schemas carry a "Response" suffix.
+var OCPP16 = mustLoad(ocpp16Files, "ocpp16")
+
+// Set is a collection of schemas addressed by name
+type Set struct {
+	schemas map[string]*Schema
+}
+
+// Load compiles every .json file in dir of fsys. Schemas are named after
+// their file name without extension.
+func Load(fsys fs.FS, dir string) (*Set, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{schemas: make(map[string]*Schema)}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		schema, err := Compile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		set.schemas[strings.TrimSuffix(entry.Name(), ".json")] = schema
+	}
+	return set, nil
+}
+
+// mustLoad loads an embedded schema set and panics if it is broken
+func mustLoad(fsys fs.FS, dir string) *Set {
+	set, err := Load(fsys, dir)
+	if err != nil {
+		panic(fmt.Sprintf("schema: loading %s: %v", dir, err))
+	}
+	return set
+}
+
+// Lookup returns the schema with the given name
+func (s *Set) Lookup(name string) (*Schema, bool) {
+	schema, ok := s.schemas[name]
+	return schema, ok
+}
+
+// Validate checks a payload against the named schema. Payloads without a
+// schema, e.g. of vendor specific actions, are accepted.
+func (s *Set) Validate(name string, payload []byte) error {
+	schema, ok := s.schemas[name]
+	if !ok {
+		return nil
+	}
+	return schema.Validate(payload)
+}
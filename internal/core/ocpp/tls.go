@@ -0,0 +1,210 @@
+package ocpp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// OCPP security profiles, see the OCPP 1.6 security whitepaper
+const (
+	SecurityProfileBasicAuth     = 1 // Unsecured transport with basic authentication
+	SecurityProfileTLSBasicAuth  = 2 // TLS with basic authentication
+	SecurityProfileTLSClientCert = 3 // TLS with client side certificates
+)
+
+// ChargerIDPlaceholder is replaced by the charger ID in certificate paths, so
+// chargers created from one template use their own certificates
+const ChargerIDPlaceholder = "{charger_id}"
+
+// TLSConfig configures wss:// connections to the CSMS
+type TLSConfig struct {
+	CACertFile string // PEM bundle trusted for the CSMS certificate, system roots when empty
+	CertFile   string // Client certificate (PEM) for security profile 3
+	KeyFile    string // Private key of the client certificate (PEM)
+
+	// Issue a client certificate with the charger ID as common name from this
+	// CA instead of loading CertFile and KeyFile
+	ClientCACertFile string
+	ClientCAKeyFile  string
+
+	// ClientCertificate returns a certificate installed at runtime, e.g. one
+	// renewed through CertificateSigned. It takes precedence over the
+	// configured certificate when it returns non-nil.
+	ClientCertificate func() *tls.Certificate
+
+	ServerName         string // SNI and verified host name, defaults to the endpoint host
+	MinVersion         uint16 // Lowest TLS version, defaults to TLS 1.2
+	MaxVersion         uint16 // Highest TLS version, defaults to the highest supported
+	InsecureSkipVerify bool   // Accept any CSMS certificate
+}
+
+// HasClientCertificate reports whether a client certificate is configured
+func (t TLSConfig) HasClientCertificate() bool {
+	return (t.CertFile != "" && t.KeyFile != "") || (t.ClientCACertFile != "" && t.ClientCAKeyFile != "")
+}
+
+// clientTLSConfig builds the crypto/tls configuration for a charger
+func (t TLSConfig) clientTLSConfig(chargerID string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		MinVersion:         t.MinVersion,
+		MaxVersion:         t.MaxVersion,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if t.CACertFile != "" {
+		pem, err := os.ReadFile(t.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", t.CACertFile)
+		}
+	}
+
+	switch {
+	case t.ClientCACertFile != "" && t.ClientCAKeyFile != "":
+		ca, err := tls.LoadX509KeyPair(t.ClientCACertFile, t.ClientCAKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client CA: %w", err)
+		}
+		cert, err := IssueClientCertificate(ca, chargerID)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+
+	case t.CertFile != "" && t.KeyFile != "":
+		certFile := strings.ReplaceAll(t.CertFile, ChargerIDPlaceholder, chargerID)
+		keyFile := strings.ReplaceAll(t.KeyFile, ChargerIDPlaceholder, chargerID)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.ClientCertificate != nil {
+		configured := config.Certificates
+		config.Certificates = nil
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := t.ClientCertificate(); cert != nil {
+				return cert, nil
+			}
+			if len(configured) > 0 {
+				return &configured[0], nil
+			}
+			// An empty certificate lets the CSMS decide whether to continue
+			return &tls.Certificate{}, nil
+		}
+	}
+
+	return config, nil
+}
+
+// IssueClientCertificate creates a client certificate for a charger signed by
+// a CA. The charger ID becomes the common name, as the security whitepaper
+// requires for security profile 3.
+func IssueClientCertificate(ca tls.Certificate, chargerID string) (tls.Certificate, error) {
+	if len(ca.Certificate) == 0 {
+		return tls.Certificate{}, fmt.Errorf("CA certificate is empty")
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	caKey, ok := ca.PrivateKey.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("CA key of type %T cannot sign", ca.PrivateKey)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   chargerID,
+			Organization: caCert.Subject.Organization,
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(1, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to issue client certificate: %w", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der, caCert.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+// ValidateSecurityProfile checks that a connection satisfies the requirements
+// of an OCPP security profile. Profile 0 leaves the connection unchecked.
+func ValidateSecurityProfile(profile int, endpoint string, basicAuth, clientCert bool) error {
+	if profile == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL: %w", err)
+	}
+	secure := u.Scheme == "wss"
+
+	switch profile {
+	case SecurityProfileBasicAuth:
+		if !basicAuth {
+			return fmt.Errorf("security profile 1 requires basic auth credentials")
+		}
+	case SecurityProfileTLSBasicAuth:
+		if !secure {
+			return fmt.Errorf("security profile 2 requires a wss:// endpoint")
+		}
+		if !basicAuth {
+			return fmt.Errorf("security profile 2 requires basic auth credentials")
+		}
+	case SecurityProfileTLSClientCert:
+		if !secure {
+			return fmt.Errorf("security profile 3 requires a wss:// endpoint")
+		}
+		if !clientCert {
+			return fmt.Errorf("security profile 3 requires a client certificate")
+		}
+	default:
+		return fmt.Errorf("unknown security profile %d", profile)
+	}
+	return nil
+}
+
+// validateSecurity checks the client config against its security profile
+func (c ClientConfig) validateSecurity() error {
+	return ValidateSecurityProfile(c.SecurityProfile, c.Endpoint,
+		c.BasicAuthUser != "" && c.BasicAuthPass != "", c.TLS.HasClientCertificate())
+}
@@ -0,0 +1,215 @@
+package ocpp
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// writeTestCA creates a self-signed CA and writes its certificate and key to dir
+func writeTestCA(t *testing.T, dir string) (tls.Certificate, string, string) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    require.NoError(t, err)
+    template := &x509.Certificate{
+        SerialNumber:          big.NewInt(1),
+        Subject:               pkix.Name{CommonName: "Test CA", Organization: []string{"Test CPO"}},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().Add(time.Hour),
+        KeyUsage:              x509.KeyUsageCertSign,
+        BasicConstraintsValid: true,
+        IsCA:                  true,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+    require.NoError(t, err)
+
+    certFile := writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+    keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+    require.NoError(t, err)
+    keyFile := writePEM(t, filepath.Join(dir, "ca-key.pem"), "PRIVATE KEY", keyDER)
+
+    ca, err := tls.LoadX509KeyPair(certFile, keyFile)
+    require.NoError(t, err)
+    return ca, certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+    require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+    return path
+}
+
+// newTestTLSCSMS starts a wss:// CSMS that reports the TLS state of every
+// connection and trusts client certificates issued by clientCAs
+func newTestTLSCSMS(t *testing.T, clientCAs *x509.CertPool) (*httptest.Server, string, chan *http.Request) {
+    upgrader := websocket.Upgrader{Subprotocols: []string{"ocpp1.6"}}
+    requests := make(chan *http.Request, 4)
+
+    server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requests <- r
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                return
+            }
+        }
+    }))
+    server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+    if clientCAs != nil {
+        server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+        server.TLS.ClientCAs = clientCAs
+    }
+    server.StartTLS()
+    t.Cleanup(server.Close)
+
+    caFile := writePEM(t, filepath.Join(t.TempDir(), "csms.pem"), "CERTIFICATE", server.Certificate().Raw)
+    return server, caFile, requests
+}
+
+func connectTLSClient(config ClientConfig) (*OCPP16Client, error) {
+    client := NewOCCP16ClientWithConfig(config).(*OCPP16Client)
+    if err := client.Connect(context.Background()); err != nil {
+        return nil, err
+    }
+    return client, nil
+}
+
+func TestOCPP16Client_SecurityProfile2(t *testing.T) {
+    server, caFile, requests := newTestTLSCSMS(t, nil)
+    endpoint := "wss" + strings.TrimPrefix(server.URL, "https")
+
+    client, err := connectTLSClient(ClientConfig{
+        ChargerID:       "CP001",
+        Endpoint:        endpoint,
+        BasicAuthUser:   "CP001",
+        BasicAuthPass:   "secret",
+        SecurityProfile: SecurityProfileTLSBasicAuth,
+        TLS:             TLSConfig{CACertFile: caFile, ServerName: "example.com"},
+    })
+    require.NoError(t, err)
+    defer client.Disconnect(context.Background())
+
+    r := <-requests
+    require.NotNil(t, r.TLS)
+    assert.Equal(t, "example.com", r.TLS.ServerName)
+    assert.Equal(t, uint16(tls.VersionTLS12), r.TLS.Version)
+    user, pass, ok := r.BasicAuth()
+    assert.True(t, ok)
+    assert.Equal(t, "CP001", user)
+    assert.Equal(t, "secret", pass)
+
+    // The CSMS certificate must be trusted and match the server name
+    _, err = connectTLSClient(ClientConfig{ChargerID: "CP001", Endpoint: endpoint})
+    assert.Error(t, err)
+    _, err = connectTLSClient(ClientConfig{ChargerID: "CP001", Endpoint: endpoint, TLS: TLSConfig{CACertFile: caFile, ServerName: "csms.invalid"}})
+    assert.Error(t, err)
+
+    // The CSMS only speaks TLS 1.2
+    _, err = connectTLSClient(ClientConfig{ChargerID: "CP001", Endpoint: endpoint, TLS: TLSConfig{CACertFile: caFile, MinVersion: tls.VersionTLS13}})
+    assert.Error(t, err)
+}
+
+func TestOCPP16Client_SecurityProfile3(t *testing.T) {
+    dir := t.TempDir()
+    ca, caCertFile, caKeyFile := writeTestCA(t, dir)
+    caCert, err := x509.ParseCertificate(ca.Certificate[0])
+    require.NoError(t, err)
+    clientCAs := x509.NewCertPool()
+    clientCAs.AddCert(caCert)
+
+    server, caFile, requests := newTestTLSCSMS(t, clientCAs)
+    endpoint := "wss" + strings.TrimPrefix(server.URL, "https")
+
+    // Certificates issued on the fly from the test CA
+    client, err := connectTLSClient(ClientConfig{
+        ChargerID:       "CP001",
+        Endpoint:        endpoint,
+        SecurityProfile: SecurityProfileTLSClientCert,
+        TLS:             TLSConfig{CACertFile: caFile, ClientCACertFile: caCertFile, ClientCAKeyFile: caKeyFile},
+    })
+    require.NoError(t, err)
+    client.Disconnect(context.Background())
+
+    r := <-requests
+    require.Len(t, r.TLS.PeerCertificates, 2)
+    assert.Equal(t, "CP001", r.TLS.PeerCertificates[0].Subject.CommonName)
+    assert.Equal(t, []string{"Test CPO"}, r.TLS.PeerCertificates[0].Subject.Organization)
+
+    // Per charger certificate files
+    cert, err := IssueClientCertificate(ca, "CP002")
+    require.NoError(t, err)
+    writePEM(t, filepath.Join(dir, "CP002.pem"), "CERTIFICATE", cert.Certificate[0])
+    keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+    require.NoError(t, err)
+    writePEM(t, filepath.Join(dir, "CP002-key.pem"), "PRIVATE KEY", keyDER)
+
+    client, err = connectTLSClient(ClientConfig{
+        ChargerID:       "CP002",
+        Endpoint:        endpoint,
+        SecurityProfile: SecurityProfileTLSClientCert,
+        TLS: TLSConfig{
+            CACertFile: caFile,
+            CertFile:   filepath.Join(dir, ChargerIDPlaceholder+".pem"),
+            KeyFile:    filepath.Join(dir, ChargerIDPlaceholder+"-key.pem"),
+        },
+    })
+    require.NoError(t, err)
+    client.Disconnect(context.Background())
+    assert.Equal(t, "CP002", (<-requests).TLS.PeerCertificates[0].Subject.CommonName)
+
+    // Certificates installed at runtime take precedence over configured ones
+    renewed, err := IssueClientCertificate(ca, "CP002-renewed")
+    require.NoError(t, err)
+    client, err = connectTLSClient(ClientConfig{
+        ChargerID:       "CP002",
+        Endpoint:        endpoint,
+        SecurityProfile: SecurityProfileTLSClientCert,
+        TLS: TLSConfig{
+            CACertFile:        caFile,
+            ClientCACertFile:  caCertFile,
+            ClientCAKeyFile:   caKeyFile,
+            ClientCertificate: func() *tls.Certificate { return &renewed },
+        },
+    })
+    require.NoError(t, err)
+    client.Disconnect(context.Background())
+    assert.Equal(t, "CP002-renewed", (<-requests).TLS.PeerCertificates[0].Subject.CommonName)
+
+    // The CSMS rejects chargers without a certificate
+    _, err = connectTLSClient(ClientConfig{ChargerID: "CP003", Endpoint: endpoint, TLS: TLSConfig{CACertFile: caFile}})
+    assert.Error(t, err)
+}
+
+func TestValidateSecurityProfile(t *testing.T) {
+    assert.NoError(t, ValidateSecurityProfile(0, "ws://csms/ocpp", false, false))
+    assert.NoError(t, ValidateSecurityProfile(1, "ws://csms/ocpp", true, false))
+    assert.Error(t, ValidateSecurityProfile(1, "ws://csms/ocpp", false, false))
+    assert.NoError(t, ValidateSecurityProfile(2, "wss://csms/ocpp", true, false))
+    assert.ErrorContains(t, ValidateSecurityProfile(2, "ws://csms/ocpp", true, false), "wss://")
+    assert.ErrorContains(t, ValidateSecurityProfile(3, "wss://csms/ocpp", true, false), "client certificate")
+    assert.NoError(t, ValidateSecurityProfile(3, "wss://csms/ocpp", false, true))
+    assert.Error(t, ValidateSecurityProfile(4, "wss://csms/ocpp", true, true))
+
+    // Connect refuses endpoints that do not satisfy the profile
+    _, err := connectTLSClient(ClientConfig{ChargerID: "CP001", Endpoint: "ws://localhost:1/ocpp", SecurityProfile: SecurityProfileTLSBasicAuth})
+    assert.ErrorContains(t, err, "security profile 2")
+}
@@ -0,0 +1,145 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaValidationConfig controls the validation of payloads against the
+// JSON schemas of the dialect. CSMS payloads are validated strictly: an
+// invalid CallResult fails the Call and an invalid Call is answered with a
+// CallError.
+type SchemaValidationConfig struct {
+	Disabled     bool // Validate neither incoming nor outgoing payloads
+	SkipOutgoing bool // Send payloads without validating them, e.g. to inject invalid messages
+}
+
+// Directions of a SchemaViolation
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// SchemaViolation describes a payload that does not conform to the JSON
+// schema of its action
+type SchemaViolation struct {
+	Direction   string // DirectionIncoming or DirectionOutgoing
+	MessageType string
+	MessageID   string
+	Action      string
+	Err         error // *schema.ValidationError listing the violations
+}
+
+// Error implements the error interface
+func (v *SchemaViolation) Error() string {
+	return fmt.Sprintf("%s %s %s: %v", v.Direction, v.Action, v.MessageType, v.Err)
+}
+
+// Unwrap returns the validation error
+func (v *SchemaViolation) Unwrap() error {
+	return v.Err
+}
+
+// ErrorCode returns the CallError code matching the first violation, e.g.
+// OccurenceConstraintViolation for a missing required property
+func (v *SchemaViolation) ErrorCode() string {
+	var validationErr *schema.ValidationError
+	if !errors.As(v.Err, &validationErr) || len(validationErr.Violations) == 0 {
+		return ErrorCodeFormationViolation
+	}
+
+	switch validationErr.Violations[0].Keyword {
+	case schema.KeywordRequired:
+		return ErrorCodeOccurenceConstraintViolation
+	case schema.KeywordType:
+		return ErrorCodeTypeConstraintViolation
+	case schema.KeywordEnum, schema.KeywordMaxLength, schema.KeywordFormat, schema.KeywordMultipleOf, schema.KeywordMinItems:
+		return ErrorCodePropertyConstraintViolation
+	default:
+		return ErrorCodeFormationViolation
+	}
+}
+
+// CallError returns the CallError answering a Call with the invalid payload
+func (v *SchemaViolation) CallError() *CallError {
+	return NewCallError(v.ErrorCode(), v.Err.Error())
+}
+
+// SchemaViolationHandler is implemented by message handlers that want to be
+// notified about payloads violating their schema
+type SchemaViolationHandler interface {
+	OnSchemaViolation(violation *SchemaViolation)
+}
+
+// ValidatePayload validates an OCPP 1.6 payload against the schema of the
+// action's request or response. Actions without a schema are accepted.
+func ValidatePayload(action string, response bool, payload json.RawMessage) error {
+	name := action
+	if response {
+		name += "Response"
+	}
+	return schema.OCPP16.Validate(name, payload)
+}
+
+// validateIncoming checks the payload of a Call or CallResult received from
+// the CSMS. It returns nil when the payload conforms or is not validated.
+func (c *OCPP16Client) validateIncoming(msg *OCPP16Message, action string) *SchemaViolation {
+	if c.config.SchemaValidation.Disabled {
+		return nil
+	}
+
+	raw, _ := msg.Payload.(json.RawMessage)
+	return c.checkSchema(DirectionIncoming, msg, action, raw)
+}
+
+// validateOutgoing checks the payload of a Call or CallResult before it is
+// sent. Messages flagged with SkipValidation are sent as they are.
+func (c *OCPP16Client) validateOutgoing(msg *OCPP16Message, action string) error {
+	if c.config.SchemaValidation.Disabled || c.config.SchemaValidation.SkipOutgoing || msg.SkipValidation {
+		return nil
+	}
+
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if violation := c.checkSchema(DirectionOutgoing, msg, action, payload); violation != nil {
+		return violation
+	}
+	return nil
+}
+
+// checkSchema validates a payload with the dialect and reports violations to
+// the message handler
+func (c *OCPP16Client) checkSchema(direction string, msg *OCPP16Message, action string, payload []byte) *SchemaViolation {
+	if c.dialect.ValidatePayload == nil || action == "" {
+		return nil
+	}
+
+	err := c.dialect.ValidatePayload(action, msg.MessageType == "CallResult", payload)
+	if err == nil {
+		return nil
+	}
+
+	violation := &SchemaViolation{
+		Direction:   direction,
+		MessageType: msg.MessageType,
+		MessageID:   msg.MessageID,
+		Action:      action,
+		Err:         err,
+	}
+	c.logger.WithError(err).WithFields(logrus.Fields{
+		"direction":  direction,
+		"message_id": msg.MessageID,
+		"action":     action,
+	}).Warn("OCPP payload violates its schema")
+
+	if handler, ok := c.currentMessageHandler().(SchemaViolationHandler); ok {
+		handler.OnSchemaViolation(violation)
+	}
+	return violation
+}
@@ -2,6 +2,7 @@ package simulation
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -18,23 +19,53 @@ type Engine struct {
 	config         *config.Config
 	db             storage.Database
 	eventBus       eventbus.EventBus
-	chargers       map[string]*charger.VirtualCharger
+	chargers       map[string]charger.Charger // All chargers by ID, unique across simulations
+	simulations    map[uint]*simulation       // The running simulations
 	scenarioLoader *ScenarioLoader
+	newCharger     func(config charger.ChargerConfig, eventBus eventbus.EventBus) (charger.Charger, error)
 	mu             sync.RWMutex
 	logger         *logrus.Logger
 }
 
+// simulationStopTimeout bounds stopping the chargers of a finished simulation
+const simulationStopTimeout = 30 * time.Second
+
+// simulation is a running simulation and the chargers its timeline created
+type simulation struct {
+	config   *SimulationConfig
+	chargers map[string]charger.Charger
+}
+
+func newSimulation(config *SimulationConfig) *simulation {
+	return &simulation{config: config, chargers: make(map[string]charger.Charger)}
+}
+
 // NewEngine creates a new simulation engine
 func NewEngine(cfg *config.Config, db storage.Database) *Engine {
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel) // TODO: Set from config
 
+	scenarioLoader := NewScenarioLoader("./examples")
+	if cfg != nil {
+		reconnect := cfg.OCPP.Reconnect
+		scenarioLoader.SetDefaultReconnectPolicy(charger.ReconnectPolicy{
+			Disabled:       reconnect.Disabled,
+			InitialBackoff: reconnect.InitialBackoff,
+			MaxBackoff:     reconnect.MaxBackoff,
+			Multiplier:     reconnect.Multiplier,
+			Jitter:         reconnect.Jitter,
+			MaxAttempts:    reconnect.MaxAttempts,
+		})
+	}
+
 	return &Engine{
 		config:         cfg,
 		db:             db,
 		eventBus:       eventbus.NewInMemoryBus(),
-		chargers:       make(map[string]*charger.VirtualCharger),
-		scenarioLoader: NewScenarioLoader("./examples"),
+		chargers:       make(map[string]charger.Charger),
+		simulations:    make(map[uint]*simulation),
+		scenarioLoader: scenarioLoader,
+		newCharger:     charger.New,
 		logger:         logger,
 	}
 }
@@ -93,16 +124,39 @@ func (e *Engine) StartSimulation(ctx context.Context, simulationID uint) error {
 	return fmt.Errorf("not implemented")
 }
 
-// StopSimulation stops a simulation
+// StopSimulation stops a simulation and its chargers
 func (e *Engine) StopSimulation(ctx context.Context, simulationID uint) error {
 	e.logger.WithField("simulation_id", simulationID).Info("Stopping simulation")
 
-	// TODO: Implement simulation stop logic
-	// - Stop all chargers in simulation
-	// - Update simulation status
-	// - Clean up resources
+	e.mu.Lock()
+	sim, exists := e.simulations[simulationID]
+	if exists {
+		delete(e.simulations, simulationID)
+		for id := range sim.chargers {
+			delete(e.chargers, id)
+		}
+	}
+	e.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("simulation %d is not running", simulationID)
+	}
 
-	return fmt.Errorf("not implemented")
+	// Chargers shut down concurrently, those failing to stop are logged
+	var wg sync.WaitGroup
+	for _, c := range sim.chargers {
+		wg.Add(1)
+		go func(c charger.Charger) {
+			defer wg.Done()
+			if err := c.Stop(ctx); err != nil {
+				e.logger.WithError(err).WithField("charger_id", c.GetID()).Error("Failed to stop charger")
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// TODO: Update simulation status
+
+	return nil
 }
 
 // GetSimulation retrieves a simulation by ID
@@ -182,6 +236,20 @@ func (e *Engine) executeScenarioTimeline(ctx context.Context, simulationID uint,
 		return fmt.Errorf("failed to start simulation: %w", err)
 	}
 
+	// The chargers of the scenario are created by the timeline and stopped
+	// once the scenario ends
+	started := time.Now()
+	e.mu.Lock()
+	e.simulations[simulationID] = newSimulation(e.scenarioLoader.ConvertToSimulationConfig(scenario))
+	e.mu.Unlock()
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), simulationStopTimeout)
+		defer cancel()
+		if err := e.StopSimulation(stopCtx, simulationID); err != nil {
+			e.logger.WithError(err).WithField("simulation_id", simulationID).Error("Failed to stop simulation")
+		}
+	}()
+
 	// Execute timeline events
 	for _, event := range scenario.Timeline {
 		select {
@@ -199,6 +267,15 @@ func (e *Engine) executeScenarioTimeline(ctx context.Context, simulationID uint,
 	}
 
 	e.logger.Info("Scenario timeline execution completed")
+
+	// The chargers keep running until the scenario duration has passed
+	if scenario.Duration > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(started.Add(time.Duration(scenario.Duration) * time.Second))):
+		}
+	}
 	return nil
 }
 
@@ -218,15 +295,106 @@ func (e *Engine) executeTimelineEvent(ctx context.Context, simulationID uint, ev
 		return e.handleInjectChaosEvent(ctx, simulationID, event)
 	case "start_flow":
 		return e.handleStartFlowEvent(ctx, simulationID, event)
+	case "honor_reservations", "ignore_reservations":
+		return e.handleReservationDriversEvent(ctx, simulationID, event)
+	case "firmware_faults":
+		return e.handleFirmwareFaultsEvent(ctx, simulationID, event)
+	case "reboot_chargers":
+		return e.handleRebootChargersEvent(ctx, simulationID, event)
 	default:
 		return fmt.Errorf("unknown timeline action: %s", event.Action)
 	}
 }
 
-// handleCreateChargersEvent handles charger creation events
+// handleCreateChargersEvent creates the chargers of a simulation from its
+// template and starts them. The "count" param defaults to the charger count
+// of the scenario, the "prefix" of the charger IDs to "CP".
 func (e *Engine) handleCreateChargersEvent(ctx context.Context, simulationID uint, event *TimelineEvent) error {
-	// TODO: Implement charger creation based on event parameters
-	e.logger.Info("Creating chargers (placeholder)")
+	e.mu.RLock()
+	sim, exists := e.simulations[simulationID]
+	e.mu.RUnlock()
+	if !exists || len(sim.config.Chargers) == 0 {
+		return fmt.Errorf("simulation %d has no charger template", simulationID)
+	}
+	templates := sim.config.Chargers
+
+	params := struct {
+		Count  int    `json:"count"`
+		Prefix string `json:"prefix"`
+	}{Count: len(templates), Prefix: "CP"}
+	data, err := json.Marshal(event.Params)
+	if err == nil {
+		err = json.Unmarshal(data, &params)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid create_chargers params: %w", err)
+	}
+	if params.Count <= 0 {
+		return fmt.Errorf("create_chargers count must be greater than 0")
+	}
+
+	var created []charger.Charger
+	profiles := make(map[string]*charger.VendorProfile)
+	for i := 0; i < params.Count; i++ {
+		config := templates[i%len(templates)]
+		config.Identifier = fmt.Sprintf("%s%03d", params.Prefix, i+1)
+		config.SerialNumber = fmt.Sprintf("SN%06d", i+1)
+
+		// Vendor profiles are kept by name in the config and loaded once
+		if config.Profile != "" {
+			profile, loaded := profiles[config.Profile]
+			if !loaded {
+				if profile, err = e.scenarioLoader.LoadProfile(config.Profile); err != nil {
+					return fmt.Errorf("failed to create charger %s: %w", config.Identifier, err)
+				}
+				profiles[config.Profile] = profile
+			}
+			config.VendorProfile = *profile
+		}
+
+		c, err := e.newCharger(config, e.eventBus)
+		if err != nil {
+			return fmt.Errorf("failed to create charger %s: %w", config.Identifier, err)
+		}
+		created = append(created, c)
+	}
+
+	// Charger IDs identify the chargers at the CSMS, so none may be taken by
+	// a charger of this or another simulation
+	e.mu.Lock()
+	if e.simulations[simulationID] != sim {
+		e.mu.Unlock()
+		return fmt.Errorf("simulation %d has been stopped", simulationID)
+	}
+	for _, c := range created {
+		if _, exists := e.chargers[c.GetID()]; exists {
+			e.mu.Unlock()
+			return fmt.Errorf("charger %s already exists", c.GetID())
+		}
+	}
+	for _, c := range created {
+		e.chargers[c.GetID()] = c
+		sim.chargers[c.GetID()] = c
+	}
+	e.mu.Unlock()
+
+	// Chargers boot concurrently, those failing to connect are logged
+	var wg sync.WaitGroup
+	for _, c := range created {
+		wg.Add(1)
+		go func(c charger.Charger) {
+			defer wg.Done()
+			if err := c.Start(ctx); err != nil {
+				e.logger.WithError(err).WithField("charger_id", c.GetID()).Error("Failed to start charger")
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	e.logger.WithFields(logrus.Fields{
+		"simulation_id": simulationID,
+		"chargers":      len(created),
+	}).Info("Created chargers")
 	return nil
 }
 
@@ -250,3 +418,116 @@ func (e *Engine) handleStartFlowEvent(ctx context.Context, simulationID uint, ev
 	e.logger.WithField("flow_steps", len(event.Flow)).Info("Starting flow execution (placeholder)")
 	return nil
 }
+
+// simulationChargers returns the chargers created by a running simulation
+func (e *Engine) simulationChargers(simulationID uint) ([]charger.Charger, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	sim, exists := e.simulations[simulationID]
+	if !exists {
+		return nil, fmt.Errorf("simulation %d is not running", simulationID)
+	}
+	chargers := make([]charger.Charger, 0, len(sim.chargers))
+	for _, c := range sim.chargers {
+		chargers = append(chargers, c)
+	}
+	return chargers, nil
+}
+
+// handleReservationDriversEvent makes the drivers of every charger of the
+// simulation honor or ignore the reservations made by the CSMS
+func (e *Engine) handleReservationDriversEvent(ctx context.Context, simulationID uint, event *TimelineEvent) error {
+	ignore := event.Action == "ignore_reservations"
+
+	chargers, err := e.simulationChargers(simulationID)
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, c := range chargers {
+		if drivers, ok := c.(charger.ReservationDrivers); ok {
+			drivers.SetIgnoreReservations(ignore)
+			updated++
+		}
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"ignore_reservations": ignore,
+		"chargers":            updated,
+	}).Info("Changed how drivers treat reservations")
+	return nil
+}
+
+// handleFirmwareFaultsEvent replaces the faults injected into firmware
+// updates and diagnostics uploads of every charger of the simulation. The params hold the
+// fields of the firmware block, missing ones clear that fault.
+func (e *Engine) handleFirmwareFaultsEvent(ctx context.Context, simulationID uint, event *TimelineEvent) error {
+	var behavior charger.FirmwareBehavior
+	params, err := json.Marshal(event.Params)
+	if err == nil {
+		err = json.Unmarshal(params, &behavior)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid firmware_faults params: %w", err)
+	}
+
+	chargers, err := e.simulationChargers(simulationID)
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, c := range chargers {
+		if faults, ok := c.(charger.FirmwareFaults); ok {
+			faults.SetFirmwareBehavior(behavior)
+			updated++
+		}
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"download_failure":    behavior.DownloadFailure,
+		"corrupt_image":       behavior.CorruptImage,
+		"brick_after_install": behavior.BrickAfterInstall,
+		"upload_failure":      behavior.UploadFailure,
+		"chargers":            updated,
+	}).Info("Changed firmware faults")
+	return nil
+}
+
+// handleRebootChargersEvent power-cycles every charger of the simulation. The "type" param is
+// "Hard" (default), a power cut, or "Soft". Chargers reboot concurrently and
+// the timeline does not wait for them to come back.
+func (e *Engine) handleRebootChargersEvent(ctx context.Context, simulationID uint, event *TimelineEvent) error {
+	resetType := charger.ResetHard
+	if value, ok := event.Params["type"]; ok {
+		resetType = charger.ResetType(fmt.Sprint(value))
+	}
+	if resetType != charger.ResetHard && resetType != charger.ResetSoft {
+		return fmt.Errorf("invalid reboot_chargers type: %s", resetType)
+	}
+
+	chargers, err := e.simulationChargers(simulationID)
+	if err != nil {
+		return err
+	}
+
+	rebooted := 0
+	for _, c := range chargers {
+		if power, ok := c.(charger.PowerCycling); ok {
+			go func(id string, power charger.PowerCycling) {
+				if err := power.Reboot(resetType); err != nil {
+					e.logger.WithError(err).WithField("charger_id", id).Error("Failed to reboot charger")
+				}
+			}(c.GetID(), power)
+			rebooted++
+		}
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"type":     resetType,
+		"chargers": rebooted,
+	}).Info("Rebooting chargers")
+	return nil
+}
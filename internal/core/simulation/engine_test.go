@@ -0,0 +1,240 @@
+package simulation
+
+import (
+    "context"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/charger"
+    "github.com/HackStrix/ocpp-chaos-simulator/pkg/event-bus"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// fakeCharger records what the timeline actions do to a charger. Methods the
+// engine does not call are left to the embedded nil interface.
+type fakeCharger struct {
+    charger.Charger
+    config  charger.ChargerConfig
+    mu      sync.Mutex
+    started bool
+    stopped bool
+    // ignoreReservations is the last value set by the reservation actions
+    ignoreReservations *bool
+    firmware           charger.FirmwareBehavior
+    reboots            []charger.ResetType
+}
+
+func (c *fakeCharger) GetID() string { return c.config.Identifier }
+
+func (c *fakeCharger) Start(ctx context.Context) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.started = true
+    return nil
+}
+
+func (c *fakeCharger) Stop(ctx context.Context) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.stopped = true
+    return nil
+}
+
+func (c *fakeCharger) SetIgnoreReservations(ignore bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.ignoreReservations = &ignore
+}
+
+func (c *fakeCharger) SetFirmwareBehavior(behavior charger.FirmwareBehavior) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.firmware = behavior
+}
+
+func (c *fakeCharger) Reboot(resetType charger.ResetType) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.reboots = append(c.reboots, resetType)
+    return nil
+}
+
+func (c *fakeCharger) rebootTypes() []charger.ResetType {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return append([]charger.ResetType(nil), c.reboots...)
+}
+
+// newTestEngine returns an engine creating fake chargers for simulations 1
+// and 2, whose templates have two chargers
+func newTestEngine() *Engine {
+    e := NewEngine(nil, nil)
+    e.newCharger = func(config charger.ChargerConfig, eventBus eventbus.EventBus) (charger.Charger, error) {
+        return &fakeCharger{config: config}, nil
+    }
+    for _, id := range []uint{1, 2} {
+        e.simulations[id] = newSimulation(&SimulationConfig{Chargers: []charger.ChargerConfig{
+            {Model: "TestCharger", OCPPVersion: "1.6"},
+            {Model: "TestCharger", OCPPVersion: "1.6"},
+        }})
+    }
+    return e
+}
+
+// createChargers runs a create_chargers action of simulation 1 and returns
+// its chargers
+func createChargers(t *testing.T, e *Engine, params map[string]interface{}) []*fakeCharger {
+    return createSimulationChargers(t, e, 1, params)
+}
+
+// createSimulationChargers runs a create_chargers action of a simulation and
+// returns its chargers
+func createSimulationChargers(t *testing.T, e *Engine, simulationID uint, params map[string]interface{}) []*fakeCharger {
+    require.NoError(t, e.executeTimelineEvent(context.Background(), simulationID, &TimelineEvent{Action: "create_chargers", Params: params}))
+
+    e.mu.RLock()
+    defer e.mu.RUnlock()
+    var chargers []*fakeCharger
+    for _, c := range e.simulations[simulationID].chargers {
+        chargers = append(chargers, c.(*fakeCharger))
+    }
+    return chargers
+}
+
+func TestEngine_CreateChargers(t *testing.T) {
+    e := newTestEngine()
+
+    chargers := createChargers(t, e, map[string]interface{}{"count": 3, "prefix": "AUTH"})
+    require.Len(t, chargers, 3)
+    for _, id := range []string{"AUTH001", "AUTH002", "AUTH003"} {
+        require.Contains(t, e.chargers, id)
+        c := e.chargers[id].(*fakeCharger)
+        assert.True(t, c.started)
+        assert.Equal(t, "TestCharger", c.config.Model)
+    }
+
+    // The scenario charger count and the CP prefix are the defaults
+    e = newTestEngine()
+    createChargers(t, e, nil)
+    assert.Len(t, e.chargers, 2)
+    assert.Contains(t, e.chargers, "CP002")
+
+    assert.Error(t, e.executeTimelineEvent(context.Background(), 3, &TimelineEvent{Action: "create_chargers"}))
+}
+
+func TestEngine_ChargersOfSimulations(t *testing.T) {
+    e := newTestEngine()
+    first := createChargers(t, e, nil)
+
+    // Charger IDs are unique across simulations
+    err := e.executeTimelineEvent(context.Background(), 2, &TimelineEvent{Action: "create_chargers"})
+    assert.ErrorContains(t, err, "charger CP001 already exists")
+    assert.Empty(t, e.simulations[2].chargers)
+    second := createSimulationChargers(t, e, 2, map[string]interface{}{"prefix": "EU"})
+    require.Len(t, second, 2)
+
+    // Actions only change the chargers of their simulation
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 2, &TimelineEvent{Action: "ignore_reservations"}))
+    for _, c := range first {
+        assert.Nil(t, c.ignoreReservations)
+    }
+    for _, c := range second {
+        assert.NotNil(t, c.ignoreReservations)
+    }
+
+    // Stopping a simulation stops its chargers and frees their IDs
+    require.NoError(t, e.StopSimulation(context.Background(), 1))
+    for _, c := range first {
+        assert.True(t, c.stopped)
+    }
+    for _, c := range second {
+        assert.False(t, c.stopped)
+    }
+    assert.Len(t, e.chargers, 2)
+    assert.NotContains(t, e.simulations, uint(1))
+    assert.Error(t, e.StopSimulation(context.Background(), 1))
+    assert.Error(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{Action: "reboot_chargers"}))
+}
+
+func TestEngine_ReservationDrivers(t *testing.T) {
+    e := newTestEngine()
+    chargers := createChargers(t, e, nil)
+
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{Action: "ignore_reservations"}))
+    for _, c := range chargers {
+        require.NotNil(t, c.ignoreReservations)
+        assert.True(t, *c.ignoreReservations)
+    }
+
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{Action: "honor_reservations"}))
+    for _, c := range chargers {
+        assert.False(t, *c.ignoreReservations)
+    }
+}
+
+func TestEngine_FirmwareFaults(t *testing.T) {
+    e := newTestEngine()
+    chargers := createChargers(t, e, nil)
+
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{
+        Action: "firmware_faults",
+        Params: map[string]interface{}{"corrupt_image": true, "upload_failure": true},
+    }))
+    for _, c := range chargers {
+        assert.Equal(t, charger.FirmwareBehavior{CorruptImage: true, UploadFailure: true}, c.firmware)
+    }
+
+    // Faults missing from the params are cleared
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{
+        Action: "firmware_faults",
+        Params: map[string]interface{}{"download_failure": true},
+    }))
+    for _, c := range chargers {
+        assert.Equal(t, charger.FirmwareBehavior{DownloadFailure: true}, c.firmware)
+    }
+
+    assert.Error(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{
+        Action: "firmware_faults",
+        Params: map[string]interface{}{"corrupt_image": "yes"},
+    }))
+}
+
+func TestEngine_RebootChargers(t *testing.T) {
+    e := newTestEngine()
+    chargers := createChargers(t, e, nil)
+
+    // Chargers reboot in the background, hard unless told otherwise
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{Action: "reboot_chargers"}))
+    require.NoError(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{
+        Action: "reboot_chargers",
+        Params: map[string]interface{}{"type": "Soft"},
+    }))
+    for _, c := range chargers {
+        assert.Eventually(t, func() bool { return len(c.rebootTypes()) == 2 }, time.Second, 10*time.Millisecond)
+        assert.ElementsMatch(t, []charger.ResetType{charger.ResetHard, charger.ResetSoft}, c.rebootTypes())
+    }
+
+    assert.Error(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{
+        Action: "reboot_chargers",
+        Params: map[string]interface{}{"type": "Warm"},
+    }))
+}
+
+func TestEngine_CreateChargersResolvesVendorProfile(t *testing.T) {
+    e := newTestEngine()
+    e.scenarioLoader.SetProfilePath("../../../examples/profiles")
+    for i := range e.simulations[1].config.Chargers {
+        e.simulations[1].config.Chargers[i].Profile = "vendorX-fw2.3"
+    }
+
+    for _, c := range createChargers(t, e, nil) {
+        assert.Equal(t, "vendorX-fw2.3", c.config.VendorProfile.Name)
+        assert.True(t, c.config.VendorProfile.StatusBeforeBoot)
+    }
+
+    e = newTestEngine()
+    e.simulations[1].config.Chargers[0].Profile = "vendorY-fw1.0"
+    assert.ErrorContains(t, e.executeTimelineEvent(context.Background(), 1, &TimelineEvent{Action: "create_chargers"}), "vendor profile")
+}
@@ -6,25 +6,41 @@ import (
 	"path/filepath"
 
 	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/charger"
+	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
 	"gopkg.in/yaml.v3"
 )
 
 // ScenarioLoader handles loading and parsing YAML scenario files
 type ScenarioLoader struct {
-	scenarioPath string
+	scenarioPath     string
+	profilePath      string
+	defaultReconnect charger.ReconnectPolicy
 }
 
 // NewScenarioLoader creates a new scenario loader
 func NewScenarioLoader(scenarioPath string) *ScenarioLoader {
 	return &ScenarioLoader{
 		scenarioPath: scenarioPath,
+		profilePath:  filepath.Join(scenarioPath, "profiles"),
 	}
 }
 
+// SetProfilePath sets the directory vendor profiles are loaded from, the
+// profiles directory next to the scenarios by default
+func (sl *ScenarioLoader) SetProfilePath(profilePath string) {
+	sl.profilePath = profilePath
+}
+
+// SetDefaultReconnectPolicy sets the reconnect policy used for settings a
+// scenario does not specify itself
+func (sl *ScenarioLoader) SetDefaultReconnectPolicy(policy charger.ReconnectPolicy) {
+	sl.defaultReconnect = policy
+}
+
 // LoadScenario loads a scenario from a YAML file
 func (sl *ScenarioLoader) LoadScenario(filename string) (*ScenarioConfig, error) {
 	fullPath := filepath.Join(sl.scenarioPath, filename)
-	
+
 	data, err := ioutil.ReadFile(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read scenario file %s: %w", fullPath, err)
@@ -40,6 +56,10 @@ func (sl *ScenarioLoader) LoadScenario(filename string) (*ScenarioConfig, error)
 		return nil, fmt.Errorf("scenario validation failed: %w", err)
 	}
 
+	if err := sl.checkProfile(&scenario); err != nil {
+		return nil, err
+	}
+
 	return &scenario, nil
 }
 
@@ -54,6 +74,10 @@ func (sl *ScenarioLoader) LoadScenarioFromString(yamlContent string) (*ScenarioC
 		return nil, fmt.Errorf("scenario validation failed: %w", err)
 	}
 
+	if err := sl.checkProfile(&scenario); err != nil {
+		return nil, err
+	}
+
 	return &scenario, nil
 }
 
@@ -81,6 +105,43 @@ func (sl *ScenarioLoader) ListAvailableScenarios() ([]string, error) {
 	return scenarios, nil
 }
 
+// LoadProfile loads a vendor profile by name from <name>.yaml in the
+// profile directory
+func (sl *ScenarioLoader) LoadProfile(name string) (*charger.VendorProfile, error) {
+	if name == "" || filepath.Base(name) != name {
+		return nil, fmt.Errorf("invalid vendor profile name %q", name)
+	}
+
+	fullPath := filepath.Join(sl.profilePath, name+".yaml")
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vendor profile %s: %w", fullPath, err)
+	}
+
+	var profile charger.VendorProfile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse vendor profile %s: %w", name, err)
+	}
+	profile.Name = name
+
+	return &profile, nil
+}
+
+// checkProfile makes sure the vendor profile the charger template names can
+// be loaded; chargers resolve it by name when they are created
+func (sl *ScenarioLoader) checkProfile(scenario *ScenarioConfig) error {
+	name := scenario.Chargers.Template.Profile
+	if name == "" {
+		return nil
+	}
+
+	if _, err := sl.LoadProfile(name); err != nil {
+		return fmt.Errorf("chargers.template.profile: %w", err)
+	}
+
+	return nil
+}
+
 // validateScenario performs basic validation on a scenario
 func (sl *ScenarioLoader) validateScenario(scenario *ScenarioConfig) error {
 	if scenario.Name == "" {
@@ -95,6 +156,33 @@ func (sl *ScenarioLoader) validateScenario(scenario *ScenarioConfig) error {
 		return fmt.Errorf("CSMS endpoint is required")
 	}
 
+	// Scenarios without ocpp_version speak OCPP 1.6
+	if scenario.Chargers.Template.OCPPVersion == "" {
+		scenario.Chargers.Template.OCPPVersion = ocpp.Version16
+	}
+	if _, err := ocpp.LookupProtocol(scenario.Chargers.Template.OCPPVersion); err != nil {
+		return fmt.Errorf("chargers.template.ocpp_version: %w", err)
+	}
+
+	switch scenario.Chargers.Template.CurrentType {
+	case "", charger.CurrentTypeAC, charger.CurrentTypeDC:
+	default:
+		return fmt.Errorf("chargers.template.current_type must be %q or %q", charger.CurrentTypeAC, charger.CurrentTypeDC)
+	}
+
+	if err := scenario.Chargers.Template.MessageIDs.Validate(); err != nil {
+		return fmt.Errorf("chargers.template.message_ids: %w", err)
+	}
+
+	if err := scenario.CSMS.TLS.Validate(); err != nil {
+		return fmt.Errorf("csms.tls: %w", err)
+	}
+	clientCert := scenario.CSMS.TLS.ClientCert != "" || scenario.CSMS.TLS.ClientCACert != ""
+	basicAuth := scenario.CSMS.BasicAuthUser != "" && scenario.CSMS.BasicAuthPass != ""
+	if err := ocpp.ValidateSecurityProfile(scenario.CSMS.SecurityProfile, scenario.CSMS.Endpoint, basicAuth, clientCert); err != nil {
+		return fmt.Errorf("csms.security_profile: %w", err)
+	}
+
 	if scenario.Duration <= 0 {
 		return fmt.Errorf("scenario duration must be greater than 0")
 	}
@@ -104,7 +192,7 @@ func (sl *ScenarioLoader) validateScenario(scenario *ScenarioConfig) error {
 		if event.Action == "" {
 			return fmt.Errorf("timeline event %d: action is required", i)
 		}
-		
+
 		if event.At < 0 {
 			return fmt.Errorf("timeline event %d: 'at' time cannot be negative", i)
 		}
@@ -116,7 +204,8 @@ func (sl *ScenarioLoader) validateScenario(scenario *ScenarioConfig) error {
 // ConvertToSimulationConfig converts a ScenarioConfig to legacy SimulationConfig
 func (sl *ScenarioLoader) ConvertToSimulationConfig(scenario *ScenarioConfig) *SimulationConfig {
 	chargers := make([]charger.ChargerConfig, scenario.Chargers.Count)
-	
+	reconnect := scenario.CSMS.Reconnect.Merge(sl.defaultReconnect)
+
 	for i := 0; i < scenario.Chargers.Count; i++ {
 		chargers[i] = charger.ChargerConfig{
 			Identifier:     fmt.Sprintf("%s%03d", "CP", i+1), // CP001, CP002, etc.
@@ -130,6 +219,27 @@ func (sl *ScenarioLoader) ConvertToSimulationConfig(scenario *ScenarioConfig) *S
 			BasicAuthUser:  scenario.CSMS.BasicAuthUser,
 			BasicAuthPass:  scenario.CSMS.BasicAuthPass,
 			CustomData:     scenario.Chargers.Template.CustomData,
+			Configuration:  scenario.Chargers.Template.Configuration,
+			Boot:           scenario.Chargers.Template.Boot,
+			Reconnect:      reconnect,
+			OfflineQueue:   scenario.Chargers.Template.OfflineQueue,
+			MaxPowerKW:     scenario.Chargers.Template.MaxPowerKW,
+			CurrentType:    scenario.Chargers.Template.CurrentType,
+			EVFleet:        scenario.Chargers.Template.EVFleet,
+
+			SchemaValidation: scenario.Chargers.Template.SchemaValidation,
+			ConnectorStates:  scenario.Chargers.Template.ConnectorStates,
+			Reservations:     scenario.Chargers.Template.Reservations,
+			LocalAuthList:    scenario.Chargers.Template.LocalAuthList,
+			FirmwareVersion:  scenario.Chargers.Template.FirmwareVersion,
+			Firmware:         scenario.Chargers.Template.Firmware,
+			RebootDelay:      scenario.Chargers.Template.RebootDelay,
+			SecurityProfile:  scenario.CSMS.SecurityProfile,
+			TLS:              scenario.CSMS.TLS,
+			Keepalive:        scenario.CSMS.Keepalive,
+			Pipeline:         scenario.CSMS.Pipeline,
+			Profile:          scenario.Chargers.Template.Profile,
+			MessageIDs:       scenario.Chargers.Template.MessageIDs,
 		}
 	}
 
@@ -1,8 +1,10 @@
 package simulation
 
 import (
+    "encoding/json"
     "testing"
     
+    "github.com/HackStrix/ocpp-chaos-simulator/internal/core/charger"
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/require"
 )
@@ -69,6 +71,124 @@ func TestScenarioLoader_ConvertToSimulationConfig(t *testing.T) {
     assert.Equal(t, "CP002", simConfig.Chargers[1].Identifier)
 }
 
+func TestScenarioLoader_ReconnectPolicyDefaults(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    loader.SetDefaultReconnectPolicy(charger.ReconnectPolicy{InitialBackoff: 1, MaxBackoff: 60, Jitter: 0.2})
+    
+    scenario, err := loader.LoadScenarioFromString(`
+name: "Reconnect"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+csms:
+  endpoint: "ws://test:8080/ocpp"
+  reconnect:
+    max_backoff: 5
+    max_attempts: 3
+`)
+    require.NoError(t, err)
+    
+    reconnect := loader.ConvertToSimulationConfig(scenario).Chargers[0].Reconnect
+    assert.Equal(t, 1.0, reconnect.InitialBackoff)
+    assert.Equal(t, 5.0, reconnect.MaxBackoff)
+    assert.Equal(t, 0.2, reconnect.Jitter)
+    assert.Equal(t, 3, reconnect.MaxAttempts)
+}
+
+func TestScenarioLoader_Keepalive(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    scenario, err := loader.LoadScenarioFromString(`
+name: "Keepalive"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+    configuration:
+      WebSocketPingInterval: "20"
+csms:
+  endpoint: "ws://test:8080/ocpp"
+  keepalive:
+    pong_timeout: 10
+    ignore_pings: true
+`)
+    require.NoError(t, err)
+    
+    config := loader.ConvertToSimulationConfig(scenario).Chargers[0]
+    assert.Equal(t, charger.KeepalivePolicy{PongTimeout: 10, IgnorePings: true}, config.Keepalive)
+    assert.Equal(t, "20", config.Configuration["WebSocketPingInterval"])
+}
+
+func TestScenarioLoader_Pipeline(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    scenario, err := loader.LoadScenarioFromString(`
+name: "Pipeline"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+csms:
+  endpoint: "ws://test:8080/ocpp"
+  pipeline:
+    outbound_queue_size: 8
+    write_timeout: 2.5
+`)
+    require.NoError(t, err)
+    
+    pipeline := loader.ConvertToSimulationConfig(scenario).Chargers[0].Pipeline
+    assert.Equal(t, charger.PipelinePolicy{OutboundQueueSize: 8, WriteTimeout: 2.5}, pipeline)
+}
+
+func TestScenarioLoader_EVFleet(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    scenario, err := loader.LoadScenarioFromString(`
+name: "EV Fleet"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+    current_type: "DC"
+    ev_fleet:
+      - name: compact
+        weight: 3
+        battery_capacity_kwh: {min: 40, max: 60}
+        initial_soc: {min: 10, max: 30}
+        target_soc: 80
+        max_dc_power_kw: 50
+      - name: suv
+        battery_capacity_kwh: 100
+csms:
+  endpoint: "ws://test:8080/ocpp"
+`)
+    require.NoError(t, err)
+    
+    config := loader.ConvertToSimulationConfig(scenario).Chargers[0]
+    assert.Equal(t, charger.CurrentTypeDC, config.CurrentType)
+    require.Len(t, config.EVFleet, 2)
+    assert.Equal(t, charger.Range{Min: 40, Max: 60}, config.EVFleet[0].BatteryCapacityKWh)
+    assert.Equal(t, charger.Fixed(80), config.EVFleet[0].TargetSoC)
+    assert.Equal(t, 3.0, config.EVFleet[0].Weight)
+    assert.Equal(t, charger.Fixed(100), config.EVFleet[1].BatteryCapacityKWh)
+    
+    _, err = loader.LoadScenarioFromString(`
+name: "Bad Range"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+    ev_fleet:
+      - initial_soc: {min: 50, max: 20}
+csms:
+  endpoint: "ws://test:8080/ocpp"
+`)
+    assert.Error(t, err)
+}
+
 func TestScenarioLoader_ValidationErrors(t *testing.T) {
     loader := NewScenarioLoader("./examples")
     
@@ -114,3 +234,182 @@ chargers:
         })
     }
 }
+
+func TestScenarioLoader_RejectsUnsupportedOCPPVersion(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    
+    _, err := loader.LoadScenarioFromString(`
+name: "Unsupported"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "2.0"
+csms:
+  endpoint: "ws://test:8080/ocpp"
+`)
+    assert.ErrorContains(t, err, `unsupported OCPP version "2.0"`)
+}
+
+func TestScenarioLoader_DefaultsToOCPP16(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    
+    scenario, err := loader.LoadScenarioFromString(`
+name: "No Version"
+duration: 30
+chargers:
+  count: 1
+  template:
+    model: "TestCharger"
+csms:
+  endpoint: "ws://test:8080/ocpp"
+`)
+    require.NoError(t, err)
+    assert.Equal(t, "1.6", scenario.Chargers.Template.OCPPVersion)
+    assert.Equal(t, "1.6", loader.ConvertToSimulationConfig(scenario).Chargers[0].OCPPVersion)
+}
+
+func TestScenarioLoader_SecurityProfile(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    
+    scenario, err := loader.LoadScenarioFromString(`
+name: "Profile 3"
+duration: 30
+chargers:
+  count: 2
+  template:
+    ocpp_version: "1.6"
+csms:
+  endpoint: "wss://csms.example.com/ocpp"
+  security_profile: 3
+  tls:
+    ca_cert: "certs/csms-ca.pem"
+    client_cert: "certs/{charger_id}.pem"
+    client_key: "certs/{charger_id}-key.pem"
+    server_name: "csms.example.com"
+    min_version: "1.3"
+`)
+    require.NoError(t, err)
+    
+    config := loader.ConvertToSimulationConfig(scenario)
+    assert.Equal(t, 3, config.Chargers[1].SecurityProfile)
+    assert.Equal(t, "certs/{charger_id}.pem", config.Chargers[1].TLS.ClientCert)
+    assert.Equal(t, "1.3", config.Chargers[1].TLS.MinVersion)
+    
+    _, err = loader.LoadScenarioFromString(`
+name: "Profile 3 without certificate"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+csms:
+  endpoint: "wss://csms.example.com/ocpp"
+  security_profile: 3
+`)
+    assert.ErrorContains(t, err, "security profile 3 requires a client certificate")
+    
+    _, err = loader.LoadScenarioFromString(`
+name: "Bad TLS version"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+csms:
+  endpoint: "wss://csms.example.com/ocpp"
+  tls:
+    min_version: "1.4"
+`)
+    assert.ErrorContains(t, err, "csms.tls: min_version")
+}
+
+func TestScenarioLoader_VendorProfile(t *testing.T) {
+    loader := NewScenarioLoader("../../../examples")
+    
+    scenario, err := loader.LoadScenarioFromString(`
+name: "Quirky firmware"
+duration: 30
+chargers:
+  count: 2
+  template:
+    ocpp_version: "1.6"
+    profile: "vendorX-fw2.3"
+csms:
+  endpoint: "ws://localhost:8080/ocpp"
+`)
+    require.NoError(t, err)
+    
+    // Charger configs keep the profile name and round-trip through JSON
+    config := loader.ConvertToSimulationConfig(scenario)
+    assert.Equal(t, "vendorX-fw2.3", config.Chargers[1].Profile)
+    data, err := json.Marshal(config.Chargers[1])
+    require.NoError(t, err)
+    var decoded charger.ChargerConfig
+    require.NoError(t, json.Unmarshal(data, &decoded))
+    assert.Equal(t, config.Chargers[1], decoded)
+    
+    profile, err := loader.LoadProfile(config.Chargers[1].Profile)
+    require.NoError(t, err)
+    assert.Equal(t, "vendorX-fw2.3", profile.Name)
+    assert.True(t, profile.StatusBeforeBoot)
+    assert.True(t, profile.OmitTimestamps)
+    assert.True(t, profile.MeterValuesInKWh)
+    assert.False(t, profile.ReuseMessageIDs)
+    
+    // Profiles are looked up by name in the profile directory only
+    for _, name := range []string{"vendorY-fw1.0", "../basic-auth-example"} {
+        _, err = loader.LoadScenarioFromString(`
+name: "Unknown profile"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+    profile: "` + name + `"
+csms:
+  endpoint: "ws://localhost:8080/ocpp"
+`)
+        assert.ErrorContains(t, err, "chargers.template.profile")
+    }
+    
+    loader.SetProfilePath(t.TempDir())
+    _, err = loader.LoadProfile("vendorX-fw2.3")
+    assert.Error(t, err)
+}
+
+func TestScenarioLoader_MessageIDs(t *testing.T) {
+    loader := NewScenarioLoader("./examples")
+    
+    scenario, err := loader.LoadScenarioFromString(`
+name: "Duplicate message IDs"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+    message_ids:
+      format: "prefixed"
+      duplicate_rate: 0.1
+csms:
+  endpoint: "ws://localhost:8080/ocpp"
+`)
+    require.NoError(t, err)
+    
+    config := loader.ConvertToSimulationConfig(scenario)
+    assert.Equal(t, charger.MessageIDPolicy{Format: "prefixed", DuplicateRate: 0.1}, config.Chargers[0].MessageIDs)
+    
+    _, err = loader.LoadScenarioFromString(`
+name: "Bad reuse rate"
+duration: 30
+chargers:
+  count: 1
+  template:
+    ocpp_version: "1.6"
+    message_ids:
+      reuse_rate: 2
+csms:
+  endpoint: "ws://localhost:8080/ocpp"
+`)
+    assert.ErrorContains(t, err, "chargers.template.message_ids: reuse_rate")
+}
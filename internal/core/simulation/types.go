@@ -4,69 +4,92 @@ import "github.com/HackStrix/ocpp-chaos-simulator/internal/core/charger"
 
 // ScenarioConfig represents a complete YAML scenario configuration
 type ScenarioConfig struct {
-	Name        string            `json:"name" yaml:"name"`
-	Description string            `json:"description" yaml:"description"`
-	Version     string            `json:"version" yaml:"version"`
-	Duration    int               `json:"duration" yaml:"duration"` // in seconds
-	Tags        []string          `json:"tags" yaml:"tags"`
-	Chargers    ChargerTemplate   `json:"chargers" yaml:"chargers"`
-	CSMS        CSMSConfig        `json:"csms" yaml:"csms"`
-	Timeline    []TimelineEvent   `json:"timeline" yaml:"timeline"`
-	Chaos       []ChaosStrategy   `json:"chaos_strategies,omitempty" yaml:"chaos_strategies,omitempty"`
+	Name         string               `json:"name" yaml:"name"`
+	Description  string               `json:"description" yaml:"description"`
+	Version      string               `json:"version" yaml:"version"`
+	Duration     int                  `json:"duration" yaml:"duration"` // in seconds
+	Tags         []string             `json:"tags" yaml:"tags"`
+	Chargers     ChargerTemplate      `json:"chargers" yaml:"chargers"`
+	CSMS         CSMSConfig           `json:"csms" yaml:"csms"`
+	Timeline     []TimelineEvent      `json:"timeline" yaml:"timeline"`
+	Chaos        []ChaosStrategy      `json:"chaos_strategies,omitempty" yaml:"chaos_strategies,omitempty"`
 	Expectations ScenarioExpectations `json:"expectations,omitempty" yaml:"expectations,omitempty"`
-	Results     ResultsConfig     `json:"results,omitempty" yaml:"results,omitempty"`
-	Monitoring  MonitoringConfig  `json:"monitoring,omitempty" yaml:"monitoring,omitempty"`
-	LoadProfile LoadProfileConfig `json:"load_profile,omitempty" yaml:"load_profile,omitempty"`
+	Results      ResultsConfig        `json:"results,omitempty" yaml:"results,omitempty"`
+	Monitoring   MonitoringConfig     `json:"monitoring,omitempty" yaml:"monitoring,omitempty"`
+	LoadProfile  LoadProfileConfig    `json:"load_profile,omitempty" yaml:"load_profile,omitempty"`
 }
 
 // ChargerTemplate defines the template for creating chargers
 type ChargerTemplate struct {
-	Count    int                      `json:"count" yaml:"count"`
-	Template ChargerTemplateConfig    `json:"template" yaml:"template"`
+	Count    int                   `json:"count" yaml:"count"`
+	Template ChargerTemplateConfig `json:"template" yaml:"template"`
 }
 
 // ChargerTemplateConfig defines the template configuration for chargers in YAML scenarios
 type ChargerTemplateConfig struct {
-	Model          string            `json:"model" yaml:"model"`
-	Vendor         string            `json:"vendor" yaml:"vendor"`
-	Connectors     int               `json:"connectors" yaml:"connectors"` // YAML field name
-	OCPPVersion    string            `json:"ocpp_version" yaml:"ocpp_version"`
-	Features       []string          `json:"features,omitempty" yaml:"features,omitempty"`
-	CustomData     map[string]string `json:"custom_data,omitempty" yaml:"custom_data,omitempty"`
+	Model         string                     `json:"model" yaml:"model"`
+	Vendor        string                     `json:"vendor" yaml:"vendor"`
+	Connectors    int                        `json:"connectors" yaml:"connectors"` // YAML field name
+	OCPPVersion   string                     `json:"ocpp_version" yaml:"ocpp_version"`
+	Features      []string                   `json:"features,omitempty" yaml:"features,omitempty"`
+	CustomData    map[string]string          `json:"custom_data,omitempty" yaml:"custom_data,omitempty"`
+	Configuration map[string]string          `json:"configuration,omitempty" yaml:"configuration,omitempty"` // OCPP configuration keys
+	Boot          charger.BootBehavior       `json:"boot,omitempty" yaml:"boot,omitempty"`                   // Boot sequence deviations
+	OfflineQueue  charger.OfflineQueuePolicy `json:"offline_queue,omitempty" yaml:"offline_queue,omitempty"` // Buffering while offline
+	MaxPowerKW    float64                    `json:"max_power_kw,omitempty" yaml:"max_power_kw,omitempty"`   // Rated power capped by charging profiles
+	CurrentType   string                     `json:"current_type,omitempty" yaml:"current_type,omitempty"`   // "AC" or "DC"
+	EVFleet       []charger.EVType           `json:"ev_fleet,omitempty" yaml:"ev_fleet,omitempty"`           // EVs drawn for each transaction
+
+	SchemaValidation charger.SchemaValidationPolicy `json:"schema_validation,omitempty" yaml:"schema_validation,omitempty"` // Payload validation
+	ConnectorStates  charger.ConnectorBehavior      `json:"connector_states,omitempty" yaml:"connector_states,omitempty"`   // Connector state machine deviations
+	Reservations     charger.ReservationBehavior    `json:"reservations,omitempty" yaml:"reservations,omitempty"`           // How drivers treat reservations
+	LocalAuthList    charger.LocalAuthList          `json:"local_auth_list,omitempty" yaml:"local_auth_list,omitempty"`     // Local authorization list installed at start
+	FirmwareVersion  string                         `json:"firmware_version,omitempty" yaml:"firmware_version,omitempty"`   // Reported in BootNotification
+	Firmware         charger.FirmwareBehavior       `json:"firmware,omitempty" yaml:"firmware,omitempty"`                   // Firmware and diagnostics faults
+	RebootDelay      float64                        `json:"reboot_delay,omitempty" yaml:"reboot_delay,omitempty"`           // Seconds offline while rebooting
+	Profile          string                         `json:"profile,omitempty" yaml:"profile,omitempty"`                     // Vendor profile emulating firmware quirks
+	MessageIDs       charger.MessageIDPolicy        `json:"message_ids,omitempty" yaml:"message_ids,omitempty"`             // Message ID format and chaos
 }
 
 // CSMSConfig defines CSMS connection parameters
 type CSMSConfig struct {
-	Endpoint      string `json:"endpoint" yaml:"endpoint"`
-	Protocol      string `json:"protocol" yaml:"protocol"`
-	BasicAuthUser string `json:"basic_auth_user,omitempty" yaml:"basic_auth_user,omitempty"`
-	BasicAuthPass string `json:"basic_auth_pass,omitempty" yaml:"basic_auth_pass,omitempty"`
+	Endpoint      string                  `json:"endpoint" yaml:"endpoint"`
+	Protocol      string                  `json:"protocol" yaml:"protocol"`
+	BasicAuthUser string                  `json:"basic_auth_user,omitempty" yaml:"basic_auth_user,omitempty"`
+	BasicAuthPass string                  `json:"basic_auth_pass,omitempty" yaml:"basic_auth_pass,omitempty"`
+	Reconnect     charger.ReconnectPolicy `json:"reconnect,omitempty" yaml:"reconnect,omitempty"` // Backoff after losing the connection
+
+	SecurityProfile int               `json:"security_profile,omitempty" yaml:"security_profile,omitempty"` // OCPP security profile 1-3
+	TLS             charger.TLSPolicy `json:"tls,omitempty" yaml:"tls,omitempty"`                           // Settings for wss:// endpoints
+
+	Keepalive charger.KeepalivePolicy `json:"keepalive,omitempty" yaml:"keepalive,omitempty"` // WebSocket pings and read deadline
+	Pipeline  charger.PipelinePolicy  `json:"pipeline,omitempty" yaml:"pipeline,omitempty"`   // Message queues of the connection
 }
 
 // TimelineEvent represents an action at a specific time
 type TimelineEvent struct {
-	At      int               `json:"at" yaml:"at"` // seconds from start
-	Action  string            `json:"action" yaml:"action"`
-	Targets interface{}       `json:"targets,omitempty" yaml:"targets,omitempty"` // "all", range, specific IDs
-	Params  map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
-	Flow    []MessageStep     `json:"flow,omitempty" yaml:"flow,omitempty"`
-	Strategy string           `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	At       int                    `json:"at" yaml:"at"` // seconds from start
+	Action   string                 `json:"action" yaml:"action"`
+	Targets  interface{}            `json:"targets,omitempty" yaml:"targets,omitempty"` // "all", range, specific IDs
+	Params   map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+	Flow     []MessageStep          `json:"flow,omitempty" yaml:"flow,omitempty"`
+	Strategy string                 `json:"strategy,omitempty" yaml:"strategy,omitempty"`
 }
 
 // MessageStep represents a single step in a message flow
 type MessageStep struct {
-	Send      string            `json:"send,omitempty" yaml:"send,omitempty"`
-	WaitFor   string            `json:"wait_for,omitempty" yaml:"wait_for,omitempty"`
-	Delay     interface{}       `json:"delay,omitempty" yaml:"delay,omitempty"` // int or string like "random(1,5)"
-	Repeat    *RepeatConfig     `json:"repeat,omitempty" yaml:"repeat,omitempty"`
-	Params    map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
-	Expect    map[string]interface{} `json:"expect,omitempty" yaml:"expect,omitempty"`
-	Timeout   int               `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Send    string                 `json:"send,omitempty" yaml:"send,omitempty"`
+	WaitFor string                 `json:"wait_for,omitempty" yaml:"wait_for,omitempty"`
+	Delay   interface{}            `json:"delay,omitempty" yaml:"delay,omitempty"` // int or string like "random(1,5)"
+	Repeat  *RepeatConfig          `json:"repeat,omitempty" yaml:"repeat,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+	Expect  map[string]interface{} `json:"expect,omitempty" yaml:"expect,omitempty"`
+	Timeout int                    `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 }
 
 // RepeatConfig defines how to repeat a message or action
 type RepeatConfig struct {
-	Count    interface{} `json:"count,omitempty" yaml:"count,omitempty"`     // int or string like "random(5,10)"
+	Count    interface{} `json:"count,omitempty" yaml:"count,omitempty"`       // int or string like "random(5,10)"
 	Interval interface{} `json:"interval,omitempty" yaml:"interval,omitempty"` // int or string
 	Duration int         `json:"duration,omitempty" yaml:"duration,omitempty"`
 }
@@ -81,42 +104,42 @@ type ChaosStrategy struct {
 
 // ScenarioExpectations defines what should happen during the scenario
 type ScenarioExpectations struct {
-	CSMSShould      map[string]bool `json:"csms_should,omitempty" yaml:"csms_should,omitempty"`
-	ChargersShould  map[string]bool `json:"chargers_should,omitempty" yaml:"chargers_should,omitempty"`
-	Performance     *PerformanceExpectations `json:"performance,omitempty" yaml:"performance,omitempty"`
+	CSMSShould     map[string]bool          `json:"csms_should,omitempty" yaml:"csms_should,omitempty"`
+	ChargersShould map[string]bool          `json:"chargers_should,omitempty" yaml:"chargers_should,omitempty"`
+	Performance    *PerformanceExpectations `json:"performance,omitempty" yaml:"performance,omitempty"`
 }
 
 // PerformanceExpectations defines performance criteria
 type PerformanceExpectations struct {
-	MaxResponseTime       int     `json:"max_response_time" yaml:"max_response_time"` // milliseconds
-	MaxMemoryUsage        string  `json:"max_memory_usage" yaml:"max_memory_usage"`
-	MinSuccessRate        float64 `json:"min_success_rate" yaml:"min_success_rate"`
-	MaxConcurrentConnections int  `json:"max_concurrent_connections" yaml:"max_concurrent_connections"`
+	MaxResponseTime          int     `json:"max_response_time" yaml:"max_response_time"` // milliseconds
+	MaxMemoryUsage           string  `json:"max_memory_usage" yaml:"max_memory_usage"`
+	MinSuccessRate           float64 `json:"min_success_rate" yaml:"min_success_rate"`
+	MaxConcurrentConnections int     `json:"max_concurrent_connections" yaml:"max_concurrent_connections"`
 }
 
 // ResultsConfig defines how to export results
 type ResultsConfig struct {
-	Format      []string `json:"format" yaml:"format"`
-	Include     []string `json:"include" yaml:"include"`
-	ExportPath  string   `json:"export_path,omitempty" yaml:"export_path,omitempty"`
-	Metrics     *MetricsConfig `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	Format     []string       `json:"format" yaml:"format"`
+	Include    []string       `json:"include" yaml:"include"`
+	ExportPath string         `json:"export_path,omitempty" yaml:"export_path,omitempty"`
+	Metrics    *MetricsConfig `json:"metrics,omitempty" yaml:"metrics,omitempty"`
 }
 
 // MetricsConfig defines what metrics to collect
 type MetricsConfig struct {
-	Timeline    string   `json:"timeline,omitempty" yaml:"timeline,omitempty"`
-	Aggregated  string   `json:"aggregated,omitempty" yaml:"aggregated,omitempty"`
-	Percentiles []int    `json:"percentiles,omitempty" yaml:"percentiles,omitempty"`
+	Timeline    string `json:"timeline,omitempty" yaml:"timeline,omitempty"`
+	Aggregated  string `json:"aggregated,omitempty" yaml:"aggregated,omitempty"`
+	Percentiles []int  `json:"percentiles,omitempty" yaml:"percentiles,omitempty"`
 }
 
 // SimulationConfig represents the configuration for a simulation (legacy)
 type SimulationConfig struct {
-	Name         string                     `json:"name" yaml:"name"`
-	ChargerCount int                        `json:"charger_count" yaml:"charger_count"`
-	OCPPVersion  string                     `json:"ocpp_version" yaml:"ocpp_version"`
-	CSMSEndpoint string                     `json:"csms_endpoint" yaml:"csms_endpoint"`
-	Chargers     []charger.ChargerConfig    `json:"chargers" yaml:"chargers"`
-	Duration     int                        `json:"duration" yaml:"duration"` // in seconds, 0 for unlimited
+	Name         string                  `json:"name" yaml:"name"`
+	ChargerCount int                     `json:"charger_count" yaml:"charger_count"`
+	OCPPVersion  string                  `json:"ocpp_version" yaml:"ocpp_version"`
+	CSMSEndpoint string                  `json:"csms_endpoint" yaml:"csms_endpoint"`
+	Chargers     []charger.ChargerConfig `json:"chargers" yaml:"chargers"`
+	Duration     int                     `json:"duration" yaml:"duration"` // in seconds, 0 for unlimited
 }
 
 // ChargerConfig represents the configuration for a single charger
@@ -166,9 +189,9 @@ type AlertConfig struct {
 
 // LoadProfileConfig defines load testing parameters
 type LoadProfileConfig struct {
-	RampUp     RampConfig `json:"ramp_up,omitempty" yaml:"ramp_up,omitempty"`
+	RampUp      RampConfig  `json:"ramp_up,omitempty" yaml:"ramp_up,omitempty"`
 	SteadyState StateConfig `json:"steady_state,omitempty" yaml:"steady_state,omitempty"`
-	RampDown   RampConfig `json:"ramp_down,omitempty" yaml:"ramp_down,omitempty"`
+	RampDown    RampConfig  `json:"ramp_down,omitempty" yaml:"ramp_down,omitempty"`
 }
 
 // RampConfig defines ramp-up or ramp-down parameters
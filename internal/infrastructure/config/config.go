@@ -25,11 +25,22 @@ type DatabaseConfig struct {
 }
 
 type OCPPConfig struct {
-	DefaultVersion   string `mapstructure:"default_version"`
-	Timeout          int    `mapstructure:"timeout"`
-	DefaultAuthUser  string `mapstructure:"default_auth_user"`
-	DefaultAuthPass  string `mapstructure:"default_auth_pass"`
-	DefaultEndpoint  string `mapstructure:"default_endpoint"`
+	DefaultVersion  string          `mapstructure:"default_version"`
+	Timeout         int             `mapstructure:"timeout"`
+	DefaultAuthUser string          `mapstructure:"default_auth_user"`
+	DefaultAuthPass string          `mapstructure:"default_auth_pass"`
+	DefaultEndpoint string          `mapstructure:"default_endpoint"`
+	Reconnect       ReconnectConfig `mapstructure:"reconnect"`
+}
+
+// ReconnectConfig holds the default reconnect backoff for chargers, in seconds
+type ReconnectConfig struct {
+	Disabled       bool    `mapstructure:"disabled"`
+	InitialBackoff float64 `mapstructure:"initial_backoff"`
+	MaxBackoff     float64 `mapstructure:"max_backoff"`
+	Multiplier     float64 `mapstructure:"multiplier"`
+	Jitter         float64 `mapstructure:"jitter"`
+	MaxAttempts    int     `mapstructure:"max_attempts"`
 }
 
 type LoggingConfig struct {
@@ -45,6 +56,10 @@ func Load() *Config {
 	viper.SetDefault("database.path", "./data/simulator.db")
 	viper.SetDefault("ocpp.default_version", "1.6")
 	viper.SetDefault("ocpp.timeout", 30)
+	viper.SetDefault("ocpp.reconnect.initial_backoff", 1)
+	viper.SetDefault("ocpp.reconnect.max_backoff", 60)
+	viper.SetDefault("ocpp.reconnect.multiplier", 2)
+	viper.SetDefault("ocpp.reconnect.jitter", 0.2)
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 
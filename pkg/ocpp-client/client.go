@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp"
+	_ "github.com/HackStrix/ocpp-chaos-simulator/internal/core/ocpp/ocpp201" // Registers OCPP 2.0.1
 )
 
 // Client provides a public interface to OCPP client functionality
@@ -16,6 +17,11 @@ type Client interface {
 	// Message operations
 	SendMessage(ctx context.Context, message ocpp.Message) error
 	SetMessageHandler(handler ocpp.MessageHandler)
+	SetConnectionHandler(handler ocpp.ConnectionHandler)
+	Call(ctx context.Context, action string, payload interface{}) (interface{}, error)
+	SendCallResult(ctx context.Context, messageID string, payload interface{}) error
+	SendCallError(ctx context.Context, messageID string, callErr *ocpp.CallError) error
+	ResumeQueue()
 
 	// Lifecycle
 	Start(ctx context.Context) error
@@ -24,20 +30,30 @@ type Client interface {
 
 // Config holds client configuration
 type Config struct {
-	ChargerID    string `json:"charger_id"`
-	Endpoint     string `json:"endpoint"`
-	OCPPVersion  string `json:"ocpp_version"`
-	Timeout      int    `json:"timeout"`
-	RetryAttempts int   `json:"retry_attempts"`
+	ChargerID     string `json:"charger_id"`
+	Endpoint      string `json:"endpoint"`
+	OCPPVersion   string `json:"ocpp_version"`
+	Timeout       int    `json:"timeout"`
+	RetryAttempts int    `json:"retry_attempts"`
 }
 
-// NewClient creates a new OCPP client based on configuration
+// NewClient creates a new OCPP client based on configuration. Versions that
+// are not supported default to OCPP 1.6.
 func NewClient(config Config) Client {
-	switch config.OCPPVersion {
-	case "1.6":
-		return ocpp.NewOCCP16Client(config.ChargerID, config.Endpoint)
-	default:
+	client, err := NewClientForVersion(config)
+	if err != nil {
 		// Default to OCPP 1.6
 		return ocpp.NewOCCP16Client(config.ChargerID, config.Endpoint)
 	}
+	return client
+}
+
+// NewClientForVersion creates a new OCPP client for the configured OCPP
+// version, failing if the version is not supported
+func NewClientForVersion(config Config) (Client, error) {
+	protocol, err := ocpp.LookupProtocol(config.OCPPVersion)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.CreateClient(config.ChargerID, config.Endpoint), nil
 }